@@ -0,0 +1,101 @@
+package backendplugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// maxMessageSize bounds a single line of plugin output.
+const maxMessageSize = 1 << 20
+
+// cancelGrace is how long a plugin has to exit after being interrupted
+// before it is killed.
+const cancelGrace = 10 * time.Second
+
+// Call runs the plugin at executable with req and waits for its answer.
+// Progress messages are passed to onProgress when it is set, and the plugin's
+// stderr is copied to stderr when it is set. It returns the result message,
+// or an error if the plugin reported one, broke the protocol or failed.
+//
+// If ctx is done first, the plugin is sent an interrupt so it can undo
+// partial work, and killed if it has not exited within a few seconds.
+func Call(ctx context.Context, executable string, req Request, onProgress func(Progress), stderr io.Writer) (*Message, error) {
+	name := filepath.Base(executable)
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, executable)
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = cancelGrace
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting %s: %w", name, err)
+	}
+
+	result, readErr := readMessages(stdout, onProgress)
+	// Drain the rest, so the plugin is not blocked writing to a full pipe
+	// and Wait does not close the pipe before everything is read.
+	_, _ = io.Copy(io.Discard, stdout)
+	waitErr := cmd.Wait()
+
+	switch {
+	case readErr != nil:
+		return nil, fmt.Errorf("%s: %w", name, readErr)
+	case result == nil && waitErr != nil:
+		return nil, fmt.Errorf("%s failed: %w", name, waitErr)
+	case result == nil:
+		return nil, fmt.Errorf("%s exited without a result", name)
+	case result.Type == MessageError:
+		return nil, errors.New(result.Error)
+	case waitErr != nil:
+		return nil, fmt.Errorf("%s failed after reporting success: %w", name, waitErr)
+	}
+	return result, nil
+}
+
+// readMessages decodes messages from r until the result or error message,
+// which it returns.
+func readMessages(r io.Reader, onProgress func(Progress)) (*Message, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			return nil, fmt.Errorf("invalid message %q: %w", line, err)
+		}
+		switch msg.Type {
+		case MessageProgress:
+			if onProgress != nil {
+				onProgress(msg.Progress)
+			}
+		case MessageResult:
+			return &msg, nil
+		case MessageError:
+			if msg.Error == "" {
+				msg.Error = "plugin reported an error without a message"
+			}
+			return &msg, nil
+		}
+	}
+	return nil, scanner.Err()
+}
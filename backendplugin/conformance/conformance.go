@@ -0,0 +1,180 @@
+// Package conformance checks that a clone backend plugin follows the
+// backendplugin protocol.
+//
+// Plugins written in Go can call Run from their own tests. Any other plugin
+// can be checked with this package's test:
+//
+//	GROVE_BACKEND_PLUGIN=/path/to/grove-backend-foo go test github.com/chrisbanes/grove/backendplugin/conformance
+package conformance
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/chrisbanes/grove/backendplugin"
+)
+
+// Run checks the plugin at executable against the protocol, creating and
+// destroying workspaces under temporary directories.
+func Run(t *testing.T, executable string) {
+	t.Helper()
+
+	t.Run("Hello", func(t *testing.T) {
+		msg, err := call(t, executable, backendplugin.Request{Method: backendplugin.MethodHello}, nil)
+		if err != nil {
+			t.Fatalf("hello failed: %v", err)
+		}
+		if msg.Name == "" {
+			t.Error("hello result has no name")
+		}
+		if !slices.Contains(msg.Versions, backendplugin.Version) {
+			t.Errorf("hello reports versions %v, want %d among them", msg.Versions, backendplugin.Version)
+		}
+	})
+
+	t.Run("UnsupportedVersion", func(t *testing.T) {
+		req := backendplugin.Request{Version: backendplugin.Version + 1000, Method: backendplugin.MethodRefresh}
+		req.GoldenRoot, req.StateDir = newGolden(t), t.TempDir()
+		if _, err := call(t, executable, req, nil); err == nil {
+			t.Error("expected a request with an unknown protocol version to fail")
+		}
+	})
+
+	t.Run("UnknownMethod", func(t *testing.T) {
+		req := backendplugin.Request{Version: backendplugin.Version, Method: "no-such-method"}
+		if _, err := call(t, executable, req, nil); err == nil {
+			t.Error("expected an unknown method to fail")
+		}
+	})
+
+	t.Run("CreateAndDestroy", func(t *testing.T) {
+		golden := newGolden(t)
+		wsPath := filepath.Join(t.TempDir(), "ws-1")
+		req := backendplugin.Request{
+			Version:       backendplugin.Version,
+			GoldenRoot:    golden,
+			StateDir:      filepath.Join(t.TempDir(), "state"),
+			Excludes:      []string{"cache/"},
+			WorkspaceID:   "ws-1",
+			WorkspacePath: wsPath,
+			Commit:        "abc1234",
+		}
+
+		req.Method = backendplugin.MethodCreate
+		var events []backendplugin.Progress
+		if _, err := call(t, executable, req, func(e backendplugin.Progress) { events = append(events, e) }); err != nil {
+			t.Fatalf("create failed: %v", err)
+		}
+		for _, e := range events {
+			checkProgress(t, e)
+		}
+
+		for rel, want := range goldenFiles {
+			got, err := os.ReadFile(filepath.Join(wsPath, rel))
+			if err != nil {
+				t.Errorf("workspace is missing %s: %v", rel, err)
+				continue
+			}
+			if string(got) != want {
+				t.Errorf("workspace %s = %q, want %q", rel, got, want)
+			}
+		}
+		if _, err := os.Lstat(filepath.Join(wsPath, "cache")); !os.IsNotExist(err) {
+			t.Error("excluded cache/ was copied into the workspace")
+		}
+
+		// Writes in the workspace must not reach the golden copy.
+		if err := os.WriteFile(filepath.Join(wsPath, "README.md"), []byte("changed"), 0644); err != nil {
+			t.Fatalf("workspace is not writable: %v", err)
+		}
+		if got, _ := os.ReadFile(filepath.Join(golden, "README.md")); string(got) != goldenFiles["README.md"] {
+			t.Error("writing to the workspace changed the golden copy")
+		}
+
+		req.Method = backendplugin.MethodDestroy
+		if _, err := call(t, executable, req, nil); err != nil {
+			t.Fatalf("destroy failed: %v", err)
+		}
+		if _, err := os.Lstat(wsPath); !os.IsNotExist(err) {
+			t.Errorf("workspace still exists after destroy: %v", err)
+		}
+		if _, err := call(t, executable, req, nil); err != nil {
+			t.Errorf("destroying a destroyed workspace failed: %v", err)
+		}
+	})
+
+	t.Run("Refresh", func(t *testing.T) {
+		req := backendplugin.Request{
+			Version:    backendplugin.Version,
+			Method:     backendplugin.MethodRefresh,
+			GoldenRoot: newGolden(t),
+			StateDir:   filepath.Join(t.TempDir(), "state"),
+			Excludes:   []string{"cache/"},
+			Commit:     "abc1234",
+		}
+		var events []backendplugin.Progress
+		if _, err := call(t, executable, req, func(e backendplugin.Progress) { events = append(events, e) }); err != nil {
+			t.Fatalf("refresh failed: %v", err)
+		}
+		for _, e := range events {
+			checkProgress(t, e)
+		}
+	})
+}
+
+// goldenFiles is the content of the golden copy given to the plugin, besides
+// the excluded cache/ directory.
+var goldenFiles = map[string]string{
+	"README.md":                "# golden\n",
+	"src/main.go":              "package main\n",
+	"src/nested/deep/data.txt": "data\n",
+	".grove/config.json":       "{}\n",
+}
+
+func newGolden(t *testing.T) string {
+	t.Helper()
+	root := filepath.Join(t.TempDir(), "golden")
+	files := map[string]string{"cache/blob.bin": "cached"}
+	for rel, data := range goldenFiles {
+		files[rel] = data
+	}
+	for rel, data := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func checkProgress(t *testing.T, e backendplugin.Progress) {
+	t.Helper()
+	if e.Percent < 0 || e.Percent > 100 {
+		t.Errorf("progress percent %d out of range", e.Percent)
+	}
+	if e.Files < 0 || (e.FilesTotal > 0 && e.Files > e.FilesTotal) {
+		t.Errorf("progress files %d of %d out of range", e.Files, e.FilesTotal)
+	}
+	if e.Bytes < 0 || (e.BytesTotal > 0 && e.Bytes > e.BytesTotal) {
+		t.Errorf("progress bytes %d of %d out of range", e.Bytes, e.BytesTotal)
+	}
+}
+
+func call(t *testing.T, executable string, req backendplugin.Request, onProgress func(backendplugin.Progress)) (*backendplugin.Message, error) {
+	return backendplugin.Call(t.Context(), executable, req, onProgress, testWriter{t})
+}
+
+// testWriter sends plugin stderr to the test log.
+type testWriter struct {
+	t *testing.T
+}
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.t.Logf("stderr: %s", p)
+	return len(p), nil
+}
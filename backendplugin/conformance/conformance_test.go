@@ -0,0 +1,24 @@
+package conformance_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/chrisbanes/grove/backendplugin/conformance"
+)
+
+// TestConformance checks the plugin named by GROVE_BACKEND_PLUGIN, or the
+// reference fake backend when it is unset.
+func TestConformance(t *testing.T) {
+	executable := os.Getenv("GROVE_BACKEND_PLUGIN")
+	if executable == "" {
+		executable = filepath.Join(t.TempDir(), "grove-backend-fake")
+		cmd := exec.Command("go", "build", "-o", executable, "github.com/chrisbanes/grove/cmd/grove-backend-fake")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("building fake backend: %v\n%s", err, out)
+		}
+	}
+	conformance.Run(t, executable)
+}
@@ -0,0 +1,122 @@
+// Package backendplugin defines the protocol between Grove and out-of-tree
+// clone backends.
+//
+// A plugin is an executable named grove-backend-<name> on PATH, selected with
+// clone_backend: "exec:<name>". Grove runs it once per operation, writes a
+// single JSON Request to its stdin and closes it. The plugin answers on stdout
+// with newline-delimited JSON Messages: any number of "progress" messages,
+// then exactly one "result" or "error" message. Anything written to stderr is
+// shown to the user. A plugin reporting an error should also exit non-zero.
+//
+// Grove keeps ownership of everything except materializing and removing the
+// workspace directory: it picks workspace IDs and paths, enforces
+// max_workspaces, relocates golden paths and writes the workspace marker.
+package backendplugin
+
+import "fmt"
+
+// Version is the protocol version spoken by this package. It is bumped on
+// incompatible changes; plugins reject requests with a version they do not
+// support.
+const Version = 1
+
+// ExecutablePrefix is prepended to a plugin name to form its executable
+// name.
+const ExecutablePrefix = "grove-backend-"
+
+// ExecutableName returns the executable implementing the plugin name.
+func ExecutableName(name string) string {
+	return ExecutablePrefix + name
+}
+
+// Methods a plugin must implement.
+const (
+	// MethodHello asks the plugin for its name, supported protocol versions
+	// and capabilities. It is answered whatever the request version.
+	MethodHello = "hello"
+	// MethodCreate materializes the golden copy at WorkspacePath, leaving
+	// out Excludes. The path does not exist yet; its parent does.
+	MethodCreate = "create"
+	// MethodDestroy removes the workspace at WorkspacePath. Destroying a
+	// workspace that is already gone succeeds.
+	MethodDestroy = "destroy"
+	// MethodRefresh tells the plugin the golden copy changed, so it can
+	// update any base it creates workspaces from.
+	MethodRefresh = "refresh"
+)
+
+// Request is the JSON object Grove writes to a plugin's stdin.
+type Request struct {
+	Version int    `json:"version"`
+	Method  string `json:"method"`
+	// GoldenRoot is the absolute path of the golden copy.
+	GoldenRoot string `json:"golden_root,omitempty"`
+	// StateDir is a directory reserved for the plugin's own state for this
+	// golden copy. It may not exist yet.
+	StateDir string `json:"state_dir,omitempty"`
+	// Excludes lists gitignore-style patterns of paths to leave out of
+	// workspaces, merged with any .groveignore files in the golden copy.
+	Excludes []string `json:"excludes,omitempty"`
+	// WorkspaceID and WorkspacePath identify the workspace for create and
+	// destroy.
+	WorkspaceID   string `json:"workspace_id,omitempty"`
+	WorkspacePath string `json:"workspace_path,omitempty"`
+	// Commit is the golden copy's commit, for create and refresh.
+	Commit string `json:"commit,omitempty"`
+}
+
+// Message types a plugin writes to stdout.
+const (
+	MessageProgress = "progress"
+	MessageResult   = "result"
+	MessageError    = "error"
+)
+
+// Message is one line of plugin output. Only the fields for its Type are
+// set; unknown types are ignored so the protocol can grow.
+type Message struct {
+	Type string `json:"type"`
+
+	// Progress fields. Totals are zero when unknown.
+	Progress
+
+	// Result fields for hello.
+	Name         string        `json:"name,omitempty"`
+	Versions     []int         `json:"versions,omitempty"`
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+
+	// Error fields.
+	Error string `json:"error,omitempty"`
+}
+
+// Capabilities describes what a plugin's workspaces support. Grove assumes
+// none of them for plugins whose hello reports no capabilities.
+type Capabilities struct {
+	// RefreshWhileActive is set if refresh works while workspaces exist.
+	RefreshWhileActive bool `json:"refresh_while_active,omitempty"`
+	// ConstantTimeCreate is set if create takes the same time however big
+	// the golden copy is.
+	ConstantTimeCreate bool `json:"constant_time_create,omitempty"`
+	// Snapshot is set if workspaces can be snapshotted or forked cheaply.
+	Snapshot bool `json:"snapshot,omitempty"`
+	// DiskUsage is set if the plugin can tell how much disk a workspace
+	// uses on its own.
+	DiskUsage bool `json:"disk_usage,omitempty"`
+}
+
+// Progress reports how far an operation has come. Percent, when set, takes
+// precedence over the file and byte counts for display.
+type Progress struct {
+	Phase      string `json:"phase,omitempty"`
+	Percent    int    `json:"percent,omitempty"`
+	Files      int    `json:"files,omitempty"`
+	FilesTotal int    `json:"files_total,omitempty"`
+	Bytes      int64  `json:"bytes,omitempty"`
+	BytesTotal int64  `json:"bytes_total,omitempty"`
+}
+
+// UnsupportedVersionError reports a request whose protocol version the
+// plugin does not speak.
+func UnsupportedVersionError(version int) error {
+	return fmt.Errorf("unsupported protocol version %d (supported: %d)", version, Version)
+}
@@ -0,0 +1,98 @@
+package backendplugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// Handler implements a plugin's operations. Progress callbacks may be called
+// from any goroutine.
+//
+// ctx is cancelled when Grove interrupts the operation. The handler should
+// then undo its partial work and return.
+type Handler interface {
+	// Name is reported by hello.
+	Name() string
+	Create(ctx context.Context, req *Request, progress func(Progress)) error
+	Destroy(ctx context.Context, req *Request) error
+	Refresh(ctx context.Context, req *Request, progress func(Progress)) error
+}
+
+// CapabilityReporter is implemented by handlers that report their
+// capabilities in answer to hello.
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+// Serve answers the request on stdin with h and exits, with status 1 if the
+// operation failed. It is meant to be the whole of a plugin's main. The
+// handler's ctx is cancelled on SIGINT, which Grove sends to interrupt it.
+func Serve(h Handler) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := ServeIO(ctx, h, os.Stdin, os.Stdout)
+	stop()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", ExecutableName(h.Name()), err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// ServeIO reads one request from r, handles it with h and writes the
+// messages to w. It returns the operation's error, which has already been
+// reported to w.
+func ServeIO(ctx context.Context, h Handler, r io.Reader, w io.Writer) error {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	write := func(msg Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		_ = enc.Encode(msg)
+	}
+	fail := func(err error) error {
+		write(Message{Type: MessageError, Error: err.Error()})
+		return err
+	}
+	progress := func(p Progress) {
+		write(Message{Type: MessageProgress, Progress: p})
+	}
+
+	var req Request
+	if err := json.NewDecoder(r).Decode(&req); err != nil {
+		return fail(fmt.Errorf("reading request: %w", err))
+	}
+	if req.Method == MethodHello {
+		msg := Message{Type: MessageResult, Name: h.Name(), Versions: []int{Version}}
+		if r, ok := h.(CapabilityReporter); ok {
+			caps := r.Capabilities()
+			msg.Capabilities = &caps
+		}
+		write(msg)
+		return nil
+	}
+	if req.Version != Version {
+		return fail(UnsupportedVersionError(req.Version))
+	}
+
+	var err error
+	switch req.Method {
+	case MethodCreate:
+		err = h.Create(ctx, &req, progress)
+	case MethodDestroy:
+		err = h.Destroy(ctx, &req)
+	case MethodRefresh:
+		err = h.Refresh(ctx, &req, progress)
+	default:
+		err = fmt.Errorf("unknown method %q", req.Method)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	write(Message{Type: MessageResult})
+	return nil
+}
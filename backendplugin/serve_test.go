@@ -0,0 +1,141 @@
+package backendplugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type stubHandler struct {
+	err error
+}
+
+func (stubHandler) Name() string { return "stub" }
+
+func (h stubHandler) Create(ctx context.Context, req *Request, progress func(Progress)) error {
+	progress(Progress{Phase: "clone", Files: 1, FilesTotal: 2})
+	return h.err
+}
+
+func (h stubHandler) Destroy(ctx context.Context, req *Request) error { return h.err }
+
+func (h stubHandler) Refresh(ctx context.Context, req *Request, progress func(Progress)) error {
+	return h.err
+}
+
+func serve(t *testing.T, h Handler, req string) (*Message, []Progress, error) {
+	t.Helper()
+	var out bytes.Buffer
+	_ = ServeIO(t.Context(), h, strings.NewReader(req), &out)
+	var events []Progress
+	msg, err := readMessages(&out, func(p Progress) { events = append(events, p) })
+	if err != nil {
+		t.Fatalf("reading messages: %v\n%s", err, out.String())
+	}
+	if msg == nil {
+		t.Fatalf("no result message in:\n%s", out.String())
+	}
+	if msg.Type == MessageError {
+		return msg, events, errors.New(msg.Error)
+	}
+	return msg, events, nil
+}
+
+func TestServeIO_Hello(t *testing.T) {
+	// hello is answered whatever the version, so clients can negotiate.
+	msg, _, err := serve(t, stubHandler{}, `{"version":99,"method":"hello"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Name != "stub" || len(msg.Versions) != 1 || msg.Versions[0] != Version {
+		t.Errorf("hello = %+v", msg)
+	}
+	if msg.Capabilities != nil {
+		t.Errorf("capabilities = %+v, want none from a handler that reports none", msg.Capabilities)
+	}
+}
+
+type capableHandler struct {
+	stubHandler
+}
+
+func (capableHandler) Capabilities() Capabilities {
+	return Capabilities{ConstantTimeCreate: true, Snapshot: true}
+}
+
+func TestServeIO_HelloReportsCapabilities(t *testing.T) {
+	msg, _, err := serve(t, capableHandler{}, `{"version":1,"method":"hello"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Capabilities{ConstantTimeCreate: true, Snapshot: true}
+	if msg.Capabilities == nil || *msg.Capabilities != want {
+		t.Errorf("capabilities = %+v, want %+v", msg.Capabilities, want)
+	}
+}
+
+func TestServeIO_Create(t *testing.T) {
+	_, events, err := serve(t, stubHandler{}, `{"version":1,"method":"create"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Files != 1 || events[0].FilesTotal != 2 {
+		t.Errorf("progress = %+v", events)
+	}
+}
+
+func TestServeIO_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		h    Handler
+		req  string
+		want string
+	}{
+		{"handler error", stubHandler{err: errors.New("disk full")}, `{"version":1,"method":"destroy"}`, "disk full"},
+		{"unsupported version", stubHandler{}, `{"version":2,"method":"destroy"}`, "unsupported protocol version 2"},
+		{"unknown method", stubHandler{}, `{"version":1,"method":"fork"}`, `unknown method "fork"`},
+		{"malformed request", stubHandler{}, `{`, "reading request"},
+	}
+	for _, tt := range tests {
+		_, _, err := serve(t, tt.h, tt.req)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want it to contain %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestReadMessages_SkipsUnknownTypes(t *testing.T) {
+	in := "\n{\"type\":\"log\",\"text\":\"hi\"}\n{\"type\":\"result\",\"name\":\"x\"}\n"
+	msg, err := readMessages(strings.NewReader(in), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg == nil || msg.Name != "x" {
+		t.Errorf("result = %+v", msg)
+	}
+
+	if _, err := readMessages(strings.NewReader("not json\n"), nil); err == nil {
+		t.Error("expected malformed output to fail")
+	}
+}
+
+// ctxHandler fails create with the error of the ctx it is given.
+type ctxHandler struct {
+	stubHandler
+}
+
+func (ctxHandler) Create(ctx context.Context, req *Request, progress func(Progress)) error {
+	return ctx.Err()
+}
+
+func TestServeIO_PassesContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	var out bytes.Buffer
+	err := ServeIO(ctx, ctxHandler{}, strings.NewReader(`{"version":1,"method":"create"}`), &out)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ServeIO() error = %v, want the handler to see the cancelled ctx", err)
+	}
+}
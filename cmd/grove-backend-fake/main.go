@@ -0,0 +1,155 @@
+// Command grove-backend-fake is a reference clone backend plugin. It creates
+// workspaces with a plain copy of the golden copy, and records the last
+// refreshed commit in its state dir. Select it with
+// clone_backend: "exec:fake".
+//
+// It only uses the public backendplugin package, as an out-of-tree plugin
+// would.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/chrisbanes/grove/backendplugin"
+)
+
+// stateFile records the last refresh in the plugin state dir.
+const stateFile = "fake.json"
+
+type fakeBackend struct{}
+
+func (fakeBackend) Name() string {
+	return "fake"
+}
+
+// Capabilities reports that refresh only records the commit, so it never
+// disturbs workspaces.
+func (fakeBackend) Capabilities() backendplugin.Capabilities {
+	return backendplugin.Capabilities{RefreshWhileActive: true}
+}
+
+// Create copies the golden copy to the workspace path. If it fails or is
+// interrupted, the partial copy is removed.
+func (fakeBackend) Create(ctx context.Context, req *backendplugin.Request, progress func(backendplugin.Progress)) error {
+	err := copyTree(ctx, req.GoldenRoot, req.WorkspacePath, req.Excludes, progress)
+	if err != nil {
+		os.RemoveAll(req.WorkspacePath)
+	}
+	return err
+}
+
+func (fakeBackend) Destroy(_ context.Context, req *backendplugin.Request) error {
+	return os.RemoveAll(req.WorkspacePath)
+}
+
+func (fakeBackend) Refresh(_ context.Context, req *backendplugin.Request, progress func(backendplugin.Progress)) error {
+	progress(backendplugin.Progress{Phase: "recording commit", Percent: 50})
+	if err := os.MkdirAll(req.StateDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(map[string]string{"commit": req.Commit})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(req.StateDir, stateFile), data, 0644)
+}
+
+// copyTree copies src to dst, leaving out paths matching excludes, and
+// reports each copied file.
+func copyTree(ctx context.Context, src, dst string, excludes []string, progress func(backendplugin.Progress)) error {
+	files := 0
+	var bytes int64
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		if rel != "." && excluded(excludes, filepath.ToSlash(rel), d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir():
+			return os.Mkdir(target, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			if err := copyFile(p, target, info.Mode().Perm()); err != nil {
+				return err
+			}
+			files++
+			bytes += info.Size()
+			progress(backendplugin.Progress{Phase: "clone", Files: files, Bytes: bytes})
+		}
+		return nil
+	})
+}
+
+func copyFile(src, dst string, mode fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// excluded reports whether rel matches one of the gitignore-style patterns.
+// Only the common forms are understood: a trailing slash matches
+// directories only, a pattern containing a slash is matched against the
+// whole path and any other against the base name. Negations are ignored.
+func excluded(patterns []string, rel string, isDir bool) bool {
+	for _, pattern := range patterns {
+		if pattern == "" || strings.HasPrefix(pattern, "#") || strings.HasPrefix(pattern, "!") {
+			continue
+		}
+		pattern, dirOnly := strings.CutSuffix(pattern, "/")
+		if dirOnly && !isDir {
+			continue
+		}
+		name := path.Base(rel)
+		if strings.Contains(pattern, "/") {
+			pattern, name = strings.TrimPrefix(pattern, "/"), rel
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func main() {
+	backendplugin.Serve(fakeBackend{})
+}
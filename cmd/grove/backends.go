@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/chrisbanes/grove/internal/backend"
+	"github.com/chrisbanes/grove/internal/config"
+	"github.com/spf13/cobra"
+)
+
+type backendReport struct {
+	Name string `json:"name"`
+	backend.Capabilities
+}
+
+var backendsCmd = &cobra.Command{
+	Use:   "backends",
+	Short: "List clone backends and whether they work here",
+	Long: `Lists the built-in clone backends and the plugin backends on PATH, with
+what each supports and whether it works for the golden copy on this machine.
+Outside a golden copy, the current directory is checked instead.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		root := cwd
+		if goldenRoot, err := config.FindGroveRoot(cwd); err == nil {
+			root = goldenRoot
+		}
+
+		reports, err := backendReports(cmd.Context(), root)
+		if err != nil {
+			return err
+		}
+
+		jsonOut, _ := cmd.Flags().GetBool("json")
+		if jsonOut {
+			data, _ := json.MarshalIndent(reports, "", "  ")
+			fmt.Println(string(data))
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "BACKEND\tAVAILABLE\tFEATURES\tREASON")
+		for _, r := range reports {
+			availability := "yes"
+			if !r.Available {
+				availability = "no"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Name, availability, formatFeatures(r.Capabilities), r.Reason)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+// backendReports checks every built-in and plugin backend against the
+// golden copy at root.
+func backendReports(ctx context.Context, root string) ([]backendReport, error) {
+	var reports []backendReport
+	for _, name := range append(backend.Names(), backend.Plugins()...) {
+		impl, err := backend.ForName(name)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, backendReport{Name: name, Capabilities: impl.Capabilities(ctx, root)})
+	}
+	return reports, nil
+}
+
+func formatFeatures(caps backend.Capabilities) string {
+	var features []string
+	if caps.ConstantTimeCreate {
+		features = append(features, "constant-time create")
+	}
+	if caps.RefreshWhileActive {
+		features = append(features, "refresh while active")
+	}
+	if caps.Snapshot {
+		features = append(features, "snapshot")
+	}
+	if caps.DiskUsage {
+		features = append(features, "disk usage")
+	}
+	if len(features) == 0 {
+		return "-"
+	}
+	return strings.Join(features, ", ")
+}
+
+func init() {
+	backendsCmd.Flags().Bool("json", false, "Output backends as JSON")
+	rootCmd.AddCommand(backendsCmd)
+}
@@ -1,16 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/charmbracelet/huh"
+	"github.com/chrisbanes/grove/internal/backend"
 	"github.com/chrisbanes/grove/internal/config"
 	gitpkg "github.com/chrisbanes/grove/internal/git"
 	"github.com/chrisbanes/grove/internal/image"
+	"github.com/chrisbanes/grove/internal/lockfile"
 	"github.com/chrisbanes/grove/internal/termio"
 	"github.com/spf13/cobra"
 )
@@ -65,12 +69,14 @@ Can be re-run to update configuration.`,
 		stateDirSet := cmd.Flags().Changed("state-dir")
 
 		if backendSet {
-			switch backendFlag {
-			case "cp", "image":
-				cfg.CloneBackend = backendFlag
-			default:
-				return fmt.Errorf("invalid --backend %q: expected cp or image", backendFlag)
+			if !config.ValidCloneBackend(backendFlag) {
+				return fmt.Errorf("invalid --backend %q: expected cp, copy, image, btrfs, zfs, overlay, worktree or exec:<name>", backendFlag)
 			}
+			// Fail before configuring anything if a plugin is not installed.
+			if _, err := backend.ForName(backendFlag); err != nil {
+				return err
+			}
+			cfg.CloneBackend = backendFlag
 		}
 		if wsDirSet {
 			cfg.WorkspaceDir = wsDirFlag
@@ -87,16 +93,17 @@ Can be re-run to update configuration.`,
 			fmt.Printf("Configuring grove for %s...\n\n", projectName)
 
 			if !backendSet {
+				options, names := availableBackendOptions(cmd.Context(), absPath)
 				backendChoice := cfg.CloneBackend
 				if backendChoice == "" {
 					backendChoice = "cp"
 				}
+				if !slices.Contains(names, backendChoice) {
+					backendChoice = names[0]
+				}
 				err := huh.NewSelect[string]().
 					Title("Which clone backend?").
-					Options(
-						huh.NewOption("cp - fast APFS copy-on-write clones (default)", "cp"),
-						huh.NewOption("image - sparsebundle-based clones (experimental)", "image"),
-					).
+					Options(options...).
 					Value(&backendChoice).
 					Run()
 				if err != nil {
@@ -211,10 +218,18 @@ Can be re-run to update configuration.`,
 			return fmt.Errorf("saving config: %w", err)
 		}
 
+		// Warming up and seeding the image backend's base both use the
+		// golden copy, so nothing may clone it until they are done.
+		lock, err := lockGolden(cmd, absPath, cfg, lockfile.Exclusive)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+
 		// Run warmup if configured
 		if cfg.WarmupCommand != "" {
 			fmt.Printf("Running warmup: %s\n", cfg.WarmupCommand)
-			warmup := exec.Command("sh", "-c", cfg.WarmupCommand)
+			warmup := exec.CommandContext(cmd.Context(), "sh", "-c", cfg.WarmupCommand)
 			warmup.Dir = absPath
 			if err := termio.RunInteractive(warmup); err != nil {
 				return fmt.Errorf("warmup command failed: %w", err)
@@ -238,13 +253,17 @@ Can be re-run to update configuration.`,
 			if err != nil {
 				return fmt.Errorf("computing image sync excludes: %w", err)
 			}
-			var onProgress func(int, string)
+			var onProgress func(image.Progress)
 			if progress != nil {
-				onProgress = func(pct int, phase string) {
-					progress.Update(pct, phase)
+				onProgress = func(p image.Progress) {
+					progress.UpdateTransfer(p.Percent, p.Phase, imageTransfer(p))
 				}
 			}
-			if _, err := image.InitBase(runtimeRoot, absPath, nil, sizeGB, excludes, onProgress); err != nil {
+			syncer, err := image.NewSyncer(cfg.ImageSyncEngine, cfg.ImageSyncChecksum, nil)
+			if err != nil {
+				return err
+			}
+			if _, err := image.InitBase(cmd.Context(), runtimeRoot, absPath, nil, syncer, sizeGB, cfg.ImageHeadroomGB, excludes, onProgress); err != nil {
 				return fmt.Errorf("initializing image backend: %w", err)
 			}
 		}
@@ -259,13 +278,42 @@ Can be re-run to update configuration.`,
 	},
 }
 
+// backendOptions describes the built-in backends in the config wizard.
+var backendOptions = []struct{ name, label string }{
+	{"cp", "cp - fast copy-on-write clones (default)"},
+	{"copy", "copy - full parallel copy for filesystems without copy-on-write"},
+	{"image", "image - sparsebundle-based clones (experimental)"},
+	{"btrfs", "btrfs - subvolume snapshots (Linux, Btrfs)"},
+	{"zfs", "zfs - dataset clones (ZFS)"},
+	{"overlay", "overlay - overlayfs mounts over a synced base (Linux)"},
+	{"worktree", "worktree - git worktrees plus copy-on-write clones of ignored files"},
+}
+
+// availableBackendOptions returns wizard options for the built-in backends
+// that work for the golden copy at root, and their names. The copy backend
+// works everywhere, so there is always at least one.
+func availableBackendOptions(ctx context.Context, root string) ([]huh.Option[string], []string) {
+	var options []huh.Option[string]
+	var names []string
+	for _, opt := range backendOptions {
+		impl, err := backend.ForName(opt.name)
+		if err != nil || !impl.Capabilities(ctx, root).Available {
+			continue
+		}
+		options = append(options, huh.NewOption(opt.label, opt.name))
+		names = append(names, opt.name)
+	}
+	return options, names
+}
+
 func init() {
 	configCmd.Flags().String("warmup-command", "", "Command to run for warming up build caches")
 	configCmd.Flags().String("workspace-dir", "", "Directory for workspaces (default: ~/grove-workspaces/{project})")
 	configCmd.Flags().String("state-dir", "", "Directory for grove internal state (default: ~/.grove)")
-	configCmd.Flags().String("backend", "", "Workspace backend: cp or image (experimental)")
+	configCmd.Flags().String("backend", "", "Workspace backend: cp, copy, image (experimental), btrfs, zfs, overlay, worktree or exec:<name> for a plugin")
 	configCmd.Flags().Int("image-size-gb", 200, "Base sparsebundle size in GB when using --backend image")
 	configCmd.Flags().Bool("progress", false, "Show progress output (default: auto-detect TTY)")
 	configCmd.Flags().Bool("defaults", false, "Skip interactive prompts and use all defaults")
+	addNoWaitFlag(configCmd)
 	rootCmd.AddCommand(configCmd)
 }
@@ -1,17 +1,21 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
+	"text/tabwriter"
+	"time"
 
 	"github.com/chrisbanes/grove/internal/backend"
 	"github.com/chrisbanes/grove/internal/clone"
 	"github.com/chrisbanes/grove/internal/config"
 	gitpkg "github.com/chrisbanes/grove/internal/git"
 	"github.com/chrisbanes/grove/internal/hooks"
+	"github.com/chrisbanes/grove/internal/lockfile"
 	"github.com/chrisbanes/grove/internal/workspace"
 	"github.com/spf13/cobra"
 )
@@ -23,9 +27,15 @@ var createCmd = &cobra.Command{
 caches and gitignored files. Builds in the workspace start warm.
 
 Without --branch, the workspace stays on the golden copy's current branch.
-With --branch, a new git branch is created and checked out in the workspace.`,
+With --branch, a new git branch is created and checked out in the workspace.
+
+With --dry-run, no workspace is created. Instead, Grove lists the paths the
+clone would skip and the exclude pattern (config or .groveignore file and
+line) responsible for each.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		progressEnabled := resolveProgress(cmd)
+		ctx := cmd.Context()
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		progressEnabled := resolveProgress(cmd) && !dryRun
 		jsonOut, _ := cmd.Flags().GetBool("json")
 		var (
 			progressMu sync.Mutex
@@ -88,12 +98,35 @@ With --branch, a new git branch is created and checked out in the workspace.`,
 		cfg.WorkspaceDir = config.ExpandWorkspaceDir(cfg.WorkspaceDir, projectName)
 		cfg.StateDir = config.ExpandStateDir(cfg.StateDir)
 
+		if dryRun {
+			excludes := cfg.Exclude
+			if backendImpl.Capabilities(ctx, goldenRoot).RefreshesBase {
+				excludes, err = config.BuildImageSyncExcludes(goldenRoot, cfg)
+				if err != nil {
+					return fmt.Errorf("computing %s sync excludes: %w", backendImpl.Name(), err)
+				}
+			}
+			excluded, err := clone.ExcludedPaths(goldenRoot, excludes)
+			if err != nil {
+				return err
+			}
+			return printExclusions(excluded, jsonOut)
+		}
+
 		if migrated, err := config.MigrateRuntimesToStateDir(cfg); err != nil {
 			return fmt.Errorf("migrating runtime state: %w", err)
 		} else if migrated {
 			fmt.Fprintf(os.Stderr, "Migrated runtime state to %s\n", cfg.StateDir)
 		}
 
+		// Held only until the workspace is cloned or claimed; readying it
+		// doesn't read the golden copy.
+		lock, err := lockGolden(cmd, goldenRoot, cfg, lockfile.Shared)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+
 		// Check for uncommitted changes
 		force, _ := cmd.Flags().GetBool("force")
 		dirty, err := gitpkg.IsDirty(goldenRoot)
@@ -120,12 +153,17 @@ With --branch, a new git branch is created and checked out in the workspace.`,
 		// Get current commit
 		commit, _ := gitpkg.CurrentCommit(goldenRoot)
 
-		updateProgress(5, "clone")
-
 		opts := backend.CreateOptions{
 			Branch:       branch,
 			BranchForID:  branchForID,
 			GoldenCommit: commit,
+			Dirty:        dirty,
+			OnRelocateSkip: func(rel string) {
+				fmt.Fprintf(os.Stderr, "Warning: not relocating %s: binary file and the workspace path is longer than the golden copy path\n", rel)
+			},
+			OnWarning: func(msg string) {
+				fmt.Fprintf(os.Stderr, "Warning: %s\n", msg)
+			},
 		}
 		if progressEnabled {
 			opts.OnClone = func(event clone.ProgressEvent) {
@@ -134,25 +172,57 @@ With --branch, a new git branch is created and checked out in the workspace.`,
 				}
 				progressMu.Lock()
 				defer progressMu.Unlock()
-				cloneState.updateClone(event.Copied, event.Total)
-				progress.Update(cloneState.percent, "clone")
+				if event.BytesTotal > 0 {
+					cloneState.updateBytes(event.Bytes, event.BytesTotal)
+				} else {
+					cloneState.updateClone(event.Copied, event.Total)
+				}
+				progress.UpdateTransfer(cloneState.percent, "clone", transfer{
+					bytes: event.Bytes,
+					total: event.BytesTotal,
+					rate:  event.Rate,
+				})
 			}
 		}
 
-		info, err := backendImpl.CreateWorkspace(goldenRoot, cfg, opts)
-		if err != nil {
-			updateProgress(100, "failed")
-			return err
+		// A pooled workspace was cloned and hooked at a commit, so it stands
+		// in for a new one unless the golden copy has uncommitted changes.
+		var info *workspace.Info
+		if !dirty && commit != "" {
+			info, err = claimPooled(ctx, backendImpl, goldenRoot, cfg, commit, branchForID, opts.OnRelocateSkip)
+			if err != nil {
+				updateProgress(100, "failed")
+				return err
+			}
 		}
-		updateProgress(95, "post-clone hook")
-
-		// Run post-clone hook
-		if err := hooks.Run(info.Path, "post-clone"); err != nil {
-			if cleanupErr := backendImpl.DestroyWorkspace(goldenRoot, cfg, info.ID); cleanupErr != nil {
-				fmt.Fprintf(os.Stderr, "Warning: cleanup failed for %s: %v\n", info.ID, cleanupErr)
+		if info != nil {
+			lock.Release()
+			info.Branch = branch
+			info.CreatedAt = time.Now().UTC()
+			if err := workspace.WriteMarker(info.Path, info); err != nil {
+				cleanupWorkspace(ctx, backendImpl, goldenRoot, cfg, info.ID)
+				updateProgress(100, "failed")
+				return fmt.Errorf("writing workspace marker: %w\nWorkspace cleaned up", err)
+			}
+		} else {
+			updateProgress(5, "clone")
+			info, err = backendImpl.CreateWorkspace(ctx, goldenRoot, cfg, opts)
+			lock.Release()
+			if err != nil {
+				updateProgress(100, "failed")
+				return err
+			}
+			err = readyWorkspace(ctx, backendImpl, goldenRoot, cfg, info, func(step string) {
+				updateProgress(95, step)
+			})
+			if err != nil {
+				updateProgress(100, "failed")
+				return err
 			}
+		}
+		cleanup := func() {
+			cleanupWorkspace(ctx, backendImpl, goldenRoot, cfg, info.ID)
 			updateProgress(100, "failed")
-			return fmt.Errorf("post-clone hook failed: %w\nWorkspace cleaned up", err)
 		}
 
 		// Checkout branch if specified
@@ -164,6 +234,10 @@ With --branch, a new git branch is created and checked out in the workspace.`,
 			}
 			info.Branch = branch
 		}
+		if err := ctx.Err(); err != nil {
+			cleanup()
+			return fmt.Errorf("interrupted\nWorkspace cleaned up")
+		}
 		updateProgress(100, "done")
 
 		// Output result
@@ -182,6 +256,103 @@ With --branch, a new git branch is created and checked out in the workspace.`,
 	},
 }
 
+// createWorkspace creates a workspace with backendImpl and readies it with
+// readyWorkspace.
+func createWorkspace(ctx context.Context, backendImpl backend.Backend, goldenRoot string, cfg *config.Config, opts backend.CreateOptions, onStep func(string)) (*workspace.Info, error) {
+	info, err := backendImpl.CreateWorkspace(ctx, goldenRoot, cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := readyWorkspace(ctx, backendImpl, goldenRoot, cfg, info, onStep); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// readyWorkspace readies a new workspace: the post_clone actions are
+// applied, then the post-clone hook runs. A workspace that cannot be
+// readied is destroyed again. onStep is called as each step starts.
+func readyWorkspace(ctx context.Context, backendImpl backend.Backend, goldenRoot string, cfg *config.Config, info *workspace.Info, onStep func(string)) error {
+	// Apply post_clone actions from the config
+	err := hooks.RunActions(ctx, goldenRoot, info.Path, cfg.PostClone, func(action config.PostCloneAction) {
+		onStep("post-clone: " + action.String())
+	})
+	if err != nil {
+		cleanupWorkspace(ctx, backendImpl, goldenRoot, cfg, info.ID)
+		return fmt.Errorf("%w\nWorkspace cleaned up", err)
+	}
+	onStep("post-clone hook")
+
+	// Run post-clone hook
+	if err := hooks.Run(ctx, info.Path, "post-clone"); err != nil {
+		cleanupWorkspace(ctx, backendImpl, goldenRoot, cfg, info.ID)
+		return fmt.Errorf("post-clone hook failed: %w\nWorkspace cleaned up", err)
+	}
+	return nil
+}
+
+// cleanupWorkspace destroys a workspace that failed to get ready, warning
+// rather than failing if it cannot.
+func cleanupWorkspace(ctx context.Context, backendImpl backend.Backend, goldenRoot string, cfg *config.Config, id string) {
+	// Clean up even when interrupted: that is when it matters most.
+	if err := backendImpl.DestroyWorkspace(context.WithoutCancel(ctx), goldenRoot, cfg, id); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: cleanup failed for %s: %v\n", id, err)
+	}
+}
+
+// exclusionOutput is the --dry-run --json form of a clone.Exclusion.
+type exclusionOutput struct {
+	Path    string `json:"path"`
+	Dir     bool   `json:"dir"`
+	Pattern string `json:"pattern"`
+	Source  string `json:"source"`
+	Line    int    `json:"line,omitempty"`
+}
+
+func printExclusions(excluded []clone.Exclusion, jsonOut bool) error {
+	out := make([]exclusionOutput, 0, len(excluded))
+	for _, e := range excluded {
+		o := exclusionOutput{
+			Path:    e.Path,
+			Dir:     e.IsDir,
+			Pattern: e.Pattern.Raw,
+			Source:  e.Pattern.Source,
+			Line:    e.Pattern.Line,
+		}
+		if o.Source == "" {
+			o.Source = filepath.Join(config.GroveDirName, config.ConfigFile)
+		}
+		out = append(out, o)
+	}
+
+	if jsonOut {
+		data, _ := json.MarshalIndent(out, "", "  ")
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Println("Dry run: no workspace created.")
+	if len(out) == 0 {
+		fmt.Println("No paths excluded.")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "EXCLUDED\tSOURCE\tPATTERN")
+	for _, o := range out {
+		path := o.Path
+		if o.Dir {
+			path += "/"
+		}
+		source := o.Source
+		if o.Line > 0 {
+			source = fmt.Sprintf("%s:%d", source, o.Line)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", path, source, o.Pattern)
+	}
+	w.Flush()
+	return nil
+}
+
 func getProjectName(repoRoot string) string {
 	return filepath.Base(repoRoot)
 }
@@ -190,6 +361,8 @@ func init() {
 	createCmd.Flags().String("branch", "", "Create and checkout a new git branch in the workspace (default: golden copy's current branch)")
 	createCmd.Flags().Bool("force", false, "Proceed even if golden copy has uncommitted changes")
 	createCmd.Flags().Bool("json", false, "Output workspace info as JSON")
+	createCmd.Flags().Bool("dry-run", false, "List the paths the clone would exclude, and why, without creating a workspace")
 	createCmd.Flags().Bool("progress", false, "Show progress output (default: auto-detect TTY)")
+	addNoWaitFlag(createCmd)
 	rootCmd.AddCommand(createCmd)
 }
@@ -53,13 +53,16 @@ var destroyCmd = &cobra.Command{
 				return nil
 			}
 			for _, ws := range list {
+				if err := cmd.Context().Err(); err != nil {
+					return err
+				}
 				if push && ws.Branch != "" {
 					if err := gitpkg.Push(ws.Path, ws.Branch); err != nil {
 						fmt.Fprintf(os.Stderr, "Warning: failed to push %s (%s): %v\n", ws.ID, ws.Branch, err)
 						continue
 					}
 				}
-				if err := backendImpl.DestroyWorkspace(goldenRoot, cfg, ws.ID); err != nil {
+				if err := backendImpl.DestroyWorkspace(cmd.Context(), goldenRoot, cfg, ws.ID); err != nil {
 					fmt.Fprintf(os.Stderr, "Warning: failed to destroy %s: %v\n", ws.ID, err)
 					continue
 				}
@@ -86,7 +89,7 @@ var destroyCmd = &cobra.Command{
 			}
 		}
 
-		if err := backendImpl.DestroyWorkspace(goldenRoot, cfg, info.ID); err != nil {
+		if err := backendImpl.DestroyWorkspace(cmd.Context(), goldenRoot, cfg, info.ID); err != nil {
 			return err
 		}
 		fmt.Printf("Destroyed: %s\n", info.ID)
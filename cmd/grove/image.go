@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chrisbanes/grove/internal/config"
+	"github.com/chrisbanes/grove/internal/image"
+	"github.com/chrisbanes/grove/internal/lockfile"
+	"github.com/chrisbanes/grove/internal/workspace"
+	"github.com/spf13/cobra"
+)
+
+var imageCmd = &cobra.Command{
+	Use:   "image",
+	Short: "Maintain the image backend's disk images",
+}
+
+var imageReconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Reattach image workspaces after a reboot or crash",
+	Long: `Compares the image workspaces Grove knows about with the disk images that
+are actually attached. Workspaces whose shadow file still exists are
+attached again at their path, and the devices Grove records for them are
+updated. Workspaces whose shadow file is gone are reported; with --clean
+their metadata is removed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		goldenRoot, cfg, runtimeRoot, err := imageRuntime("reconcile")
+		if err != nil {
+			return err
+		}
+		// Reattaching is safe alongside creates, but not while the base is
+		// compacted.
+		lock, err := lockGolden(cmd, goldenRoot, cfg, lockfile.Shared)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+
+		clean, _ := cmd.Flags().GetBool("clean")
+		results, err := image.Reconcile(cmd.Context(), runtimeRoot, nil, clean)
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			fmt.Println("No image workspaces.")
+			return nil
+		}
+
+		failed, orphaned := 0, 0
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSTATUS\tDEVICE")
+		for _, r := range results {
+			device := r.Device
+			if device == "" {
+				device = "-"
+			}
+			status := string(r.Action)
+			switch r.Action {
+			case image.ReconcileFailed:
+				failed++
+				status = fmt.Sprintf("failed: %v", r.Err)
+			case image.ReconcileOrphaned:
+				orphaned++
+				status = "no shadow"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", r.ID, status, device)
+		}
+		w.Flush()
+
+		if orphaned > 0 {
+			fmt.Printf("\n%d workspace(s) have lost their shadow and cannot be reattached. Run grove image reconcile --clean to remove them.\n", orphaned)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d workspace(s) could not be reconciled", failed)
+		}
+		return nil
+	},
+}
+
+var imageCompactCmd = &cobra.Command{
+	Use:   "compact",
+	Short: "Return unused space in the base image to the disk",
+	Long: `Compacts every generation of the base image with hdiutil compact, returning
+space freed inside the image to the host disk. hdiutil cannot compact an
+attached image, so this fails while any workspace is attached; destroy them,
+or run it after a reboot and before grove image reconcile.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		goldenRoot, cfg, runtimeRoot, err := imageRuntime("compact")
+		if err != nil {
+			return err
+		}
+		// Keep creates, refreshes and reconciles from attaching the base
+		// while it is compacted.
+		lock, err := lockGolden(cmd, goldenRoot, cfg, lockfile.Exclusive)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+
+		results, err := image.CompactBase(cmd.Context(), runtimeRoot, nil)
+		for _, r := range results {
+			fmt.Printf("Compacted %s: %s -> %s\n", filepath.Base(r.Path), formatBytes(r.Before), formatBytes(r.After))
+		}
+		return err
+	},
+}
+
+var imageCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check image workspace shadows against image_shadow_max_gb",
+	Long: `Measures the shadow file of every image workspace, records the sizes shown
+by grove list, and fails if any shadow has grown past image_shadow_max_gb.
+grove list flags the same workspaces, and grove create warns about them
+without refusing.
+
+With --every, the check repeats at that interval until interrupted, printing
+the workspaces over the cap each time, e.g. from a login item or a tmux
+pane. Without it, the exit status suits cron or launchd.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, cfg, runtimeRoot, err := imageRuntime("check")
+		if err != nil {
+			return err
+		}
+		every, _ := cmd.Flags().GetDuration("every")
+		if every <= 0 {
+			return checkShadows(runtimeRoot, cfg.ImageShadowMaxGB)
+		}
+
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			if err := checkShadows(runtimeRoot, cfg.ImageShadowMaxGB); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", time.Now().Format(time.TimeOnly), err)
+			}
+			select {
+			case <-cmd.Context().Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	},
+}
+
+// checkShadows prints the shadow sizes and returns an error naming the
+// workspaces over maxGB.
+func checkShadows(runtimeRoot string, maxGB int) error {
+	metas, err := image.CheckShadows(runtimeRoot, maxGB)
+	var capErr *image.ShadowCapError
+	if err != nil && !errors.As(err, &capErr) {
+		return err
+	}
+	var total int64
+	for _, m := range metas {
+		total += m.ShadowBytes
+	}
+	limit := "no cap"
+	if maxGB > 0 {
+		limit = fmt.Sprintf("cap %d GB each", maxGB)
+	}
+	fmt.Printf("Shadows: %s in %d workspace(s), %s\n", formatBytes(total), len(metas), limit)
+	if capErr != nil {
+		return fmt.Errorf("workspace %w — destroy it or raise image_shadow_max_gb", capErr)
+	}
+	return nil
+}
+
+// imageRuntime returns the golden copy containing the working directory, its
+// config and its image runtime root, for the grove image subcommand name.
+func imageRuntime(name string) (string, *config.Config, string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	goldenRoot, err := config.FindGroveRoot(cwd)
+	if err != nil {
+		return "", nil, "", err
+	}
+	if workspace.IsWorkspace(goldenRoot) {
+		return "", nil, "", fmt.Errorf("cannot %s from inside a workspace.\nRun this from the golden copy instead", name)
+	}
+
+	cfg, err := config.LoadOrDefault(goldenRoot)
+	if err != nil {
+		return "", nil, "", err
+	}
+	if cfg.CloneBackend != "image" {
+		return "", nil, "", fmt.Errorf("clone_backend is %q; grove image %s only applies to the image backend", cfg.CloneBackend, name)
+	}
+	runtimeRoot, err := config.EnsureImageRuntimeRoot(goldenRoot, cfg)
+	if err != nil {
+		return "", nil, "", fmt.Errorf("resolving image runtime root: %w", err)
+	}
+	return goldenRoot, cfg, runtimeRoot, nil
+}
+
+func init() {
+	imageReconcileCmd.Flags().Bool("clean", false, "Remove metadata of workspaces whose shadow file is gone")
+	imageCheckCmd.Flags().Duration("every", 0, "Repeat the check at this interval, e.g. 10m, until interrupted")
+	addNoWaitFlag(imageReconcileCmd)
+	addNoWaitFlag(imageCompactCmd)
+	imageCmd.AddCommand(imageReconcileCmd, imageCompactCmd, imageCheckCmd)
+	rootCmd.AddCommand(imageCmd)
+}
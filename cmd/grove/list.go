@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/chrisbanes/grove/internal/config"
+	"github.com/chrisbanes/grove/internal/image"
 	"github.com/chrisbanes/grove/internal/workspace"
 	"github.com/spf13/cobra"
 )
@@ -40,9 +41,25 @@ var listCmd = &cobra.Command{
 			return err
 		}
 
+		// Image workspaces also report how big their shadow has grown.
+		var shadows map[string]int64
+		if cfg.CloneBackend == "image" {
+			if shadows, err = imageShadowSizes(goldenRoot, cfg); err != nil {
+				return err
+			}
+		}
+
 		jsonOut, _ := cmd.Flags().GetBool("json")
 		if jsonOut {
-			data, _ := json.MarshalIndent(workspaces, "", "  ")
+			var entries []listEntry
+			for _, ws := range workspaces {
+				entries = append(entries, listEntry{
+					Info:          ws,
+					ShadowBytes:   shadows[ws.ID],
+					OverShadowCap: overShadowCap(shadows[ws.ID], cfg.ImageShadowMaxGB),
+				})
+			}
+			data, _ := json.MarshalIndent(entries, "", "  ")
 			fmt.Println(string(data))
 			return nil
 		}
@@ -53,16 +70,58 @@ var listCmd = &cobra.Command{
 		}
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-		fmt.Fprintln(w, "ID\tBRANCH\tCREATED\tPATH")
+		if shadows == nil {
+			fmt.Fprintln(w, "ID\tBRANCH\tCREATED\tPATH")
+		} else {
+			fmt.Fprintln(w, "ID\tBRANCH\tCREATED\tSHADOW\tPATH")
+		}
 		for _, ws := range workspaces {
 			age := formatAge(ws.CreatedAt)
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", ws.ID, ws.Branch, age, ws.Path)
+			if shadows == nil {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", ws.ID, ws.Branch, age, ws.Path)
+				continue
+			}
+			shadow := formatBytes(shadows[ws.ID])
+			if overShadowCap(shadows[ws.ID], cfg.ImageShadowMaxGB) {
+				shadow += " (over cap)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", ws.ID, ws.Branch, age, shadow, ws.Path)
 		}
 		w.Flush()
 		return nil
 	},
 }
 
+type listEntry struct {
+	workspace.Info
+	ShadowBytes   int64 `json:"shadow_bytes,omitempty"`
+	OverShadowCap bool  `json:"over_shadow_cap,omitempty"`
+}
+
+// overShadowCap reports whether a shadow of the given size is over
+// image_shadow_max_gb.
+func overShadowCap(bytes int64, maxGB int) bool {
+	return maxGB > 0 && bytes > int64(maxGB)<<30
+}
+
+// imageShadowSizes measures the shadow of every image workspace, keyed by
+// workspace ID.
+func imageShadowSizes(goldenRoot string, cfg *config.Config) (map[string]int64, error) {
+	runtimeRoot, err := config.ImageRuntimeRoot(goldenRoot, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("resolving image runtime root: %w", err)
+	}
+	metas, err := image.UpdateShadowSizes(runtimeRoot)
+	if err != nil {
+		return nil, fmt.Errorf("measuring shadows: %w", err)
+	}
+	sizes := make(map[string]int64, len(metas))
+	for _, m := range metas {
+		sizes[m.ID] = m.ShadowBytes
+	}
+	return sizes, nil
+}
+
 func formatAge(t time.Time) string {
 	d := time.Since(t)
 	switch {
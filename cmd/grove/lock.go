@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/chrisbanes/grove/internal/config"
+	"github.com/chrisbanes/grove/internal/lockfile"
+	"github.com/spf13/cobra"
+)
+
+// lockGolden takes the golden copy lock: shared to read the golden copy,
+// as creating workspaces does, or exclusive to change it, as pulling and
+// warming up do. While another command holds it, lockGolden says who holds
+// it and waits, or with --no-wait fails straight away.
+func lockGolden(cmd *cobra.Command, goldenRoot string, cfg *config.Config, mode lockfile.Mode) (*lockfile.Lock, error) {
+	path, err := config.GoldenLockPath(goldenRoot, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("resolving golden copy lock: %w", err)
+	}
+	noWait, _ := cmd.Flags().GetBool("no-wait")
+	lock, err := lockfile.Hold(cmd.Context(), path, lockfile.HoldOptions{
+		Mode:   mode,
+		NoWait: noWait,
+		OnWait: func(holders []lockfile.Holder) {
+			fmt.Fprintln(os.Stderr, waitingMessage(holders))
+		},
+	})
+	var busy *lockfile.BusyError
+	if errors.As(err, &busy) {
+		return nil, fmt.Errorf("golden copy is %w", busy)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("locking golden copy: %w", err)
+	}
+	return lock, nil
+}
+
+func waitingMessage(holders []lockfile.Holder) string {
+	if len(holders) == 0 {
+		return "Waiting for another grove command to finish with the golden copy..."
+	}
+	msg := "Waiting for the golden copy, in use by:"
+	for _, h := range holders {
+		msg += "\n  " + h.String()
+	}
+	return msg
+}
+
+// addNoWaitFlag adds the --no-wait flag read by lockGolden.
+func addNoWaitFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("no-wait", false, "Fail instead of waiting while another grove command is using the golden copy")
+}
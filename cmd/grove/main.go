@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 )
@@ -26,7 +29,18 @@ var versionCmd = &cobra.Command{
 
 func main() {
 	rootCmd.AddCommand(versionCmd)
-	if err := rootCmd.Execute(); err != nil {
+
+	// Interrupting cancels the command's context, which kills the commands
+	// grove is running and lets it roll back what it had done. A second
+	// interrupt exits immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	if err != nil {
 		os.Exit(1)
 	}
 }
@@ -8,14 +8,15 @@ import (
 
 	"github.com/chrisbanes/grove/internal/config"
 	"github.com/chrisbanes/grove/internal/image"
+	"github.com/chrisbanes/grove/internal/lockfile"
 	"github.com/chrisbanes/grove/internal/workspace"
 	"github.com/spf13/cobra"
 )
 
 var migrateCmd = &cobra.Command{
-	Use:   "migrate --to <cp|image>",
+	Use:   "migrate --to <cp|copy|image|exec:name>",
 	Short: "Migrate workspace backend safely",
-	Long:  `Migrates an initialized golden copy between cp and image backends.`,
+	Long:  `Migrates an initialized golden copy between cp, copy, image, btrfs, zfs, overlay, worktree and plugin backends.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		progressEnabled := resolveProgress(cmd)
 		var progress *progressRenderer
@@ -49,12 +50,16 @@ var migrateCmd = &cobra.Command{
 		}
 
 		to, _ := cmd.Flags().GetString("to")
-		switch to {
-		case "cp", "image":
-		default:
-			return fmt.Errorf("invalid --to %q: expected cp or image", to)
+		if !config.ValidCloneBackend(to) {
+			return fmt.Errorf("invalid --to %q: expected cp, copy, image, btrfs, zfs, overlay, worktree or exec:<name>", to)
 		}
 
+		lock, err := lockGolden(cmd, goldenRoot, cfg, lockfile.Exclusive)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+
 		currentBackend, err := detectInitializedBackend(goldenRoot, cfg)
 		if err != nil {
 			return err
@@ -74,6 +79,21 @@ var migrateCmd = &cobra.Command{
 			return nil
 		}
 
+		if _, ok := config.ExecBackendName(currentBackend); ok || currentBackend == "btrfs" || currentBackend == "zfs" || currentBackend == "overlay" || currentBackend == "worktree" {
+			// Only the plugin knows how to destroy its workspaces, btrfs, zfs
+			// and overlay workspaces are subvolumes, datasets or mounts other
+			// backends cannot remove, and worktrees must be removed with git.
+			listCfg := *cfg
+			listCfg.WorkspaceDir = config.ExpandWorkspaceDir(cfg.WorkspaceDir, getProjectName(goldenRoot))
+			existing, err := workspace.List(&listCfg)
+			if err != nil {
+				return err
+			}
+			if len(existing) > 0 {
+				return fmt.Errorf("cannot migrate from %s with active workspaces (%d). Destroy them first", currentBackend, len(existing))
+			}
+		}
+
 		switch to {
 		case "image":
 			runtimeRoot, err := config.EnsureImageRuntimeRoot(goldenRoot, cfg)
@@ -92,17 +112,21 @@ var migrateCmd = &cobra.Command{
 				if err != nil {
 					return fmt.Errorf("computing image sync excludes: %w", err)
 				}
-				var onProgress func(int, string)
+				var onProgress func(image.Progress)
 				if progress != nil {
-					onProgress = func(pct int, phase string) {
-						progress.Update(pct, phase)
+					onProgress = func(p image.Progress) {
+						progress.UpdateTransfer(p.Percent, p.Phase, imageTransfer(p))
 					}
 				}
-				if _, err := image.InitBase(runtimeRoot, goldenRoot, nil, sizeGB, excludes, onProgress); err != nil {
+				syncer, err := image.NewSyncer(cfg.ImageSyncEngine, cfg.ImageSyncChecksum, nil)
+				if err != nil {
+					return err
+				}
+				if _, err := image.InitBase(cmd.Context(), runtimeRoot, goldenRoot, nil, syncer, sizeGB, cfg.ImageHeadroomGB, excludes, onProgress); err != nil {
 					return fmt.Errorf("initializing image backend: %w", err)
 				}
 			}
-		case "cp":
+		default: // cp, copy, btrfs, zfs, overlay, worktree or exec:<name>
 			runtimeRoot, err := config.EnsureImageRuntimeRoot(goldenRoot, cfg)
 			if err != nil {
 				return fmt.Errorf("resolving image runtime root: %w", err)
@@ -112,7 +136,7 @@ var migrateCmd = &cobra.Command{
 				return err
 			}
 			if len(metas) > 0 {
-				return fmt.Errorf("cannot migrate to cp with active image workspaces (%d). Destroy them first", len(metas))
+				return fmt.Errorf("cannot migrate to %s with active image workspaces (%d). Destroy them first", to, len(metas))
 			}
 		}
 
@@ -130,9 +154,10 @@ var migrateCmd = &cobra.Command{
 }
 
 func init() {
-	migrateCmd.Flags().String("to", "", "Target backend: cp or image")
+	migrateCmd.Flags().String("to", "", "Target backend: cp, copy, image, btrfs, zfs, overlay, worktree or exec:<name>")
 	migrateCmd.Flags().Int("image-size-gb", 200, "Base sparsebundle size in GB when migrating to image")
 	migrateCmd.Flags().Bool("progress", false, "Show progress output (default: auto-detect TTY)")
+	addNoWaitFlag(migrateCmd)
 	_ = migrateCmd.MarkFlagRequired("to")
 	rootCmd.AddCommand(migrateCmd)
 }
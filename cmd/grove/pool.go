@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/chrisbanes/grove/internal/backend"
+	"github.com/chrisbanes/grove/internal/config"
+	gitpkg "github.com/chrisbanes/grove/internal/git"
+	"github.com/chrisbanes/grove/internal/lockfile"
+	"github.com/chrisbanes/grove/internal/workspace"
+	"github.com/spf13/cobra"
+)
+
+var poolCmd = &cobra.Command{
+	Use:   "pool",
+	Short: "Manage the pool of ready workspaces",
+	Long: `With pool_size set in .grove/config.json, Grove keeps that many unclaimed
+workspaces cloned and hooked at the golden copy's current commit. grove
+create claims one of them instead of cloning, as long as the golden copy is
+still at that commit and has no uncommitted changes.`,
+}
+
+var poolFillCmd = &cobra.Command{
+	Use:   "fill",
+	Short: "Fill the pool up to pool_size",
+	Long: `Removes pooled workspaces cloned at an older commit, or beyond pool_size,
+then creates workspaces until pool_size are ready. Run it after claiming
+workspaces, or after the golden copy moves on, to keep creates fast. With
+pool_size 0 it empties the pool.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+
+		goldenRoot, err := config.FindGroveRoot(cwd)
+		if err != nil {
+			return err
+		}
+		if workspace.IsWorkspace(goldenRoot) {
+			return fmt.Errorf("cannot fill the pool from inside a workspace.\nRun this from the golden copy instead")
+		}
+
+		cfg, err := config.LoadOrDefault(goldenRoot)
+		if err != nil {
+			return err
+		}
+		if err := config.EnsureMinimalGroveDir(goldenRoot); err != nil {
+			return err
+		}
+		if err := config.EnsureBackendCompatible(goldenRoot, cfg); err != nil {
+			return err
+		}
+		backendImpl, err := backend.ForName(cfg.CloneBackend)
+		if err != nil {
+			return err
+		}
+		if _, ok := backendImpl.(backend.Renamer); !ok && cfg.PoolSize > 0 {
+			return fmt.Errorf("clone_backend %q cannot rename workspaces, which claiming a pooled one needs.\nSet pool_size to 0", cfg.CloneBackend)
+		}
+
+		projectName := getProjectName(goldenRoot)
+		cfg.WorkspaceDir = config.ExpandWorkspaceDir(cfg.WorkspaceDir, projectName)
+		cfg.StateDir = config.ExpandStateDir(cfg.StateDir)
+
+		lock, err := lockGolden(cmd, goldenRoot, cfg, lockfile.Shared)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+
+		dirty, err := gitpkg.IsDirty(goldenRoot)
+		if err != nil {
+			return fmt.Errorf("checking repo status: %w", err)
+		}
+		if dirty {
+			return fmt.Errorf("golden copy has uncommitted changes.\nPooled workspaces are only claimed at a clean commit; commit or stash them first")
+		}
+		commit, err := gitpkg.CurrentCommit(goldenRoot)
+		if err != nil {
+			return fmt.Errorf("reading golden commit: %w", err)
+		}
+		branchForID, _ := gitpkg.CurrentBranch(goldenRoot)
+
+		ready, err := prunePool(ctx, backendImpl, goldenRoot, cfg, commit)
+		if err != nil {
+			return err
+		}
+
+		opts := backend.CreateOptions{
+			BranchForID:  branchForID,
+			GoldenCommit: commit,
+			OnRelocateSkip: func(rel string) {
+				fmt.Fprintf(os.Stderr, "Warning: not relocating %s: binary file and the workspace path is longer than the golden copy path\n", rel)
+			},
+			OnWarning: func(msg string) {
+				fmt.Fprintf(os.Stderr, "Warning: %s\n", msg)
+			},
+		}
+		for ready < cfg.PoolSize {
+			workspaces, err := workspace.List(cfg)
+			if err != nil {
+				return err
+			}
+			if len(workspaces)+ready >= cfg.MaxWorkspaces {
+				return fmt.Errorf("max workspaces (%d) reached with %d of %d pooled — destroy one first", cfg.MaxWorkspaces, ready, cfg.PoolSize)
+			}
+			info, err := createWorkspace(ctx, backendImpl, goldenRoot, cfg, opts, func(string) {})
+			if err != nil {
+				return err
+			}
+			if err := workspace.AddToPool(info.Path); err != nil {
+				cleanupWorkspace(ctx, backendImpl, goldenRoot, cfg, info.ID)
+				return fmt.Errorf("pooling workspace: %w", err)
+			}
+			ready++
+			fmt.Printf("Pooled: %s\n", info.ID)
+		}
+		fmt.Printf("Pool: %d / %d ready at %s\n", ready, cfg.PoolSize, commit)
+		return nil
+	},
+}
+
+// prunePool removes pooled workspaces cloned at a commit other than commit,
+// or beyond pool_size, and returns how many are left.
+func prunePool(ctx context.Context, backendImpl backend.Backend, goldenRoot string, cfg *config.Config, commit string) (int, error) {
+	pooled, err := workspace.ListPool(cfg)
+	if err != nil {
+		return 0, err
+	}
+	ready := 0
+	for _, ws := range pooled {
+		if ws.GoldenCommit == commit && ready < cfg.PoolSize {
+			ready++
+			continue
+		}
+		// Claim it first so that a concurrent grove create can't be
+		// handed a workspace that is being destroyed.
+		if _, err := workspace.Claim(cfg, ws.ID); err != nil {
+			if errors.Is(err, workspace.ErrClaimed) {
+				continue
+			}
+			return 0, err
+		}
+		if err := backendImpl.DestroyWorkspace(ctx, goldenRoot, cfg, ws.ID); err != nil {
+			return 0, fmt.Errorf("removing pooled workspace %s: %w", ws.ID, err)
+		}
+		fmt.Printf("Removed: %s\n", ws.ID)
+	}
+	return ready, nil
+}
+
+// claimPooled claims a pooled workspace cloned at commit and renames it
+// after branchForID, as if it had just been created. A pooled workspace
+// does not count against max_workspaces, so it is claimed under a slot
+// reservation like a new one. It returns nil if there is none left to claim.
+func claimPooled(ctx context.Context, backendImpl backend.Backend, goldenRoot string, cfg *config.Config, commit, branchForID string, onRelocateSkip func(string)) (*workspace.Info, error) {
+	renamer, ok := backendImpl.(backend.Renamer)
+	if !ok {
+		return nil, nil
+	}
+	pooled, err := workspace.ListPool(cfg)
+	if err != nil {
+		return nil, err
+	}
+	pooled = slices.DeleteFunc(pooled, func(ws workspace.Info) bool { return ws.GoldenCommit != commit })
+	if len(pooled) == 0 {
+		return nil, nil
+	}
+
+	id, err := workspace.GenerateID(branchForID)
+	if err != nil {
+		return nil, fmt.Errorf("generating workspace ID: %w", err)
+	}
+	slot, err := workspace.Reserve(cfg, id)
+	if err != nil {
+		return nil, err
+	}
+	defer slot.Release()
+
+	for _, ws := range pooled {
+		if _, err := workspace.Claim(cfg, ws.ID); errors.Is(err, workspace.ErrClaimed) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		info, err := renamer.RenameWorkspace(ctx, goldenRoot, cfg, ws.ID, id, onRelocateSkip)
+		if err != nil {
+			// The failed rename left it under one ID or the other.
+			if backendImpl.DestroyWorkspace(context.WithoutCancel(ctx), goldenRoot, cfg, id) != nil {
+				cleanupWorkspace(ctx, backendImpl, goldenRoot, cfg, ws.ID)
+			}
+			return nil, fmt.Errorf("renaming pooled workspace %s: %w", ws.ID, err)
+		}
+		return info, nil
+	}
+	return nil, nil
+}
+
+func init() {
+	addNoWaitFlag(poolFillCmd)
+	poolCmd.AddCommand(poolFillCmd)
+	rootCmd.AddCommand(poolCmd)
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 
+	"github.com/chrisbanes/grove/internal/image"
 	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
 )
@@ -20,19 +22,102 @@ func newProgressState(min, max int) *progressState {
 }
 
 func (s *progressState) updateClone(copied, total int) {
-	next := mapPercent(copied, total, s.min, s.max)
+	s.advance(mapPercent(copied, total, s.min, s.max))
+}
+
+// updateBytes advances the percentage by bytes copied, which tracks elapsed
+// time more closely than entry counts when file sizes vary.
+func (s *progressState) updateBytes(copied, total int64) {
+	if total <= 0 {
+		return
+	}
+	copied = min(max(copied, 0), total)
+	s.advance(s.min + int(copied*int64(s.max-s.min)/total))
+}
+
+func (s *progressState) advance(next int) {
 	if next < s.percent {
 		return
 	}
 	s.percent = clampPercent(next)
 }
 
+// transfer describes the data moved so far by a phase, for showing
+// throughput and the estimated time remaining.
+type transfer struct {
+	bytes int64
+	total int64
+	rate  float64
+	// files and filesTotal count files moved, when the phase counts them.
+	files      int
+	filesTotal int
+}
+
+// imageTransfer returns the transfer described by an image sync's progress.
+func imageTransfer(p image.Progress) transfer {
+	return transfer{bytes: p.Bytes, total: p.BytesTotal, rate: p.Rate, files: p.Files, filesTotal: p.FilesTotal}
+}
+
+func (t transfer) String() string {
+	if t.bytes <= 0 && t.total <= 0 {
+		return ""
+	}
+	s := formatBytes(t.bytes)
+	if t.total > 0 {
+		s += " / " + formatBytes(t.total)
+	}
+	if t.filesTotal > 0 {
+		s += fmt.Sprintf(", %d / %d files", t.files, t.filesTotal)
+	}
+	if t.rate > 0 {
+		s += ", " + formatBytes(int64(t.rate)) + "/s"
+		if t.total > t.bytes {
+			eta := time.Duration(float64(t.total-t.bytes) / t.rate * float64(time.Second))
+			s += ", ETA " + formatETA(eta)
+		}
+	}
+	return s
+}
+
+// formatBytes renders n using binary units, e.g. "1.5 GiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTP"[exp])
+}
+
+// formatETA renders d rounded to the second, e.g. "45s", "3m05s", "1h02m".
+func formatETA(d time.Duration) string {
+	d = d.Round(time.Second)
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	default:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+}
+
+// transferRedrawInterval limits how often the bar is redrawn when only the
+// transfer details have changed.
+const transferRedrawInterval = 100 * time.Millisecond
+
 type progressRenderer struct {
-	w           io.Writer
-	tty         bool
-	lastPercent int
-	lastPhase   string
-	bar         *progressbar.ProgressBar
+	w            io.Writer
+	tty          bool
+	lastPercent  int
+	lastPhase    string
+	lastTransfer string
+	lastDraw     time.Time
+	bar          *progressbar.ProgressBar
 }
 
 func newProgressRenderer(w io.Writer, tty bool, label string) *progressRenderer {
@@ -57,14 +142,29 @@ func newProgressRenderer(w io.Writer, tty bool, label string) *progressRenderer
 }
 
 func (r *progressRenderer) Update(percent int, phase string) {
+	r.UpdateTransfer(percent, phase, transfer{})
+}
+
+// UpdateTransfer is like Update, and also shows the bytes moved, the
+// throughput and an ETA when t has them.
+func (r *progressRenderer) UpdateTransfer(percent int, phase string, t transfer) {
 	percent = clampPercent(percent)
+	detail := t.String()
 	if r.bar != nil {
 		if percent == r.lastPercent && phase == r.lastPhase {
-			return
+			if detail == r.lastTransfer || time.Since(r.lastDraw) < transferRedrawInterval {
+				return
+			}
 		}
 		r.lastPercent = percent
 		r.lastPhase = phase
-		r.bar.Describe(phase)
+		r.lastTransfer = detail
+		r.lastDraw = time.Now()
+		if detail != "" {
+			r.bar.Describe(phase + " (" + detail + ")")
+		} else {
+			r.bar.Describe(phase)
+		}
 		_ = r.bar.Set(percent)
 		return
 	}
@@ -85,6 +185,10 @@ func (r *progressRenderer) Update(percent int, phase string) {
 	}
 	r.lastPercent = percent
 	r.lastPhase = phase
+	if detail != "" {
+		fmt.Fprintf(r.w, "[%d%%] %s (%s)\n", percent, phase, detail)
+		return
+	}
 	fmt.Fprintf(r.w, "[%d%%] %s\n", percent, phase)
 }
 
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -94,3 +95,60 @@ func TestResolveProgress_RespectsExplicitFalse(t *testing.T) {
 		t.Fatal("expected false when --progress=false explicitly set")
 	}
 }
+
+func TestProgressState_UpdateBytes(t *testing.T) {
+	s := newProgressState(5, 95)
+	s.updateBytes(50<<30, 100<<30)
+	if s.percent != 50 {
+		t.Fatalf("percent = %d, want 50", s.percent)
+	}
+	// Stale totals never push past the phase maximum.
+	s.updateBytes(200<<30, 100<<30)
+	if s.percent != 95 {
+		t.Fatalf("percent = %d, want 95", s.percent)
+	}
+}
+
+func TestTransferString(t *testing.T) {
+	tests := []struct {
+		name string
+		t    transfer
+		want string
+	}{
+		{"empty", transfer{}, ""},
+		{"bytes only", transfer{bytes: 512}, "512 B"},
+		{"no rate yet", transfer{bytes: 1 << 20, total: 4 << 20}, "1.0 MiB / 4.0 MiB"},
+		{"with eta", transfer{bytes: 1 << 30, total: 3 << 30, rate: 100 << 20}, "1.0 GiB / 3.0 GiB, 100.0 MiB/s, ETA 20s"},
+		{"with files", transfer{bytes: 1 << 20, total: 4 << 20, files: 3, filesTotal: 12}, "1.0 MiB / 4.0 MiB, 3 / 12 files"},
+		{"complete", transfer{bytes: 2 << 20, total: 2 << 20, rate: 1 << 20}, "2.0 MiB / 2.0 MiB, 1.0 MiB/s"},
+	}
+	for _, tt := range tests {
+		if got := tt.t.String(); got != tt.want {
+			t.Errorf("%s: String() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatETA(t *testing.T) {
+	tests := map[time.Duration]string{
+		45 * time.Second:                        "45s",
+		3*time.Minute + 5*time.Second:           "3m05s",
+		time.Hour + 2*time.Minute + time.Second: "1h02m",
+		1500 * time.Millisecond:                 "2s",
+	}
+	for d, want := range tests {
+		if got := formatETA(d); got != want {
+			t.Errorf("formatETA(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestProgressRenderer_NonTTYShowsTransfer(t *testing.T) {
+	var buf bytes.Buffer
+	r := newProgressRenderer(&buf, false, "update")
+	r.UpdateTransfer(40, "syncing golden copy", transfer{bytes: 1 << 30, total: 2 << 30, rate: 1 << 30})
+	want := "[40%] syncing golden copy (1.0 GiB / 2.0 GiB, 1.0 GiB/s, ETA 1s)\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("output = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/chrisbanes/grove/internal/clone"
+	"github.com/chrisbanes/grove/internal/config"
+	gitpkg "github.com/chrisbanes/grove/internal/git"
+	"github.com/spf13/cobra"
+)
+
+// maxRelocateFiles is how many files in one ignored directory are suggested
+// as separate relocate patterns before the whole directory is suggested
+// instead.
+const maxRelocateFiles = 5
+
+var scanPathsCmd = &cobra.Command{
+	Use:   "scan-paths",
+	Short: "Find ignored files that refer to the golden copy's path",
+	Long: `Search the gitignored files of the golden copy for ones that mention its
+absolute path, and for absolute symlinks into it. Workspaces cloned from
+these would still refer to the golden copy.
+
+Paths excluded by the config or .groveignore files are skipped, as they are
+never cloned. Results are grouped by top-level directory, with the sizes of
+the ignored files in each, to help decide between excluding a directory and
+relocating the files in it.
+Use --suggest to print matching "exclude" or "relocate" config entries.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jsonOut, _ := cmd.Flags().GetBool("json")
+		suggest, _ := cmd.Flags().GetString("suggest")
+		switch suggest {
+		case "", "exclude", "relocate":
+		default:
+			return fmt.Errorf("invalid --suggest %q: expected exclude or relocate", suggest)
+		}
+		if jsonOut && suggest != "" {
+			return fmt.Errorf("--json and --suggest cannot be used together")
+		}
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+
+		goldenRoot, err := config.FindGroveRoot(cwd)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := config.LoadOrDefault(goldenRoot)
+		if err != nil {
+			return err
+		}
+
+		ignored, err := gitpkg.IgnoredPaths(cmd.Context(), goldenRoot)
+		if err != nil {
+			return err
+		}
+		groups, err := clone.ScanPaths(goldenRoot, cfg.Exclude, cfg.Relocate, ignored)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case jsonOut:
+			if groups == nil {
+				groups = []clone.ScanGroup{}
+			}
+			data, _ := json.MarshalIndent(groups, "", "  ")
+			fmt.Println(string(data))
+			return nil
+		case suggest == "exclude":
+			return printSuggestion(goldenRoot, "exclude", cfg.Exclude, suggestExcludes(groups))
+		case suggest == "relocate":
+			return printSuggestion(goldenRoot, "relocate", cfg.Relocate, suggestRelocates(groups))
+		}
+
+		if len(groups) == 0 {
+			fmt.Printf("No ignored files refer to %s.\n", goldenRoot)
+			return nil
+		}
+
+		fmt.Printf("Ignored files referring to %s:\n\n", goldenRoot)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, g := range groups {
+			name := g.Path
+			if g.IsDir {
+				name += "/"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", name, pluralFiles(g.Files), formatBytes(g.Size))
+			for _, ref := range g.References {
+				size := ""
+				if !ref.Symlink {
+					size = formatBytes(ref.Size)
+				}
+				fmt.Fprintf(w, "  %s\t%s\t%s", ref.Path, ref.Kind(), size)
+				switch {
+				case ref.Symlink:
+					fmt.Fprint(w, "\tretargeted on clone")
+				case ref.Relocated:
+					fmt.Fprint(w, "\trelocated")
+				}
+				fmt.Fprintln(w)
+			}
+		}
+		w.Flush()
+		fmt.Println()
+		fmt.Println("Use --suggest exclude or --suggest relocate to print config entries.")
+		return nil
+	},
+}
+
+func pluralFiles(n int) string {
+	if n == 1 {
+		return "1 file"
+	}
+	return fmt.Sprintf("%d files", n)
+}
+
+// suggestExcludes returns an anchored exclude pattern for each wholly
+// ignored group, and for each reference in the others, so that tracked
+// files are never excluded.
+func suggestExcludes(groups []clone.ScanGroup) []string {
+	var patterns []string
+	for _, g := range groups {
+		if g.Ignored {
+			patterns = append(patterns, anchoredPattern(g.Path, g.IsDir))
+			continue
+		}
+		for _, ref := range g.References {
+			patterns = append(patterns, anchoredPattern(ref.Path, false))
+		}
+	}
+	return patterns
+}
+
+// suggestRelocates returns relocate patterns covering the files in groups
+// that are not relocated yet. Symlinks need no pattern. Wholly ignored
+// directories with many such files are suggested as a whole.
+func suggestRelocates(groups []clone.ScanGroup) []string {
+	var patterns []string
+	for _, g := range groups {
+		var files []string
+		for _, ref := range g.References {
+			if !ref.Symlink && !ref.Relocated {
+				files = append(files, ref.Path)
+			}
+		}
+		if g.Ignored && g.IsDir && len(files) > maxRelocateFiles {
+			patterns = append(patterns, anchoredPattern(g.Path, true))
+			continue
+		}
+		for _, f := range files {
+			patterns = append(patterns, anchoredPattern(f, false))
+		}
+	}
+	return patterns
+}
+
+// anchoredPattern returns a gitignore-style pattern matching only the path
+// rel from the root.
+func anchoredPattern(rel string, isDir bool) string {
+	if isDir {
+		return "/" + rel + "/"
+	}
+	return "/" + rel
+}
+
+// printSuggestion prints the config entry for key with the suggested
+// patterns appended to the existing ones.
+func printSuggestion(goldenRoot, key string, existing, suggested []string) error {
+	patterns := slices.Clone(existing)
+	added := 0
+	for _, p := range suggested {
+		if !slices.Contains(patterns, p) {
+			patterns = append(patterns, p)
+			added++
+		}
+	}
+	if added == 0 {
+		fmt.Fprintf(os.Stderr, "No %s entries to suggest.\n", key)
+		return nil
+	}
+	data, err := json.MarshalIndent(map[string][]string{key: patterns}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	fmt.Fprintf(os.Stderr, "Merge into %s.\n", filepath.Join(goldenRoot, config.GroveDirName, config.ConfigFile))
+	return nil
+}
+
+func init() {
+	scanPathsCmd.Flags().Bool("json", false, "Output as JSON")
+	scanPathsCmd.Flags().String("suggest", "", `Print suggested config entries: "exclude" or "relocate"`)
+	rootCmd.AddCommand(scanPathsCmd)
+}
@@ -56,6 +56,19 @@ var statusCmd = &cobra.Command{
 
 		workspaces, _ := workspace.List(cfg)
 		fmt.Printf("Workspaces:  %d / %d (max)\n", len(workspaces), cfg.MaxWorkspaces)
+		if pooled, _ := workspace.ListPool(cfg); cfg.PoolSize > 0 || len(pooled) > 0 {
+			fresh := 0
+			for _, ws := range pooled {
+				if ws.GoldenCommit == commit {
+					fresh++
+				}
+			}
+			fmt.Printf("Pool:        %d / %d ready", fresh, cfg.PoolSize)
+			if stale := len(pooled) - fresh; stale > 0 {
+				fmt.Printf(", %d stale (run grove pool fill)", stale)
+			}
+			fmt.Println()
+		}
 		fmt.Printf("Workspace dir: %s\n", cfg.WorkspaceDir)
 		fmt.Printf("State dir:     %s\n", cfg.StateDir)
 
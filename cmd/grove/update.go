@@ -8,6 +8,8 @@ import (
 	"github.com/chrisbanes/grove/internal/backend"
 	"github.com/chrisbanes/grove/internal/config"
 	gitpkg "github.com/chrisbanes/grove/internal/git"
+	"github.com/chrisbanes/grove/internal/image"
+	"github.com/chrisbanes/grove/internal/lockfile"
 	"github.com/chrisbanes/grove/internal/termio"
 	"github.com/spf13/cobra"
 )
@@ -38,6 +40,7 @@ var updateCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		cfg.WorkspaceDir = config.ExpandWorkspaceDir(cfg.WorkspaceDir, getProjectName(goldenRoot))
 		cfg.StateDir = config.ExpandStateDir(cfg.StateDir)
 		// Ensure .grove/ exists before backend compat check writes backend.json
 		if err := config.EnsureMinimalGroveDir(goldenRoot); err != nil {
@@ -51,14 +54,20 @@ var updateCmd = &cobra.Command{
 			return err
 		}
 
+		lock, err := lockGolden(cmd, goldenRoot, cfg, lockfile.Exclusive)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+
 		fmt.Println("Pulling latest...")
-		if err := gitpkg.Pull(goldenRoot); err != nil {
+		if err := gitpkg.Pull(cmd.Context(), goldenRoot); err != nil {
 			return fmt.Errorf("git pull failed: %w", err)
 		}
 
 		if cfg.WarmupCommand != "" {
 			fmt.Printf("Running warmup: %s\n", cfg.WarmupCommand)
-			warmup := exec.Command("sh", "-c", cfg.WarmupCommand)
+			warmup := exec.CommandContext(cmd.Context(), "sh", "-c", cfg.WarmupCommand)
 			warmup.Dir = goldenRoot
 			if err := termio.RunInteractive(warmup); err != nil {
 				return fmt.Errorf("warmup command failed: %w", err)
@@ -67,30 +76,42 @@ var updateCmd = &cobra.Command{
 
 		commit, _ := gitpkg.CurrentCommit(goldenRoot)
 		excludes := cfg.Exclude
-		if backendImpl.Name() == "image" && progress == nil {
-			fmt.Println("Refreshing image backend...")
+		refreshesBase := backendImpl.Capabilities(cmd.Context(), goldenRoot).RefreshesBase
+		if refreshesBase && progress == nil {
+			fmt.Printf("Refreshing %s backend...\n", backendImpl.Name())
 		}
-		if backendImpl.Name() == "image" {
+		if refreshesBase {
 			excludes, err = config.BuildImageSyncExcludes(goldenRoot, cfg)
 			if err != nil {
-				return fmt.Errorf("computing image sync excludes: %w", err)
+				return fmt.Errorf("computing %s sync excludes: %w", backendImpl.Name(), err)
 			}
 		}
-		var onProgress func(int, string)
+		var onProgress func(image.Progress)
 		if progress != nil {
-			onProgress = func(pct int, phase string) {
-				progress.Update(pct, phase)
+			onProgress = func(p image.Progress) {
+				progress.UpdateTransfer(p.Percent, p.Phase, imageTransfer(p))
 			}
 		}
-		if err := backendImpl.RefreshBase(goldenRoot, commit, excludes, onProgress); err != nil {
+		if err := backendImpl.RefreshBase(cmd.Context(), goldenRoot, commit, excludes, onProgress); err != nil {
+			return err
+		}
+
+		// Pooled workspaces cloned before the pull would only be claimed
+		// once the golden copy is back at their commit.
+		ready, err := prunePool(cmd.Context(), backendImpl, goldenRoot, cfg, commit)
+		if err != nil {
 			return err
 		}
 		fmt.Printf("Golden copy updated to %s\n", commit)
+		if ready < cfg.PoolSize {
+			fmt.Printf("Pool: %d / %d ready; run `grove pool fill` to refill it\n", ready, cfg.PoolSize)
+		}
 		return nil
 	},
 }
 
 func init() {
 	updateCmd.Flags().Bool("progress", false, "Show progress output (default: auto-detect TTY)")
+	addNoWaitFlag(updateCmd)
 	rootCmd.AddCommand(updateCmd)
 }
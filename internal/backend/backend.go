@@ -1,10 +1,19 @@
 package backend
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 
+	"github.com/chrisbanes/grove/backendplugin"
 	"github.com/chrisbanes/grove/internal/clone"
 	"github.com/chrisbanes/grove/internal/config"
+	"github.com/chrisbanes/grove/internal/image"
+	"github.com/chrisbanes/grove/internal/lockfile"
 	"github.com/chrisbanes/grove/internal/workspace"
 )
 
@@ -13,24 +22,202 @@ type CreateOptions struct {
 	Branch       string
 	BranchForID  string
 	GoldenCommit string
-	OnClone      clone.ProgressFunc
+	// Dirty is set if the golden copy has uncommitted changes, which a
+	// backend that works from a commit or an earlier snapshot must pick up
+	// itself.
+	Dirty   bool
+	OnClone clone.ProgressFunc
+	// OnRelocateSkip is called with each binary file that could not be
+	// relocated safely.
+	OnRelocateSkip func(rel string)
+	// OnWarning is called with problems that do not stop the workspace
+	// from being created.
+	OnWarning func(msg string)
+}
+
+// Capabilities describes what a backend supports, and whether it can be
+// used on this host.
+type Capabilities struct {
+	// RefreshWhileActive is set if RefreshBase works while workspaces
+	// exist.
+	RefreshWhileActive bool `json:"refresh_while_active"`
+	// ConstantTimeCreate is set if creating a workspace takes the same time
+	// however big the golden copy is.
+	ConstantTimeCreate bool `json:"constant_time_create"`
+	// Snapshot is set if a workspace can be snapshotted or forked cheaply.
+	// Only plugins report it so far.
+	Snapshot bool `json:"snapshot"`
+	// DiskUsage is set if grove list reports the disk a workspace uses on
+	// its own, beyond what it shares with the golden copy.
+	DiskUsage bool `json:"disk_usage"`
+	// RefreshesBase is set if workspaces are created from a base copy of
+	// the golden copy, which RefreshBase syncs without the workspace and
+	// state dirs.
+	RefreshesBase bool `json:"refreshes_base"`
+	// Available is set if the backend works for the golden copy on this
+	// host. Otherwise Reason says why not.
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
 }
 
 // Backend provides workspace lifecycle operations for a clone backend.
+//
+// Commands a backend runs are killed once ctx is done. CreateWorkspace and
+// RefreshBase then undo their partial work before returning, so an
+// interrupted call leaves nothing behind.
 type Backend interface {
 	Name() string
-	CreateWorkspace(goldenRoot string, cfg *config.Config, opts CreateOptions) (*workspace.Info, error)
-	DestroyWorkspace(goldenRoot string, cfg *config.Config, id string) error
-	RefreshBase(goldenRoot, commit string, excludes []string, onProgress func(int, string)) error
+	// Capabilities reports what the backend supports, and whether it works
+	// for the golden copy at goldenRoot. Checking may run commands.
+	Capabilities(ctx context.Context, goldenRoot string) Capabilities
+	CreateWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, opts CreateOptions) (*workspace.Info, error)
+	DestroyWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, id string) error
+	RefreshBase(ctx context.Context, goldenRoot, commit string, excludes []string, onProgress func(image.Progress)) error
+}
+
+// Renamer is implemented by backends that can give a workspace a new ID,
+// moving it to the matching path in the workspace directory. Pooled
+// workspaces are claimed by renaming them, so pool_size needs a Renamer.
+type Renamer interface {
+	// RenameWorkspace renames the workspace id to newID, rewriting paths
+	// to it the way creating it relocated paths to the golden copy. If it
+	// fails, the workspace is left under one of the two IDs.
+	RenameWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, id, newID string, onRelocateSkip func(rel string)) (*workspace.Info, error)
+}
+
+// renameDir renames a workspace whose directory holds all of it, then
+// relocates paths from its old location to the new one. excludes are those
+// the workspace was cloned with.
+func renameDir(goldenRoot string, cfg *config.Config, excludes []string, id, newID string, onRelocateSkip func(rel string)) (*workspace.Info, error) {
+	info, err := workspace.Rename(cfg, id, newID)
+	if err != nil {
+		return nil, err
+	}
+	return relocateRenamed(goldenRoot, cfg, excludes, info, id, onRelocateSkip)
+}
+
+// relocateOptions returns the options that relocate a workspace cloned from
+// the golden copy with excludes. The entries to rewrite come from the cached
+// clone plan, so relocating does not walk the workspace.
+func relocateOptions(cfg *config.Config, excludes []string, onRelocateSkip func(rel string)) clone.Options {
+	return clone.Options{
+		Excludes:       excludes,
+		CacheDir:       config.PlanCacheDir(cfg),
+		Relocate:       cfg.Relocate,
+		OnRelocateSkip: onRelocateSkip,
+	}
+}
+
+// relocate rewrites paths to the golden copy in the workspace at wsPath, a
+// clone of goldenRoot with excludes, to the workspace.
+func relocate(goldenRoot, wsPath string, cfg *config.Config, excludes []string, onRelocateSkip func(rel string)) error {
+	if err := clone.Relocate(goldenRoot, wsPath, relocateOptions(cfg, excludes, onRelocateSkip)); err != nil {
+		return fmt.Errorf("relocating workspace: %w", err)
+	}
+	return nil
+}
+
+// relocateRenamed rewrites paths to the workspace's location under its old
+// ID, left by relocation when it was created, to its current location.
+func relocateRenamed(goldenRoot string, cfg *config.Config, excludes []string, info *workspace.Info, id string, onRelocateSkip func(rel string)) (*workspace.Info, error) {
+	opts := relocateOptions(cfg, excludes, onRelocateSkip)
+	if err := clone.RelocateMoved(goldenRoot, filepath.Join(cfg.WorkspaceDir, id), info.Path, opts); err != nil {
+		return nil, fmt.Errorf("relocating workspace: %w", err)
+	}
+	return info, nil
+}
+
+// hostGOOS is the operating system backends check their support against.
+var hostGOOS = runtime.GOOS
+
+// Names returns the built-in backends.
+// lockBase takes the lock in runtimeRoot that serializes changes to a
+// backend's base across processes. Creates only hold the golden copy lock
+// shared, so without it two first creates would both set the base up.
+func lockBase(runtimeRoot string) (*lockfile.Lock, error) {
+	lock, err := lockfile.Acquire(filepath.Join(runtimeRoot, "base.lock"))
+	if err != nil {
+		return nil, fmt.Errorf("locking base: %w", err)
+	}
+	return lock, nil
+}
+
+func Names() []string {
+	return []string{"cp", "copy", "image", "btrfs", "zfs", "overlay", "worktree"}
+}
+
+// Plugins returns the plugin backends found on PATH, as exec:<name>.
+func Plugins() []string {
+	var names []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			plugin, ok := strings.CutPrefix(entry.Name(), backendplugin.ExecutablePrefix)
+			name := config.ExecBackendPrefix + plugin
+			if !ok || !config.ValidCloneBackend(name) || slices.Contains(names, name) {
+				continue
+			}
+			if info, err := entry.Info(); err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+				continue
+			}
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
 }
 
 func ForName(name string) (Backend, error) {
+	if plugin, ok := config.ExecBackendName(name); ok && config.ValidCloneBackend(name) {
+		return newExecBackend(plugin)
+	}
 	switch name {
 	case "cp":
 		return cpBackend{}, nil
+	case "copy":
+		return copyBackend{}, nil
 	case "image":
 		return imageBackend{}, nil
+	case "btrfs":
+		return btrfsBackend{}, nil
+	case "zfs":
+		return zfsBackend{}, nil
+	case "overlay":
+		return overlayBackend{}, nil
+	case "worktree":
+		return worktreeBackend{}, nil
 	default:
-		return nil, fmt.Errorf("invalid clone_backend %q: expected cp or image", name)
+		return nil, fmt.Errorf("invalid clone_backend %q: expected cp, copy, image, btrfs, zfs, overlay, worktree or exec:<name>", name)
+	}
+}
+
+// available marks caps as available if err is nil, or gives the first line
+// of err as the reason it is not.
+func available(caps Capabilities, err error) Capabilities {
+	if err != nil {
+		caps.Reason, _, _ = strings.Cut(err.Error(), "\n")
+		return caps
+	}
+	caps.Available = true
+	return caps
+}
+
+// requireCommand returns an error unless the named command is on PATH.
+func requireCommand(name string) error {
+	if _, err := execLookPath(name); err != nil {
+		return fmt.Errorf("%s not found on PATH", name)
+	}
+	return nil
+}
+
+// requireOS returns an error unless the host runs goos.
+func requireOS(backend, goos string) error {
+	if hostGOOS == goos {
+		return nil
 	}
+	name := map[string]string{"darwin": "macOS", "linux": "Linux"}[goos]
+	return fmt.Errorf("clone_backend %q requires %s", backend, name)
 }
@@ -1,6 +1,9 @@
 package backend_test
 
 import (
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
 
 	"github.com/chrisbanes/grove/internal/backend"
@@ -9,7 +12,7 @@ import (
 func TestForName_ValidBackends(t *testing.T) {
 	t.Parallel()
 
-	for _, name := range []string{"cp", "image"} {
+	for _, name := range []string{"cp", "copy", "image", "btrfs", "zfs", "overlay", "worktree"} {
 		name := name
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
@@ -33,3 +36,62 @@ func TestForName_InvalidBackend(t *testing.T) {
 		t.Fatalf("ForName() expected error for invalid backend, got impl=%T", impl)
 	}
 }
+
+func TestPlugins_FindsExecutablesOnPath(t *testing.T) {
+	dir := t.TempDir()
+	for name, mode := range map[string]os.FileMode{
+		"grove-backend-mystore": 0755,
+		"grove-backend-notexec": 0644,
+		"grove-backend-BAD":     0755,
+		"unrelated":             0755,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+dir)
+
+	if got, want := backend.Plugins(), []string{"exec:mystore"}; !slices.Equal(got, want) {
+		t.Errorf("Plugins() = %q, want %q", got, want)
+	}
+}
+
+// Snapshot and DiskUsage are only reported where grove backs them: no
+// built-in backend snapshots workspaces, and grove list only measures image
+// shadows.
+func TestBackends_ReportBackedFeatures(t *testing.T) {
+	tests := []struct {
+		name                string
+		snapshot, diskUsage bool
+	}{
+		{name: "cp"},
+		{name: "copy"},
+		{name: "image", diskUsage: true},
+		{name: "btrfs"},
+		{name: "zfs"},
+		{name: "overlay"},
+		{name: "worktree"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			impl, err := backend.ForName(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			caps := impl.Capabilities(t.Context(), t.TempDir())
+			if caps.Snapshot != tt.snapshot || caps.DiskUsage != tt.diskUsage {
+				t.Errorf("Capabilities() = %+v, want Snapshot %v and DiskUsage %v", caps, tt.snapshot, tt.diskUsage)
+			}
+		})
+	}
+}
+
+func TestCopyBackend_AlwaysAvailable(t *testing.T) {
+	impl, err := backend.ForName("copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps := impl.Capabilities(t.Context(), t.TempDir()); !caps.Available || caps.Reason != "" {
+		t.Errorf("Capabilities() = %+v, want available", caps)
+	}
+}
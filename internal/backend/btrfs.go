@@ -0,0 +1,160 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chrisbanes/grove/internal/btrfs"
+	"github.com/chrisbanes/grove/internal/config"
+	"github.com/chrisbanes/grove/internal/image"
+	"github.com/chrisbanes/grove/internal/workspace"
+)
+
+type btrfsBackend struct{}
+
+var (
+	btrfsLoadState   = btrfs.LoadState
+	btrfsRefreshBase = btrfs.RefreshBase
+	btrfsRunner      btrfs.Runner
+)
+
+func (btrfsBackend) Name() string {
+	return "btrfs"
+}
+
+func (btrfsBackend) Capabilities(ctx context.Context, goldenRoot string) Capabilities {
+	caps := Capabilities{
+		RefreshWhileActive: true,
+		ConstantTimeCreate: true,
+		RefreshesBase:      true,
+	}
+	err := requireOS("btrfs", "linux")
+	if err == nil {
+		err = requireCommand("btrfs")
+	}
+	if err == nil {
+		if fsErr := btrfs.CheckFilesystem(ctx, btrfsRunner, goldenRoot); fsErr != nil {
+			err = fmt.Errorf("golden copy is not on a Btrfs filesystem: %w", fsErr)
+		}
+	}
+	return available(caps, err)
+}
+
+func (btrfsBackend) CreateWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, opts CreateOptions) (*workspace.Info, error) {
+	runtimeRoot, err := config.EnsureImageRuntimeRoot(goldenRoot, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("resolving runtime root: %w", err)
+	}
+	excludes, err := config.BuildImageSyncExcludes(goldenRoot, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("computing btrfs excludes: %w", err)
+	}
+
+	st, err := btrfsLoadState(runtimeRoot)
+	if errors.Is(err, os.ErrNotExist) {
+		syncer, syncErr := image.NewSyncer(cfg.ImageSyncEngine, cfg.ImageSyncChecksum, nil)
+		if syncErr != nil {
+			return nil, syncErr
+		}
+		st, err = btrfsRefreshBase(ctx, runtimeRoot, goldenRoot, btrfsBasePath(cfg), btrfsRunner, syncer, opts.GoldenCommit, excludes, nil)
+		if err != nil {
+			return nil, fmt.Errorf("initializing btrfs backend: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("loading btrfs backend state: %w", err)
+	}
+
+	id, err := workspace.GenerateID(opts.BranchForID)
+	if err != nil {
+		return nil, fmt.Errorf("generating workspace ID: %w", err)
+	}
+	slot, err := workspace.Reserve(cfg, id)
+	if err != nil {
+		return nil, err
+	}
+	defer slot.Release()
+
+	wsPath := filepath.Join(cfg.WorkspaceDir, id)
+
+	if err := os.MkdirAll(cfg.WorkspaceDir, 0755); err != nil {
+		return nil, fmt.Errorf("creating workspace directory: %w", err)
+	}
+
+	if err := btrfs.CreateWorkspace(ctx, btrfsRunner, st, goldenRoot, wsPath, excludes); err != nil {
+		return nil, fmt.Errorf("btrfs workspace create failed: %w", err)
+	}
+	if err := relocate(goldenRoot, wsPath, cfg, excludes, opts.OnRelocateSkip); err != nil {
+		_ = btrfs.DestroyWorkspace(context.WithoutCancel(ctx), btrfsRunner, wsPath)
+		return nil, err
+	}
+
+	info := &workspace.Info{
+		ID:           id,
+		GoldenCopy:   goldenRoot,
+		GoldenCommit: opts.GoldenCommit,
+		CreatedAt:    time.Now().UTC(),
+		Branch:       opts.Branch,
+		Path:         wsPath,
+	}
+	if err := os.MkdirAll(filepath.Join(wsPath, config.GroveDirName), 0755); err != nil {
+		_ = btrfs.DestroyWorkspace(context.WithoutCancel(ctx), btrfsRunner, wsPath)
+		return nil, fmt.Errorf("writing workspace marker: %w", err)
+	}
+	if err := workspace.WriteMarker(wsPath, info); err != nil {
+		_ = btrfs.DestroyWorkspace(context.WithoutCancel(ctx), btrfsRunner, wsPath)
+		return nil, fmt.Errorf("writing workspace marker: %w", err)
+	}
+
+	return info, nil
+}
+
+func (btrfsBackend) DestroyWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, id string) error {
+	info, err := workspace.Get(cfg, id)
+	if err != nil {
+		return err
+	}
+	if err := btrfs.DestroyWorkspace(ctx, btrfsRunner, info.Path); err != nil {
+		return fmt.Errorf("btrfs workspace destroy failed: %w", err)
+	}
+	return nil
+}
+
+func (btrfsBackend) RenameWorkspace(_ context.Context, goldenRoot string, cfg *config.Config, id, newID string, onRelocateSkip func(rel string)) (*workspace.Info, error) {
+	excludes, err := config.BuildImageSyncExcludes(goldenRoot, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("computing btrfs excludes: %w", err)
+	}
+	return renameDir(goldenRoot, cfg, excludes, id, newID, onRelocateSkip)
+}
+
+func (btrfsBackend) RefreshBase(ctx context.Context, goldenRoot, commit string, excludes []string, onProgress func(image.Progress)) error {
+	cfg, err := config.Load(goldenRoot)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	cfg.WorkspaceDir = config.ExpandWorkspaceDir(cfg.WorkspaceDir, filepath.Base(goldenRoot))
+	cfg.StateDir = config.ExpandStateDir(cfg.StateDir)
+	runtimeRoot, err := config.EnsureImageRuntimeRoot(goldenRoot, cfg)
+	if err != nil {
+		return fmt.Errorf("resolving runtime root: %w", err)
+	}
+
+	syncer, err := image.NewSyncer(cfg.ImageSyncEngine, cfg.ImageSyncChecksum, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := btrfsRefreshBase(ctx, runtimeRoot, goldenRoot, btrfsBasePath(cfg), btrfsRunner, syncer, commit, excludes, onProgress); err != nil {
+		return fmt.Errorf("btrfs backend refresh failed: %w", err)
+	}
+	return nil
+}
+
+// btrfsBasePath is where the managed base subvolume goes when the golden copy
+// is not a subvolume itself.
+func btrfsBasePath(cfg *config.Config) string {
+	return filepath.Join(cfg.WorkspaceDir, btrfs.BaseDirName)
+}
@@ -0,0 +1,134 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/chrisbanes/grove/internal/btrfs"
+	"github.com/chrisbanes/grove/internal/config"
+	"github.com/chrisbanes/grove/internal/image"
+)
+
+// copySnapshotRunner treats every path as a subvolume and takes snapshots by
+// copying.
+type copySnapshotRunner struct {
+	commands []string
+}
+
+func (r *copySnapshotRunner) CombinedOutput(_ context.Context, name string, args ...string) ([]byte, error) {
+	r.commands = append(r.commands, name+" "+strings.Join(args, " "))
+	switch args[1] {
+	case "snapshot":
+		return nil, os.CopyFS(args[3], os.DirFS(args[2]))
+	case "delete":
+		return nil, os.RemoveAll(args[2])
+	}
+	return nil, nil
+}
+
+func TestBtrfsBackend_CreateAndDestroy(t *testing.T) {
+	r := &copySnapshotRunner{}
+	origRunner, origRefresh := btrfsRunner, btrfsRefreshBase
+	t.Cleanup(func() { btrfsRunner, btrfsRefreshBase = origRunner, origRefresh })
+	btrfsRunner = r
+
+	golden := t.TempDir()
+	os.MkdirAll(filepath.Join(golden, ".grove"), 0755)
+	os.MkdirAll(filepath.Join(golden, "build"), 0755)
+	os.WriteFile(filepath.Join(golden, "main.go"), []byte("package main\n"), 0644)
+	os.WriteFile(filepath.Join(golden, "build", "output.bin"), []byte("compiled"), 0644)
+	os.Symlink(filepath.Join(golden, "main.go"), filepath.Join(golden, "link"))
+
+	cfg := config.DefaultConfig("test")
+	cfg.WorkspaceDir = filepath.Join(t.TempDir(), "ws")
+	cfg.StateDir = t.TempDir()
+	cfg.CloneBackend = "btrfs"
+	cfg.Exclude = []string{"build/"}
+	cfg.ImageSyncEngine = "rsync"
+
+	refreshed := 0
+	btrfsRefreshBase = func(ctx context.Context, runtimeRoot, goldenRoot, basePath string, runner btrfs.Runner, syncer image.Syncer, commit string, excludes []string, onProgress func(image.Progress)) (*btrfs.State, error) {
+		refreshed++
+		if syncer != (image.RsyncSyncer{}) {
+			t.Errorf("expected the configured rsync syncer, got %#v", syncer)
+		}
+		return btrfs.RefreshBase(ctx, runtimeRoot, goldenRoot, basePath, runner, syncer, commit, excludes, onProgress)
+	}
+
+	b, err := ForName("btrfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := b.CreateWorkspace(t.Context(), golden, cfg, CreateOptions{BranchForID: "main", GoldenCommit: "abc1234"})
+	if err != nil {
+		t.Fatalf("CreateWorkspace() error = %v", err)
+	}
+	if refreshed != 1 {
+		t.Errorf("expected the base to be set up on first create, refreshed %d times", refreshed)
+	}
+	if want := "btrfs subvolume snapshot " + golden + " " + info.Path; !slices.Contains(r.commands, want) {
+		t.Errorf("commands = %q, want %q", r.commands, want)
+	}
+	if _, err := os.Stat(filepath.Join(info.Path, ".grove", config.WorkspaceFile)); err != nil {
+		t.Errorf("workspace marker missing: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(info.Path, "build")); !os.IsNotExist(err) {
+		t.Errorf("excluded build/ is in the workspace: %v", err)
+	}
+	target, err := os.Readlink(filepath.Join(info.Path, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(info.Path, "main.go"); target != want {
+		t.Errorf("link -> %q, want it relocated to %q", target, want)
+	}
+
+	if _, err := b.CreateWorkspace(t.Context(), golden, cfg, CreateOptions{BranchForID: "other"}); err != nil {
+		t.Fatalf("second CreateWorkspace() error = %v", err)
+	}
+	if refreshed != 1 {
+		t.Errorf("expected saved state to be reused, refreshed %d times", refreshed)
+	}
+
+	if err := b.DestroyWorkspace(t.Context(), golden, cfg, info.ID); err != nil {
+		t.Fatalf("DestroyWorkspace() error = %v", err)
+	}
+	if want := "btrfs subvolume delete " + info.Path; !slices.Contains(r.commands, want) {
+		t.Errorf("commands = %q, want %q", r.commands, want)
+	}
+	if _, err := os.Stat(info.Path); !os.IsNotExist(err) {
+		t.Errorf("workspace still exists after destroy: %v", err)
+	}
+}
+
+func TestBtrfsBackend_CapabilitiesChecksFilesystem(t *testing.T) {
+	origRunner, origGOOS, origLookPath := btrfsRunner, hostGOOS, execLookPath
+	t.Cleanup(func() { btrfsRunner, hostGOOS, execLookPath = origRunner, origGOOS, origLookPath })
+	hostGOOS = "linux"
+	execLookPath = func(file string) (string, error) { return "/usr/bin/" + file, nil }
+
+	golden := t.TempDir()
+	b := btrfsBackend{}
+	btrfsRunner = &copySnapshotRunner{}
+	if caps := b.Capabilities(t.Context(), golden); !caps.Available {
+		t.Errorf("Capabilities() = %+v, want available on Btrfs", caps)
+	}
+
+	btrfsRunner = notBtrfsRunner{}
+	caps := b.Capabilities(t.Context(), golden)
+	if caps.Available || !strings.Contains(caps.Reason, "not on a Btrfs filesystem") {
+		t.Errorf("Capabilities() = %+v, want unavailable off Btrfs", caps)
+	}
+}
+
+// notBtrfsRunner fails every btrfs command the way it fails off Btrfs.
+type notBtrfsRunner struct{}
+
+func (notBtrfsRunner) CombinedOutput(context.Context, string, ...string) ([]byte, error) {
+	return []byte("ERROR: not a btrfs filesystem"), errors.New("exit status 1")
+}
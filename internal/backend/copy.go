@@ -0,0 +1,49 @@
+package backend
+
+import (
+	"context"
+
+	"github.com/chrisbanes/grove/internal/clone"
+	"github.com/chrisbanes/grove/internal/config"
+	"github.com/chrisbanes/grove/internal/image"
+	"github.com/chrisbanes/grove/internal/workspace"
+)
+
+// copyBackend creates workspaces with a full parallel copy, for filesystems
+// without copy-on-write support.
+type copyBackend struct{}
+
+func (copyBackend) Name() string {
+	return "copy"
+}
+
+func (copyBackend) Capabilities(context.Context, string) Capabilities {
+	return available(Capabilities{RefreshWhileActive: true}, nil)
+}
+
+func (copyBackend) CreateWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, opts CreateOptions) (*workspace.Info, error) {
+	cloner := &clone.CopyCloner{
+		Root:          goldenRoot,
+		HardlinkPaths: cfg.HardlinkPaths,
+	}
+
+	return workspace.Create(ctx, goldenRoot, cfg, cloner, workspace.CreateOpts{
+		Branch:         opts.Branch,
+		BranchForID:    opts.BranchForID,
+		GoldenCommit:   opts.GoldenCommit,
+		OnClone:        opts.OnClone,
+		OnRelocateSkip: opts.OnRelocateSkip,
+	})
+}
+
+func (copyBackend) DestroyWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, id string) error {
+	return destroyWorkspace(ctx, goldenRoot, cfg, id)
+}
+
+func (copyBackend) RenameWorkspace(_ context.Context, goldenRoot string, cfg *config.Config, id, newID string, onRelocateSkip func(rel string)) (*workspace.Info, error) {
+	return renameDir(goldenRoot, cfg, cfg.Exclude, id, newID, onRelocateSkip)
+}
+
+func (copyBackend) RefreshBase(_ context.Context, _ string, _ string, _ []string, _ func(image.Progress)) error {
+	return nil
+}
@@ -1,8 +1,11 @@
 package backend
 
 import (
+	"context"
+
 	"github.com/chrisbanes/grove/internal/clone"
 	"github.com/chrisbanes/grove/internal/config"
+	"github.com/chrisbanes/grove/internal/image"
 	"github.com/chrisbanes/grove/internal/workspace"
 )
 
@@ -12,24 +15,34 @@ func (cpBackend) Name() string {
 	return "cp"
 }
 
-func (cpBackend) CreateWorkspace(goldenRoot string, cfg *config.Config, opts CreateOptions) (*workspace.Info, error) {
+func (cpBackend) Capabilities(_ context.Context, goldenRoot string) Capabilities {
+	_, err := clone.NewCloner(goldenRoot)
+	return available(Capabilities{RefreshWhileActive: true}, err)
+}
+
+func (cpBackend) CreateWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, opts CreateOptions) (*workspace.Info, error) {
 	cloner, err := clone.NewCloner(goldenRoot)
 	if err != nil {
 		return nil, err
 	}
 
-	return workspace.Create(goldenRoot, cfg, cloner, workspace.CreateOpts{
-		Branch:       opts.Branch,
-		BranchForID:  opts.BranchForID,
-		GoldenCommit: opts.GoldenCommit,
-		OnClone:      opts.OnClone,
+	return workspace.Create(ctx, goldenRoot, cfg, cloner, workspace.CreateOpts{
+		Branch:         opts.Branch,
+		BranchForID:    opts.BranchForID,
+		GoldenCommit:   opts.GoldenCommit,
+		OnClone:        opts.OnClone,
+		OnRelocateSkip: opts.OnRelocateSkip,
 	})
 }
 
-func (cpBackend) DestroyWorkspace(goldenRoot string, cfg *config.Config, id string) error {
-	return destroyWorkspace(goldenRoot, cfg, id)
+func (cpBackend) DestroyWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, id string) error {
+	return destroyWorkspace(ctx, goldenRoot, cfg, id)
+}
+
+func (cpBackend) RenameWorkspace(_ context.Context, goldenRoot string, cfg *config.Config, id, newID string, onRelocateSkip func(rel string)) (*workspace.Info, error) {
+	return renameDir(goldenRoot, cfg, cfg.Exclude, id, newID, onRelocateSkip)
 }
 
-func (cpBackend) RefreshBase(_ string, _ string, _ []string, _ func(int, string)) error {
+func (cpBackend) RefreshBase(_ context.Context, _ string, _ string, _ []string, _ func(image.Progress)) error {
 	return nil
 }
@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"context"
 	"errors"
 	"os"
 
@@ -9,13 +10,13 @@ import (
 	"github.com/chrisbanes/grove/internal/workspace"
 )
 
-func destroyWorkspace(goldenRoot string, cfg *config.Config, id string) error {
+func destroyWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, id string) error {
 	runtimeRoot, err := config.EnsureImageRuntimeRoot(goldenRoot, cfg)
 	if err != nil {
 		return err
 	}
 	if _, err := image.LoadWorkspaceMeta(runtimeRoot, id); err == nil {
-		return image.DestroyWorkspace(runtimeRoot, id, nil)
+		return image.DestroyWorkspace(ctx, runtimeRoot, id, nil)
 	} else if !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
@@ -0,0 +1,217 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/chrisbanes/grove/backendplugin"
+	"github.com/chrisbanes/grove/internal/clone"
+	"github.com/chrisbanes/grove/internal/config"
+	"github.com/chrisbanes/grove/internal/image"
+	"github.com/chrisbanes/grove/internal/workspace"
+)
+
+// execBackend delegates materializing and removing workspaces to a
+// grove-backend-<name> plugin speaking the backendplugin protocol.
+type execBackend struct {
+	name       string
+	executable string
+}
+
+var execLookPath = exec.LookPath
+
+func newExecBackend(name string) (Backend, error) {
+	executable, err := execLookPath(backendplugin.ExecutableName(name))
+	if err != nil {
+		return nil, fmt.Errorf("clone_backend %q: %s not found on PATH", config.ExecBackendPrefix+name, backendplugin.ExecutableName(name))
+	}
+	return execBackend{name: name, executable: executable}, nil
+}
+
+func (b execBackend) Name() string {
+	return config.ExecBackendPrefix + b.name
+}
+
+// Capabilities asks the plugin for its capabilities with hello.
+func (b execBackend) Capabilities(ctx context.Context, _ string) Capabilities {
+	msg, err := backendplugin.Call(ctx, b.executable, backendplugin.Request{Method: backendplugin.MethodHello}, nil, nil)
+	if err != nil {
+		return available(Capabilities{}, fmt.Errorf("hello failed: %w", err))
+	}
+	if !slices.Contains(msg.Versions, backendplugin.Version) {
+		return available(Capabilities{}, fmt.Errorf("%s speaks protocol versions %v, not %d", filepath.Base(b.executable), msg.Versions, backendplugin.Version))
+	}
+	var caps Capabilities
+	if c := msg.Capabilities; c != nil {
+		caps = Capabilities{
+			RefreshWhileActive: c.RefreshWhileActive,
+			ConstantTimeCreate: c.ConstantTimeCreate,
+			Snapshot:           c.Snapshot,
+			DiskUsage:          c.DiskUsage,
+		}
+	}
+	return available(caps, nil)
+}
+
+func (b execBackend) CreateWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, opts CreateOptions) (*workspace.Info, error) {
+	stateDir, err := b.stateDir(goldenRoot, cfg)
+	if err != nil {
+		return nil, err
+	}
+	excludes, err := config.BuildImageSyncExcludes(goldenRoot, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("computing %s excludes: %w", b.Name(), err)
+	}
+
+	id, err := workspace.GenerateID(opts.BranchForID)
+	if err != nil {
+		return nil, fmt.Errorf("generating workspace ID: %w", err)
+	}
+	slot, err := workspace.Reserve(cfg, id)
+	if err != nil {
+		return nil, err
+	}
+	defer slot.Release()
+
+	wsPath := filepath.Join(cfg.WorkspaceDir, id)
+
+	if err := os.MkdirAll(cfg.WorkspaceDir, 0755); err != nil {
+		return nil, fmt.Errorf("creating workspace directory: %w", err)
+	}
+
+	req := backendplugin.Request{
+		Method:        backendplugin.MethodCreate,
+		GoldenRoot:    goldenRoot,
+		StateDir:      stateDir,
+		Excludes:      excludes,
+		WorkspaceID:   id,
+		WorkspacePath: wsPath,
+		Commit:        opts.GoldenCommit,
+	}
+	var onProgress func(backendplugin.Progress)
+	if opts.OnClone != nil {
+		onProgress = func(p backendplugin.Progress) {
+			opts.OnClone(clone.ProgressEvent{
+				Phase:      "clone",
+				Copied:     p.Files,
+				Total:      p.FilesTotal,
+				Bytes:      p.Bytes,
+				BytesTotal: p.BytesTotal,
+			})
+		}
+	}
+	if err := b.call(ctx, req, onProgress); err != nil {
+		b.destroy(ctx, req)
+		return nil, fmt.Errorf("%s workspace create failed: %w", b.Name(), err)
+	}
+	// Grove owns relocation so plugins only have to copy the golden copy.
+	if err := relocate(goldenRoot, wsPath, cfg, excludes, opts.OnRelocateSkip); err != nil {
+		b.destroy(ctx, req)
+		return nil, err
+	}
+
+	info := &workspace.Info{
+		ID:           id,
+		GoldenCopy:   goldenRoot,
+		GoldenCommit: opts.GoldenCommit,
+		CreatedAt:    time.Now().UTC(),
+		Branch:       opts.Branch,
+		Path:         wsPath,
+	}
+	if err := os.MkdirAll(filepath.Join(wsPath, config.GroveDirName), 0755); err != nil {
+		b.destroy(ctx, req)
+		return nil, fmt.Errorf("writing workspace marker: %w", err)
+	}
+	if err := workspace.WriteMarker(wsPath, info); err != nil {
+		b.destroy(ctx, req)
+		return nil, fmt.Errorf("writing workspace marker: %w", err)
+	}
+
+	return info, nil
+}
+
+func (b execBackend) DestroyWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, id string) error {
+	stateDir, err := b.stateDir(goldenRoot, cfg)
+	if err != nil {
+		return err
+	}
+	info, err := workspace.Get(cfg, id)
+	if err != nil {
+		return err
+	}
+	err = b.call(ctx, backendplugin.Request{
+		Method:        backendplugin.MethodDestroy,
+		GoldenRoot:    goldenRoot,
+		StateDir:      stateDir,
+		WorkspaceID:   info.ID,
+		WorkspacePath: info.Path,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("%s workspace destroy failed: %w", b.Name(), err)
+	}
+	return nil
+}
+
+func (b execBackend) RefreshBase(ctx context.Context, goldenRoot, commit string, excludes []string, onProgress func(image.Progress)) error {
+	cfg, err := config.Load(goldenRoot)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	cfg.StateDir = config.ExpandStateDir(cfg.StateDir)
+	stateDir, err := b.stateDir(goldenRoot, cfg)
+	if err != nil {
+		return err
+	}
+
+	var onPluginProgress func(backendplugin.Progress)
+	if onProgress != nil {
+		onPluginProgress = func(p backendplugin.Progress) {
+			percent := p.Percent
+			if percent == 0 && p.BytesTotal > 0 {
+				percent = int(p.Bytes * 100 / p.BytesTotal)
+			} else if percent == 0 && p.FilesTotal > 0 {
+				percent = p.Files * 100 / p.FilesTotal
+			}
+			onProgress(image.Progress{Percent: percent, Phase: p.Phase, Bytes: p.Bytes, BytesTotal: p.BytesTotal})
+		}
+	}
+	err = b.call(ctx, backendplugin.Request{
+		Method:     backendplugin.MethodRefresh,
+		GoldenRoot: goldenRoot,
+		StateDir:   stateDir,
+		Excludes:   excludes,
+		Commit:     commit,
+	}, onPluginProgress)
+	if err != nil {
+		return fmt.Errorf("%s refresh failed: %w", b.Name(), err)
+	}
+	return nil
+}
+
+// stateDir returns the directory reserved for the plugin's state for this
+// golden copy, under the runtime root shared with the image backend.
+func (b execBackend) stateDir(goldenRoot string, cfg *config.Config) (string, error) {
+	runtimeRoot, err := config.EnsureImageRuntimeRoot(goldenRoot, cfg)
+	if err != nil {
+		return "", fmt.Errorf("resolving runtime root: %w", err)
+	}
+	return filepath.Join(runtimeRoot, "plugins", b.name), nil
+}
+
+func (b execBackend) call(ctx context.Context, req backendplugin.Request, onProgress func(backendplugin.Progress)) error {
+	req.Version = backendplugin.Version
+	_, err := backendplugin.Call(ctx, b.executable, req, onProgress, os.Stderr)
+	return err
+}
+
+// destroy asks the plugin to remove a partially created workspace, even once
+// ctx is done. Errors are ignored: the create error is what gets reported.
+func (b execBackend) destroy(ctx context.Context, req backendplugin.Request) {
+	req.Method = backendplugin.MethodDestroy
+	_ = b.call(context.WithoutCancel(ctx), req, nil)
+}
@@ -0,0 +1,182 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/chrisbanes/grove/backendplugin"
+	"github.com/chrisbanes/grove/internal/clone"
+	"github.com/chrisbanes/grove/internal/config"
+)
+
+// scriptPlugin is a minimal plugin: create copies the golden copy, or fails
+// after leaving a partial workspace when PLUGIN_FAIL is set, destroy removes
+// the workspace, and hello reports constant-time creates. Create also saves
+// its request to $PLUGIN_RECORD, and writes more output after its result
+// when PLUGIN_TRAILING is set.
+const scriptPlugin = `#!/bin/sh
+req=$(cat)
+field() { printf '%s' "$req" | sed -n "s/.*\"$1\":\"\([^\"]*\)\".*/\1/p"; }
+case "$req" in
+*'"method":"create"'*)
+	if [ -n "$PLUGIN_FAIL" ]; then
+		mkdir -p "$(field workspace_path)"
+		echo '{"type":"error","error":"no space left"}'
+		exit 1
+	fi
+	if [ -n "$PLUGIN_RECORD" ]; then
+		printf '%s' "$req" > "$PLUGIN_RECORD"
+	fi
+	cp -R "$(field golden_root)" "$(field workspace_path)"
+	echo '{"type":"progress","phase":"clone","files":1,"files_total":2}'
+	echo '{"type":"result"}'
+	if [ -n "$PLUGIN_TRAILING" ]; then
+		head -c 1048576 /dev/zero | tr '\0' '\n'
+	fi
+	;;
+*'"method":"destroy"'*)
+	rm -rf "$(field workspace_path)"
+	echo '{"type":"result"}'
+	;;
+*'"method":"hello"'*)
+	echo '{"type":"result","name":"script","versions":[1],"capabilities":{"constant_time_create":true}}'
+	;;
+*)
+	echo '{"type":"result"}'
+	;;
+esac
+`
+
+func setupExecBackend(t *testing.T) (Backend, string, *config.Config) {
+	t.Helper()
+	binDir := t.TempDir()
+	script := filepath.Join(binDir, "grove-backend-script")
+	if err := os.WriteFile(script, []byte(scriptPlugin), 0755); err != nil {
+		t.Fatal(err)
+	}
+	orig := execLookPath
+	t.Cleanup(func() { execLookPath = orig })
+	execLookPath = func(file string) (string, error) {
+		if file != "grove-backend-script" {
+			return "", errors.New("not found")
+		}
+		return script, nil
+	}
+
+	golden := t.TempDir()
+	os.MkdirAll(filepath.Join(golden, ".grove"), 0755)
+	os.WriteFile(filepath.Join(golden, "main.go"), []byte("package main\n"), 0644)
+	os.Symlink(filepath.Join(golden, "main.go"), filepath.Join(golden, "link"))
+
+	cfg := config.DefaultConfig("test")
+	cfg.WorkspaceDir = filepath.Join(t.TempDir(), "ws")
+	cfg.StateDir = t.TempDir()
+	cfg.CloneBackend = "exec:script"
+
+	b, err := ForName("exec:script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, golden, cfg
+}
+
+func TestExecBackend_CreateAndDestroy(t *testing.T) {
+	b, golden, cfg := setupExecBackend(t)
+
+	var events []clone.ProgressEvent
+	info, err := b.CreateWorkspace(t.Context(), golden, cfg, CreateOptions{
+		BranchForID: "main",
+		OnClone:     func(e clone.ProgressEvent) { events = append(events, e) },
+	})
+	if err != nil {
+		t.Fatalf("CreateWorkspace() error = %v", err)
+	}
+	if len(events) != 1 || events[0].Phase != "clone" || events[0].Copied != 1 || events[0].Total != 2 {
+		t.Errorf("progress events = %+v", events)
+	}
+	if _, err := os.Stat(filepath.Join(info.Path, ".grove", config.WorkspaceFile)); err != nil {
+		t.Errorf("workspace marker missing: %v", err)
+	}
+	target, err := os.Readlink(filepath.Join(info.Path, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(info.Path, "main.go"); target != want {
+		t.Errorf("link -> %q, want it relocated to %q", target, want)
+	}
+
+	if err := b.DestroyWorkspace(t.Context(), golden, cfg, info.ID); err != nil {
+		t.Fatalf("DestroyWorkspace() error = %v", err)
+	}
+	if _, err := os.Stat(info.Path); !os.IsNotExist(err) {
+		t.Errorf("workspace still exists after destroy: %v", err)
+	}
+}
+
+func TestExecBackend_CreateFailureCleansUp(t *testing.T) {
+	b, golden, cfg := setupExecBackend(t)
+	t.Setenv("PLUGIN_FAIL", "1")
+
+	_, err := b.CreateWorkspace(t.Context(), golden, cfg, CreateOptions{BranchForID: "main"})
+	if err == nil || !strings.Contains(err.Error(), "no space left") {
+		t.Fatalf("CreateWorkspace() error = %v, want the plugin's error", err)
+	}
+	entries, _ := os.ReadDir(cfg.WorkspaceDir)
+	if len(entries) != 0 {
+		t.Errorf("expected the partial workspace to be destroyed, found %d entries", len(entries))
+	}
+}
+
+func TestExecBackend_CreateSendsSyncExcludes(t *testing.T) {
+	b, golden, cfg := setupExecBackend(t)
+	cfg.Exclude = []string{"build/"}
+	cfg.StateDir = filepath.Join(golden, ".grove-state")
+	record := filepath.Join(t.TempDir(), "request.json")
+	t.Setenv("PLUGIN_RECORD", record)
+
+	if _, err := b.CreateWorkspace(t.Context(), golden, cfg, CreateOptions{BranchForID: "main"}); err != nil {
+		t.Fatalf("CreateWorkspace() error = %v", err)
+	}
+	data, err := os.ReadFile(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req backendplugin.Request
+	if err := json.Unmarshal(data, &req); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"build/", "/.grove-state/"}; !slices.Equal(req.Excludes, want) {
+		t.Errorf("excludes = %q, want %q, with the in-repo state dir left out", req.Excludes, want)
+	}
+}
+
+func TestExecBackend_ReadsOutputAfterResult(t *testing.T) {
+	b, golden, cfg := setupExecBackend(t)
+	t.Setenv("PLUGIN_TRAILING", "1")
+
+	if _, err := b.CreateWorkspace(t.Context(), golden, cfg, CreateOptions{BranchForID: "main"}); err != nil {
+		t.Fatalf("CreateWorkspace() error = %v", err)
+	}
+}
+
+func TestExecBackend_CapabilitiesFromHello(t *testing.T) {
+	b, golden, _ := setupExecBackend(t)
+
+	caps := b.Capabilities(t.Context(), golden)
+	want := Capabilities{ConstantTimeCreate: true, Available: true}
+	if caps != want {
+		t.Errorf("Capabilities() = %+v, want %+v", caps, want)
+	}
+}
+
+func TestForName_MissingPlugin(t *testing.T) {
+	_, err := ForName("exec:does-not-exist")
+	if err == nil || !strings.Contains(err.Error(), "grove-backend-does-not-exist not found on PATH") {
+		t.Fatalf("ForName() error = %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -25,7 +26,21 @@ func (imageBackend) Name() string {
 	return "image"
 }
 
-func (imageBackend) CreateWorkspace(goldenRoot string, cfg *config.Config, opts CreateOptions) (*workspace.Info, error) {
+func (imageBackend) Capabilities(context.Context, string) Capabilities {
+	caps := Capabilities{
+		ConstantTimeCreate: true,
+		RefreshWhileActive: true,
+		DiskUsage:          true,
+		RefreshesBase:      true,
+	}
+	err := requireOS("image", "darwin")
+	if err == nil {
+		err = requireCommand("hdiutil")
+	}
+	return available(caps, err)
+}
+
+func (imageBackend) CreateWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, opts CreateOptions) (*workspace.Info, error) {
 	runtimeRoot, err := config.EnsureImageRuntimeRoot(goldenRoot, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("resolving image runtime root: %w", err)
@@ -35,32 +50,40 @@ func (imageBackend) CreateWorkspace(goldenRoot string, cfg *config.Config, opts
 		return nil, fmt.Errorf("computing image sync excludes: %w", err)
 	}
 
-	st, _, err := loadOrInitImageState(runtimeRoot, goldenRoot, excludes, nil)
+	st, _, err := loadOrInitImageState(ctx, runtimeRoot, goldenRoot, cfg, excludes, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	existing, err := workspace.List(cfg)
-	if err != nil && !os.IsNotExist(err) {
+	if err := warnShadowsOverCap(runtimeRoot, cfg.ImageShadowMaxGB, opts.OnWarning); err != nil {
 		return nil, err
 	}
-	if len(existing) >= cfg.MaxWorkspaces {
-		return nil, fmt.Errorf("max workspaces (%d) reached — destroy one first", cfg.MaxWorkspaces)
-	}
 
 	id, err := workspace.GenerateID(opts.BranchForID)
 	if err != nil {
 		return nil, fmt.Errorf("generating workspace ID: %w", err)
 	}
+	slot, err := workspace.Reserve(cfg, id)
+	if err != nil {
+		return nil, err
+	}
+	defer slot.Release()
+
 	wsPath := filepath.Join(cfg.WorkspaceDir, id)
 
 	if err := os.MkdirAll(cfg.WorkspaceDir, 0755); err != nil {
 		return nil, fmt.Errorf("creating workspace directory: %w", err)
 	}
 
-	if _, err := image.CreateWorkspace(runtimeRoot, goldenRoot, wsPath, id, st, nil); err != nil {
+	if _, err := image.CreateWorkspace(ctx, runtimeRoot, goldenRoot, wsPath, id, st, nil); err != nil {
 		return nil, fmt.Errorf("image workspace create failed: %w", err)
 	}
+	// The base image is a copy of the golden copy, so its symlinks and
+	// configured files still refer to the golden path.
+	if err := relocate(goldenRoot, wsPath, cfg, excludes, opts.OnRelocateSkip); err != nil {
+		_ = image.DestroyWorkspace(context.WithoutCancel(ctx), runtimeRoot, id, nil)
+		return nil, err
+	}
 
 	info := &workspace.Info{
 		ID:           id,
@@ -71,18 +94,63 @@ func (imageBackend) CreateWorkspace(goldenRoot string, cfg *config.Config, opts
 		Path:         wsPath,
 	}
 	if err := workspace.WriteMarker(wsPath, info); err != nil {
-		_ = image.DestroyWorkspace(runtimeRoot, id, nil)
+		_ = image.DestroyWorkspace(context.WithoutCancel(ctx), runtimeRoot, id, nil)
 		return nil, fmt.Errorf("writing workspace marker: %w", err)
 	}
 
 	return info, nil
 }
 
-func (imageBackend) DestroyWorkspace(goldenRoot string, cfg *config.Config, id string) error {
-	return destroyWorkspace(goldenRoot, cfg, id)
+// warnShadowsOverCap records the shadow sizes and warns about workspaces
+// whose shadow is over maxGB. The cap belongs to those workspaces, so it
+// does not stop another from being created.
+func warnShadowsOverCap(runtimeRoot string, maxGB int, onWarning func(string)) error {
+	if maxGB <= 0 {
+		return nil
+	}
+	_, err := image.CheckShadows(runtimeRoot, maxGB)
+	var capErr *image.ShadowCapError
+	if errors.As(err, &capErr) {
+		if onWarning != nil {
+			onWarning(fmt.Sprintf("workspace %v — destroy it or raise image_shadow_max_gb", capErr))
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("checking shadow sizes: %w", err)
+	}
+	return nil
+}
+
+func (imageBackend) DestroyWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, id string) error {
+	return destroyWorkspace(ctx, goldenRoot, cfg, id)
 }
 
-func (imageBackend) RefreshBase(goldenRoot, commit string, excludes []string, onProgress func(int, string)) error {
+func (imageBackend) RenameWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, id, newID string, onRelocateSkip func(rel string)) (*workspace.Info, error) {
+	runtimeRoot, err := config.EnsureImageRuntimeRoot(goldenRoot, cfg)
+	if err != nil {
+		return nil, err
+	}
+	newPath := filepath.Join(cfg.WorkspaceDir, newID)
+	if _, err := image.LoadWorkspaceMeta(runtimeRoot, id); errors.Is(err, os.ErrNotExist) {
+		// Not an image workspace; rename it like a cp workspace.
+		return renameDir(goldenRoot, cfg, cfg.Exclude, id, newID, onRelocateSkip)
+	}
+	excludes, err := config.BuildImageSyncExcludes(goldenRoot, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("computing image sync excludes: %w", err)
+	}
+	if _, err := image.RenameWorkspace(ctx, runtimeRoot, id, newID, newPath, nil); err != nil {
+		return nil, fmt.Errorf("image workspace rename failed: %w", err)
+	}
+	info, err := workspace.Relabel(newPath, newID)
+	if err != nil {
+		return nil, err
+	}
+	return relocateRenamed(goldenRoot, cfg, excludes, info, id, onRelocateSkip)
+}
+
+func (imageBackend) RefreshBase(ctx context.Context, goldenRoot, commit string, excludes []string, onProgress func(image.Progress)) error {
 	cfg, err := config.Load(goldenRoot)
 	if err != nil {
 		return fmt.Errorf("loading config: %w", err)
@@ -93,7 +161,7 @@ func (imageBackend) RefreshBase(goldenRoot, commit string, excludes []string, on
 		return fmt.Errorf("resolving image runtime root: %w", err)
 	}
 
-	st, initialized, err := loadOrInitImageState(runtimeRoot, goldenRoot, excludes, onProgress)
+	st, initialized, err := loadOrInitImageState(ctx, runtimeRoot, goldenRoot, cfg, excludes, onProgress)
 	if err != nil {
 		return err
 	}
@@ -105,13 +173,17 @@ func (imageBackend) RefreshBase(goldenRoot, commit string, excludes []string, on
 		return nil
 	}
 
-	if _, err := image.RefreshBase(runtimeRoot, goldenRoot, nil, commit, excludes, onProgress); err != nil {
+	syncer, err := image.NewSyncer(cfg.ImageSyncEngine, cfg.ImageSyncChecksum, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := image.RefreshBase(ctx, runtimeRoot, goldenRoot, nil, syncer, commit, cfg.ImageHeadroomGB, excludes, onProgress); err != nil {
 		return fmt.Errorf("image backend refresh failed: %w", err)
 	}
 	return nil
 }
 
-func loadOrInitImageState(runtimeRoot, goldenRoot string, excludes []string, onProgress func(int, string)) (*image.State, bool, error) {
+func loadOrInitImageState(ctx context.Context, runtimeRoot, goldenRoot string, cfg *config.Config, excludes []string, onProgress func(image.Progress)) (*image.State, bool, error) {
 	st, err := imageLoadState(runtimeRoot)
 	if err == nil {
 		return st, false, nil
@@ -120,7 +192,11 @@ func loadOrInitImageState(runtimeRoot, goldenRoot string, excludes []string, onP
 		return nil, false, fmt.Errorf("loading image backend state: %w", err)
 	}
 
-	st, err = imageInitBase(runtimeRoot, goldenRoot, nil, createInitBaseSizeGB, excludes, onProgress)
+	syncer, err := image.NewSyncer(cfg.ImageSyncEngine, cfg.ImageSyncChecksum, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	st, err = imageInitBase(ctx, runtimeRoot, goldenRoot, nil, syncer, createInitBaseSizeGB, cfg.ImageHeadroomGB, excludes, onProgress)
 	if err != nil {
 		return nil, false, fmt.Errorf("initializing image backend: %w", err)
 	}
@@ -1,11 +1,14 @@
 package backend
 
 import (
+	"context"
 	"errors"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/chrisbanes/grove/internal/config"
 	"github.com/chrisbanes/grove/internal/image"
 )
 
@@ -21,14 +24,14 @@ func TestLoadOrInitImageState_UsesExistingState(t *testing.T) {
 	imageLoadState = func(string) (*image.State, error) {
 		return want, nil
 	}
-	imageInitBase = func(string, string, image.Runner, int, []string, func(int, string)) (*image.State, error) {
+	imageInitBase = func(context.Context, string, string, image.Runner, image.Syncer, int, int, []string, func(image.Progress)) (*image.State, error) {
 		t.Fatal("imageInitBase should not be called when state exists")
 		return nil, nil
 	}
 
-	got, initialized, err := loadOrInitImageState("/tmp/runtime", "/tmp/repo", nil, nil)
+	got, initialized, err := loadOrInitImageState(t.Context(), "/tmp/runtime", "/tmp/repo", &config.Config{}, nil, nil)
 	if err != nil {
-		t.Fatalf("loadOrInitImageState() error = %v", err)
+		t.Fatalf("loadOrInitImageState(t.Context(), ) error = %v", err)
 	}
 	if initialized {
 		t.Fatal("expected initialized=false when state exists")
@@ -51,7 +54,7 @@ func TestLoadOrInitImageState_InitializesWhenMissing(t *testing.T) {
 	}
 
 	seenProgress := false
-	imageInitBase = func(runtimeRoot, goldenRoot string, runner image.Runner, sizeGB int, excludes []string, onProgress func(int, string)) (*image.State, error) {
+	imageInitBase = func(_ context.Context, runtimeRoot, goldenRoot string, runner image.Runner, syncer image.Syncer, sizeGB, headroomGB int, excludes []string, onProgress func(image.Progress)) (*image.State, error) {
 		if runtimeRoot != "/tmp/runtime" {
 			t.Fatalf("unexpected runtime root: %s", runtimeRoot)
 		}
@@ -61,23 +64,30 @@ func TestLoadOrInitImageState_InitializesWhenMissing(t *testing.T) {
 		if runner != nil {
 			t.Fatal("expected nil runner")
 		}
+		if syncer != (image.RsyncSyncer{}) {
+			t.Fatalf("expected the configured rsync syncer, got %#v", syncer)
+		}
 		if sizeGB != createInitBaseSizeGB {
 			t.Fatalf("expected size %d, got %d", createInitBaseSizeGB, sizeGB)
 		}
+		if headroomGB != 30 {
+			t.Fatalf("expected headroom 30, got %d", headroomGB)
+		}
 		if len(excludes) != 1 || excludes[0] != "node_modules" {
 			t.Fatalf("unexpected excludes: %v", excludes)
 		}
 		if onProgress == nil {
 			t.Fatal("expected progress callback to be forwarded")
 		}
-		onProgress(10, "creating")
+		onProgress(image.Progress{Percent: 10, Phase: "creating"})
 		return &image.State{Backend: "image", BasePath: "/tmp/base.sparsebundle", BaseGeneration: 1}, nil
 	}
 
-	onProgress := func(int, string) { seenProgress = true }
-	got, initialized, err := loadOrInitImageState("/tmp/runtime", "/tmp/repo", []string{"node_modules"}, onProgress)
+	onProgress := func(image.Progress) { seenProgress = true }
+	cfg := &config.Config{ImageHeadroomGB: 30, ImageSyncEngine: image.SyncEngineRsync}
+	got, initialized, err := loadOrInitImageState(t.Context(), "/tmp/runtime", "/tmp/repo", cfg, []string{"node_modules"}, onProgress)
 	if err != nil {
-		t.Fatalf("loadOrInitImageState() error = %v", err)
+		t.Fatalf("loadOrInitImageState(t.Context(), ) error = %v", err)
 	}
 	if !initialized {
 		t.Fatal("expected initialized=true when state is missing")
@@ -101,12 +111,12 @@ func TestLoadOrInitImageState_PropagatesLoadError(t *testing.T) {
 	imageLoadState = func(string) (*image.State, error) {
 		return nil, image.ErrInitIncomplete
 	}
-	imageInitBase = func(string, string, image.Runner, int, []string, func(int, string)) (*image.State, error) {
+	imageInitBase = func(context.Context, string, string, image.Runner, image.Syncer, int, int, []string, func(image.Progress)) (*image.State, error) {
 		t.Fatal("imageInitBase should not be called on non-ENOENT load errors")
 		return nil, nil
 	}
 
-	_, _, err := loadOrInitImageState("/tmp/runtime", "/tmp/repo", nil, nil)
+	_, _, err := loadOrInitImageState(t.Context(), "/tmp/runtime", "/tmp/repo", &config.Config{}, nil, nil)
 	if err == nil {
 		t.Fatal("expected error")
 	}
@@ -126,11 +136,11 @@ func TestLoadOrInitImageState_PropagatesInitError(t *testing.T) {
 	imageLoadState = func(string) (*image.State, error) {
 		return nil, os.ErrNotExist
 	}
-	imageInitBase = func(string, string, image.Runner, int, []string, func(int, string)) (*image.State, error) {
+	imageInitBase = func(context.Context, string, string, image.Runner, image.Syncer, int, int, []string, func(image.Progress)) (*image.State, error) {
 		return nil, errors.New("hdiutil failed")
 	}
 
-	_, _, err := loadOrInitImageState("/tmp/runtime", "/tmp/repo", nil, nil)
+	_, _, err := loadOrInitImageState(t.Context(), "/tmp/runtime", "/tmp/repo", &config.Config{}, nil, nil)
 	if err == nil {
 		t.Fatal("expected error")
 	}
@@ -138,3 +148,49 @@ func TestLoadOrInitImageState_PropagatesInitError(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestImageBackend_UnavailableOffMacOS(t *testing.T) {
+	orig := hostGOOS
+	t.Cleanup(func() { hostGOOS = orig })
+	hostGOOS = "linux"
+
+	caps := imageBackend{}.Capabilities(t.Context(), t.TempDir())
+	if caps.Available || !strings.Contains(caps.Reason, "requires macOS") {
+		t.Errorf("Capabilities() = %+v, want unavailable off macOS", caps)
+	}
+	if !caps.RefreshesBase || !caps.RefreshWhileActive {
+		t.Errorf("Capabilities() = %+v, want a base that refreshes while active", caps)
+	}
+}
+
+func TestWarnShadowsOverCap_WarnsWithoutRefusing(t *testing.T) {
+	runtimeRoot := t.TempDir()
+	// A sparse shadow that reports 2 GB without using the disk.
+	shadow := filepath.Join(runtimeRoot, "shadows", "main-a1b2.shadow")
+	os.MkdirAll(filepath.Dir(shadow), 0755)
+	f, err := os.Create(shadow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Truncate(2 << 30)
+	f.Close()
+	if err := image.SaveWorkspaceMeta(runtimeRoot, &image.WorkspaceMeta{ID: "main-a1b2", ShadowPath: shadow}); err != nil {
+		t.Fatal(err)
+	}
+
+	var warnings []string
+	if err := warnShadowsOverCap(runtimeRoot, 1, func(msg string) { warnings = append(warnings, msg) }); err != nil {
+		t.Fatalf("warnShadowsOverCap() error = %v, want only a warning", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "main-a1b2 (2.0 GB)") {
+		t.Errorf("warnings = %q, want one naming the workspace over the cap", warnings)
+	}
+
+	warnings = nil
+	if err := warnShadowsOverCap(runtimeRoot, 3, func(msg string) { warnings = append(warnings, msg) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings = %q, want none under the cap", warnings)
+	}
+}
@@ -0,0 +1,221 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chrisbanes/grove/internal/config"
+	"github.com/chrisbanes/grove/internal/image"
+	"github.com/chrisbanes/grove/internal/overlay"
+	"github.com/chrisbanes/grove/internal/workspace"
+)
+
+type overlayBackend struct{}
+
+var (
+	overlayLoadState   = overlay.LoadState
+	overlayRefreshBase = overlay.RefreshBase
+	overlayRunner      overlay.Runner
+)
+
+func (overlayBackend) Name() string {
+	return "overlay"
+}
+
+func (overlayBackend) Capabilities(context.Context, string) Capabilities {
+	caps := Capabilities{
+		RefreshWhileActive: true,
+		ConstantTimeCreate: true,
+		RefreshesBase:      true,
+	}
+	err := requireOverlaySupport()
+	if err == nil && os.Geteuid() != 0 && requireCommand("unshare") != nil {
+		// Without root, overlays are mounted in a user namespace, or
+		// failing that with FUSE.
+		err = requireCommand("fuse-overlayfs")
+	}
+	return available(caps, err)
+}
+
+func (overlayBackend) CreateWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, opts CreateOptions) (*workspace.Info, error) {
+	if err := requireOverlaySupport(); err != nil {
+		return nil, err
+	}
+	runtimeRoot, err := config.EnsureImageRuntimeRoot(goldenRoot, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("resolving runtime root: %w", err)
+	}
+
+	excludes, err := config.BuildImageSyncExcludes(goldenRoot, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("computing overlay sync excludes: %w", err)
+	}
+	st, err := loadOrInitOverlayState(ctx, runtimeRoot, goldenRoot, cfg, opts.GoldenCommit, excludes)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := workspace.GenerateID(opts.BranchForID)
+	if err != nil {
+		return nil, fmt.Errorf("generating workspace ID: %w", err)
+	}
+	slot, err := workspace.Reserve(cfg, id)
+	if err != nil {
+		return nil, err
+	}
+	defer slot.Release()
+
+	wsPath := filepath.Join(cfg.WorkspaceDir, id)
+
+	if err := os.MkdirAll(cfg.WorkspaceDir, 0755); err != nil {
+		return nil, fmt.Errorf("creating workspace directory: %w", err)
+	}
+
+	if _, err := overlay.CreateWorkspace(ctx, runtimeRoot, wsPath, id, st, overlayRunner); err != nil {
+		return nil, fmt.Errorf("overlay workspace create failed: %w", err)
+	}
+	// The lower layer is a copy of the golden copy, so its symlinks and
+	// configured files still refer to the golden path.
+	if err := relocate(goldenRoot, wsPath, cfg, excludes, opts.OnRelocateSkip); err != nil {
+		_ = overlay.DestroyWorkspace(context.WithoutCancel(ctx), runtimeRoot, id, overlayRunner)
+		return nil, err
+	}
+
+	info := &workspace.Info{
+		ID:           id,
+		GoldenCopy:   goldenRoot,
+		GoldenCommit: opts.GoldenCommit,
+		CreatedAt:    time.Now().UTC(),
+		Branch:       opts.Branch,
+		Path:         wsPath,
+	}
+	if err := os.MkdirAll(filepath.Join(wsPath, config.GroveDirName), 0755); err != nil {
+		_ = overlay.DestroyWorkspace(context.WithoutCancel(ctx), runtimeRoot, id, overlayRunner)
+		return nil, fmt.Errorf("writing workspace marker: %w", err)
+	}
+	if err := workspace.WriteMarker(wsPath, info); err != nil {
+		_ = overlay.DestroyWorkspace(context.WithoutCancel(ctx), runtimeRoot, id, overlayRunner)
+		return nil, fmt.Errorf("writing workspace marker: %w", err)
+	}
+
+	return info, nil
+}
+
+// loadOrInitOverlayState loads the backend state, setting up the first
+// lower layer if there is none yet.
+func loadOrInitOverlayState(ctx context.Context, runtimeRoot, goldenRoot string, cfg *config.Config, commit string, excludes []string) (*overlay.State, error) {
+	st, err := overlayLoadState(runtimeRoot)
+	if err == nil {
+		return st, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("loading overlay backend state: %w", err)
+	}
+
+	lock, err := lockBase(runtimeRoot)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+	// Another create may have set it up while this one waited.
+	st, err = overlayLoadState(runtimeRoot)
+	if err == nil {
+		return st, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("loading overlay backend state: %w", err)
+	}
+
+	syncer, err := image.NewSyncer(cfg.ImageSyncEngine, cfg.ImageSyncChecksum, nil)
+	if err != nil {
+		return nil, err
+	}
+	st, err = overlayRefreshBase(ctx, runtimeRoot, goldenRoot, syncer, commit, excludes, nil)
+	if err != nil {
+		return nil, fmt.Errorf("initializing overlay backend: %w", err)
+	}
+	return st, nil
+}
+
+func (overlayBackend) DestroyWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, id string) error {
+	runtimeRoot, err := config.EnsureImageRuntimeRoot(goldenRoot, cfg)
+	if err != nil {
+		return err
+	}
+	// The marker is only visible while the workspace is mounted, so an
+	// unmounted workspace is found by its metadata alone.
+	wsID := id
+	if info, err := workspace.Get(cfg, id); err == nil {
+		wsID = info.ID
+	}
+	err = overlay.DestroyWorkspace(ctx, runtimeRoot, wsID, overlayRunner)
+	if errors.Is(err, os.ErrNotExist) {
+		// Not an overlay; remove it like a cp workspace.
+		return workspace.Destroy(cfg, id)
+	}
+	if err != nil {
+		return fmt.Errorf("overlay workspace destroy failed: %w", err)
+	}
+	return nil
+}
+
+func (overlayBackend) RenameWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, id, newID string, onRelocateSkip func(rel string)) (*workspace.Info, error) {
+	runtimeRoot, err := config.EnsureImageRuntimeRoot(goldenRoot, cfg)
+	if err != nil {
+		return nil, err
+	}
+	newPath := filepath.Join(cfg.WorkspaceDir, newID)
+	if _, err := overlay.LoadWorkspaceMeta(runtimeRoot, id); errors.Is(err, os.ErrNotExist) {
+		// Not an overlay; rename it like a cp workspace.
+		return renameDir(goldenRoot, cfg, cfg.Exclude, id, newID, onRelocateSkip)
+	}
+	excludes, err := config.BuildImageSyncExcludes(goldenRoot, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("computing overlay sync excludes: %w", err)
+	}
+	if _, err := overlay.RenameWorkspace(ctx, runtimeRoot, id, newID, newPath, overlayRunner); err != nil {
+		return nil, fmt.Errorf("overlay workspace rename failed: %w", err)
+	}
+	info, err := workspace.Relabel(newPath, newID)
+	if err != nil {
+		return nil, err
+	}
+	return relocateRenamed(goldenRoot, cfg, excludes, info, id, onRelocateSkip)
+}
+
+func (overlayBackend) RefreshBase(ctx context.Context, goldenRoot, commit string, excludes []string, onProgress func(image.Progress)) error {
+	if err := requireOverlaySupport(); err != nil {
+		return err
+	}
+	cfg, err := config.Load(goldenRoot)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	cfg.StateDir = config.ExpandStateDir(cfg.StateDir)
+	runtimeRoot, err := config.EnsureImageRuntimeRoot(goldenRoot, cfg)
+	if err != nil {
+		return fmt.Errorf("resolving runtime root: %w", err)
+	}
+
+	syncer, err := image.NewSyncer(cfg.ImageSyncEngine, cfg.ImageSyncChecksum, nil)
+	if err != nil {
+		return err
+	}
+	lock, err := lockBase(runtimeRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	if _, err := overlayRefreshBase(ctx, runtimeRoot, goldenRoot, syncer, commit, excludes, onProgress); err != nil {
+		return fmt.Errorf("overlay backend refresh failed: %w", err)
+	}
+	return nil
+}
+
+func requireOverlaySupport() error {
+	return requireOS("overlay", "linux")
+}
@@ -0,0 +1,142 @@
+package backend
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chrisbanes/grove/internal/config"
+	"github.com/chrisbanes/grove/internal/image"
+	"github.com/chrisbanes/grove/internal/overlay"
+)
+
+// bindRunner stands in for an overlay mount by copying the lower layer to
+// the mountpoint.
+type bindRunner struct {
+	commands []string
+}
+
+func (r *bindRunner) CombinedOutput(_ context.Context, name string, args ...string) ([]byte, error) {
+	r.commands = append(r.commands, name+" "+strings.Join(args, " "))
+	if name == "fuse-overlayfs" || name == "mount" {
+		opts := args[len(args)-2]
+		lower := strings.TrimPrefix(strings.Split(opts, ",")[0], "lowerdir=")
+		mountpoint := args[len(args)-1]
+		if err := os.Remove(mountpoint); err != nil {
+			return nil, err
+		}
+		return nil, os.CopyFS(mountpoint, os.DirFS(lower))
+	}
+	return nil, nil
+}
+
+func TestOverlayBackend_CreateAndDestroy(t *testing.T) {
+	r := &bindRunner{}
+	origRunner, origRefresh := overlayRunner, overlayRefreshBase
+	t.Cleanup(func() { overlayRunner, overlayRefreshBase = origRunner, origRefresh })
+	overlayRunner = r
+
+	golden := t.TempDir()
+	os.MkdirAll(filepath.Join(golden, ".grove"), 0755)
+	os.WriteFile(filepath.Join(golden, "main.go"), []byte("package main\n"), 0644)
+
+	var refreshed []string
+	overlayRefreshBase = func(ctx context.Context, runtimeRoot, goldenRoot string, syncer image.Syncer, commit string, excludes []string, onProgress func(image.Progress)) (*overlay.State, error) {
+		if syncer != (image.RsyncSyncer{}) {
+			t.Errorf("expected the configured rsync syncer, got %#v", syncer)
+		}
+		refreshed = append(refreshed, commit)
+		lower := filepath.Join(runtimeRoot, "lower")
+		if err := os.CopyFS(lower, os.DirFS(goldenRoot)); err != nil {
+			return nil, err
+		}
+		st := &overlay.State{Backend: "overlay", BasePath: lower, BaseGeneration: 1, LastSyncCommit: commit}
+		return st, overlay.SaveState(runtimeRoot, st)
+	}
+
+	cfg := config.DefaultConfig("test")
+	cfg.WorkspaceDir = filepath.Join(t.TempDir(), "ws")
+	cfg.StateDir = t.TempDir()
+	cfg.CloneBackend = "overlay"
+	cfg.ImageSyncEngine = "rsync"
+
+	b, err := ForName("overlay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := b.CreateWorkspace(t.Context(), golden, cfg, CreateOptions{BranchForID: "main", GoldenCommit: "aaa"})
+	if err != nil {
+		t.Fatalf("CreateWorkspace() error = %v", err)
+	}
+	if _, err := b.CreateWorkspace(t.Context(), golden, cfg, CreateOptions{BranchForID: "main", GoldenCommit: "bbb"}); err != nil {
+		t.Fatalf("second CreateWorkspace() error = %v", err)
+	}
+	if !slices.Equal(refreshed, []string{"aaa"}) {
+		t.Errorf("refreshed for %q, want only the first create to set up the base", refreshed)
+	}
+	if _, err := os.Stat(filepath.Join(info.Path, "main.go")); err != nil {
+		t.Errorf("workspace is missing main.go: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(info.Path, ".grove", config.WorkspaceFile)); err != nil {
+		t.Errorf("workspace marker missing: %v", err)
+	}
+
+	// The fake mount is not in /proc/self/mountinfo, so destroy sees the
+	// workspace as unmounted, e.g. after a reboot, which only leaves the
+	// empty mountpoint.
+	os.RemoveAll(info.Path)
+	os.Mkdir(info.Path, 0755)
+	if err := b.DestroyWorkspace(t.Context(), golden, cfg, info.ID); err != nil {
+		t.Fatalf("DestroyWorkspace() error = %v", err)
+	}
+	if _, err := os.Stat(info.Path); !os.IsNotExist(err) {
+		t.Errorf("workspace still exists after destroy: %v", err)
+	}
+}
+
+func TestOverlayBackend_RequiresLinux(t *testing.T) {
+	orig := hostGOOS
+	t.Cleanup(func() { hostGOOS = orig })
+	hostGOOS = "darwin"
+
+	err := overlayBackend{}.RefreshBase(t.Context(), t.TempDir(), "", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "requires Linux") {
+		t.Fatalf("RefreshBase() error = %v", err)
+	}
+}
+
+func TestLoadOrInitOverlayState_ConcurrentFirstCreatesSetUpOnce(t *testing.T) {
+	orig := overlayRefreshBase
+	t.Cleanup(func() { overlayRefreshBase = orig })
+	var refreshes atomic.Int32
+	overlayRefreshBase = func(_ context.Context, runtimeRoot, _ string, _ image.Syncer, commit string, _ []string, _ func(image.Progress)) (*overlay.State, error) {
+		refreshes.Add(1)
+		// Long enough for the other create to find no state.
+		time.Sleep(50 * time.Millisecond)
+		st := &overlay.State{Backend: "overlay", BasePath: filepath.Join(runtimeRoot, "lower"), BaseGeneration: 1, LastSyncCommit: commit}
+		return st, overlay.SaveState(runtimeRoot, st)
+	}
+
+	runtimeRoot := t.TempDir()
+	cfg := config.DefaultConfig("test")
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := loadOrInitOverlayState(t.Context(), runtimeRoot, t.TempDir(), cfg, "aaa", nil); err != nil {
+				t.Errorf("loadOrInitOverlayState() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := refreshes.Load(); n != 1 {
+		t.Errorf("set up the base %d times, want once", n)
+	}
+}
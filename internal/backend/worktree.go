@@ -0,0 +1,161 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chrisbanes/grove/internal/clone"
+	"github.com/chrisbanes/grove/internal/config"
+	"github.com/chrisbanes/grove/internal/git"
+	"github.com/chrisbanes/grove/internal/image"
+	"github.com/chrisbanes/grove/internal/workspace"
+)
+
+// worktreeBackend checks out the tracked tree with git worktree, sharing the
+// golden copy's objects, then clones only the files git ignores, such as
+// build outputs and caches, into place.
+type worktreeBackend struct{}
+
+var worktreeCloner = clone.NewCloner
+
+func (worktreeBackend) Name() string {
+	return "worktree"
+}
+
+func (worktreeBackend) Capabilities(_ context.Context, goldenRoot string) Capabilities {
+	err := requireCommand("git")
+	if err == nil && !git.IsRepo(goldenRoot) {
+		err = fmt.Errorf("%s is not a git repository", goldenRoot)
+	}
+	if err == nil {
+		_, err = worktreeCloner(goldenRoot)
+	}
+	return available(Capabilities{RefreshWhileActive: true}, err)
+}
+
+func (worktreeBackend) CreateWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, opts CreateOptions) (*workspace.Info, error) {
+	cloner, err := worktreeCloner(goldenRoot)
+	if err != nil {
+		return nil, err
+	}
+	ignored, err := git.IgnoredPaths(ctx, goldenRoot)
+	if err != nil {
+		return nil, fmt.Errorf("listing ignored files: %w", err)
+	}
+	// The worktree is checked out at HEAD, so uncommitted changes are
+	// brought over like ignored files.
+	var changed []string
+	if opts.Dirty {
+		if changed, err = git.ChangedPaths(ctx, goldenRoot); err != nil {
+			return nil, fmt.Errorf("listing uncommitted changes: %w", err)
+		}
+	}
+	excludes, err := config.BuildImageSyncExcludes(goldenRoot, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("computing worktree excludes: %w", err)
+	}
+
+	id, err := workspace.GenerateID(opts.BranchForID)
+	if err != nil {
+		return nil, fmt.Errorf("generating workspace ID: %w", err)
+	}
+	slot, err := workspace.Reserve(cfg, id)
+	if err != nil {
+		return nil, err
+	}
+	defer slot.Release()
+
+	wsPath := filepath.Join(cfg.WorkspaceDir, id)
+
+	if err := os.MkdirAll(cfg.WorkspaceDir, 0755); err != nil {
+		return nil, fmt.Errorf("creating workspace directory: %w", err)
+	}
+
+	if err := git.AddWorktree(ctx, goldenRoot, wsPath, "HEAD"); err != nil {
+		return nil, fmt.Errorf("worktree create failed: %w", err)
+	}
+	// Clear the committed versions of changed files; those the golden
+	// copy deleted stay deleted.
+	for _, rel := range changed {
+		if err := os.RemoveAll(filepath.Join(wsPath, filepath.FromSlash(rel))); err != nil {
+			_ = git.RemoveWorktree(context.WithoutCancel(ctx), goldenRoot, wsPath)
+			return nil, fmt.Errorf("bringing over uncommitted changes: %w", err)
+		}
+	}
+	cloneOpts := clone.Options{
+		Excludes:    excludes,
+		Concurrency: cfg.CloneConcurrency,
+		OnProgress:  opts.OnClone,
+		CacheDir:    config.PlanCacheDir(cfg),
+	}
+	if err := clone.ClonePaths(ctx, cloner, goldenRoot, wsPath, append(ignored, changed...), cloneOpts); err != nil {
+		_ = git.RemoveWorktree(context.WithoutCancel(ctx), goldenRoot, wsPath)
+		return nil, fmt.Errorf("cloning ignored and changed files: %w", err)
+	}
+	if err := relocate(goldenRoot, wsPath, cfg, excludes, opts.OnRelocateSkip); err != nil {
+		_ = git.RemoveWorktree(context.WithoutCancel(ctx), goldenRoot, wsPath)
+		return nil, err
+	}
+
+	info := &workspace.Info{
+		ID:           id,
+		GoldenCopy:   goldenRoot,
+		GoldenCommit: opts.GoldenCommit,
+		CreatedAt:    time.Now().UTC(),
+		Branch:       opts.Branch,
+		Path:         wsPath,
+	}
+	// .grove is only checked out if the golden copy commits it.
+	if err := os.MkdirAll(filepath.Join(wsPath, config.GroveDirName), 0755); err != nil {
+		_ = git.RemoveWorktree(context.WithoutCancel(ctx), goldenRoot, wsPath)
+		return nil, fmt.Errorf("writing workspace marker: %w", err)
+	}
+	if err := workspace.WriteMarker(wsPath, info); err != nil {
+		_ = git.RemoveWorktree(context.WithoutCancel(ctx), goldenRoot, wsPath)
+		return nil, fmt.Errorf("writing workspace marker: %w", err)
+	}
+
+	return info, nil
+}
+
+func (worktreeBackend) DestroyWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, id string) error {
+	info, err := workspace.Get(cfg, id)
+	if err != nil {
+		return err
+	}
+	if err := git.RemoveWorktree(ctx, goldenRoot, info.Path); err == nil {
+		return nil
+	}
+	// Not a worktree of the golden copy, e.g. one created before switching
+	// backends. Remove it like a cp workspace and forget it if it was.
+	if err := destroyWorkspace(ctx, goldenRoot, cfg, id); err != nil {
+		return err
+	}
+	return git.PruneWorktrees(ctx, goldenRoot)
+}
+
+func (worktreeBackend) RenameWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, id, newID string, onRelocateSkip func(rel string)) (*workspace.Info, error) {
+	info, err := workspace.Get(cfg, id)
+	if err != nil {
+		return nil, err
+	}
+	excludes, err := config.BuildImageSyncExcludes(goldenRoot, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("computing worktree excludes: %w", err)
+	}
+	newPath := filepath.Join(cfg.WorkspaceDir, newID)
+	if err := git.MoveWorktree(ctx, goldenRoot, info.Path, newPath); err != nil {
+		return nil, err
+	}
+	if info, err = workspace.Relabel(newPath, newID); err != nil {
+		return nil, err
+	}
+	return relocateRenamed(goldenRoot, cfg, excludes, info, id, onRelocateSkip)
+}
+
+func (worktreeBackend) RefreshBase(_ context.Context, _ string, _ string, _ []string, _ func(image.Progress)) error {
+	return nil
+}
@@ -0,0 +1,205 @@
+package backend
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chrisbanes/grove/internal/clone"
+	"github.com/chrisbanes/grove/internal/config"
+)
+
+func gitRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("build/\n.grove/\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644)
+	for _, args := range [][]string{
+		{"init"},
+		{"config", "user.email", "test@test.com"},
+		{"config", "user.name", "Test"},
+		{"add", "."},
+		{"commit", "-m", "init"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	return dir
+}
+
+func TestWorktreeBackend_CreateAndDestroy(t *testing.T) {
+	orig := worktreeCloner
+	t.Cleanup(func() { worktreeCloner = orig })
+	worktreeCloner = func(root string) (clone.Cloner, error) {
+		return &clone.CopyCloner{Root: root}, nil
+	}
+
+	golden := gitRepo(t)
+	os.MkdirAll(filepath.Join(golden, "build", "cache"), 0755)
+	os.WriteFile(filepath.Join(golden, "build", "out.o"), []byte("compiled"), 0644)
+	os.WriteFile(filepath.Join(golden, "build", "cache", "entry"), []byte("cache"), 0644)
+	os.MkdirAll(filepath.Join(golden, ".grove", "hooks"), 0755)
+	os.WriteFile(filepath.Join(golden, ".grove", "hooks", "post-clone"), []byte("#!/bin/sh\n"), 0755)
+
+	cfg := config.DefaultConfig("test")
+	cfg.WorkspaceDir = filepath.Join(t.TempDir(), "ws")
+	cfg.StateDir = t.TempDir()
+	cfg.CloneBackend = "worktree"
+	cfg.Exclude = []string{"build/cache/"}
+
+	b, err := ForName("worktree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := b.CreateWorkspace(t.Context(), golden, cfg, CreateOptions{BranchForID: "main"})
+	if err != nil {
+		t.Fatalf("CreateWorkspace() error = %v", err)
+	}
+
+	for _, rel := range []string{"main.go", "build/out.o", ".grove/hooks/post-clone", ".grove/" + config.WorkspaceFile} {
+		if _, err := os.Stat(filepath.Join(info.Path, rel)); err != nil {
+			t.Errorf("workspace is missing %s: %v", rel, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(info.Path, "build", "cache")); !os.IsNotExist(err) {
+		t.Errorf("excluded build/cache was cloned: %v", err)
+	}
+	if fi, err := os.Lstat(filepath.Join(info.Path, ".git")); err != nil || fi.IsDir() {
+		t.Errorf("workspace .git should be a worktree link file: %v", err)
+	}
+	list, _ := exec.Command("git", "-C", golden, "worktree", "list").Output()
+	if !strings.Contains(string(list), info.Path) {
+		t.Errorf("golden copy does not list the workspace as a worktree:\n%s", list)
+	}
+
+	if err := b.DestroyWorkspace(t.Context(), golden, cfg, info.ID); err != nil {
+		t.Fatalf("DestroyWorkspace() error = %v", err)
+	}
+	if _, err := os.Stat(info.Path); !os.IsNotExist(err) {
+		t.Errorf("workspace still exists after destroy: %v", err)
+	}
+	list, _ = exec.Command("git", "-C", golden, "worktree", "list").Output()
+	if strings.Contains(string(list), info.Path) {
+		t.Errorf("worktree still registered after destroy:\n%s", list)
+	}
+}
+
+func TestWorktreeBackend_RenameRelocates(t *testing.T) {
+	orig := worktreeCloner
+	t.Cleanup(func() { worktreeCloner = orig })
+	worktreeCloner = func(root string) (clone.Cloner, error) {
+		return &clone.CopyCloner{Root: root}, nil
+	}
+
+	golden := gitRepo(t)
+	os.MkdirAll(filepath.Join(golden, "build"), 0755)
+	os.Symlink(filepath.Join(golden, "main.go"), filepath.Join(golden, "build", "main.go"))
+
+	cfg := config.DefaultConfig("test")
+	cfg.WorkspaceDir = filepath.Join(t.TempDir(), "ws")
+	cfg.StateDir = t.TempDir()
+	cfg.CloneBackend = "worktree"
+
+	b := worktreeBackend{}
+	info, err := b.CreateWorkspace(t.Context(), golden, cfg, CreateOptions{BranchForID: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed, err := b.RenameWorkspace(t.Context(), golden, cfg, info.ID, "feature-1234", nil)
+	if err != nil {
+		t.Fatalf("RenameWorkspace() error = %v", err)
+	}
+	newPath := filepath.Join(cfg.WorkspaceDir, "feature-1234")
+	if renamed.ID != "feature-1234" || renamed.Path != newPath {
+		t.Errorf("RenameWorkspace() = %s at %s", renamed.ID, renamed.Path)
+	}
+	if target, err := os.Readlink(filepath.Join(newPath, "build", "main.go")); err != nil || target != filepath.Join(newPath, "main.go") {
+		t.Errorf("symlink points to %q (%v), want it relocated to the new path", target, err)
+	}
+	if out, err := exec.Command("git", "-C", golden, "worktree", "list").CombinedOutput(); err != nil || !strings.Contains(string(out), newPath) {
+		t.Errorf("git does not know the worktree moved: %v\n%s", err, out)
+	}
+
+	if err := b.DestroyWorkspace(t.Context(), golden, cfg, "feature-1234"); err != nil {
+		t.Fatalf("DestroyWorkspace() error = %v", err)
+	}
+}
+
+func TestWorktreeBackend_ExcludesWorkspaceDirInGoldenCopy(t *testing.T) {
+	orig := worktreeCloner
+	t.Cleanup(func() { worktreeCloner = orig })
+	worktreeCloner = func(root string) (clone.Cloner, error) {
+		return &clone.CopyCloner{Root: root}, nil
+	}
+
+	golden := gitRepo(t)
+	os.MkdirAll(filepath.Join(golden, "build"), 0755)
+	os.WriteFile(filepath.Join(golden, "build", "out.o"), []byte("compiled"), 0644)
+
+	cfg := config.DefaultConfig("test")
+	cfg.WorkspaceDir = filepath.Join(golden, "build", "workspaces")
+	cfg.StateDir = t.TempDir()
+	cfg.CloneBackend = "worktree"
+
+	b := worktreeBackend{}
+	first, err := b.CreateWorkspace(t.Context(), golden, cfg, CreateOptions{BranchForID: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := b.CreateWorkspace(t.Context(), golden, cfg, CreateOptions{BranchForID: "main"})
+	if err != nil {
+		t.Fatalf("CreateWorkspace() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(second.Path, "build", "out.o")); err != nil {
+		t.Errorf("workspace is missing build/out.o: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(second.Path, "build", "workspaces")); !os.IsNotExist(err) {
+		t.Errorf("workspace dir was cloned into the workspace: %v", err)
+	}
+
+	for _, info := range []string{first.ID, second.ID} {
+		if err := b.DestroyWorkspace(t.Context(), golden, cfg, info); err != nil {
+			t.Fatalf("DestroyWorkspace() error = %v", err)
+		}
+	}
+}
+
+func TestWorktreeBackend_BringsOverUncommittedChanges(t *testing.T) {
+	orig := worktreeCloner
+	t.Cleanup(func() { worktreeCloner = orig })
+	worktreeCloner = func(root string) (clone.Cloner, error) {
+		return &clone.CopyCloner{Root: root}, nil
+	}
+
+	golden := gitRepo(t)
+	os.WriteFile(filepath.Join(golden, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+	os.Remove(filepath.Join(golden, ".gitignore"))
+	os.WriteFile(filepath.Join(golden, "notes.txt"), []byte("untracked"), 0644)
+
+	cfg := config.DefaultConfig("test")
+	cfg.WorkspaceDir = filepath.Join(t.TempDir(), "ws")
+	cfg.StateDir = t.TempDir()
+	cfg.CloneBackend = "worktree"
+
+	b := worktreeBackend{}
+	info, err := b.CreateWorkspace(t.Context(), golden, cfg, CreateOptions{BranchForID: "main", Dirty: true})
+	if err != nil {
+		t.Fatalf("CreateWorkspace() error = %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(info.Path, "main.go")); string(data) != "package main\n\nfunc main() {}\n" {
+		t.Errorf("main.go = %q, want the uncommitted change", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(info.Path, "notes.txt")); string(data) != "untracked" {
+		t.Errorf("notes.txt = %q, want the untracked file", data)
+	}
+	if _, err := os.Lstat(filepath.Join(info.Path, ".gitignore")); !os.IsNotExist(err) {
+		t.Errorf(".gitignore deleted in the golden copy exists in the workspace: %v", err)
+	}
+
+	if err := b.DestroyWorkspace(t.Context(), golden, cfg, info.ID); err != nil {
+		t.Fatalf("DestroyWorkspace() error = %v", err)
+	}
+}
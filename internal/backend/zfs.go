@@ -0,0 +1,202 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chrisbanes/grove/internal/config"
+	"github.com/chrisbanes/grove/internal/image"
+	"github.com/chrisbanes/grove/internal/workspace"
+	"github.com/chrisbanes/grove/internal/zfs"
+)
+
+type zfsBackend struct{}
+
+var (
+	zfsLoadState   = zfs.LoadState
+	zfsRefreshBase = zfs.RefreshBase
+	zfsRunner      zfs.Runner
+)
+
+func (zfsBackend) Name() string {
+	return "zfs"
+}
+
+func (zfsBackend) Capabilities(ctx context.Context, goldenRoot string) Capabilities {
+	caps := Capabilities{
+		RefreshWhileActive: true,
+		ConstantTimeCreate: true,
+		RefreshesBase:      true,
+	}
+	err := requireCommand("zfs")
+	if err == nil {
+		if _, datasetErr := zfs.DatasetAt(ctx, zfsRunner, goldenRoot); datasetErr != nil {
+			err = fmt.Errorf("golden copy is not a ZFS dataset: %w", datasetErr)
+		}
+	}
+	return available(caps, err)
+}
+
+func (zfsBackend) CreateWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, opts CreateOptions) (*workspace.Info, error) {
+	runtimeRoot, err := config.EnsureImageRuntimeRoot(goldenRoot, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("resolving runtime root: %w", err)
+	}
+	excludes, err := config.BuildImageSyncExcludes(goldenRoot, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("computing zfs excludes: %w", err)
+	}
+
+	id, err := workspace.GenerateID(opts.BranchForID)
+	if err != nil {
+		return nil, fmt.Errorf("generating workspace ID: %w", err)
+	}
+	slot, err := workspace.Reserve(cfg, id)
+	if err != nil {
+		return nil, err
+	}
+	defer slot.Release()
+
+	wsPath := filepath.Join(cfg.WorkspaceDir, id)
+
+	if err := os.MkdirAll(cfg.WorkspaceDir, 0755); err != nil {
+		return nil, fmt.Errorf("creating workspace directory: %w", err)
+	}
+
+	if err := cloneZFSWorkspace(ctx, runtimeRoot, goldenRoot, wsPath, id, opts, excludes); err != nil {
+		return nil, err
+	}
+	if err := relocate(goldenRoot, wsPath, cfg, excludes, opts.OnRelocateSkip); err != nil {
+		_ = zfs.DestroyWorkspace(context.WithoutCancel(ctx), runtimeRoot, id, zfsRunner)
+		return nil, err
+	}
+
+	info := &workspace.Info{
+		ID:           id,
+		GoldenCopy:   goldenRoot,
+		GoldenCommit: opts.GoldenCommit,
+		CreatedAt:    time.Now().UTC(),
+		Branch:       opts.Branch,
+		Path:         wsPath,
+	}
+	if err := os.MkdirAll(filepath.Join(wsPath, config.GroveDirName), 0755); err != nil {
+		_ = zfs.DestroyWorkspace(context.WithoutCancel(ctx), runtimeRoot, id, zfsRunner)
+		return nil, fmt.Errorf("writing workspace marker: %w", err)
+	}
+	if err := workspace.WriteMarker(wsPath, info); err != nil {
+		_ = zfs.DestroyWorkspace(context.WithoutCancel(ctx), runtimeRoot, id, zfsRunner)
+		return nil, fmt.Errorf("writing workspace marker: %w", err)
+	}
+
+	return info, nil
+}
+
+// cloneZFSWorkspace clones the base snapshot into wsPath, first taking a
+// new snapshot if the golden copy has moved on since the last one, e.g.
+// after a plain git pull, or has uncommitted changes. Snapshotting and
+// collecting old snapshots are serialized with recording the clone, so the
+// snapshot is not collected before the clone is recorded.
+func cloneZFSWorkspace(ctx context.Context, runtimeRoot, goldenRoot, wsPath, id string, opts CreateOptions, excludes []string) error {
+	lock, err := lockBase(runtimeRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	st, err := zfsLoadState(runtimeRoot)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("loading zfs backend state: %w", err)
+	}
+	if st == nil || opts.Dirty || st.LastSyncCommit != opts.GoldenCommit {
+		st, err = zfsRefreshBase(ctx, runtimeRoot, goldenRoot, zfsRunner, opts.GoldenCommit)
+		if err != nil {
+			return fmt.Errorf("snapshotting golden copy: %w", err)
+		}
+	}
+	if _, err := zfs.CreateWorkspace(ctx, runtimeRoot, wsPath, id, st, zfsRunner, excludes); err != nil {
+		return fmt.Errorf("zfs workspace create failed: %w", err)
+	}
+	return nil
+}
+
+func (zfsBackend) DestroyWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, id string) error {
+	runtimeRoot, err := config.EnsureImageRuntimeRoot(goldenRoot, cfg)
+	if err != nil {
+		return err
+	}
+	info, err := workspace.Get(cfg, id)
+	if err != nil {
+		return err
+	}
+	// Destroying collects old snapshots, which must not race a create.
+	lock, err := lockBase(runtimeRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	err = zfs.DestroyWorkspace(ctx, runtimeRoot, info.ID, zfsRunner)
+	if errors.Is(err, os.ErrNotExist) {
+		// Not a clone; remove it like a cp workspace.
+		return workspace.Destroy(cfg, info.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("zfs workspace destroy failed: %w", err)
+	}
+	return nil
+}
+
+func (zfsBackend) RenameWorkspace(ctx context.Context, goldenRoot string, cfg *config.Config, id, newID string, onRelocateSkip func(rel string)) (*workspace.Info, error) {
+	runtimeRoot, err := config.EnsureImageRuntimeRoot(goldenRoot, cfg)
+	if err != nil {
+		return nil, err
+	}
+	newPath := filepath.Join(cfg.WorkspaceDir, newID)
+	if _, err := zfs.LoadWorkspaceMeta(runtimeRoot, id); errors.Is(err, os.ErrNotExist) {
+		// Not a clone; rename it like a cp workspace.
+		return renameDir(goldenRoot, cfg, cfg.Exclude, id, newID, onRelocateSkip)
+	}
+	excludes, err := config.BuildImageSyncExcludes(goldenRoot, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("computing zfs excludes: %w", err)
+	}
+	if _, err := zfs.RenameWorkspace(ctx, runtimeRoot, id, newID, newPath, zfsRunner); err != nil {
+		return nil, fmt.Errorf("zfs workspace rename failed: %w", err)
+	}
+	info, err := workspace.Relabel(newPath, newID)
+	if err != nil {
+		return nil, err
+	}
+	return relocateRenamed(goldenRoot, cfg, excludes, info, id, onRelocateSkip)
+}
+
+func (zfsBackend) RefreshBase(ctx context.Context, goldenRoot, commit string, excludes []string, onProgress func(image.Progress)) error {
+	cfg, err := config.Load(goldenRoot)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	cfg.StateDir = config.ExpandStateDir(cfg.StateDir)
+	runtimeRoot, err := config.EnsureImageRuntimeRoot(goldenRoot, cfg)
+	if err != nil {
+		return fmt.Errorf("resolving runtime root: %w", err)
+	}
+
+	lock, err := lockBase(runtimeRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	if onProgress != nil {
+		onProgress(image.Progress{Percent: 0, Phase: "snapshot"})
+	}
+	if _, err := zfsRefreshBase(ctx, runtimeRoot, goldenRoot, zfsRunner, commit); err != nil {
+		return fmt.Errorf("zfs backend refresh failed: %w", err)
+	}
+	if onProgress != nil {
+		onProgress(image.Progress{Percent: 100, Phase: "snapshot"})
+	}
+	return nil
+}
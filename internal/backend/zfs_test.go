@@ -0,0 +1,96 @@
+package backend
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/chrisbanes/grove/internal/config"
+	"github.com/chrisbanes/grove/internal/zfs"
+)
+
+// fakeZFSRunner reports golden as the mountpoint of tank/app and clones by
+// copying it.
+type fakeZFSRunner struct {
+	golden   string
+	clones   map[string]string
+	commands []string
+}
+
+func (r *fakeZFSRunner) CombinedOutput(_ context.Context, name string, args ...string) ([]byte, error) {
+	r.commands = append(r.commands, name+" "+strings.Join(args, " "))
+	switch args[0] {
+	case "list":
+		if args[len(args)-1] == r.golden {
+			return []byte("tank/app\t" + r.golden + "\n"), nil
+		}
+	case "clone":
+		mountpoint := strings.TrimPrefix(args[2], "mountpoint=")
+		r.clones[args[4]] = mountpoint
+		return nil, os.CopyFS(mountpoint, os.DirFS(r.golden))
+	case "destroy":
+		if mountpoint, ok := r.clones[args[1]]; ok {
+			delete(r.clones, args[1])
+			return nil, os.RemoveAll(mountpoint)
+		}
+	}
+	return nil, nil
+}
+
+func TestZFSBackend_CreateAndDestroy(t *testing.T) {
+	golden := t.TempDir()
+	os.MkdirAll(filepath.Join(golden, ".grove"), 0755)
+	os.WriteFile(filepath.Join(golden, "main.go"), []byte("package main\n"), 0644)
+
+	r := &fakeZFSRunner{golden: golden, clones: map[string]string{}}
+	origRunner, origRefresh := zfsRunner, zfsRefreshBase
+	t.Cleanup(func() { zfsRunner, zfsRefreshBase = origRunner, origRefresh })
+	zfsRunner = r
+	var refreshed []string
+	zfsRefreshBase = func(ctx context.Context, runtimeRoot, goldenRoot string, runner zfs.Runner, commit string) (*zfs.State, error) {
+		refreshed = append(refreshed, commit)
+		return zfs.RefreshBase(ctx, runtimeRoot, goldenRoot, runner, commit)
+	}
+
+	cfg := config.DefaultConfig("test")
+	cfg.WorkspaceDir = filepath.Join(t.TempDir(), "ws")
+	cfg.StateDir = t.TempDir()
+	cfg.CloneBackend = "zfs"
+
+	b, err := ForName("zfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := b.CreateWorkspace(t.Context(), golden, cfg, CreateOptions{BranchForID: "main", GoldenCommit: "aaa"})
+	if err != nil {
+		t.Fatalf("CreateWorkspace() error = %v", err)
+	}
+	if _, err := b.CreateWorkspace(t.Context(), golden, cfg, CreateOptions{BranchForID: "main", GoldenCommit: "aaa"}); err != nil {
+		t.Fatalf("second CreateWorkspace() error = %v", err)
+	}
+	if _, err := b.CreateWorkspace(t.Context(), golden, cfg, CreateOptions{BranchForID: "main", GoldenCommit: "bbb"}); err != nil {
+		t.Fatalf("third CreateWorkspace() error = %v", err)
+	}
+	if _, err := b.CreateWorkspace(t.Context(), golden, cfg, CreateOptions{BranchForID: "main", GoldenCommit: "bbb", Dirty: true}); err != nil {
+		t.Fatalf("fourth CreateWorkspace() error = %v", err)
+	}
+	if want := []string{"aaa", "bbb", "bbb"}; !slices.Equal(refreshed, want) {
+		t.Errorf("snapshotted at %q, want %q: only when the golden commit changes or it is dirty", refreshed, want)
+	}
+	if _, err := os.Stat(filepath.Join(info.Path, ".grove", config.WorkspaceFile)); err != nil {
+		t.Errorf("workspace marker missing: %v", err)
+	}
+
+	if err := b.DestroyWorkspace(t.Context(), golden, cfg, info.ID); err != nil {
+		t.Fatalf("DestroyWorkspace() error = %v", err)
+	}
+	if want := "zfs destroy " + zfs.CloneName("tank/app", info.ID); !slices.Contains(r.commands, want) {
+		t.Errorf("commands = %q, want %q", r.commands, want)
+	}
+	if _, err := os.Stat(info.Path); !os.IsNotExist(err) {
+		t.Errorf("workspace still exists after destroy: %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+// Package btrfs implements workspaces as Btrfs subvolume snapshots.
+//
+// Workspaces are writable snapshots of a base subvolume, which costs the same
+// however many files the golden copy holds. The base is the golden copy
+// itself when it is a subvolume. Otherwise it is a managed subvolume next to
+// the workspaces, kept in sync with the golden copy by RefreshBase.
+package btrfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chrisbanes/grove/internal/clone"
+	"github.com/chrisbanes/grove/internal/image"
+)
+
+// Runner executes external commands. Commands are killed if ctx is done
+// before they exit.
+type Runner interface {
+	CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+type execRunner struct{}
+
+func (execRunner) CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).CombinedOutput()
+}
+
+// BaseDirName is the managed base subvolume's name inside workspace_dir.
+// Snapshots cannot cross filesystems, so it lives next to the workspaces.
+const BaseDirName = ".grove-btrfs-base"
+
+// State stores btrfs backend metadata for a golden copy.
+type State struct {
+	Backend string `json:"backend"`
+	// BasePath is the subvolume workspaces are snapshotted from.
+	BasePath string `json:"base_path"`
+	// Managed is set when BasePath is a subvolume synced from the golden
+	// copy, rather than the golden copy itself.
+	Managed        bool      `json:"managed"`
+	LastSyncCommit string    `json:"last_sync_commit,omitempty"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func LoadState(runtimeRoot string) (*State, error) {
+	data, err := os.ReadFile(stateFilePath(runtimeRoot))
+	if err != nil {
+		return nil, err
+	}
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func SaveState(runtimeRoot string, st *State) error {
+	if err := os.MkdirAll(filepath.Dir(stateFilePath(runtimeRoot)), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(stateFilePath(runtimeRoot), data, 0644)
+}
+
+func stateFilePath(runtimeRoot string) string {
+	return filepath.Join(runtimeRoot, "btrfs", "state.json")
+}
+
+// IsSubvolume reports whether path is the root of a Btrfs subvolume.
+func IsSubvolume(ctx context.Context, r Runner, path string) bool {
+	if r == nil {
+		r = execRunner{}
+	}
+	_, err := r.CombinedOutput(ctx, "btrfs", "subvolume", "show", path)
+	return err == nil
+}
+
+// CreateSubvolume creates an empty subvolume at path.
+func CreateSubvolume(ctx context.Context, r Runner, path string) error {
+	return run(ctx, r, "btrfs", "subvolume", "create", path)
+}
+
+// Snapshot creates a writable snapshot of the subvolume src at dst.
+func Snapshot(ctx context.Context, r Runner, src, dst string) error {
+	return run(ctx, r, "btrfs", "subvolume", "snapshot", src, dst)
+}
+
+// DeleteSubvolume deletes the subvolume at path. Deleting subvolumes can need
+// privileges the user lacks, so when the command is not permitted the
+// subvolume is removed like a directory, which recent kernels allow for its
+// owner. Other failures are returned.
+func DeleteSubvolume(ctx context.Context, r Runner, path string) error {
+	err := run(ctx, r, "btrfs", "subvolume", "delete", path)
+	if err == nil || !notPermitted(err) {
+		return err
+	}
+	if rmErr := os.RemoveAll(path); rmErr != nil {
+		return err
+	}
+	return nil
+}
+
+// notPermitted reports whether a failed btrfs command was denied with EPERM,
+// which the CLI reports as "Operation not permitted".
+func notPermitted(err error) bool {
+	return errors.Is(err, syscall.EPERM) || strings.Contains(strings.ToLower(err.Error()), syscall.EPERM.Error())
+}
+
+// CheckFilesystem returns an error unless path is on a Btrfs filesystem.
+func CheckFilesystem(ctx context.Context, r Runner, path string) error {
+	return run(ctx, r, "btrfs", "filesystem", "df", path)
+}
+
+// RefreshBase points the state at the subvolume workspaces are snapshotted
+// from. If goldenRoot is a subvolume it is used directly. Otherwise the
+// golden copy is synced into a managed subvolume at basePath with syncer,
+// created on first use, leaving out excludes.
+func RefreshBase(ctx context.Context, runtimeRoot, goldenRoot, basePath string, r Runner, syncer image.Syncer, commit string, excludes []string, onProgress func(image.Progress)) (*State, error) {
+	st := &State{Backend: "btrfs", BasePath: goldenRoot, LastSyncCommit: commit}
+	if !IsSubvolume(ctx, r, goldenRoot) {
+		st.BasePath = basePath
+		st.Managed = true
+		if err := syncManagedBase(ctx, r, syncer, goldenRoot, basePath, excludes, onProgress); err != nil {
+			return nil, err
+		}
+	}
+	st.UpdatedAt = time.Now().UTC()
+	if err := SaveState(runtimeRoot, st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// syncManagedBase syncs the golden copy into a snapshot of the managed base
+// and only replaces the base once the sync is complete, so a failed or
+// interrupted sync leaves the previous base as it was.
+func syncManagedBase(ctx context.Context, r Runner, syncer image.Syncer, goldenRoot, basePath string, excludes []string, onProgress func(image.Progress)) error {
+	hasBase := IsSubvolume(ctx, r, basePath)
+	if !hasBase {
+		if _, err := os.Lstat(basePath); err == nil {
+			return fmt.Errorf("%s exists but is not a btrfs subvolume", basePath)
+		}
+		if err := os.MkdirAll(filepath.Dir(basePath), 0755); err != nil {
+			return err
+		}
+	}
+
+	next := basePath + ".next"
+	// Left behind by a refresh that was killed before it could clean up.
+	if _, err := os.Lstat(next); err == nil {
+		if err := DeleteSubvolume(ctx, r, next); err != nil {
+			return err
+		}
+	}
+	var err error
+	if hasBase {
+		err = Snapshot(ctx, r, basePath, next)
+	} else {
+		err = CreateSubvolume(ctx, r, next)
+	}
+	if err != nil {
+		return err
+	}
+	// Cleaning up and swapping in the new base must finish even once ctx
+	// is done.
+	cleanupCtx := context.WithoutCancel(ctx)
+	defer func() { _ = DeleteSubvolume(cleanupCtx, r, next) }()
+	if err := syncer.Sync(ctx, goldenRoot, next, excludes, onProgress); err != nil {
+		return fmt.Errorf("syncing base subvolume: %w", err)
+	}
+
+	if hasBase {
+		if err := DeleteSubvolume(cleanupCtx, r, basePath); err != nil {
+			return err
+		}
+	}
+	return Snapshot(cleanupCtx, r, next, basePath)
+}
+
+// CreateWorkspace snapshots the base into workspacePath. A snapshot of the
+// golden copy itself includes everything, so paths matching excludes are
+// removed from it afterwards.
+func CreateWorkspace(ctx context.Context, r Runner, st *State, goldenRoot, workspacePath string, excludes []string) error {
+	if st.BasePath == "" {
+		return fmt.Errorf("btrfs backend state missing base_path")
+	}
+	if err := Snapshot(ctx, r, st.BasePath, workspacePath); err != nil {
+		return err
+	}
+	if st.Managed {
+		return nil
+	}
+	excluded, err := clone.ExcludedPaths(goldenRoot, excludes)
+	if err != nil {
+		_ = DeleteSubvolume(context.WithoutCancel(ctx), r, workspacePath)
+		return err
+	}
+	for _, e := range excluded {
+		if err := os.RemoveAll(filepath.Join(workspacePath, filepath.FromSlash(e.Path))); err != nil {
+			_ = DeleteSubvolume(context.WithoutCancel(ctx), r, workspacePath)
+			return fmt.Errorf("removing excluded %s: %w", e.Path, err)
+		}
+	}
+	return nil
+}
+
+// DestroyWorkspace deletes the workspace subvolume. A workspace that is
+// already gone is not an error.
+func DestroyWorkspace(ctx context.Context, r Runner, workspacePath string) error {
+	if _, err := os.Lstat(workspacePath); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return DeleteSubvolume(ctx, r, workspacePath)
+}
+
+func run(ctx context.Context, r Runner, name string, args ...string) error {
+	if r == nil {
+		r = execRunner{}
+	}
+	out, err := r.CombinedOutput(ctx, name, args...)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w\n%s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
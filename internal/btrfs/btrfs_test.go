@@ -0,0 +1,284 @@
+package btrfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chrisbanes/grove/internal/image"
+)
+
+type runnerCall struct {
+	name string
+	args []string
+}
+
+// fakeRunner simulates the btrfs CLI on a plain filesystem: subvolumes are
+// directories listed in subvolumes, and snapshots are copies.
+type fakeRunner struct {
+	calls      []runnerCall
+	subvolumes map[string]bool
+	errs       map[string]error
+	// outputs is what failing subcommands print, by subcommand.
+	outputs map[string]string
+}
+
+func (f *fakeRunner) CombinedOutput(_ context.Context, name string, args ...string) ([]byte, error) {
+	f.calls = append(f.calls, runnerCall{name: name, args: append([]string(nil), args...)})
+	if err := f.errs[args[1]]; err != nil {
+		if out, ok := f.outputs[args[1]]; ok {
+			return []byte(out), err
+		}
+		return []byte("ERROR: " + args[1] + " failed"), err
+	}
+	switch args[1] {
+	case "show":
+		if !f.subvolumes[args[2]] {
+			return []byte("ERROR: not a subvolume"), errors.New("exit status 1")
+		}
+	case "create":
+		f.subvolumes[args[2]] = true
+		return nil, os.Mkdir(args[2], 0755)
+	case "snapshot":
+		f.subvolumes[args[3]] = true
+		return nil, os.CopyFS(args[3], os.DirFS(args[2]))
+	case "delete":
+		delete(f.subvolumes, args[2])
+		return nil, os.RemoveAll(args[2])
+	}
+	return nil, nil
+}
+
+func (f *fakeRunner) commands() []string {
+	var out []string
+	for _, c := range f.calls {
+		out = append(out, c.name+" "+strings.Join(c.args, " "))
+	}
+	return out
+}
+
+func newGolden(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for rel, data := range map[string]string{
+		"main.go":          "package main\n",
+		"build/output.bin": "compiled",
+	} {
+		path := filepath.Join(root, rel)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// syncFunc is an image.Syncer that calls itself.
+type syncFunc func(ctx context.Context, src, dst string, excludes []string, onProgress func(image.Progress)) error
+
+func (f syncFunc) Sync(ctx context.Context, src, dst string, excludes []string, onProgress func(image.Progress)) error {
+	return f(ctx, src, dst, excludes, onProgress)
+}
+
+func TestRefreshBase_UsesGoldenSubvolume(t *testing.T) {
+	golden := newGolden(t)
+	runtimeRoot := t.TempDir()
+	r := &fakeRunner{subvolumes: map[string]bool{golden: true}}
+	sync := syncFunc(func(context.Context, string, string, []string, func(image.Progress)) error {
+		t.Fatal("the syncer should not be called when the golden copy is a subvolume")
+		return nil
+	})
+
+	st, err := RefreshBase(t.Context(), runtimeRoot, golden, filepath.Join(t.TempDir(), BaseDirName), r, sync, "abc1234", nil, nil)
+	if err != nil {
+		t.Fatalf("RefreshBase() error = %v", err)
+	}
+	if st.BasePath != golden || st.Managed {
+		t.Errorf("state = %+v, want the golden copy as an unmanaged base", st)
+	}
+
+	loaded, err := LoadState(runtimeRoot)
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	if loaded.LastSyncCommit != "abc1234" || loaded.BasePath != golden {
+		t.Errorf("saved state = %+v", loaded)
+	}
+}
+
+func TestRefreshBase_CreatesAndSyncsManagedBase(t *testing.T) {
+	golden := newGolden(t)
+	basePath := filepath.Join(t.TempDir(), "ws", BaseDirName)
+	r := &fakeRunner{subvolumes: map[string]bool{}}
+	var synced []string
+	sync := syncFunc(func(_ context.Context, src, dst string, excludes []string, _ func(image.Progress)) error {
+		synced = append(synced, src+" -> "+dst+" "+strings.Join(excludes, ","))
+		return nil
+	})
+
+	for range 2 {
+		st, err := RefreshBase(t.Context(), t.TempDir(), golden, basePath, r, sync, "abc1234", []string{"build/"}, nil)
+		if err != nil {
+			t.Fatalf("RefreshBase() error = %v", err)
+		}
+		if st.BasePath != basePath || !st.Managed {
+			t.Errorf("state = %+v, want a managed base at %s", st, basePath)
+		}
+	}
+
+	creates := 0
+	for _, c := range r.commands() {
+		if strings.HasPrefix(c, "btrfs subvolume create") {
+			creates++
+		}
+	}
+	if creates != 1 {
+		t.Errorf("created the base subvolume %d times, want once:\n%s", creates, strings.Join(r.commands(), "\n"))
+	}
+	// Each sync goes to a snapshot that replaces the base once complete.
+	want := golden + " -> " + basePath + ".next build/"
+	if len(synced) != 2 || synced[0] != want {
+		t.Errorf("syncs = %q, want two of %q", synced, want)
+	}
+	if !r.subvolumes[basePath] || r.subvolumes[basePath+".next"] {
+		t.Errorf("subvolumes = %v, want only the base left", r.subvolumes)
+	}
+}
+
+func TestRefreshBase_FailedSyncKeepsPreviousBase(t *testing.T) {
+	golden := newGolden(t)
+	basePath := filepath.Join(t.TempDir(), BaseDirName)
+	os.Mkdir(basePath, 0755)
+	os.WriteFile(filepath.Join(basePath, "main.go"), []byte("old"), 0644)
+	r := &fakeRunner{subvolumes: map[string]bool{basePath: true}}
+	sync := syncFunc(func(_ context.Context, _, dst string, _ []string, _ func(image.Progress)) error {
+		os.WriteFile(filepath.Join(dst, "main.go"), []byte("half"), 0644)
+		return context.Canceled
+	})
+
+	if _, err := RefreshBase(t.Context(), t.TempDir(), golden, basePath, r, sync, "abc1234", nil, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("RefreshBase() error = %v, want context.Canceled", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(basePath, "main.go")); string(data) != "old" {
+		t.Errorf("base main.go = %q, want the previous base untouched", data)
+	}
+	if _, err := os.Lstat(basePath + ".next"); !os.IsNotExist(err) {
+		t.Errorf("partial sync was left behind: %v", err)
+	}
+}
+
+func TestRefreshBase_RejectsPlainDirectoryAtBasePath(t *testing.T) {
+	golden := newGolden(t)
+	basePath := filepath.Join(t.TempDir(), BaseDirName)
+	os.Mkdir(basePath, 0755)
+	sync := syncFunc(func(context.Context, string, string, []string, func(image.Progress)) error { return nil })
+
+	_, err := RefreshBase(t.Context(), t.TempDir(), golden, basePath, &fakeRunner{subvolumes: map[string]bool{}}, sync, "", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "not a btrfs subvolume") {
+		t.Fatalf("RefreshBase() error = %v, want a not-a-subvolume error", err)
+	}
+}
+
+func TestCreateWorkspace_RemovesExcludesFromGoldenSnapshot(t *testing.T) {
+	golden := newGolden(t)
+	wsPath := filepath.Join(t.TempDir(), "ws-1")
+	r := &fakeRunner{subvolumes: map[string]bool{golden: true}}
+
+	st := &State{BasePath: golden}
+	if err := CreateWorkspace(t.Context(), r, st, golden, wsPath, []string{"build/"}); err != nil {
+		t.Fatalf("CreateWorkspace() error = %v", err)
+	}
+	if got := r.commands()[0]; got != "btrfs subvolume snapshot "+golden+" "+wsPath {
+		t.Errorf("command = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(wsPath, "main.go")); err != nil {
+		t.Errorf("workspace is missing main.go: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(wsPath, "build")); !os.IsNotExist(err) {
+		t.Errorf("excluded build/ is still in the workspace: %v", err)
+	}
+}
+
+func TestCreateWorkspace_ManagedBaseKeepsSnapshot(t *testing.T) {
+	golden := newGolden(t)
+	base := t.TempDir()
+	os.WriteFile(filepath.Join(base, "kept"), []byte("x"), 0644)
+	wsPath := filepath.Join(t.TempDir(), "ws-1")
+	r := &fakeRunner{subvolumes: map[string]bool{base: true}}
+
+	if err := CreateWorkspace(t.Context(), r, &State{BasePath: base, Managed: true}, golden, wsPath, []string{"kept"}); err != nil {
+		t.Fatalf("CreateWorkspace() error = %v", err)
+	}
+	// Excludes were applied when the managed base was synced.
+	if _, err := os.Stat(filepath.Join(wsPath, "kept")); err != nil {
+		t.Errorf("snapshot content was removed: %v", err)
+	}
+}
+
+func TestCreateWorkspace_SnapshotFailure(t *testing.T) {
+	golden := newGolden(t)
+	r := &fakeRunner{
+		subvolumes: map[string]bool{golden: true},
+		errs:       map[string]error{"snapshot": errors.New("exit status 1")},
+	}
+
+	err := CreateWorkspace(t.Context(), r, &State{BasePath: golden}, golden, filepath.Join(t.TempDir(), "ws-1"), nil)
+	if err == nil || !strings.Contains(err.Error(), "btrfs subvolume snapshot") {
+		t.Fatalf("CreateWorkspace() error = %v, want the snapshot command in it", err)
+	}
+}
+
+func TestDestroyWorkspace(t *testing.T) {
+	wsPath := filepath.Join(t.TempDir(), "ws-1")
+	os.Mkdir(wsPath, 0755)
+	r := &fakeRunner{subvolumes: map[string]bool{wsPath: true}}
+
+	if err := DestroyWorkspace(t.Context(), r, wsPath); err != nil {
+		t.Fatalf("DestroyWorkspace() error = %v", err)
+	}
+	if got := r.commands(); len(got) != 1 || got[0] != "btrfs subvolume delete "+wsPath {
+		t.Errorf("commands = %q", got)
+	}
+	if err := DestroyWorkspace(t.Context(), r, wsPath); err != nil {
+		t.Errorf("destroying a missing workspace: %v", err)
+	}
+	if len(r.calls) != 1 {
+		t.Errorf("expected no command for a missing workspace, got %q", r.commands())
+	}
+}
+
+func TestDeleteSubvolume_FallsBackToRemoval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ws-1")
+	os.MkdirAll(filepath.Join(path, "src"), 0755)
+	r := &fakeRunner{
+		errs:    map[string]error{"delete": errors.New("exit status 1")},
+		outputs: map[string]string{"delete": "ERROR: Could not destroy subvolume/snapshot: Operation not permitted"},
+	}
+
+	if err := DeleteSubvolume(t.Context(), r, path); err != nil {
+		t.Fatalf("DeleteSubvolume() error = %v", err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("subvolume still exists: %v", err)
+	}
+}
+
+func TestDeleteSubvolume_ReturnsOtherFailures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ws-1")
+	os.MkdirAll(filepath.Join(path, "src"), 0755)
+	r := &fakeRunner{
+		errs:    map[string]error{"delete": errors.New("exit status 1")},
+		outputs: map[string]string{"delete": "ERROR: Could not statfs: No such device"},
+	}
+
+	err := DeleteSubvolume(t.Context(), r, path)
+	if err == nil || !strings.Contains(err.Error(), "No such device") {
+		t.Fatalf("DeleteSubvolume() error = %v, want the delete failure", err)
+	}
+	if _, err := os.Stat(filepath.Join(path, "src")); err != nil {
+		t.Errorf("subvolume was removed after a failure other than EPERM: %v", err)
+	}
+}
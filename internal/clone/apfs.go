@@ -3,13 +3,12 @@ package clone
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"runtime"
 	"strings"
 	"sync"
 	"syscall"
@@ -18,11 +17,11 @@ import (
 // APFSCloner performs CoW clones using macOS APFS cp -c.
 type APFSCloner struct{}
 
-func (c *APFSCloner) Clone(src, dst string) error {
+func (c *APFSCloner) Clone(ctx context.Context, src, dst string) error {
 	if err := ensureSameFilesystemForClone(src, dst); err != nil {
 		return err
 	}
-	cmd := exec.Command("cp", "-c", "-R", src, dst)
+	cmd := exec.CommandContext(ctx, "cp", "-c", "-R", src, dst)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("apfs clone failed: %w\n%s", err, out)
@@ -30,19 +29,20 @@ func (c *APFSCloner) Clone(src, dst string) error {
 	return nil
 }
 
-func (c *APFSCloner) CloneWithProgress(src, dst string, onProgress ProgressFunc) error {
+func (c *APFSCloner) CloneWithProgress(ctx context.Context, src, dst string, onProgress ProgressFunc) error {
+	return c.cloneWithTotal(ctx, src, dst, unknownTotals, onProgress)
+}
+
+func (c *APFSCloner) cloneWithTotal(ctx context.Context, src, dst string, total treeTotals, onProgress ProgressFunc) error {
 	if err := ensureSameFilesystemForClone(src, dst); err != nil {
 		return err
 	}
-	total, err := countEntries(src)
-	if err != nil {
-		total = 0
-	}
+	total = total.resolve(src)
 	if onProgress != nil {
-		onProgress(ProgressEvent{Total: total, Phase: "scan"})
+		onProgress(ProgressEvent{Total: total.entries, BytesTotal: total.bytes, Phase: "scan"})
 	}
 
-	cmd := exec.Command("cp", "-c", "-R", "-v", src, dst)
+	cmd := exec.CommandContext(ctx, "cp", "-c", "-R", "-v", src, dst)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return fmt.Errorf("apfs clone failed: %w", err)
@@ -57,9 +57,11 @@ func (c *APFSCloner) CloneWithProgress(src, dst string, onProgress ProgressFunc)
 	}
 
 	var (
-		wg     sync.WaitGroup
-		mu     sync.Mutex
-		copied int
+		wg          sync.WaitGroup
+		mu          sync.Mutex
+		copied      int
+		copiedBytes int64
+		meter       = newRateMeter()
 
 		stdoutBuf bytes.Buffer
 		stderrBuf bytes.Buffer
@@ -73,16 +75,28 @@ func (c *APFSCloner) CloneWithProgress(src, dst string, onProgress ProgressFunc)
 			line := scanner.Text()
 			out.WriteString(line)
 			out.WriteByte('\n')
-			if !parseCPVerboseLine(line) {
+			entry, ok := parseCPVerboseSource(line)
+			if !ok {
 				continue
 			}
+			var size int64
+			if info, err := os.Lstat(entry); err == nil && info.Mode().IsRegular() {
+				size = info.Size()
+			}
 			mu.Lock()
 			copied++
-			current := copied
-			mu.Unlock()
+			copiedBytes += size
 			if onProgress != nil {
-				onProgress(ProgressEvent{Copied: current, Total: total, Phase: "clone"})
+				onProgress(ProgressEvent{
+					Copied:     copied,
+					Total:      total.entries,
+					Bytes:      copiedBytes,
+					BytesTotal: total.bytes,
+					Rate:       meter.observe(copiedBytes),
+					Phase:      "clone",
+				})
 			}
+			mu.Unlock()
 		}
 	}
 
@@ -99,44 +113,18 @@ func (c *APFSCloner) CloneWithProgress(src, dst string, onProgress ProgressFunc)
 	return nil
 }
 
-// isAPFS checks if the filesystem at path is APFS.
-func isAPFS(path string) (bool, error) {
-	if runtime.GOOS != "darwin" {
-		return false, nil
-	}
-	// Use df to find the device for the volume containing path,
-	// then diskutil to check its filesystem type.
-	dfCmd := exec.Command("df", path)
-	dfOut, err := dfCmd.Output()
-	if err != nil {
-		return false, fmt.Errorf("df failed: %w", err)
-	}
-	// df output: last line, first field is the device
-	lines := splitLines(string(dfOut))
-	if len(lines) < 2 {
-		return false, fmt.Errorf("unexpected df output")
-	}
-	// Parse the mount point from the last column of the last line
-	fields := splitFields(lines[len(lines)-1])
-	if len(fields) < 1 {
-		return false, fmt.Errorf("unexpected df output format")
-	}
-	mountPoint := fields[len(fields)-1]
-
-	diskutilCmd := exec.Command("diskutil", "info", mountPoint)
-	diskutilOut, err := diskutilCmd.Output()
-	if err != nil {
-		return false, fmt.Errorf("diskutil failed: %w", err)
-	}
-	return containsString(string(diskutilOut), "APFS"), nil
-}
-
-func parseCPVerboseLine(line string) bool {
+// parseCPVerboseSource returns the source path from a cp -v "src -> dst"
+// line.
+func parseCPVerboseSource(line string) (string, bool) {
 	line = strings.TrimSpace(line)
 	if line == "" {
-		return false
+		return "", false
+	}
+	src, _, ok := strings.Cut(line, " -> ")
+	if !ok {
+		return "", false
 	}
-	return strings.Contains(line, " -> ")
+	return src, true
 }
 
 func mapClonePercent(copied, total, min, max int) int {
@@ -156,18 +144,6 @@ func mapClonePercent(copied, total, min, max int) int {
 	return min + (copied*span)/total
 }
 
-func countEntries(root string) (int, error) {
-	count := 0
-	err := filepath.WalkDir(root, func(_ string, _ fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		count++
-		return nil
-	})
-	return count, err
-}
-
 type statFunc func(path string) (os.FileInfo, error)
 
 func ensureSameFilesystemForClone(src, dst string) error {
@@ -195,7 +171,7 @@ func ensureSameFilesystemForCloneWithStat(src, dst string, stat statFunc) error
 	}
 	if srcDev != dstDev {
 		return fmt.Errorf(
-			"clone preflight failed: source and destination must be on the same filesystem for APFS copy-on-write clones (source: %s, destination: %s).\nSet .grove/config.json workspace_dir to a path on the same volume as the golden copy",
+			"clone preflight failed: source and destination must be on the same filesystem for copy-on-write clones (source: %s, destination: %s).\nSet .grove/config.json workspace_dir to a path on the same volume as the golden copy",
 			src, dst,
 		)
 	}
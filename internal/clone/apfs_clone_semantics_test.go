@@ -37,7 +37,7 @@ func TestClone_StatMetadataParity(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if err := c.Clone(src, dst); err != nil {
+	if err := c.Clone(t.Context(), src, dst); err != nil {
 		t.Fatal(err)
 	}
 
@@ -115,7 +115,7 @@ func TestClone_DiskUsageDeltaMuchLowerThanRegularCopy(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if err := c.Clone(src, dstClone); err != nil {
+	if err := c.Clone(t.Context(), src, dstClone); err != nil {
 		t.Fatal(err)
 	}
 	afterClone, err := freeKB(root)
@@ -1,9 +1,12 @@
 package clone
 
+import "context"
+
 // Cloner performs copy-on-write directory clones.
 type Cloner interface {
-	// Clone performs a CoW clone from src to dst.
-	Clone(src, dst string) error
+	// Clone performs a CoW clone from src to dst. It stops early, leaving
+	// dst partially written, once ctx is done.
+	Clone(ctx context.Context, src, dst string) error
 }
 
 // ProgressEvent is emitted by progress-capable cloners.
@@ -11,6 +14,12 @@ type ProgressEvent struct {
 	Copied int
 	Total  int
 	Phase  string
+	// Bytes and BytesTotal measure regular file data. BytesTotal is zero
+	// when unknown.
+	Bytes      int64
+	BytesTotal int64
+	// Rate is the recent throughput in bytes per second.
+	Rate float64
 }
 
 // ProgressFunc handles progress events.
@@ -18,5 +27,11 @@ type ProgressFunc func(ProgressEvent)
 
 // ProgressCloner is implemented by cloners that can emit clone progress.
 type ProgressCloner interface {
-	CloneWithProgress(src, dst string, onProgress ProgressFunc) error
+	CloneWithProgress(ctx context.Context, src, dst string, onProgress ProgressFunc) error
+}
+
+// totalCloner is implemented by progress cloners that can report against
+// totals the caller already knows, skipping their own counting walk.
+type totalCloner interface {
+	cloneWithTotal(ctx context.Context, src, dst string, total treeTotals, onProgress ProgressFunc) error
 }
@@ -1,46 +1,29 @@
-package clone_test
+package clone
 
 import (
 	"os"
 	"path/filepath"
 	"runtime"
 	"testing"
-
-	"github.com/chrisbanes/grove/internal/clone"
 )
 
 func TestNewCloner_ReturnsCloner(t *testing.T) {
-	if runtime.GOOS != "darwin" {
-		t.Skip("APFS tests only run on macOS")
-	}
 	dir := t.TempDir()
-	c, err := clone.NewCloner(dir)
-	if err != nil {
-		t.Fatalf("expected cloner on macOS/APFS, got error: %v", err)
-	}
+	c := newTestCloner(t, dir)
 	if c == nil {
 		t.Fatal("expected non-nil cloner")
 	}
 }
 
 func TestNewCloner_ImplementsProgressCloner(t *testing.T) {
-	if runtime.GOOS != "darwin" {
-		t.Skip("APFS tests only run on macOS")
-	}
 	dir := t.TempDir()
-	c, err := clone.NewCloner(dir)
-	if err != nil {
-		t.Fatalf("expected cloner on macOS/APFS, got error: %v", err)
-	}
-	if _, ok := c.(clone.ProgressCloner); !ok {
+	c := newTestCloner(t, dir)
+	if _, ok := c.(ProgressCloner); !ok {
 		t.Fatal("expected cloner to implement ProgressCloner")
 	}
 }
 
 func TestClone_CopiesAllFiles(t *testing.T) {
-	if runtime.GOOS != "darwin" {
-		t.Skip("APFS tests only run on macOS")
-	}
 
 	src := t.TempDir()
 	// Create a directory structure with files
@@ -51,11 +34,8 @@ func TestClone_CopiesAllFiles(t *testing.T) {
 
 	dst := filepath.Join(t.TempDir(), "clone")
 
-	c, err := clone.NewCloner(src)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if err := c.Clone(src, dst); err != nil {
+	c := newTestCloner(t, src)
+	if err := c.Clone(t.Context(), src, dst); err != nil {
 		t.Fatal(err)
 	}
 
@@ -75,17 +55,14 @@ func TestClone_CopiesAllFiles(t *testing.T) {
 }
 
 func TestClone_CopyOnWrite(t *testing.T) {
-	if runtime.GOOS != "darwin" {
-		t.Skip("APFS tests only run on macOS")
-	}
 
 	src := t.TempDir()
 	os.WriteFile(filepath.Join(src, "file.txt"), []byte("original"), 0644)
 
 	dst := filepath.Join(t.TempDir(), "clone")
 
-	c, _ := clone.NewCloner(src)
-	c.Clone(src, dst)
+	c := newTestCloner(t, src)
+	c.Clone(t.Context(), src, dst)
 
 	// Modify the clone
 	os.WriteFile(filepath.Join(dst, "file.txt"), []byte("modified"), 0644)
@@ -98,9 +75,6 @@ func TestClone_CopyOnWrite(t *testing.T) {
 }
 
 func TestClone_HiddenFiles(t *testing.T) {
-	if runtime.GOOS != "darwin" {
-		t.Skip("APFS tests only run on macOS")
-	}
 
 	src := t.TempDir()
 	os.MkdirAll(filepath.Join(src, ".hidden"), 0755)
@@ -109,8 +83,8 @@ func TestClone_HiddenFiles(t *testing.T) {
 
 	dst := filepath.Join(t.TempDir(), "clone")
 
-	c, _ := clone.NewCloner(src)
-	c.Clone(src, dst)
+	c := newTestCloner(t, src)
+	c.Clone(t.Context(), src, dst)
 
 	if _, err := os.Stat(filepath.Join(dst, ".hidden", "secret.txt")); err != nil {
 		t.Error("hidden directory not cloned")
@@ -119,3 +93,17 @@ func TestClone_HiddenFiles(t *testing.T) {
 		t.Error("dotfile not cloned")
 	}
 }
+
+// newTestCloner returns the platform cloner for dir. CoW support is required
+// on macOS; elsewhere the test is skipped when the filesystem lacks reflinks.
+func newTestCloner(t *testing.T, dir string) Cloner {
+	t.Helper()
+	c, err := NewCloner(dir)
+	if err != nil {
+		if runtime.GOOS == "darwin" {
+			t.Fatalf("expected cloner on macOS/APFS, got error: %v", err)
+		}
+		t.Skipf("copy-on-write clones unavailable: %v", err)
+	}
+	return c
+}
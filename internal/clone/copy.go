@@ -0,0 +1,96 @@
+package clone
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultCopyWorkers is the number of files CopyCloner writes concurrently
+// when Workers is unset. Copies are I/O bound, so this is deliberately
+// independent of the CPU count.
+const defaultCopyWorkers = 8
+
+// CopyCloner performs full copies for filesystems without copy-on-write
+// support. Files are copied in parallel; files under HardlinkPaths are
+// hardlinked to the source instead of copied.
+type CopyCloner struct {
+	// Root is the directory HardlinkPaths are relative to, normally the
+	// golden copy root.
+	Root string
+	// HardlinkPaths lists directories, relative to Root, whose files are
+	// treated as read-only caches and hardlinked into the destination.
+	// Writes through a hardlink modify the source as well.
+	HardlinkPaths []string
+	// Workers bounds the number of concurrent file copies.
+	Workers int
+}
+
+func (c *CopyCloner) Clone(ctx context.Context, src, dst string) error {
+	if err := c.copier().copy(ctx, src, dst); err != nil {
+		return fmt.Errorf("copy failed: %w", err)
+	}
+	return nil
+}
+
+func (c *CopyCloner) CloneWithProgress(ctx context.Context, src, dst string, onProgress ProgressFunc) error {
+	return c.cloneWithTotal(ctx, src, dst, unknownTotals, onProgress)
+}
+
+func (c *CopyCloner) cloneWithTotal(ctx context.Context, src, dst string, total treeTotals, onProgress ProgressFunc) error {
+	if err := cloneTreeWithProgress(ctx, c.copier(), src, dst, total, onProgress); err != nil {
+		return fmt.Errorf("copy %w", err)
+	}
+	return nil
+}
+
+func (c *CopyCloner) copier() *treeCopier {
+	workers := c.Workers
+	if workers <= 0 {
+		workers = defaultCopyWorkers
+	}
+	t := &treeCopier{cloneFile: copyFile, workers: workers}
+	if len(c.HardlinkPaths) > 0 {
+		t.hardlink = c.underHardlinkPath
+	}
+	return t
+}
+
+func (c *CopyCloner) underHardlinkPath(src string) bool {
+	rel, err := filepath.Rel(c.Root, src)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, p := range c.HardlinkPaths {
+		p = strings.Trim(filepath.ToSlash(filepath.Clean(p)), "/")
+		if rel == p || strings.HasPrefix(rel, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func copyFile(src, dst string, _ fs.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	// io.Copy uses copy_file_range where available, which lets the kernel
+	// do the copy (or share extents on filesystems that can).
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,174 @@
+package clone
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyCloner_CopiesTreeIndependently(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "sub", "deep"), 0755)
+	for i, rel := range []string{"a.txt", "sub/b.txt", "sub/deep/c.txt"} {
+		os.WriteFile(filepath.Join(src, rel), []byte{byte('a' + i)}, 0644)
+	}
+
+	dst := filepath.Join(t.TempDir(), "clone")
+	c := &CopyCloner{Root: src, Workers: 4}
+	if err := c.Clone(t.Context(), src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, rel := range []string{"a.txt", "sub/b.txt", "sub/deep/c.txt"} {
+		data, err := os.ReadFile(filepath.Join(dst, rel))
+		if err != nil {
+			t.Fatalf("missing %s: %v", rel, err)
+		}
+		if string(data) != string(rune('a'+i)) {
+			t.Errorf("%s = %q", rel, data)
+		}
+	}
+
+	os.WriteFile(filepath.Join(dst, "a.txt"), []byte("modified"), 0644)
+	if data, _ := os.ReadFile(filepath.Join(src, "a.txt")); string(data) != "a" {
+		t.Error("source was modified through the copy")
+	}
+}
+
+func TestCopyCloner_HardlinksConfiguredPaths(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, ".gradle", "caches"), 0755)
+	os.MkdirAll(filepath.Join(src, ".gradle", "caches-other"), 0755)
+	os.WriteFile(filepath.Join(src, ".gradle", "caches", "dep.jar"), []byte("jar"), 0644)
+	os.WriteFile(filepath.Join(src, ".gradle", "caches-other", "dep.jar"), []byte("jar"), 0644)
+	os.WriteFile(filepath.Join(src, "main.go"), []byte("go"), 0644)
+
+	dst := filepath.Join(t.TempDir(), "clone")
+	c := &CopyCloner{Root: src, HardlinkPaths: []string{".gradle/caches/"}}
+	if err := c.Clone(t.Context(), src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	sameFile := func(rel string) bool {
+		a, err := os.Stat(filepath.Join(src, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.Stat(filepath.Join(dst, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return os.SameFile(a, b)
+	}
+	if !sameFile(".gradle/caches/dep.jar") {
+		t.Error("expected file under hardlink path to be hardlinked")
+	}
+	if sameFile(".gradle/caches-other/dep.jar") {
+		t.Error("sibling directory with a shared prefix should be copied, not hardlinked")
+	}
+	if sameFile("main.go") {
+		t.Error("expected file outside hardlink paths to be copied")
+	}
+}
+
+func TestCopyCloner_CountsHardlinkedBytes(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, ".gradle", "caches"), 0755)
+	os.WriteFile(filepath.Join(src, ".gradle", "caches", "dep.jar"), []byte("jar"), 0644)
+	os.WriteFile(filepath.Join(src, "main.go"), []byte("go"), 0644)
+
+	var scanBytes, lastBytes int64
+	onProgress := func(e ProgressEvent) {
+		switch e.Phase {
+		case "scan":
+			scanBytes = e.BytesTotal
+		case "clone":
+			lastBytes = e.Bytes
+		}
+	}
+
+	dst := filepath.Join(t.TempDir(), "clone")
+	c := &CopyCloner{Root: src, HardlinkPaths: []string{".gradle/caches/"}}
+	if err := SelectiveCloneWithProgress(t.Context(), c, src, dst, nil, onProgress); err != nil {
+		t.Fatal(err)
+	}
+	if scanBytes != 5 || lastBytes != scanBytes {
+		t.Errorf("cloned %d of %d bytes, want hardlinked files counted towards 5", lastBytes, scanBytes)
+	}
+}
+
+func TestCopyCloner_SelectiveCloneWithProgress(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "keep"), 0755)
+	os.MkdirAll(filepath.Join(src, "__pycache__"), 0755)
+	os.WriteFile(filepath.Join(src, "keep", "file.txt"), []byte("keep"), 0644)
+	os.WriteFile(filepath.Join(src, "__pycache__", "module.pyc"), []byte("pyc"), 0644)
+	os.WriteFile(filepath.Join(src, "root.txt"), []byte("root"), 0644)
+
+	var scanTotal, lastCopied int
+	onProgress := func(e ProgressEvent) {
+		switch e.Phase {
+		case "scan":
+			scanTotal = e.Total
+		case "clone":
+			lastCopied = e.Copied
+		}
+	}
+
+	dst := filepath.Join(t.TempDir(), "clone")
+	c := &CopyCloner{Root: src}
+	if err := SelectiveCloneWithProgress(t.Context(), c, src, dst, []string{"__pycache__"}, onProgress); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, "keep", "file.txt")); err != nil {
+		t.Error("keep/file.txt should exist")
+	}
+	if _, err := os.Stat(filepath.Join(dst, "__pycache__")); !os.IsNotExist(err) {
+		t.Error("__pycache__ should not exist in copy")
+	}
+	// root dir, keep dir, keep/file.txt, root.txt
+	if scanTotal != 4 {
+		t.Errorf("scan total = %d, want 4", scanTotal)
+	}
+	if lastCopied < 1 {
+		t.Error("expected at least one progress event during copy")
+	}
+}
+
+func TestCopyCloner_SelectiveCloneHonorsGroveignore(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "app", "build"), 0755)
+	os.WriteFile(filepath.Join(src, "app", ".groveignore"), []byte("build/\n"), 0644)
+	os.WriteFile(filepath.Join(src, "app", "build", "out.bin"), []byte("out"), 0644)
+	os.WriteFile(filepath.Join(src, "app", "main.go"), []byte("go"), 0644)
+
+	dst := filepath.Join(t.TempDir(), "clone")
+	if err := SelectiveClone(t.Context(), &CopyCloner{Root: src}, src, dst, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, "app", "main.go")); err != nil {
+		t.Error("app/main.go should exist")
+	}
+	if _, err := os.Stat(filepath.Join(dst, "app", ".groveignore")); err != nil {
+		t.Error("app/.groveignore should be cloned")
+	}
+	if _, err := os.Stat(filepath.Join(dst, "app", "build")); !os.IsNotExist(err) {
+		t.Error("app/build should be excluded by app/.groveignore")
+	}
+}
+
+func TestCopyCloner_StopsWhenCancelled(t *testing.T) {
+	src := t.TempDir()
+	os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0644)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	err := (&CopyCloner{Root: src}).Clone(ctx, src, filepath.Join(t.TempDir(), "clone"))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Clone() error = %v, want context.Canceled", err)
+	}
+}
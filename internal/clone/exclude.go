@@ -1,100 +1,171 @@
 package clone
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+
+	"github.com/chrisbanes/grove/internal/ignore"
 )
 
-// matchExclude checks whether relPath matches a single exclude pattern.
-// If the pattern contains no /, it matches against the basename.
-// If the pattern contains /, it matches against the full relative path.
-func matchExclude(pattern, relPath string) bool {
-	if relPath == "" {
-		return false
-	}
-	if strings.Contains(pattern, "/") {
-		matched, _ := filepath.Match(pattern, relPath)
-		return matched
-	}
-	matched, _ := filepath.Match(pattern, filepath.Base(relPath))
-	return matched
+// isExcluded reports whether relPath is excluded by m. The .grove directory
+// is never excluded.
+func isExcluded(relPath string, isDir bool, m *ignore.Matcher) bool {
+	return excludedBy(relPath, isDir, m) != nil
 }
 
-// isExcluded checks whether relPath matches any of the exclude patterns.
-// The .grove directory is never excluded.
-func isExcluded(relPath string, excludes []string) bool {
-	if relPath == ".grove" || strings.HasPrefix(relPath, ".grove/") || strings.HasPrefix(relPath, ".grove\\") {
-		return false
+// excludedBy returns the pattern that excludes relPath, or nil if relPath is
+// kept.
+func excludedBy(relPath string, isDir bool, m *ignore.Matcher) *ignore.Pattern {
+	relPath = filepath.ToSlash(relPath)
+	if relPath == ".grove" || strings.HasPrefix(relPath, ".grove/") {
+		return nil
 	}
-	for _, pattern := range excludes {
-		if matchExclude(pattern, relPath) {
-			return true
-		}
+	if p := m.Match(relPath, isDir); p != nil && !p.Negated() {
+		return p
 	}
-	return false
+	return nil
+}
+
+// Exclusion records a path left out of a clone and the pattern that
+// excluded it. Descendants of an excluded directory are not listed.
+type Exclusion struct {
+	// Path is slash-separated and relative to the clone source.
+	Path    string
+	IsDir   bool
+	Pattern *ignore.Pattern
 }
 
 // clonePlan holds the results of walking the source tree with exclude patterns.
 type clonePlan struct {
 	// totalEntries is the count of non-excluded entries (for progress reporting).
 	totalEntries int
+	// totalBytes sums the sizes of non-excluded regular files.
+	totalBytes int64
 	// dirsWithExcludes maps relative directory paths that contain excluded
 	// descendants. The key "." represents the source root.
 	dirsWithExcludes map[string]bool
+	// matcher holds the exclude patterns merged with every .groveignore
+	// file found during the walk.
+	matcher *ignore.Matcher
+	// excluded lists the excluded paths in walk order.
+	excluded []Exclusion
+	// symlinks lists the kept absolute symlinks that point into the source,
+	// and relocate the kept regular files selected by relocate patterns.
+	// Both are rewritten in the clone to refer to the clone instead.
+	symlinks []string
+	relocate []string
+	// dirs and ignoreFiles record the state of the walked tree, so a cached
+	// plan can be checked for staleness without walking again.
+	dirs        []stamp
+	ignoreFiles []stamp
 }
 
-// buildClonePlan walks src and computes which entries are excluded.
-func buildClonePlan(src string, excludes []string) (*clonePlan, error) {
+// buildClonePlan walks src and computes which entries are excluded by
+// excludes and by .groveignore files in src, and which need relocating. Each
+// .groveignore is read when its directory is reached, so files inside
+// excluded directories are never consulted.
+func buildClonePlan(src string, excludes, relocate []string) (*clonePlan, error) {
+	matcher, err := ignore.New(excludes)
+	if err != nil {
+		return nil, err
+	}
+	relocateMatcher, err := newRelocateMatcher(relocate)
+	if err != nil {
+		return nil, err
+	}
+	// Relocating src onto itself is enough to tell which symlinks point in.
+	symlinks, err := newRelocator(src, src, nil)
+	if err != nil {
+		return nil, err
+	}
 	plan := &clonePlan{
 		dirsWithExcludes: make(map[string]bool),
-	}
-	if len(excludes) == 0 {
-		count, err := countAllEntries(src)
-		if err != nil {
-			return nil, err
-		}
-		plan.totalEntries = count
-		return plan, nil
+		matcher:          matcher,
 	}
 
-	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
+			if path != src && vanished(path, err) {
+				return nil
+			}
 			return err
 		}
 		rel, err := filepath.Rel(src, path)
 		if err != nil {
 			return err
 		}
-		if rel == "." {
-			plan.totalEntries++
-			return nil
-		}
-		if isExcluded(rel, excludes) {
-			markAncestors(rel, plan.dirsWithExcludes)
-			if d.IsDir() {
-				return fs.SkipDir
+		if rel != "." {
+			if p := excludedBy(rel, d.IsDir(), plan.matcher); p != nil {
+				markAncestors(rel, plan.dirsWithExcludes)
+				plan.excluded = append(plan.excluded, Exclusion{
+					Path:    filepath.ToSlash(rel),
+					IsDir:   d.IsDir(),
+					Pattern: p,
+				})
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
 			}
-			return nil
 		}
 		plan.totalEntries++
+		relocatable := rel != "." && !isGroveOrGit(rel)
+		selected := relocatable && relocateMatcher.visit(rel, d.IsDir())
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				if vanished(path, err) {
+					return nil
+				}
+				return err
+			}
+			plan.totalBytes += info.Size()
+			if selected {
+				plan.relocate = append(plan.relocate, filepath.ToSlash(rel))
+			}
+		}
+		if relocatable && d.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if _, ok := symlinks.target(target); ok {
+				plan.symlinks = append(plan.symlinks, filepath.ToSlash(rel))
+			}
+		}
+		if d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			plan.dirs = append(plan.dirs, newStamp(rel, info))
+			if info, err := os.Lstat(filepath.Join(path, ignore.FileName)); err == nil {
+				plan.ignoreFiles = append(plan.ignoreFiles, newStamp(filepath.Join(rel, ignore.FileName), info))
+			}
+			patterns, err := ignore.ReadFile(src, filepath.ToSlash(rel))
+			if err != nil {
+				return err
+			}
+			plan.matcher.Add(patterns...)
+		}
 		return nil
 	})
 	return plan, err
 }
 
-func countAllEntries(root string) (int, error) {
-	count := 0
-	err := filepath.WalkDir(root, func(_ string, _ fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		count++
-		return nil
-	})
-	return count, err
+// ExcludedPaths reports what a selective clone of src would leave out, given
+// excludes and the .groveignore files in src.
+func ExcludedPaths(src string, excludes []string) ([]Exclusion, error) {
+	plan, err := buildClonePlan(src, excludes, nil)
+	if err != nil {
+		return nil, err
+	}
+	return plan.excluded, nil
 }
 
 func markAncestors(rel string, dirs map[string]bool) {
@@ -109,89 +180,181 @@ func markAncestors(rel string, dirs map[string]bool) {
 	}
 }
 
-// SelectiveClone clones src to dst, excluding paths matching the given globs.
-// If excludes is empty, falls back to a single full clone.
-func SelectiveClone(cloner Cloner, src, dst string, excludes []string) error {
-	if len(excludes) == 0 {
-		return cloner.Clone(src, dst)
-	}
+// DefaultConcurrency is the number of subtrees cloned at once when
+// Options.Concurrency is unset.
+const DefaultConcurrency = 8
 
-	plan, err := buildClonePlan(src, excludes)
-	if err != nil {
-		return fmt.Errorf("planning clone: %w", err)
-	}
+// Options configures SelectiveCloneWithOptions.
+type Options struct {
+	// Excludes lists gitignore-style patterns to skip, merged with any
+	// .groveignore files in the source.
+	Excludes []string
+	// Concurrency bounds how many independent subtrees are cloned at once.
+	// Values below 1 use DefaultConcurrency.
+	Concurrency int
+	// OnProgress, when set, receives scan and clone progress events.
+	OnProgress ProgressFunc
+	// CacheDir, when set, is where the clone plan is cached between runs.
+	// A cached plan is reused until a directory in the source changes.
+	CacheDir string
+	// Relocate lists gitignore-style patterns of files in which the source
+	// path is rewritten to the destination path after cloning. Absolute
+	// symlinks into the source are always retargeted.
+	Relocate []string
+	// OnRelocateSkip, when set, is called with each binary file that could
+	// not be relocated without changing its layout.
+	OnRelocateSkip func(rel string)
+}
 
-	return executeClonePlan(cloner, src, dst, ".", excludes, plan)
+// SelectiveClone clones src to dst, excluding paths matching the given
+// gitignore-style patterns or any .groveignore file in src.
+// If nothing is excluded, falls back to a single full clone.
+func SelectiveClone(ctx context.Context, cloner Cloner, src, dst string, excludes []string) error {
+	return SelectiveCloneWithOptions(ctx, cloner, src, dst, Options{Excludes: excludes})
 }
 
 // SelectiveCloneWithProgress clones src to dst with excludes and progress reporting.
-// If excludes is empty, falls back to the cloner's CloneWithProgress if available.
-func SelectiveCloneWithProgress(cloner Cloner, src, dst string, excludes []string, onProgress ProgressFunc) error {
-	if len(excludes) == 0 {
-		if pc, ok := cloner.(ProgressCloner); ok && onProgress != nil {
-			return pc.CloneWithProgress(src, dst, onProgress)
-		}
-		return cloner.Clone(src, dst)
-	}
+// If nothing is excluded, falls back to the cloner's CloneWithProgress if available.
+func SelectiveCloneWithProgress(ctx context.Context, cloner Cloner, src, dst string, excludes []string, onProgress ProgressFunc) error {
+	return SelectiveCloneWithOptions(ctx, cloner, src, dst, Options{Excludes: excludes, OnProgress: onProgress})
+}
 
-	plan, err := buildClonePlan(src, excludes)
+// SelectiveCloneWithOptions clones src to dst as configured by opts. When
+// paths are excluded, the remaining subtrees are cloned in parallel and the
+// first failure stops any work not yet started. The finished clone is then
+// relocated as described by opts.Relocate. Once ctx is done, no further
+// subtrees are started and in-flight clones are stopped; dst is left
+// partially written for the caller to remove.
+func SelectiveCloneWithOptions(ctx context.Context, cloner Cloner, src, dst string, opts Options) error {
+	plan, err := planClone(src, opts)
 	if err != nil {
 		return fmt.Errorf("planning clone: %w", err)
 	}
+	if err := clonePlanned(ctx, cloner, src, dst, plan, opts); err != nil {
+		return err
+	}
+	return relocateClone(src, dst, plan, opts.OnRelocateSkip)
+}
 
-	if onProgress != nil {
-		onProgress(ProgressEvent{Total: plan.totalEntries, Phase: "scan"})
+func clonePlanned(ctx context.Context, cloner Cloner, src, dst string, plan *clonePlan, opts Options) error {
+	onProgress := opts.OnProgress
+	total := treeTotals{entries: plan.totalEntries, bytes: plan.totalBytes}
+	if len(plan.excluded) == 0 {
+		if tc, ok := cloner.(totalCloner); ok && onProgress != nil {
+			return tc.cloneWithTotal(ctx, src, dst, total, onProgress)
+		}
+		if pc, ok := cloner.(ProgressCloner); ok && onProgress != nil {
+			return pc.CloneWithProgress(ctx, src, dst, onProgress)
+		}
+		return cloner.Clone(ctx, src, dst)
 	}
 
-	copied := 0
-	countingCloner := &progressTrackingCloner{
-		inner:      cloner,
-		copied:     &copied,
-		total:      plan.totalEntries,
-		onProgress: onProgress,
+	if onProgress != nil {
+		onProgress(ProgressEvent{Total: total.entries, BytesTotal: total.bytes, Phase: "scan"})
+		cloner = &progressTrackingCloner{
+			inner:      cloner,
+			total:      total,
+			onProgress: onProgress,
+			meter:      newRateMeter(),
+		}
 	}
 
-	return executeClonePlan(countingCloner, src, dst, ".", excludes, plan)
+	return executeClonePlan(ctx, cloner, src, dst, plan, opts.Concurrency)
 }
 
-// progressTrackingCloner wraps a Cloner and accumulates progress across multiple clone calls.
+// progressTrackingCloner wraps a Cloner and accumulates progress across
+// multiple, possibly concurrent, clone calls.
 type progressTrackingCloner struct {
 	inner      Cloner
-	copied     *int
-	total      int
+	total      treeTotals
 	onProgress ProgressFunc
+
+	// mu guards the counters and serializes onProgress, so events arrive
+	// in order with monotonically increasing Copied and Bytes counts.
+	mu     sync.Mutex
+	copied int
+	bytes  int64
+	meter  *rateMeter
 }
 
-func (p *progressTrackingCloner) Clone(src, dst string) error {
+func (p *progressTrackingCloner) Clone(ctx context.Context, src, dst string) error {
+	var (
+		prevCopied int
+		prevBytes  int64
+	)
+	track := func(e ProgressEvent) {
+		if e.Phase != "clone" {
+			return
+		}
+		p.add(e.Copied-prevCopied, e.Bytes-prevBytes)
+		prevCopied, prevBytes = e.Copied, e.Bytes
+	}
+	// The plan already holds the overall totals, so subtree clones need
+	// not count their own.
+	if tc, ok := p.inner.(totalCloner); ok && p.onProgress != nil {
+		return tc.cloneWithTotal(ctx, src, dst, treeTotals{}, track)
+	}
 	if pc, ok := p.inner.(ProgressCloner); ok && p.onProgress != nil {
-		prevCopied := 0
-		return pc.CloneWithProgress(src, dst, func(e ProgressEvent) {
-			if e.Phase != "clone" {
-				return
-			}
-			delta := e.Copied - prevCopied
-			prevCopied = e.Copied
-			*p.copied += delta
-			p.onProgress(ProgressEvent{
-				Copied: *p.copied,
-				Total:  p.total,
-				Phase:  "clone",
-			})
-		})
-	}
-	return p.inner.Clone(src, dst)
-}
-
-// executeClonePlan recursively clones children of srcDir into dstDir,
-// skipping excluded entries and recursing into directories that contain excludes.
-func executeClonePlan(cloner Cloner, srcRoot, dstRoot, rel string, excludes []string, plan *clonePlan) error {
-	srcDir := filepath.Join(srcRoot, rel)
-	dstDir := filepath.Join(dstRoot, rel)
+		return pc.CloneWithProgress(ctx, src, dst, track)
+	}
+	return p.inner.Clone(ctx, src, dst)
+}
+
+func (p *progressTrackingCloner) add(delta int, deltaBytes int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.copied += delta
+	p.bytes += deltaBytes
+	p.onProgress(ProgressEvent{
+		Copied:     p.copied,
+		Total:      p.total.entries,
+		Bytes:      p.bytes,
+		BytesTotal: p.total.bytes,
+		Rate:       p.meter.observe(p.bytes),
+		Phase:      "clone",
+	})
+}
 
-	if rel == "." {
-		srcDir = srcRoot
-		dstDir = dstRoot
+// executeClonePlan clones srcRoot into dstRoot following plan. Directories
+// containing excludes are recreated and descended into on the calling
+// goroutine; every other entry is an independent subtree handed to a pool of
+// at most concurrency workers.
+func executeClonePlan(ctx context.Context, cloner Cloner, srcRoot, dstRoot string, plan *clonePlan, concurrency int) error {
+	if concurrency < 1 {
+		concurrency = DefaultConcurrency
 	}
+	e := &planExecutor{
+		ctx:    ctx,
+		cloner: cloner,
+		plan:   plan,
+		sem:    make(chan struct{}, concurrency),
+	}
+	walkErr := e.walk(srcRoot, dstRoot, ".")
+	e.wg.Wait()
+	if err := e.failed(); err != nil {
+		return err
+	}
+	return walkErr
+}
+
+type planExecutor struct {
+	ctx    context.Context
+	cloner Cloner
+	plan   *clonePlan
+	sem    chan struct{}
+	wg     sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+// walk recreates the directory rel and schedules clones of its children,
+// skipping excluded entries and recursing into directories that contain
+// excludes. It returns early, without error, once a clone has failed or the
+// context is done.
+func (e *planExecutor) walk(srcRoot, dstRoot, rel string) error {
+	srcDir := filepath.Join(srcRoot, rel)
+	dstDir := filepath.Join(dstRoot, rel)
 
 	if err := os.MkdirAll(dstDir, 0755); err != nil {
 		return err
@@ -203,29 +366,55 @@ func executeClonePlan(cloner Cloner, srcRoot, dstRoot, rel string, excludes []st
 	}
 
 	for _, entry := range entries {
-		childRel := filepath.Join(rel, entry.Name())
-		if rel == "." {
-			childRel = entry.Name()
+		if e.failed() != nil {
+			return nil
 		}
 
-		if isExcluded(childRel, excludes) {
+		childRel := filepath.Join(rel, entry.Name())
+		if isExcluded(childRel, entry.IsDir(), e.plan.matcher) {
 			continue
 		}
 
-		childSrc := filepath.Join(srcDir, entry.Name())
-		childDst := filepath.Join(dstDir, entry.Name())
-
-		if entry.IsDir() && plan.dirsWithExcludes[childRel] {
-			if err := executeClonePlan(cloner, srcRoot, dstRoot, childRel, excludes, plan); err != nil {
+		if entry.IsDir() && e.plan.dirsWithExcludes[childRel] {
+			if err := e.walk(srcRoot, dstRoot, childRel); err != nil {
 				return err
 			}
 			continue
 		}
 
 		// Fast path: clone the entire entry with a single cp -c -R
-		if err := cloner.Clone(childSrc, childDst); err != nil {
-			return err
-		}
+		e.schedule(filepath.Join(srcDir, entry.Name()), filepath.Join(dstDir, entry.Name()))
 	}
 	return nil
 }
+
+// schedule clones src to dst on a worker once one is free.
+func (e *planExecutor) schedule(src, dst string) {
+	e.sem <- struct{}{}
+	if e.failed() != nil {
+		<-e.sem
+		return
+	}
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		defer func() { <-e.sem }()
+		if err := e.cloner.Clone(e.ctx, src, dst); err != nil {
+			e.mu.Lock()
+			if e.err == nil {
+				e.err = err
+			}
+			e.mu.Unlock()
+		}
+	}()
+}
+
+// failed returns the first clone error, or ctx's error once it is done.
+func (e *planExecutor) failed() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err != nil {
+		return e.err
+	}
+	return e.ctx.Err()
+}
@@ -1,64 +1,42 @@
 package clone
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
-	"runtime"
+	"sync"
 	"testing"
-)
+	"time"
 
-func TestMatchExclude(t *testing.T) {
-	tests := []struct {
-		name    string
-		pattern string
-		relPath string
-		want    bool
-	}{
-		// Basename matching (no / in pattern)
-		{"basename wildcard matches file", "*.lock", "yarn.lock", true},
-		{"basename wildcard matches nested file", "*.lock", "packages/foo/yarn.lock", true},
-		{"basename wildcard no match", "*.lock", "yarn.txt", false},
-		{"basename exact matches dir", "__pycache__", "__pycache__", true},
-		{"basename exact matches nested dir", "__pycache__", "src/lib/__pycache__", true},
-		{"basename exact no match", "__pycache__", "pycache", false},
-
-		// Path matching (/ in pattern)
-		{"path pattern matches exact", ".gradle/configuration-cache", ".gradle/configuration-cache", true},
-		{"path pattern no match at wrong depth", ".gradle/configuration-cache", "sub/.gradle/configuration-cache", false},
-		{"path pattern no match partial", ".gradle/configuration-cache", ".gradle/caches", false},
-
-		// Edge cases
-		{"empty relPath", "*.lock", "", false},
-		{"root file basename match", "*.lock", "package.lock", true},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := matchExclude(tt.pattern, tt.relPath)
-			if got != tt.want {
-				t.Errorf("matchExclude(%q, %q) = %v, want %v", tt.pattern, tt.relPath, got, tt.want)
-			}
-		})
-	}
-}
+	"github.com/chrisbanes/grove/internal/ignore"
+)
 
 func TestIsExcluded(t *testing.T) {
-	excludes := []string{"*.lock", "__pycache__", ".gradle/configuration-cache"}
+	m, err := ignore.New([]string{"*.lock", "__pycache__", ".gradle/configuration-cache", "build/", "*.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	tests := []struct {
 		name    string
 		relPath string
+		isDir   bool
 		want    bool
 	}{
-		{"matches wildcard", "packages/yarn.lock", true},
-		{"matches basename", "src/__pycache__", true},
-		{"matches path", ".gradle/configuration-cache", true},
-		{"no match", "src/main.go", false},
-		{"grove dir never excluded", ".grove", false},
-		{"grove subpath never excluded", ".grove/config.json", false},
+		{"matches wildcard", "packages/yarn.lock", false, true},
+		{"matches basename", "src/__pycache__", true, true},
+		{"matches path", ".gradle/configuration-cache", true, true},
+		{"dir-only matches dir", "app/build", true, true},
+		{"dir-only skips file", "app/build", false, false},
+		{"no match", "src/main.go", false, false},
+		{"grove dir never excluded", ".grove", true, false},
+		{"grove subpath never excluded", ".grove/config.json", false, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := isExcluded(tt.relPath, excludes)
+			got := isExcluded(tt.relPath, tt.isDir, m)
 			if got != tt.want {
 				t.Errorf("isExcluded(%q, ...) = %v, want %v", tt.relPath, got, tt.want)
 			}
@@ -72,7 +50,7 @@ func TestBuildClonePlan_NoExcludes(t *testing.T) {
 	os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0644)
 	os.WriteFile(filepath.Join(src, "sub", "b.txt"), []byte("b"), 0644)
 
-	plan, err := buildClonePlan(src, nil)
+	plan, err := buildClonePlan(src, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -92,7 +70,7 @@ func TestBuildClonePlan_WithExcludes(t *testing.T) {
 	os.WriteFile(filepath.Join(src, "root.lock"), []byte("lock"), 0644)
 	os.WriteFile(filepath.Join(src, "keep.txt"), []byte("keep"), 0644)
 
-	plan, err := buildClonePlan(src, []string{"*.lock"})
+	plan, err := buildClonePlan(src, []string{"*.lock"}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -118,7 +96,7 @@ func TestBuildClonePlan_ExcludedDirSkipsDescendants(t *testing.T) {
 	os.WriteFile(filepath.Join(src, "__pycache__", "deep", "file.pyc"), []byte("pyc"), 0644)
 	os.WriteFile(filepath.Join(src, "keep.txt"), []byte("keep"), 0644)
 
-	plan, err := buildClonePlan(src, []string{"__pycache__"})
+	plan, err := buildClonePlan(src, []string{"__pycache__"}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -136,7 +114,7 @@ func TestBuildClonePlan_PathPatternExclude(t *testing.T) {
 	os.WriteFile(filepath.Join(src, ".gradle", "configuration-cache", "data.bin"), []byte("data"), 0644)
 	os.WriteFile(filepath.Join(src, ".gradle", "caches", "deps.jar"), []byte("jar"), 0644)
 
-	plan, err := buildClonePlan(src, []string{".gradle/configuration-cache"})
+	plan, err := buildClonePlan(src, []string{".gradle/configuration-cache"}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -147,19 +125,104 @@ func TestBuildClonePlan_PathPatternExclude(t *testing.T) {
 	}
 }
 
-func TestSelectiveClone_NoExcludes(t *testing.T) {
-	if runtime.GOOS != "darwin" {
-		t.Skip("APFS tests only run on macOS")
+func TestBuildClonePlan_GitignoreSemantics(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "build"), 0755)
+	os.MkdirAll(filepath.Join(src, "app", "build"), 0755)
+	os.WriteFile(filepath.Join(src, "build", "out.bin"), []byte("out"), 0644)
+	os.WriteFile(filepath.Join(src, "app", "build", "out.bin"), []byte("out"), 0644)
+	os.WriteFile(filepath.Join(src, "debug.log"), []byte("log"), 0644)
+	os.WriteFile(filepath.Join(src, "keep.log"), []byte("log"), 0644)
+
+	plan, err := buildClonePlan(src, []string{"/build/", "*.log", "!keep.log"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// root, app, app/build, app/build/out.bin, keep.log = 5
+	if plan.totalEntries != 5 {
+		t.Errorf("expected 5 entries, got %d", plan.totalEntries)
 	}
+	if plan.dirsWithExcludes["app"] {
+		t.Error("anchored /build/ should not exclude app/build")
+	}
+}
+
+func TestBuildClonePlan_InvalidPattern(t *testing.T) {
+	if _, err := buildClonePlan(t.TempDir(), []string{"[invalid"}, nil); err == nil {
+		t.Fatal("expected error for invalid pattern")
+	}
+}
+
+func TestBuildClonePlan_GroveignoreFiles(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "web", "dist"), 0755)
+	os.MkdirAll(filepath.Join(src, "web", "src"), 0755)
+	os.MkdirAll(filepath.Join(src, "dist"), 0755)
+	os.MkdirAll(filepath.Join(src, "vendor"), 0755)
+	os.WriteFile(filepath.Join(src, ".groveignore"), []byte("# root\nvendor/\n"), 0644)
+	os.WriteFile(filepath.Join(src, "web", ".groveignore"), []byte("/dist/\n*.map\n"), 0644)
+	// Never read: its directory is excluded.
+	os.WriteFile(filepath.Join(src, "vendor", ".groveignore"), []byte("[bad\n"), 0644)
+	os.WriteFile(filepath.Join(src, "web", "src", "app.js.map"), []byte("map"), 0644)
+	os.WriteFile(filepath.Join(src, "web", "src", "app.js"), []byte("js"), 0644)
+	os.WriteFile(filepath.Join(src, "dist", "keep.txt"), []byte("keep"), 0644)
+
+	plan, err := buildClonePlan(src, []string{"*.lock"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type origin struct {
+		source string
+		line   int
+	}
+	got := make(map[string]origin)
+	for _, e := range plan.excluded {
+		got[e.Path] = origin{e.Pattern.Source, e.Pattern.Line}
+	}
+	want := map[string]origin{
+		"vendor":             {".groveignore", 2},
+		"web/dist":           {"web/.groveignore", 1},
+		"web/src/app.js.map": {"web/.groveignore", 2},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("excluded = %v, want %v", got, want)
+	}
+	for path, o := range want {
+		if got[path] != o {
+			t.Errorf("%s excluded by %v, want %v", path, got[path], o)
+		}
+	}
+}
+
+func TestExcludedPaths_ReportsConfigPatterns(t *testing.T) {
+	src := t.TempDir()
+	os.WriteFile(filepath.Join(src, "yarn.lock"), []byte("lock"), 0644)
+	os.WriteFile(filepath.Join(src, "main.go"), []byte("go"), 0644)
+
+	excluded, err := ExcludedPaths(src, []string{"*.lock"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(excluded) != 1 || excluded[0].Path != "yarn.lock" || excluded[0].Pattern.Raw != "*.lock" {
+		t.Fatalf("unexpected exclusions: %+v", excluded)
+	}
+	if excluded[0].Pattern.Source != "" {
+		t.Errorf("config pattern should have no source file, got %q", excluded[0].Pattern.Source)
+	}
+}
+
+func TestSelectiveClone_NoExcludes(t *testing.T) {
 	src := t.TempDir()
 	os.MkdirAll(filepath.Join(src, "sub"), 0755)
 	os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0644)
 	os.WriteFile(filepath.Join(src, "sub", "b.txt"), []byte("b"), 0644)
 
 	dst := filepath.Join(t.TempDir(), "clone")
-	c, _ := NewCloner(src)
+	c := newTestCloner(t, src)
 
-	if err := SelectiveClone(c, src, dst, nil); err != nil {
+	if err := SelectiveClone(t.Context(), c, src, dst, nil); err != nil {
 		t.Fatal(err)
 	}
 
@@ -180,9 +243,6 @@ func TestSelectiveClone_NoExcludes(t *testing.T) {
 }
 
 func TestSelectiveClone_ExcludesTopLevel(t *testing.T) {
-	if runtime.GOOS != "darwin" {
-		t.Skip("APFS tests only run on macOS")
-	}
 	src := t.TempDir()
 	os.MkdirAll(filepath.Join(src, "keep"), 0755)
 	os.MkdirAll(filepath.Join(src, "__pycache__"), 0755)
@@ -190,9 +250,9 @@ func TestSelectiveClone_ExcludesTopLevel(t *testing.T) {
 	os.WriteFile(filepath.Join(src, "__pycache__", "module.pyc"), []byte("pyc"), 0644)
 
 	dst := filepath.Join(t.TempDir(), "clone")
-	c, _ := NewCloner(src)
+	c := newTestCloner(t, src)
 
-	if err := SelectiveClone(c, src, dst, []string{"__pycache__"}); err != nil {
+	if err := SelectiveClone(t.Context(), c, src, dst, []string{"__pycache__"}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -205,9 +265,6 @@ func TestSelectiveClone_ExcludesTopLevel(t *testing.T) {
 }
 
 func TestSelectiveClone_ExcludesNestedFile(t *testing.T) {
-	if runtime.GOOS != "darwin" {
-		t.Skip("APFS tests only run on macOS")
-	}
 	src := t.TempDir()
 	os.MkdirAll(filepath.Join(src, "pkg", "foo"), 0755)
 	os.WriteFile(filepath.Join(src, "pkg", "foo", "main.go"), []byte("go"), 0644)
@@ -215,9 +272,9 @@ func TestSelectiveClone_ExcludesNestedFile(t *testing.T) {
 	os.WriteFile(filepath.Join(src, "root.txt"), []byte("root"), 0644)
 
 	dst := filepath.Join(t.TempDir(), "clone")
-	c, _ := NewCloner(src)
+	c := newTestCloner(t, src)
 
-	if err := SelectiveClone(c, src, dst, []string{"*.lock"}); err != nil {
+	if err := SelectiveClone(t.Context(), c, src, dst, []string{"*.lock"}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -233,9 +290,6 @@ func TestSelectiveClone_ExcludesNestedFile(t *testing.T) {
 }
 
 func TestSelectiveClone_PathPatternExclude(t *testing.T) {
-	if runtime.GOOS != "darwin" {
-		t.Skip("APFS tests only run on macOS")
-	}
 	src := t.TempDir()
 	os.MkdirAll(filepath.Join(src, ".gradle", "configuration-cache"), 0755)
 	os.MkdirAll(filepath.Join(src, ".gradle", "caches"), 0755)
@@ -243,9 +297,9 @@ func TestSelectiveClone_PathPatternExclude(t *testing.T) {
 	os.WriteFile(filepath.Join(src, ".gradle", "caches", "deps.jar"), []byte("jar"), 0644)
 
 	dst := filepath.Join(t.TempDir(), "clone")
-	c, _ := NewCloner(src)
+	c := newTestCloner(t, src)
 
-	if err := SelectiveClone(c, src, dst, []string{".gradle/configuration-cache"}); err != nil {
+	if err := SelectiveClone(t.Context(), c, src, dst, []string{".gradle/configuration-cache"}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -258,9 +312,6 @@ func TestSelectiveClone_PathPatternExclude(t *testing.T) {
 }
 
 func TestSelectiveCloneWithProgress_ReportsCorrectTotal(t *testing.T) {
-	if runtime.GOOS != "darwin" {
-		t.Skip("APFS tests only run on macOS")
-	}
 	src := t.TempDir()
 	os.MkdirAll(filepath.Join(src, "keep"), 0755)
 	os.MkdirAll(filepath.Join(src, "__pycache__"), 0755)
@@ -269,7 +320,7 @@ func TestSelectiveCloneWithProgress_ReportsCorrectTotal(t *testing.T) {
 	os.WriteFile(filepath.Join(src, "root.txt"), []byte("root"), 0644)
 
 	dst := filepath.Join(t.TempDir(), "clone")
-	c, _ := NewCloner(src)
+	c := newTestCloner(t, src)
 
 	var scanTotal int
 	var lastCopied int
@@ -282,7 +333,7 @@ func TestSelectiveCloneWithProgress_ReportsCorrectTotal(t *testing.T) {
 		}
 	}
 
-	if err := SelectiveCloneWithProgress(c, src, dst, []string{"__pycache__"}, onProgress); err != nil {
+	if err := SelectiveCloneWithProgress(t.Context(), c, src, dst, []string{"__pycache__"}, onProgress); err != nil {
 		t.Fatal(err)
 	}
 
@@ -296,14 +347,11 @@ func TestSelectiveCloneWithProgress_ReportsCorrectTotal(t *testing.T) {
 }
 
 func TestSelectiveCloneWithProgress_NoExcludesFallback(t *testing.T) {
-	if runtime.GOOS != "darwin" {
-		t.Skip("APFS tests only run on macOS")
-	}
 	src := t.TempDir()
 	os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0644)
 
 	dst := filepath.Join(t.TempDir(), "clone")
-	c, _ := NewCloner(src)
+	c := newTestCloner(t, src)
 
 	var gotScan bool
 	onProgress := func(e ProgressEvent) {
@@ -312,7 +360,7 @@ func TestSelectiveCloneWithProgress_NoExcludesFallback(t *testing.T) {
 		}
 	}
 
-	if err := SelectiveCloneWithProgress(c, src, dst, nil, onProgress); err != nil {
+	if err := SelectiveCloneWithProgress(t.Context(), c, src, dst, nil, onProgress); err != nil {
 		t.Fatal(err)
 	}
 	if !gotScan {
@@ -321,17 +369,14 @@ func TestSelectiveCloneWithProgress_NoExcludesFallback(t *testing.T) {
 }
 
 func TestSelectiveClone_GroveDirNeverExcluded(t *testing.T) {
-	if runtime.GOOS != "darwin" {
-		t.Skip("APFS tests only run on macOS")
-	}
 	src := t.TempDir()
 	os.MkdirAll(filepath.Join(src, ".grove"), 0755)
 	os.WriteFile(filepath.Join(src, ".grove", "config.json"), []byte("{}"), 0644)
 
 	dst := filepath.Join(t.TempDir(), "clone")
-	c, _ := NewCloner(src)
+	c := newTestCloner(t, src)
 
-	if err := SelectiveClone(c, src, dst, []string{".grove"}); err != nil {
+	if err := SelectiveClone(t.Context(), c, src, dst, []string{".grove"}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -339,3 +384,138 @@ func TestSelectiveClone_GroveDirNeverExcluded(t *testing.T) {
 		t.Error(".grove/config.json should exist despite exclude pattern")
 	}
 }
+
+// fakePlanCloner records clone calls without touching dst, optionally
+// failing on one source and emitting progress per call.
+type fakePlanCloner struct {
+	delay  time.Duration
+	failOn string
+	events int
+	// onCloned, when set, is called after each successful clone.
+	onCloned func(name string)
+
+	mu          sync.Mutex
+	cloned      []string
+	inFlight    int
+	maxInFlight int
+}
+
+func (f *fakePlanCloner) Clone(ctx context.Context, src, dst string) error {
+	return f.CloneWithProgress(ctx, src, dst, nil)
+}
+
+func (f *fakePlanCloner) CloneWithProgress(_ context.Context, src, dst string, onProgress ProgressFunc) error {
+	f.mu.Lock()
+	f.inFlight++
+	f.maxInFlight = max(f.maxInFlight, f.inFlight)
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+
+	time.Sleep(f.delay)
+	if filepath.Base(src) == f.failOn {
+		return errors.New("clone failed")
+	}
+	for i := 1; i <= f.events && onProgress != nil; i++ {
+		onProgress(ProgressEvent{Copied: i, Phase: "clone"})
+	}
+	f.mu.Lock()
+	f.cloned = append(f.cloned, filepath.Base(src))
+	f.mu.Unlock()
+	if f.onCloned != nil {
+		f.onCloned(filepath.Base(src))
+	}
+	return nil
+}
+
+// planSource creates n top-level files plus an excluded one, so selective
+// clones go through the plan executor.
+func planSource(t *testing.T, n int) string {
+	t.Helper()
+	src := t.TempDir()
+	for i := range n {
+		os.WriteFile(filepath.Join(src, fmt.Sprintf("f%02d", i)), nil, 0644)
+	}
+	os.WriteFile(filepath.Join(src, "skip.lock"), nil, 0644)
+	return src
+}
+
+func TestSelectiveCloneWithOptions_BoundsConcurrency(t *testing.T) {
+	src := planSource(t, 12)
+	c := &fakePlanCloner{delay: 10 * time.Millisecond}
+
+	opts := Options{Excludes: []string{"*.lock"}, Concurrency: 3}
+	if err := SelectiveCloneWithOptions(t.Context(), c, src, filepath.Join(t.TempDir(), "clone"), opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.cloned) != 12 {
+		t.Errorf("cloned %d entries, want 12", len(c.cloned))
+	}
+	if c.maxInFlight > 3 {
+		t.Errorf("max concurrent clones = %d, want <= 3", c.maxInFlight)
+	}
+}
+
+func TestSelectiveCloneWithOptions_StopsOnFirstError(t *testing.T) {
+	src := planSource(t, 10)
+	c := &fakePlanCloner{failOn: "f02"}
+
+	opts := Options{Excludes: []string{"*.lock"}, Concurrency: 1}
+	err := SelectiveCloneWithOptions(t.Context(), c, src, filepath.Join(t.TempDir(), "clone"), opts)
+	if err == nil {
+		t.Fatal("expected clone error")
+	}
+	// With one worker, f00 and f01 finish before f02 fails. f03 may already
+	// be waiting for the worker, but nothing after it is started.
+	if len(c.cloned) > 3 {
+		t.Errorf("expected work to stop after the failure, cloned %v", c.cloned)
+	}
+}
+
+func TestSelectiveCloneWithOptions_StopsWhenCancelled(t *testing.T) {
+	src := planSource(t, 10)
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	c := &fakePlanCloner{onCloned: func(name string) {
+		if name == "f02" {
+			cancel()
+		}
+	}}
+
+	opts := Options{Excludes: []string{"*.lock"}, Concurrency: 1}
+	err := SelectiveCloneWithOptions(ctx, c, src, filepath.Join(t.TempDir(), "clone"), opts)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+	if len(c.cloned) > 4 {
+		t.Errorf("expected work to stop after cancellation, cloned %v", c.cloned)
+	}
+}
+
+func TestSelectiveCloneWithOptions_AggregatesConcurrentProgress(t *testing.T) {
+	src := planSource(t, 16)
+	c := &fakePlanCloner{events: 5}
+
+	var events []ProgressEvent
+	onProgress := func(e ProgressEvent) {
+		events = append(events, e)
+	}
+	opts := Options{Excludes: []string{"*.lock"}, Concurrency: 8, OnProgress: onProgress}
+	if err := SelectiveCloneWithOptions(t.Context(), c, src, filepath.Join(t.TempDir(), "clone"), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	last := 0
+	for _, e := range events[1:] {
+		if e.Copied != last+1 {
+			t.Fatalf("progress not monotonic: %d after %d", e.Copied, last)
+		}
+		last = e.Copied
+	}
+	if last != 16*5 {
+		t.Errorf("final copied = %d, want %d", last, 16*5)
+	}
+}
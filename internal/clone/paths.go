@@ -0,0 +1,125 @@
+package clone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ClonePaths clones the given entries of src to the same places under dst,
+// leaving out whatever opts.Excludes and the .groveignore files in src
+// exclude. paths are slash-separated and relative to src, with directories
+// marked by a trailing slash, as reported by git. Parent directories are
+// created in dst as needed, and entries removed from src since they were
+// listed are skipped.
+//
+// Unlike SelectiveCloneWithOptions, the result is not relocated: dst holds
+// more than the cloned paths, so callers relocate it once it is complete.
+func ClonePaths(ctx context.Context, cloner Cloner, src, dst string, paths []string, opts Options) error {
+	plan, err := planClone(src, Options{Excludes: opts.Excludes, CacheDir: opts.CacheDir})
+	if err != nil {
+		return fmt.Errorf("planning clone: %w", err)
+	}
+
+	var selected []string
+	for _, entry := range paths {
+		rel := strings.TrimSuffix(entry, "/")
+		if rel == "" || excludedWithAncestors(rel, strings.HasSuffix(entry, "/"), plan.matcher) {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(src, filepath.FromSlash(rel))); errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		selected = append(selected, filepath.FromSlash(rel))
+	}
+
+	if opts.OnProgress != nil {
+		total, err := countSelected(src, selected, plan)
+		if err != nil {
+			return err
+		}
+		opts.OnProgress(ProgressEvent{Total: total.entries, BytesTotal: total.bytes, Phase: "scan"})
+		cloner = &progressTrackingCloner{
+			inner:      cloner,
+			total:      total,
+			onProgress: opts.OnProgress,
+			meter:      newRateMeter(),
+		}
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = DefaultConcurrency
+	}
+	e := &planExecutor{
+		ctx:    ctx,
+		cloner: cloner,
+		plan:   plan,
+		sem:    make(chan struct{}, concurrency),
+	}
+	walkErr := func() error {
+		for _, rel := range selected {
+			if e.failed() != nil {
+				return nil
+			}
+			if err := os.MkdirAll(filepath.Join(dst, filepath.Dir(rel)), 0755); err != nil {
+				return err
+			}
+			if e.plan.dirsWithExcludes[rel] {
+				if err := e.walk(src, dst, rel); err != nil {
+					return err
+				}
+				continue
+			}
+			e.schedule(filepath.Join(src, rel), filepath.Join(dst, rel))
+		}
+		return nil
+	}()
+	e.wg.Wait()
+	if err := e.failed(); err != nil {
+		return err
+	}
+	return walkErr
+}
+
+// countSelected returns the totals of the entries under each of rels that
+// plan keeps.
+func countSelected(src string, rels []string, plan *clonePlan) (treeTotals, error) {
+	var t treeTotals
+	for _, rel := range rels {
+		err := filepath.WalkDir(filepath.Join(src, rel), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			entryRel, err := filepath.Rel(src, path)
+			if err != nil {
+				return err
+			}
+			if entryRel != rel && isExcluded(entryRel, d.IsDir(), plan.matcher) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			t.entries++
+			if d.Type().IsRegular() {
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				t.bytes += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return treeTotals{}, err
+		}
+	}
+	return t, nil
+}
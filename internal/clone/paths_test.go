@@ -0,0 +1,66 @@
+package clone
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClonePaths_ClonesOnlyListedPaths(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "build", "cache"), 0755)
+	os.MkdirAll(filepath.Join(src, "app", "gen"), 0755)
+	os.MkdirAll(filepath.Join(src, ".grove", "hooks"), 0755)
+	os.WriteFile(filepath.Join(src, ".grove", "hooks", "post-clone"), []byte("#!/bin/sh"), 0755)
+	os.WriteFile(filepath.Join(src, "main.go"), []byte("tracked"), 0644)
+	os.WriteFile(filepath.Join(src, "build", "out.o"), []byte("obj"), 0644)
+	os.WriteFile(filepath.Join(src, "build", "cache", "entry"), []byte("cache"), 0644)
+	os.WriteFile(filepath.Join(src, "app", "gen", "R.java"), []byte("gen"), 0644)
+	os.WriteFile(filepath.Join(src, ".env"), []byte("env"), 0644)
+
+	dst := t.TempDir()
+	paths := []string{".grove/", "build/", "app/gen/", ".env", "removed.log"}
+	opts := Options{Excludes: []string{"build/cache/", ".grove/"}}
+	if err := ClonePaths(t.Context(), &CopyCloner{Root: src}, src, dst, paths, opts); err != nil {
+		t.Fatalf("ClonePaths() error = %v", err)
+	}
+
+	for _, rel := range []string{".grove/hooks/post-clone", "build/out.o", "app/gen/R.java", ".env"} {
+		if _, err := os.Stat(filepath.Join(dst, rel)); err != nil {
+			t.Errorf("%s was not cloned: %v", rel, err)
+		}
+	}
+	for _, rel := range []string{"main.go", "build/cache"} {
+		if _, err := os.Stat(filepath.Join(dst, rel)); !os.IsNotExist(err) {
+			t.Errorf("%s should not be cloned: %v", rel, err)
+		}
+	}
+}
+
+func TestClonePaths_ReportsProgressForListedPaths(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "build"), 0755)
+	os.WriteFile(filepath.Join(src, "main.go"), []byte("tracked"), 0644)
+	os.WriteFile(filepath.Join(src, "build", "a.o"), []byte("aaaa"), 0644)
+	os.WriteFile(filepath.Join(src, "build", "b.o"), []byte("bb"), 0644)
+
+	var scan, last ProgressEvent
+	opts := Options{OnProgress: func(e ProgressEvent) {
+		if e.Phase == "scan" {
+			scan = e
+		} else {
+			last = e
+		}
+	}}
+	if err := ClonePaths(t.Context(), &CopyCloner{Root: src}, src, t.TempDir(), []string{"build/"}, opts); err != nil {
+		t.Fatalf("ClonePaths() error = %v", err)
+	}
+
+	// build, build/a.o and build/b.o; main.go is not listed.
+	if scan.Total != 3 || scan.BytesTotal != 6 {
+		t.Errorf("scan totals = %d entries, %d bytes, want 3 and 6", scan.Total, scan.BytesTotal)
+	}
+	if last.Bytes != 6 {
+		t.Errorf("cloned %d bytes, want 6", last.Bytes)
+	}
+}
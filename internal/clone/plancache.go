@@ -0,0 +1,213 @@
+package clone
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chrisbanes/grove/internal/ignore"
+)
+
+// planCacheVersion is bumped whenever the cached plan format or the meaning
+// of a plan changes, so stale caches from older versions are rebuilt.
+const planCacheVersion = 3
+
+// stamp records the modification time (and, for files, size) of a path
+// relative to the clone source.
+type stamp struct {
+	Path    string `json:"p"`
+	ModTime int64  `json:"m"`
+	Size    int64  `json:"s,omitempty"`
+}
+
+func newStamp(rel string, info fs.FileInfo) stamp {
+	s := stamp{Path: filepath.ToSlash(rel), ModTime: info.ModTime().UnixNano()}
+	if !info.IsDir() {
+		s.Size = info.Size()
+	}
+	return s
+}
+
+// current reports whether the path still has the recorded metadata.
+func (s stamp) current(root string) bool {
+	info, err := os.Lstat(filepath.Join(root, filepath.FromSlash(s.Path)))
+	if err != nil {
+		return false
+	}
+	return newStamp(s.Path, info) == s
+}
+
+type cachedExclusion struct {
+	Path string `json:"path"`
+	Dir  bool   `json:"dir,omitempty"`
+}
+
+// planCache is the on-disk form of a clonePlan.
+//
+// Adding, removing or renaming an entry updates its directory's mtime, so
+// the recorded directory stamps are enough to tell whether the entry count
+// and exclusions still hold. .groveignore files are stamped separately since
+// editing one does not touch its directory. TotalBytes is only an estimate,
+// since rewriting a file in place leaves the plan current.
+type planCache struct {
+	Version          int               `json:"version"`
+	Source           string            `json:"source"`
+	Excludes         []string          `json:"excludes"`
+	Relocate         []string          `json:"relocate,omitempty"`
+	TotalEntries     int               `json:"total_entries"`
+	TotalBytes       int64             `json:"total_bytes"`
+	DirsWithExcludes []string          `json:"dirs_with_excludes"`
+	Excluded         []cachedExclusion `json:"excluded"`
+	Dirs             []stamp           `json:"dirs"`
+	IgnoreFiles      []stamp           `json:"ignore_files"`
+	Symlinks         []string          `json:"symlinks,omitempty"`
+	RelocateFiles    []string          `json:"relocate_files,omitempty"`
+}
+
+// planClone returns the plan for cloning src, reusing the cached plan in
+// opts.CacheDir when it is still current. Cache failures are not fatal; the
+// plan is simply rebuilt.
+func planClone(src string, opts Options) (*clonePlan, error) {
+	if opts.CacheDir == "" {
+		return buildClonePlan(src, opts.Excludes, opts.Relocate)
+	}
+	path := planCachePath(opts.CacheDir, src, opts.Excludes, opts.Relocate)
+	if plan := loadCachedPlan(path, src, opts.Excludes, opts.Relocate); plan != nil {
+		return plan, nil
+	}
+	plan, err := buildClonePlan(src, opts.Excludes, opts.Relocate)
+	if err != nil {
+		return nil, err
+	}
+	_ = saveCachedPlan(path, src, opts.Excludes, opts.Relocate, plan)
+	return plan, nil
+}
+
+// planCachePath returns the cache file for src and its exclude and relocate
+// patterns. The key covers all of them, so changing either pattern set
+// never reuses an old plan.
+func planCachePath(cacheDir, src string, excludes, relocate []string) string {
+	if abs, err := filepath.Abs(src); err == nil {
+		src = abs
+	}
+	key := src + "\x00" + strings.Join(excludes, "\x00") + "\x01" + strings.Join(relocate, "\x00")
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(cacheDir, hex.EncodeToString(sum[:12])+".json")
+}
+
+// loadCachedPlan returns the cached plan at path, or nil if there is none or
+// any recorded directory or .groveignore file has changed.
+func loadCachedPlan(path, src string, excludes, relocate []string) *clonePlan {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var c planCache
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil
+	}
+	if c.Version != planCacheVersion ||
+		strings.Join(c.Excludes, "\x00") != strings.Join(excludes, "\x00") ||
+		strings.Join(c.Relocate, "\x00") != strings.Join(relocate, "\x00") {
+		return nil
+	}
+	if abs, err := filepath.Abs(src); err != nil || abs != c.Source {
+		return nil
+	}
+	for _, s := range c.IgnoreFiles {
+		if !s.current(src) {
+			return nil
+		}
+	}
+	for _, s := range c.Dirs {
+		if !s.current(src) {
+			return nil
+		}
+	}
+
+	// Rebuild the matcher in the order the walk loaded it.
+	matcher, err := ignore.New(excludes)
+	if err != nil {
+		return nil
+	}
+	for _, s := range c.IgnoreFiles {
+		patterns, err := ignore.ReadFile(src, filepath.ToSlash(filepath.Dir(s.Path)))
+		if err != nil {
+			return nil
+		}
+		matcher.Add(patterns...)
+	}
+
+	plan := &clonePlan{
+		totalEntries:     c.TotalEntries,
+		totalBytes:       c.TotalBytes,
+		dirsWithExcludes: make(map[string]bool, len(c.DirsWithExcludes)),
+		matcher:          matcher,
+		dirs:             c.Dirs,
+		ignoreFiles:      c.IgnoreFiles,
+		symlinks:         c.Symlinks,
+		relocate:         c.RelocateFiles,
+	}
+	for _, d := range c.DirsWithExcludes {
+		plan.dirsWithExcludes[filepath.FromSlash(d)] = true
+	}
+	for _, e := range c.Excluded {
+		p := excludedBy(e.Path, e.Dir, matcher)
+		if p == nil {
+			return nil
+		}
+		plan.excluded = append(plan.excluded, Exclusion{Path: e.Path, IsDir: e.Dir, Pattern: p})
+	}
+	return plan
+}
+
+// saveCachedPlan writes plan to path atomically.
+func saveCachedPlan(path, src string, excludes, relocate []string, plan *clonePlan) error {
+	abs, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+	c := planCache{
+		Version:       planCacheVersion,
+		Source:        abs,
+		Excludes:      excludes,
+		Relocate:      relocate,
+		TotalEntries:  plan.totalEntries,
+		TotalBytes:    plan.totalBytes,
+		Dirs:          plan.dirs,
+		IgnoreFiles:   plan.ignoreFiles,
+		Symlinks:      plan.symlinks,
+		RelocateFiles: plan.relocate,
+	}
+	for d := range plan.dirsWithExcludes {
+		c.DirsWithExcludes = append(c.DirsWithExcludes, filepath.ToSlash(d))
+	}
+	for _, e := range plan.excluded {
+		c.Excluded = append(c.Excluded, cachedExclusion{Path: e.Path, Dir: e.IsDir})
+	}
+	data, err := json.Marshal(&c)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".plan-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
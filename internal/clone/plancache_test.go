@@ -0,0 +1,170 @@
+package clone
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func planCacheSource(t *testing.T) string {
+	t.Helper()
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "pkg", "foo"), 0755)
+	os.MkdirAll(filepath.Join(src, "web", "dist"), 0755)
+	os.WriteFile(filepath.Join(src, "pkg", "foo", "main.go"), []byte("go"), 0644)
+	os.WriteFile(filepath.Join(src, "pkg", "foo", "yarn.lock"), []byte("lock"), 0644)
+	os.WriteFile(filepath.Join(src, "web", ".groveignore"), []byte("/dist/\n"), 0644)
+	os.WriteFile(filepath.Join(src, "web", "dist", "app.js"), []byte("js"), 0644)
+	return src
+}
+
+func TestPlanClone_ReusesCachedPlan(t *testing.T) {
+	src := planCacheSource(t)
+	opts := Options{Excludes: []string{"*.lock"}, CacheDir: t.TempDir()}
+
+	built, err := planClone(src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := planCachePath(opts.CacheDir, src, opts.Excludes, nil)
+	cached := loadCachedPlan(path, src, opts.Excludes, nil)
+	if cached == nil {
+		t.Fatal("expected plan to be cached")
+	}
+
+	if cached.totalEntries != built.totalEntries {
+		t.Errorf("cached total = %d, want %d", cached.totalEntries, built.totalEntries)
+	}
+	if cached.totalBytes != built.totalBytes {
+		t.Errorf("cached bytes = %d, want %d", cached.totalBytes, built.totalBytes)
+	}
+	if !reflect.DeepEqual(cached.dirsWithExcludes, built.dirsWithExcludes) {
+		t.Errorf("cached dirsWithExcludes = %v, want %v", cached.dirsWithExcludes, built.dirsWithExcludes)
+	}
+	if len(cached.excluded) != 2 {
+		t.Fatalf("expected 2 cached exclusions, got %+v", cached.excluded)
+	}
+	for _, e := range cached.excluded {
+		if e.Path == "web/dist" && e.Pattern.Source != "web/.groveignore" {
+			t.Errorf("web/dist excluded by %q, want web/.groveignore", e.Pattern.Source)
+		}
+	}
+	if !isExcluded("web/dist", true, cached.matcher) {
+		t.Error("cached matcher should include .groveignore patterns")
+	}
+
+	// Changing file contents does not affect the plan.
+	os.WriteFile(filepath.Join(src, "pkg", "foo", "main.go"), []byte("package foo"), 0644)
+	if loadCachedPlan(path, src, opts.Excludes, nil) == nil {
+		t.Error("content-only change should keep the cached plan")
+	}
+}
+
+func TestPlanClone_InvalidatesOnDirectoryChange(t *testing.T) {
+	src := planCacheSource(t)
+	opts := Options{Excludes: []string{"*.lock"}, CacheDir: t.TempDir()}
+
+	before, err := planClone(src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(src, "pkg", "foo", "new.go"), []byte("go"), 0644)
+
+	path := planCachePath(opts.CacheDir, src, opts.Excludes, nil)
+	if loadCachedPlan(path, src, opts.Excludes, nil) != nil {
+		t.Fatal("expected cached plan to be stale after adding a file")
+	}
+	after, err := planClone(src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.totalEntries != before.totalEntries+1 {
+		t.Errorf("total = %d, want %d", after.totalEntries, before.totalEntries+1)
+	}
+}
+
+func TestPlanClone_InvalidatesOnGroveignoreEdit(t *testing.T) {
+	src := planCacheSource(t)
+	opts := Options{CacheDir: t.TempDir()}
+
+	if _, err := planClone(src, opts); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(src, "web", ".groveignore"), []byte("# nothing excluded\n"), 0644)
+
+	path := planCachePath(opts.CacheDir, src, opts.Excludes, nil)
+	if loadCachedPlan(path, src, opts.Excludes, nil) != nil {
+		t.Fatal("expected cached plan to be stale after editing .groveignore")
+	}
+	plan, err := planClone(src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.excluded) != 0 {
+		t.Errorf("expected no exclusions, got %+v", plan.excluded)
+	}
+}
+
+func TestPlanCachePath_KeyedByExcludes(t *testing.T) {
+	dir := t.TempDir()
+	a := planCachePath(dir, "/repo", []string{"*.lock"}, nil)
+	b := planCachePath(dir, "/repo", []string{"*.log"}, nil)
+	c := planCachePath(dir, "/other", []string{"*.lock"}, nil)
+	if a == b || a == c {
+		t.Errorf("expected distinct cache paths, got %s, %s, %s", a, b, c)
+	}
+}
+
+func TestSelectiveCloneWithOptions_CachedTotalSkipsCount(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "sub"), 0755)
+	os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(src, "sub", "b.txt"), []byte("b"), 0644)
+
+	var scanTotal, lastCopied int
+	opts := Options{
+		CacheDir: t.TempDir(),
+		OnProgress: func(e ProgressEvent) {
+			switch e.Phase {
+			case "scan":
+				scanTotal = e.Total
+			case "clone":
+				lastCopied = e.Copied
+			}
+		},
+	}
+	dst := filepath.Join(t.TempDir(), "clone")
+	if err := SelectiveCloneWithOptions(t.Context(), &CopyCloner{Root: src}, src, dst, opts); err != nil {
+		t.Fatal(err)
+	}
+	if scanTotal != 4 || lastCopied != 4 {
+		t.Errorf("scan total = %d, last copied = %d; want 4, 4", scanTotal, lastCopied)
+	}
+}
+
+func TestSelectiveCloneWithOptions_ReportsBytesAcrossSubtrees(t *testing.T) {
+	src := planCacheSource(t)
+
+	var scanBytes, lastBytes int64
+	opts := Options{
+		Excludes: []string{"*.lock"},
+		CacheDir: t.TempDir(),
+		OnProgress: func(e ProgressEvent) {
+			switch e.Phase {
+			case "scan":
+				scanBytes = e.BytesTotal
+			case "clone":
+				lastBytes = e.Bytes
+			}
+		},
+	}
+	dst := filepath.Join(t.TempDir(), "clone")
+	if err := SelectiveCloneWithOptions(t.Context(), &CopyCloner{Root: src}, src, dst, opts); err != nil {
+		t.Fatal(err)
+	}
+	// main.go and web/.groveignore; yarn.lock and web/dist are excluded.
+	if want := int64(len("go") + len("/dist/\n")); scanBytes != want || lastBytes != want {
+		t.Errorf("scan bytes = %d, last bytes = %d; want %d", scanBytes, lastBytes, want)
+	}
+}
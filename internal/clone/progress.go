@@ -0,0 +1,87 @@
+package clone
+
+import (
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// treeTotals is the size of a tree for progress reporting: every entry
+// counts once, and bytes sums regular file sizes.
+type treeTotals struct {
+	entries int
+	bytes   int64
+}
+
+// unknownTotals asks a totalCloner to count the tree itself.
+var unknownTotals = treeTotals{entries: -1}
+
+// countTree walks root and returns its totals.
+func countTree(root string) (treeTotals, error) {
+	var t treeTotals
+	err := filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		t.entries++
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			t.bytes += info.Size()
+		}
+		return nil
+	})
+	return t, err
+}
+
+// resolve returns t, counting root first if t is unknown. Counting errors
+// leave the totals at zero rather than failing the clone.
+func (t treeTotals) resolve(root string) treeTotals {
+	if t.entries >= 0 {
+		return t
+	}
+	counted, err := countTree(root)
+	if err != nil {
+		return treeTotals{}
+	}
+	return counted
+}
+
+// rateWindow is how far back rateMeter looks when computing throughput.
+const rateWindow = 5 * time.Second
+
+// rateMeter computes a rolling throughput from cumulative byte counts.
+type rateMeter struct {
+	now     func() time.Time
+	samples []rateSample
+}
+
+type rateSample struct {
+	at    time.Time
+	bytes int64
+}
+
+func newRateMeter() *rateMeter {
+	return &rateMeter{now: time.Now}
+}
+
+// observe records the cumulative byte count and returns the rate in bytes
+// per second over the last rateWindow.
+func (m *rateMeter) observe(bytes int64) float64 {
+	now := m.now()
+	m.samples = append(m.samples, rateSample{at: now, bytes: bytes})
+	// Drop samples older than the window, keeping two so slow transfers
+	// still have a rate.
+	for len(m.samples) > 2 && now.Sub(m.samples[0].at) > rateWindow {
+		m.samples = m.samples[1:]
+	}
+
+	first := m.samples[0]
+	elapsed := now.Sub(first.at).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(bytes-first.bytes) / elapsed
+}
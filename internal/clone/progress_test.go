@@ -1,17 +1,24 @@
 package clone
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
 
-func TestParseCPVerboseLine(t *testing.T) {
+func TestParseCPVerboseSource(t *testing.T) {
 	tests := []struct {
-		name string
-		line string
-		want bool
+		name    string
+		line    string
+		wantSrc string
+		want    bool
 	}{
 		{
-			name: "valid cp verbose line",
-			line: "/tmp/src/a.txt -> /tmp/dst/a.txt",
-			want: true,
+			name:    "valid cp verbose line",
+			line:    "/tmp/src/a.txt -> /tmp/dst/a.txt",
+			wantSrc: "/tmp/src/a.txt",
+			want:    true,
 		},
 		{
 			name: "missing arrow",
@@ -27,14 +34,53 @@ func TestParseCPVerboseLine(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := parseCPVerboseLine(tt.line)
-			if got != tt.want {
-				t.Fatalf("parseCPVerboseLine(%q): want %v, got %v", tt.line, tt.want, got)
+			src, got := parseCPVerboseSource(tt.line)
+			if got != tt.want || src != tt.wantSrc {
+				t.Fatalf("parseCPVerboseSource(%q): want %q, %v, got %q, %v", tt.line, tt.wantSrc, tt.want, src, got)
 			}
 		})
 	}
 }
 
+func TestCountTree(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "sub"), 0755)
+	os.WriteFile(filepath.Join(src, "a.txt"), []byte("aaa"), 0644)
+	os.WriteFile(filepath.Join(src, "sub", "b.txt"), []byte("bb"), 0644)
+	if err := os.Symlink("a.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := countTree(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (treeTotals{entries: 5, bytes: 5}); got != want {
+		t.Errorf("countTree() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRateMeter(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	m := &rateMeter{now: func() time.Time { return now }}
+
+	if got := m.observe(0); got != 0 {
+		t.Errorf("first sample rate = %v, want 0", got)
+	}
+	now = start.Add(2 * time.Second)
+	if got := m.observe(200); got != 100 {
+		t.Errorf("rate after 2s = %v, want 100", got)
+	}
+	// Once the window has passed, only recent throughput counts.
+	now = start.Add(10 * time.Second)
+	m.observe(1200)
+	now = start.Add(11 * time.Second)
+	if got := m.observe(2200); got != 1000 {
+		t.Errorf("windowed rate = %v, want 1000", got)
+	}
+}
+
 func TestMapClonePercent(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -0,0 +1,155 @@
+package clone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// ReflinkCloner performs CoW clones by walking the tree in Go and cloning
+// each regular file with the filesystem's reflink primitive (FICLONE on
+// Linux Btrfs/XFS, clonefile on macOS APFS).
+type ReflinkCloner struct{}
+
+func (c *ReflinkCloner) Clone(ctx context.Context, src, dst string) error {
+	if err := ensureSameFilesystemForClone(src, dst); err != nil {
+		return err
+	}
+	copier := &treeCopier{cloneFile: reflinkEntry}
+	if err := copier.copy(ctx, src, dst); err != nil {
+		return fmt.Errorf("reflink clone failed: %w", err)
+	}
+	return nil
+}
+
+func (c *ReflinkCloner) CloneWithProgress(ctx context.Context, src, dst string, onProgress ProgressFunc) error {
+	return c.cloneWithTotal(ctx, src, dst, unknownTotals, onProgress)
+}
+
+func (c *ReflinkCloner) cloneWithTotal(ctx context.Context, src, dst string, total treeTotals, onProgress ProgressFunc) error {
+	if err := ensureSameFilesystemForClone(src, dst); err != nil {
+		return err
+	}
+	copier := &treeCopier{cloneFile: reflinkEntry}
+	if err := cloneTreeWithProgress(ctx, copier, src, dst, total, onProgress); err != nil {
+		return fmt.Errorf("reflink %w", err)
+	}
+	return nil
+}
+
+func reflinkEntry(src, dst string, _ fs.FileInfo) error {
+	return reflinkFile(src, dst)
+}
+
+// probeReflink reports whether the filesystem containing path can clone
+// files. It clones a file from path into a scratch directory outside it, so
+// concurrent walks of the tree never see the probe, and a read-only tree can
+// be probed.
+func probeReflink(path string) (bool, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	src, err := probeSource(path)
+	if err != nil {
+		return false, err
+	}
+
+	// Clones can't cross filesystems, so climb until a writable directory
+	// on the same one is found. Only other filesystems above path means it
+	// can't be cloned to outside itself.
+	crossed := false
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		ok, err := probeReflinkIn(dir, src)
+		switch {
+		case err == nil:
+			return ok, nil
+		case errors.Is(err, syscall.EXDEV):
+			crossed = true
+		case !errors.Is(err, errNoScratchDir):
+			return false, err
+		}
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	if !crossed {
+		return false, fmt.Errorf("no writable directory outside %s to probe in", path)
+	}
+	return false, nil
+}
+
+// errNoScratchDir is returned by probeReflinkIn when it cannot create its
+// scratch directory.
+var errNoScratchDir = errors.New("cannot create probe directory")
+
+// probeReflinkIn clones src into a scratch directory created in dir. If src
+// is empty, a scratch file in the scratch directory is cloned instead.
+func probeReflinkIn(dir, src string) (bool, error) {
+	scratch, err := os.MkdirTemp(dir, ".grove-reflink-probe-*")
+	if err != nil {
+		return false, errNoScratchDir
+	}
+	defer os.RemoveAll(scratch)
+	if src == "" {
+		src = filepath.Join(scratch, "src")
+		if err := os.WriteFile(src, []byte("grove"), 0600); err != nil {
+			return false, err
+		}
+	}
+
+	err = reflinkFile(src, filepath.Join(scratch, "clone"))
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, syscall.EXDEV):
+		return false, err
+	case isReflinkUnsupported(err):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// probeSource returns a regular file at or under path to probe with, or ""
+// if there is none.
+func probeSource(path string) (string, error) {
+	var src string
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == path {
+				return err
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			src = p
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return src, err
+}
+
+// isReflinkUnsupported reports whether err means the filesystem cannot clone
+// files, as opposed to an I/O or permission failure.
+func isReflinkUnsupported(err error) bool {
+	for _, target := range []error{
+		errors.ErrUnsupported,
+		syscall.EOPNOTSUPP,
+		syscall.ENOTSUP,
+		syscall.EXDEV,
+		syscall.EINVAL,
+		syscall.ENOTTY,
+		syscall.ENOSYS,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,15 @@
+package clone
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflinkFile creates dst as an APFS clone of src via clonefile(2).
+func reflinkFile(src, dst string) error {
+	if err := unix.Clonefile(src, dst, unix.CLONE_NOFOLLOW); err != nil {
+		return &os.PathError{Op: "clonefile", Path: dst, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package clone
+
+import (
+	"errors"
+	"os"
+)
+
+func reflinkFile(_, dst string) error {
+	return &os.PathError{Op: "reflink", Path: dst, Err: errors.ErrUnsupported}
+}
@@ -0,0 +1,230 @@
+package clone
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTreeCopier_PreservesStructureAndMetadata(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "sub", "deep"), 0755)
+	os.WriteFile(filepath.Join(src, "root.txt"), []byte("root"), 0644)
+	os.WriteFile(filepath.Join(src, "run.sh"), []byte("#!/bin/sh\n"), 0755)
+	os.WriteFile(filepath.Join(src, "sub", "deep", "leaf.txt"), []byte("leaf"), 0600)
+	if err := os.Symlink("sub/deep/leaf.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(src, "sub"), 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	past := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, rel := range []string{"root.txt", "sub/deep/leaf.txt", "sub/deep", "sub"} {
+		if err := os.Chtimes(filepath.Join(src, rel), past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := filepath.Join(t.TempDir(), "clone")
+	entries := 0
+	copier := &treeCopier{cloneFile: copyFile, onEntry: func(int64) { entries++ }}
+	if err := copier.copy(t.Context(), src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dst, "sub", "deep", "leaf.txt"))
+	if err != nil || string(data) != "leaf" {
+		t.Fatalf("leaf.txt: data=%q err=%v", data, err)
+	}
+
+	target, err := os.Readlink(filepath.Join(dst, "link"))
+	if err != nil {
+		t.Fatalf("expected symlink to be recreated: %v", err)
+	}
+	if target != "sub/deep/leaf.txt" {
+		t.Errorf("symlink target = %q, want %q", target, "sub/deep/leaf.txt")
+	}
+
+	for rel, want := range map[string]fs.FileMode{
+		"run.sh":            0755,
+		"sub/deep/leaf.txt": 0600,
+		"sub":               0750,
+	} {
+		info, err := os.Stat(filepath.Join(dst, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s mode = %v, want %v", rel, got, want)
+		}
+	}
+
+	for _, rel := range []string{"root.txt", "sub/deep/leaf.txt", "sub/deep", "sub"} {
+		info, err := os.Stat(filepath.Join(dst, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(past) {
+			t.Errorf("%s mtime = %v, want %v", rel, info.ModTime(), past)
+		}
+	}
+
+	total, err := countTree(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries != total.entries {
+		t.Errorf("onEntry called %d times, want %d", entries, total.entries)
+	}
+}
+
+func TestTreeCopier_SingleFile(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "file.txt")
+	os.WriteFile(src, []byte("data"), 0640)
+	dst := filepath.Join(t.TempDir(), "file.txt")
+
+	copier := &treeCopier{cloneFile: copyFile}
+	if err := copier.copy(t.Context(), src, dst); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("mode = %v, want 0640", info.Mode().Perm())
+	}
+}
+
+func TestTreeCopier_SkipsVanishedFiles(t *testing.T) {
+	src := t.TempDir()
+	os.WriteFile(filepath.Join(src, "index.lock"), []byte("lock"), 0644)
+	os.WriteFile(filepath.Join(src, "main.go"), []byte("go"), 0644)
+	dst := filepath.Join(t.TempDir(), "clone")
+
+	// Remove index.lock after the walk lists it, as git does.
+	copier := &treeCopier{cloneFile: func(src, dst string, info fs.FileInfo) error {
+		if filepath.Base(src) == "index.lock" {
+			os.Remove(src)
+		}
+		return copyFile(src, dst, info)
+	}}
+	if err := copier.copy(t.Context(), src, dst); err != nil {
+		t.Fatalf("copy() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "main.go")); err != nil {
+		t.Errorf("main.go should be copied: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dst, "index.lock")); !os.IsNotExist(err) {
+		t.Errorf("vanished index.lock should be skipped: %v", err)
+	}
+}
+
+func TestCloneTreeWithProgress_ReportsEveryEntry(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "sub"), 0755)
+	os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(src, "sub", "b.txt"), []byte("b"), 0644)
+
+	var scanTotal, lastCopied int
+	var scanBytes, lastBytes int64
+	onProgress := func(e ProgressEvent) {
+		switch e.Phase {
+		case "scan":
+			scanTotal, scanBytes = e.Total, e.BytesTotal
+		case "clone":
+			lastCopied, lastBytes = e.Copied, e.Bytes
+		}
+	}
+	dst := filepath.Join(t.TempDir(), "clone")
+	if err := cloneTreeWithProgress(t.Context(), &treeCopier{cloneFile: copyFile}, src, dst, unknownTotals, onProgress); err != nil {
+		t.Fatal(err)
+	}
+	if scanTotal != 4 {
+		t.Errorf("scan total = %d, want 4", scanTotal)
+	}
+	if lastCopied != scanTotal {
+		t.Errorf("last copied = %d, want %d", lastCopied, scanTotal)
+	}
+	if scanBytes != 2 || lastBytes != 2 {
+		t.Errorf("scan bytes = %d, last bytes = %d; want 2, 2", scanBytes, lastBytes)
+	}
+}
+
+func TestIsReflinkUnsupported(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"eopnotsupp", &os.PathError{Op: "ficlone", Path: "x", Err: syscall.EOPNOTSUPP}, true},
+		{"cross device", &os.PathError{Op: "ficlone", Path: "x", Err: syscall.EXDEV}, true},
+		{"unsupported platform", errors.ErrUnsupported, true},
+		{"permission denied", &os.PathError{Op: "ficlone", Path: "x", Err: syscall.EACCES}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isReflinkUnsupported(tt.err); got != tt.want {
+				t.Errorf("isReflinkUnsupported(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeReflink_LeavesNoScratchFiles(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "golden")
+	os.Mkdir(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644)
+
+	if _, err := probeReflink(dir); err != nil {
+		t.Fatalf("probeReflink() error = %v", err)
+	}
+	for _, d := range []string{dir, parent} {
+		entries, err := os.ReadDir(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Errorf("expected probe to clean up in %s, found %d entries", d, len(entries))
+		}
+	}
+}
+
+func TestProbeReflink_ReadOnlyTree(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "golden")
+	os.Mkdir(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644)
+	os.Chmod(dir, 0555)
+	t.Cleanup(func() { os.Chmod(dir, 0755) })
+
+	if _, err := probeReflink(dir); err != nil {
+		t.Fatalf("probeReflink() error = %v, want a read-only tree to be probed", err)
+	}
+}
+
+func TestReflinkCloner_ClonesTree(t *testing.T) {
+	src := t.TempDir()
+	if ok, err := probeReflink(src); err != nil || !ok {
+		t.Skipf("reflink unsupported in %s (err=%v)", src, err)
+	}
+	os.MkdirAll(filepath.Join(src, "sub"), 0755)
+	os.WriteFile(filepath.Join(src, "sub", "file.txt"), []byte("original"), 0644)
+
+	dst := filepath.Join(t.TempDir(), "clone")
+	c := &ReflinkCloner{}
+	if err := c.Clone(t.Context(), src, dst); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dst, "sub", "file.txt"), []byte("modified"), 0644)
+
+	data, _ := os.ReadFile(filepath.Join(src, "sub", "file.txt"))
+	if string(data) != "original" {
+		t.Error("source was modified — CoW isolation broken")
+	}
+}
@@ -0,0 +1,306 @@
+package clone
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chrisbanes/grove/internal/ignore"
+)
+
+// BinarySniffLen is how much of a file IsBinary checks for NUL bytes.
+const BinarySniffLen = 8000
+
+// relocator rewrites references to a source tree so they point into its
+// clone instead.
+type relocator struct {
+	// from lists the spellings of the source root: as given, and with
+	// symlinks resolved.
+	from []string
+	to   string
+	// onSkip is called for files that cannot be relocated safely.
+	onSkip func(rel string)
+}
+
+func newRelocator(src, dst string, onSkip func(rel string)) (*relocator, error) {
+	src, err := filepath.Abs(src)
+	if err != nil {
+		return nil, err
+	}
+	dst, err = filepath.Abs(dst)
+	if err != nil {
+		return nil, err
+	}
+	r := &relocator{from: []string{src}, to: dst, onSkip: onSkip}
+	if real, err := filepath.EvalSymlinks(src); err == nil && real != src {
+		r.from = append(r.from, real)
+	}
+	return r, nil
+}
+
+// symlink retargets the symlink at rel in the clone if it is absolute and
+// points into the source tree. Left alone, writes through it would reach
+// the source.
+func (r *relocator) symlink(rel string) error {
+	path := filepath.Join(r.to, rel)
+	target, err := os.Readlink(path)
+	if err != nil {
+		return err
+	}
+	relocated, ok := r.target(target)
+	if !ok {
+		return nil
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	return os.Symlink(relocated, path)
+}
+
+// target returns the symlink target rewritten into the clone, and whether
+// it pointed into the source tree.
+func (r *relocator) target(target string) (string, bool) {
+	if !filepath.IsAbs(target) {
+		return "", false
+	}
+	for _, from := range r.from {
+		if target == from {
+			return r.to, true
+		}
+		if rest, ok := strings.CutPrefix(target, from+string(filepath.Separator)); ok {
+			return filepath.Join(r.to, rest), true
+		}
+	}
+	return "", false
+}
+
+// file rewrites occurrences of the source root in the regular file at rel.
+// Text files are rewritten freely. In binary files the root is replaced
+// inside its NUL-terminated string, padding with NULs so offsets are kept;
+// files where the clone path is too long for that are skipped.
+func (r *relocator) file(rel string) error {
+	path := filepath.Join(r.to, rel)
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	replace := replacePath
+	if IsBinary(data) {
+		replace = replacePathPadded
+	}
+	out := data
+	for _, from := range r.from {
+		var ok bool
+		out, ok = replace(out, []byte(from), []byte(r.to))
+		if !ok {
+			if r.onSkip != nil {
+				r.onSkip(filepath.ToSlash(rel))
+			}
+			return nil
+		}
+	}
+	if bytes.Equal(out, data) {
+		return nil
+	}
+	return ReplaceFile(path, out, info.Mode().Perm())
+}
+
+// replacePath replaces every occurrence of old that is a whole path prefix,
+// so "/src" is rewritten in "/src/a" but not in "/src2/a".
+func replacePath(data, old, new []byte) ([]byte, bool) {
+	if !bytes.Contains(data, old) {
+		return data, true
+	}
+	var out bytes.Buffer
+	for {
+		i := indexPath(data, old)
+		if i < 0 {
+			out.Write(data)
+			return out.Bytes(), true
+		}
+		out.Write(data[:i])
+		out.Write(new)
+		data = data[i+len(old):]
+	}
+}
+
+// replacePathPadded is like replacePath, but keeps the length of each
+// NUL-terminated string containing old by padding it with NULs. It reports
+// false, leaving data alone, when new is longer than old.
+func replacePathPadded(data, old, new []byte) ([]byte, bool) {
+	if indexPath(data, old) < 0 {
+		return data, true
+	}
+	if len(new) > len(old) {
+		return data, false
+	}
+	out := bytes.Clone(data)
+	for start := 0; ; {
+		i := indexPath(out[start:], old)
+		if i < 0 {
+			return out, true
+		}
+		i += start
+		end := bytes.IndexByte(out[i:], 0)
+		if end < 0 {
+			end = len(out)
+		} else {
+			end += i
+		}
+		rewritten, _ := replacePath(bytes.Clone(out[i:end]), old, new)
+		n := copy(out[i:end], rewritten)
+		clear(out[i+n : end])
+		start = end
+	}
+}
+
+// indexPath returns the index of the first occurrence of root in data that
+// is followed by a path separator or a byte that cannot continue a file
+// name, or -1.
+func indexPath(data, root []byte) int {
+	offset := 0
+	for {
+		i := bytes.Index(data[offset:], root)
+		if i < 0 {
+			return -1
+		}
+		i += offset
+		next := i + len(root)
+		if next == len(data) || !isNameByte(data[next]) {
+			return i
+		}
+		offset = i + 1
+	}
+}
+
+func isNameByte(b byte) bool {
+	return b == '.' || b == '-' || b == '_' || b == '+' || b == '@' ||
+		'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9'
+}
+
+// IsBinary reports whether data looks like binary content, using git's NUL
+// byte heuristic.
+func IsBinary(data []byte) bool {
+	if len(data) > BinarySniffLen {
+		data = data[:BinarySniffLen]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// ReplaceFile swaps path for a new file holding data, with permissions
+// mode. Writing a new file instead of rewriting in place keeps files that
+// share data with the golden copy, such as hardlinks, untouched.
+func ReplaceFile(path string, data []byte, mode fs.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".grove-replace-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// isGroveOrGit reports whether rel is in the .git or .grove directory,
+// which relocation never touches.
+func isGroveOrGit(rel string) bool {
+	top, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+	return top == ".git" || top == ".grove"
+}
+
+// relocateMatcher tracks which files a relocate pattern set selects during
+// a depth-first walk. A matching directory selects every file beneath it.
+type relocateMatcher struct {
+	m          *ignore.Matcher
+	matchedDir string
+}
+
+func newRelocateMatcher(patterns []string) (*relocateMatcher, error) {
+	m, err := ignore.New(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid relocate pattern: %w", err)
+	}
+	return &relocateMatcher{m: m}, nil
+}
+
+// visit reports whether the entry at rel is selected. Entries must be
+// visited in walk order.
+func (r *relocateMatcher) visit(rel string, isDir bool) bool {
+	rel = filepath.ToSlash(rel)
+	if r.matchedDir != "" && strings.HasPrefix(rel, r.matchedDir+"/") {
+		return true
+	}
+	if !r.m.Excluded(rel, isDir) {
+		return false
+	}
+	if isDir {
+		r.matchedDir = rel
+	}
+	return true
+}
+
+// Relocate rewrites references to src inside its clone dst: absolute
+// symlinks into src are retargeted into dst, and occurrences of the src path
+// in regular files matching opts.Relocate are replaced with the dst path.
+// opts.OnRelocateSkip, when set, is called with each binary file that could
+// not be rewritten without changing its layout. The .git and .grove
+// directories are left alone.
+//
+// The entries to rewrite are those a clone of src with opts would relocate,
+// so dst is not walked, and with opts.CacheDir set the plan is reused from
+// the cache. Entries missing from dst are skipped.
+func Relocate(src, dst string, opts Options) error {
+	return RelocateMoved(src, src, dst, opts)
+}
+
+// RelocateMoved is like Relocate for a clone of src that was relocated to
+// from and has since moved to dst: references to from are rewritten to
+// refer to dst.
+func RelocateMoved(src, from, dst string, opts Options) error {
+	opts.OnProgress = nil
+	plan, err := planClone(src, opts)
+	if err != nil {
+		return fmt.Errorf("planning relocation: %w", err)
+	}
+	return relocateClone(from, dst, plan, opts.OnRelocateSkip)
+}
+
+// relocateClone rewrites the symlinks and files recorded in plan inside dst,
+// skipping any that dst does not have.
+func relocateClone(src, dst string, plan *clonePlan, onSkip func(rel string)) error {
+	if len(plan.symlinks) == 0 && len(plan.relocate) == 0 {
+		return nil
+	}
+	r, err := newRelocator(src, dst, onSkip)
+	if err != nil {
+		return err
+	}
+	for _, rel := range plan.symlinks {
+		if err := r.symlink(filepath.FromSlash(rel)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("relocating %s: %w", rel, err)
+		}
+	}
+	for _, rel := range plan.relocate {
+		if err := r.file(filepath.FromSlash(rel)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("relocating %s: %w", rel, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package clone
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReplacePath(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"prefix of a path", "root=/src/lib", "root=/workspace/lib"},
+		{"whole value", "/src", "/workspace"},
+		{"many occurrences", "/src:/src/bin", "/workspace:/workspace/bin"},
+		{"longer name untouched", "/src2/lib /srcdir", "/src2/lib /srcdir"},
+		{"quoted", `"/src"`, `"/workspace"`},
+	}
+	for _, tt := range tests {
+		got, ok := replacePath([]byte(tt.data), []byte("/src"), []byte("/workspace"))
+		if !ok || string(got) != tt.want {
+			t.Errorf("%s: replacePath(%q) = %q, %v; want %q", tt.name, tt.data, got, ok, tt.want)
+		}
+	}
+}
+
+func TestReplacePathPadded(t *testing.T) {
+	data := []byte("\x00\x01/golden/copy/bin\x00/golden/copy/lib:/golden/copy\x00tail")
+	got, ok := replacePathPadded(data, []byte("/golden/copy"), []byte("/ws"))
+	if !ok {
+		t.Fatal("expected shorter path to be relocated")
+	}
+	want := []byte("\x00\x01/ws/bin\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00/ws/lib:/ws\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00tail")
+	if len(got) != len(data) {
+		t.Fatalf("length changed: %d -> %d", len(data), len(got))
+	}
+	if string(got) != string(want) {
+		t.Errorf("replacePathPadded() = %q, want %q", got, want)
+	}
+
+	if _, ok := replacePathPadded(data, []byte("/golden/copy"), []byte("/much/longer/workspace")); ok {
+		t.Error("expected longer path to be rejected")
+	}
+	if out, ok := replacePathPadded([]byte("\x00nothing"), []byte("/golden"), []byte("/much/longer")); !ok || string(out) != "\x00nothing" {
+		t.Error("data without the path should be left alone")
+	}
+}
+
+func relocateSource(t *testing.T) (string, string) {
+	t.Helper()
+	base := t.TempDir()
+	src := filepath.Join(base, "golden")
+	os.MkdirAll(filepath.Join(src, "venv", "bin"), 0755)
+	os.MkdirAll(filepath.Join(src, ".grove"), 0755)
+	os.WriteFile(filepath.Join(src, "venv", "bin", "pip"), []byte("#!"+src+"/venv/bin/python\n"), 0755)
+	os.WriteFile(filepath.Join(src, "venv", "lib.so"), []byte("\x00"+src+"/venv\x00"), 0644)
+	os.WriteFile(filepath.Join(src, "notes.txt"), []byte(src), 0644)
+	os.WriteFile(filepath.Join(src, ".grove", "config.json"), []byte(src), 0644)
+	os.Symlink(filepath.Join(src, "notes.txt"), filepath.Join(src, "abs-link"))
+	os.Symlink("notes.txt", filepath.Join(src, "rel-link"))
+	os.Symlink("/usr/bin/env", filepath.Join(src, "outside-link"))
+	return src, filepath.Join(base, "workspace-with-a-longer-path")
+}
+
+func checkRelocated(t *testing.T, src, dst string, skipped []string) {
+	t.Helper()
+	read := func(rel string) string {
+		data, err := os.ReadFile(filepath.Join(dst, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if got, want := read("venv/bin/pip"), "#!"+dst+"/venv/bin/python\n"; got != want {
+		t.Errorf("venv/bin/pip = %q, want %q", got, want)
+	}
+	info, err := os.Stat(filepath.Join(dst, "venv", "bin", "pip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("venv/bin/pip mode = %v, want 0755", info.Mode().Perm())
+	}
+	if got := read("notes.txt"); got != src {
+		t.Errorf("notes.txt should not be relocated, got %q", got)
+	}
+	if got := read(".grove/config.json"); got != src {
+		t.Errorf(".grove should not be relocated, got %q", got)
+	}
+	// The workspace path is longer, so the binary cannot be padded.
+	if got := read("venv/lib.so"); got != "\x00"+src+"/venv\x00" {
+		t.Errorf("venv/lib.so = %q, want unchanged", got)
+	}
+	if !reflect.DeepEqual(skipped, []string{"venv/lib.so"}) {
+		t.Errorf("skipped = %q, want [venv/lib.so]", skipped)
+	}
+
+	for link, want := range map[string]string{
+		"abs-link":     filepath.Join(dst, "notes.txt"),
+		"rel-link":     "notes.txt",
+		"outside-link": "/usr/bin/env",
+	} {
+		got, err := os.Readlink(filepath.Join(dst, link))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s -> %q, want %q", link, got, want)
+		}
+	}
+}
+
+func TestRelocate(t *testing.T) {
+	src, dst := relocateSource(t)
+	if err := (&CopyCloner{}).Clone(t.Context(), src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	var skipped []string
+	opts := Options{
+		Relocate:       []string{"/venv/"},
+		OnRelocateSkip: func(rel string) { skipped = append(skipped, rel) },
+	}
+	if err := Relocate(src, dst, opts); err != nil {
+		t.Fatal(err)
+	}
+	checkRelocated(t, src, dst, skipped)
+}
+
+func TestRelocate_SkipsEntriesMissingFromClone(t *testing.T) {
+	src, dst := relocateSource(t)
+	if err := (&CopyCloner{}).Clone(t.Context(), src, dst); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(dst, "venv", "bin", "pip"))
+	os.Remove(filepath.Join(dst, "abs-link"))
+
+	if err := Relocate(src, dst, Options{Relocate: []string{"/venv/"}}); err != nil {
+		t.Fatalf("Relocate() = %v, want missing entries skipped", err)
+	}
+}
+
+func TestRelocateMoved(t *testing.T) {
+	src, dst := relocateSource(t)
+	if err := (&CopyCloner{}).Clone(t.Context(), src, dst); err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Relocate: []string{"/venv/"}}
+	if err := Relocate(src, dst, opts); err != nil {
+		t.Fatal(err)
+	}
+	moved := dst + "-moved"
+	if err := os.Rename(dst, moved); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RelocateMoved(src, dst, moved, opts); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(moved, "venv", "bin", "pip"))
+	if want := "#!" + moved + "/venv/bin/python\n"; string(data) != want {
+		t.Errorf("venv/bin/pip = %q, want %q", data, want)
+	}
+	if got, _ := os.Readlink(filepath.Join(moved, "abs-link")); got != filepath.Join(moved, "notes.txt") {
+		t.Errorf("abs-link -> %q, want it in the moved clone", got)
+	}
+}
+
+func TestSelectiveCloneWithOptions_Relocates(t *testing.T) {
+	src, dst := relocateSource(t)
+	cacheDir := t.TempDir()
+
+	for _, run := range []string{"fresh plan", "cached plan"} {
+		var skipped []string
+		opts := Options{
+			Relocate:       []string{"/venv/"},
+			CacheDir:       cacheDir,
+			OnRelocateSkip: func(rel string) { skipped = append(skipped, rel) },
+		}
+		os.RemoveAll(dst)
+		if err := SelectiveCloneWithOptions(t.Context(), &CopyCloner{}, src, dst, opts); err != nil {
+			t.Fatalf("%s: %v", run, err)
+		}
+		checkRelocated(t, src, dst, skipped)
+
+		// The golden copy is never rewritten.
+		data, _ := os.ReadFile(filepath.Join(src, "venv", "bin", "pip"))
+		if string(data) != "#!"+src+"/venv/bin/python\n" {
+			t.Fatalf("%s: golden copy modified: %q", run, data)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package clone
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/chrisbanes/grove/internal/ignore"
+)
+
+// scanChunkSize is how much of a file is read at a time when searching it
+// for the source path.
+const scanChunkSize = 1 << 20
+
+// PathReference is a file that refers to the source tree by absolute path,
+// so its clone would still refer to the source.
+type PathReference struct {
+	// Path is slash-separated and relative to the source.
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Symlink is set for absolute symlinks into the source. Clones always
+	// retarget those.
+	Symlink bool `json:"symlink,omitempty"`
+	// Binary is set for files that look binary. They can only be relocated
+	// when the clone path is no longer than the source path.
+	Binary bool `json:"binary,omitempty"`
+	// Relocated is set when the file is already selected by a relocate
+	// pattern.
+	Relocated bool `json:"relocated,omitempty"`
+}
+
+// Kind describes the reference as "symlink", "binary" or "text".
+func (r PathReference) Kind() string {
+	switch {
+	case r.Symlink:
+		return "symlink"
+	case r.Binary:
+		return "binary"
+	default:
+		return "text"
+	}
+}
+
+// ScanGroup collects the references found under one top-level entry of the
+// source.
+type ScanGroup struct {
+	// Path is the entry's name, without a trailing slash.
+	Path  string `json:"path"`
+	IsDir bool   `json:"is_dir"`
+	// Ignored is set when the whole entry is ignored, rather than only some
+	// of the paths under it.
+	Ignored bool `json:"ignored"`
+	// Files and Size count the ignored regular files under Path that a
+	// clone keeps.
+	Files      int             `json:"files"`
+	Size       int64           `json:"size"`
+	References []PathReference `json:"references"`
+}
+
+// ScanPaths searches the ignored paths of src for files that mention the
+// absolute path of src and for absolute symlinks into it. ignored lists
+// slash-separated paths relative to src, with directories marked by a
+// trailing slash, as reported by git. Entries a selective clone would
+// exclude, given excludes and the .groveignore files in src, are skipped.
+// Files selected by the relocate patterns are marked as relocated.
+//
+// References are grouped by the top-level entry they are under, so that
+// ignored paths spread over one directory are counted together. One group
+// is returned for each entry that holds references, in the order first
+// given.
+func ScanPaths(src string, excludes, relocate, ignored []string) ([]ScanGroup, error) {
+	plan, err := buildClonePlan(src, excludes, nil)
+	if err != nil {
+		return nil, err
+	}
+	relocateMatcher, err := ignore.New(relocate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid relocate pattern: %w", err)
+	}
+	r, err := newRelocator(src, src, nil)
+	if err != nil {
+		return nil, err
+	}
+	roots := make([][]byte, len(r.from))
+	for i, from := range r.from {
+		roots[i] = []byte(from)
+	}
+
+	var groups []ScanGroup
+	index := map[string]int{}
+	for _, entry := range ignored {
+		rel := strings.TrimSuffix(entry, "/")
+		if rel == "" || isGroveOrGit(rel) || excludedWithAncestors(rel, strings.HasSuffix(entry, "/"), plan.matcher) {
+			continue
+		}
+		root := filepath.Join(src, filepath.FromSlash(rel))
+		if _, err := os.Lstat(root); errors.Is(err, fs.ErrNotExist) {
+			// Removed since git listed it.
+			continue
+		}
+		top, _, nested := strings.Cut(rel, "/")
+		i, ok := index[top]
+		if !ok {
+			i = len(groups)
+			index[top] = i
+			groups = append(groups, ScanGroup{Path: top, IsDir: nested || strings.HasSuffix(entry, "/"), Ignored: !nested})
+		}
+		group := &groups[i]
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			fileRel, err := filepath.Rel(src, path)
+			if err != nil {
+				return err
+			}
+			fileRel = filepath.ToSlash(fileRel)
+			if path != root && isExcluded(fileRel, d.IsDir(), plan.matcher) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+
+			ref := PathReference{Path: fileRel}
+			switch {
+			case d.Type()&fs.ModeSymlink != 0:
+				target, err := os.Readlink(path)
+				if err != nil {
+					return err
+				}
+				if _, ok := r.target(target); !ok {
+					return nil
+				}
+				ref.Symlink = true
+			case d.Type().IsRegular():
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				group.Files++
+				group.Size += info.Size()
+				found, binary, err := fileMentions(path, roots)
+				if err != nil {
+					return err
+				}
+				if !found {
+					return nil
+				}
+				ref.Size = info.Size()
+				ref.Binary = binary
+				ref.Relocated = selectedWithAncestors(fileRel, relocateMatcher)
+			default:
+				return nil
+			}
+			group.References = append(group.References, ref)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("scanning %s: %w", rel, err)
+		}
+	}
+	return slices.DeleteFunc(groups, func(g ScanGroup) bool { return len(g.References) == 0 }), nil
+}
+
+// excludedWithAncestors reports whether rel, or any directory above it, is
+// excluded by m.
+func excludedWithAncestors(rel string, isDir bool, m *ignore.Matcher) bool {
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if isExcluded(strings.Join(parts[:i], "/"), true, m) {
+			return true
+		}
+	}
+	return isExcluded(rel, isDir, m)
+}
+
+// selectedWithAncestors reports whether the file at rel is selected by m,
+// either directly or through a matching directory above it.
+func selectedWithAncestors(rel string, m *ignore.Matcher) bool {
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.Excluded(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.Excluded(rel, false)
+}
+
+// fileMentions reports whether the file at path contains any of roots as a
+// whole path prefix, and whether it looks binary. The file is read in
+// chunks, so large build outputs are never held in memory.
+func fileMentions(path string, roots [][]byte) (found, binary bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, false, err
+	}
+	defer f.Close()
+
+	overlap := 0
+	for _, root := range roots {
+		overlap = max(overlap, len(root))
+	}
+	buf := make([]byte, 0, scanChunkSize+overlap)
+	first := true
+	for {
+		n, err := io.ReadFull(f, buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return false, false, err
+		}
+		if first {
+			binary = IsBinary(buf)
+			first = false
+		}
+		for _, root := range roots {
+			// A match ending the buffer is only whole once the next byte
+			// is known, so it is left for the next chunk unless at EOF.
+			if i := indexPath(buf, root); i >= 0 && (eof || i+len(root) < len(buf)) {
+				return true, binary, nil
+			}
+		}
+		if eof {
+			return false, binary, nil
+		}
+		keep := min(overlap, len(buf))
+		copy(buf, buf[len(buf)-keep:])
+		buf = buf[:keep]
+	}
+}
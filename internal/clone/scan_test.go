@@ -0,0 +1,112 @@
+package clone
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanPaths(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "golden")
+	for _, dir := range []string{"build/cache", "node_modules/.bin", "dist", ".grove", "src/gen"} {
+		os.MkdirAll(filepath.Join(src, dir), 0755)
+	}
+	os.WriteFile(filepath.Join(src, "build", "cache", "config.txt"), []byte("root="+src+"/src\n"), 0644)
+	os.WriteFile(filepath.Join(src, "build", "cache", "lib.so"), []byte("\x00"+src+"\x00"), 0644)
+	os.WriteFile(filepath.Join(src, "build", "cache", "other.txt"), []byte(src+"2/elsewhere"), 0644)
+	os.Symlink(filepath.Join(src, "src"), filepath.Join(src, "build", "src-link"))
+	os.Symlink("../src", filepath.Join(src, "build", "relative-link"))
+	os.WriteFile(filepath.Join(src, "node_modules", ".bin", "tool"), []byte("#!"+src+"/node\n"), 0755)
+	os.WriteFile(filepath.Join(src, "dist", "app.js"), []byte("clean"), 0644)
+	os.WriteFile(filepath.Join(src, "debug.log"), []byte("cwd: "+src), 0644)
+	os.WriteFile(filepath.Join(src, "src", "a.log"), []byte("cwd: "+src), 0644)
+	os.WriteFile(filepath.Join(src, "src", "gen", "paths.txt"), []byte(src), 0644)
+	os.WriteFile(filepath.Join(src, "src", "gen", "clean.txt"), []byte("clean"), 0644)
+
+	ignored := []string{"build/", "src/a.log", "node_modules/", "dist/", "debug.log", "src/gen/", "missing/"}
+	groups, err := ScanPaths(src, []string{"node_modules/"}, []string{"*.txt"}, ignored)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ScanGroup{
+		{
+			Path:    "build",
+			IsDir:   true,
+			Ignored: true,
+			Files:   3,
+			Size:    int64(len("root="+src+"/src\n") + len("\x00"+src+"\x00") + len(src+"2/elsewhere")),
+			References: []PathReference{
+				{Path: "build/cache/config.txt", Size: int64(len("root=" + src + "/src\n")), Relocated: true},
+				{Path: "build/cache/lib.so", Size: int64(len("\x00" + src + "\x00")), Binary: true},
+				{Path: "build/src-link", Symlink: true},
+			},
+		},
+		{
+			Path:  "src",
+			IsDir: true,
+			Files: 3,
+			Size:  int64(len("cwd: "+src) + len(src) + len("clean")),
+			References: []PathReference{
+				{Path: "src/a.log", Size: int64(len("cwd: " + src))},
+				{Path: "src/gen/paths.txt", Size: int64(len(src)), Relocated: true},
+			},
+		},
+		{
+			Path:       "debug.log",
+			Ignored:    true,
+			Files:      1,
+			Size:       int64(len("cwd: " + src)),
+			References: []PathReference{{Path: "debug.log", Size: int64(len("cwd: " + src))}},
+		},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("ScanPaths() =\n%+v\nwant\n%+v", groups, want)
+	}
+}
+
+func TestFileMentions(t *testing.T) {
+	root := []byte("/golden/copy")
+	dir := t.TempDir()
+	// Place matches across the chunk boundary to check they are still found.
+	padding := strings.Repeat("x", scanChunkSize-5)
+	tests := []struct {
+		name   string
+		data   string
+		found  bool
+		binary bool
+	}{
+		{"text", "path=/golden/copy/bin", true, false},
+		{"binary", "\x00/golden/copy\x00", true, true},
+		{"longer name", "/golden/copy2", false, false},
+		{"split across chunks", padding + "/golden/copy/x", true, false},
+		{"longer name across chunks", padding + "/golden/copyx", false, false},
+		{"at chunk end", strings.Repeat("x", scanChunkSize-len(root)) + "/golden/copy", true, false},
+		{"absent", "nothing here", false, false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, "f")
+		os.WriteFile(path, []byte(tt.data), 0644)
+		found, binary, err := fileMentions(path, [][]byte{root})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != tt.found || binary != tt.binary {
+			t.Errorf("%s: fileMentions() = %v, %v; want %v, %v", tt.name, found, binary, tt.found, tt.binary)
+		}
+	}
+
+	// The first read fills the buffer exactly, so the name byte that rules
+	// the match out only arrives with the next chunk.
+	path := filepath.Join(dir, "boundary")
+	data := bytes.Repeat([]byte("x"), scanChunkSize+len(root))
+	copy(data[len(data)-len(root):], root)
+	data = append(data, 'z')
+	os.WriteFile(path, data, 0644)
+	if found, _, _ := fileMentions(path, [][]byte{root}); found {
+		t.Error("expected a match continued in the next chunk to be rejected")
+	}
+}
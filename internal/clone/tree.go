@@ -0,0 +1,247 @@
+package clone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// fileCloneFunc produces dst as a copy of the regular file src. dst does not
+// exist when it is called.
+type fileCloneFunc func(src, dst string, info fs.FileInfo) error
+
+// treeCopier recreates a directory tree entry by entry. Regular files are
+// produced by cloneFile; directories and symlinks are recreated directly.
+// Permissions and modification times are carried over so the result matches
+// what cp -R -p would produce.
+type treeCopier struct {
+	cloneFile fileCloneFunc
+	// hardlink, when set, reports whether a regular file should be
+	// hardlinked to its source instead of cloned. Hardlinked files share an
+	// inode with the source, so their metadata is left untouched.
+	hardlink func(src string) bool
+	// workers bounds how many regular files are written concurrently.
+	// Values below 2 write files inline during the walk.
+	workers int
+	// onEntry is called once for every entry written, including src itself,
+	// with the number of bytes written (zero for anything but regular
+	// files). Calls are serialized even when workers > 1.
+	onEntry func(size int64)
+
+	mu sync.Mutex
+}
+
+type dirMeta struct {
+	path    string
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// copy clones src to dst. src may be a directory, a regular file or a symlink.
+// The walk stops at the next entry once ctx is done.
+func (t *treeCopier) copy(ctx context.Context, src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return t.copyEntry(src, dst, info)
+	}
+
+	var (
+		dirs    []dirMeta
+		wg      sync.WaitGroup
+		errMu   sync.Mutex
+		fileErr error
+		sem     chan struct{}
+	)
+	if t.workers > 1 {
+		sem = make(chan struct{}, t.workers)
+	}
+	failed := func() error {
+		errMu.Lock()
+		defer errMu.Unlock()
+		return fileErr
+	}
+
+	walkErr := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path != src && vanished(path, err) {
+				return nil
+			}
+			return err
+		}
+		if err := failed(); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			if vanished(path, err) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			if sem == nil || !info.Mode().IsRegular() {
+				if err := t.copyEntry(path, target, info); err != nil && !vanished(path, err) {
+					return err
+				}
+				return nil
+			}
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				if err := t.copyEntry(path, target, info); err != nil && !vanished(path, err) {
+					errMu.Lock()
+					if fileErr == nil {
+						fileErr = err
+					}
+					errMu.Unlock()
+				}
+			}()
+			return nil
+		}
+		// Create directories owner-writable so their contents can be
+		// populated; the real mode is restored once the walk completes.
+		if err := os.Mkdir(target, info.Mode().Perm()|0700); err != nil {
+			return err
+		}
+		dirs = append(dirs, dirMeta{path: target, mode: info.Mode(), modTime: info.ModTime()})
+		t.entryDone(0)
+		return nil
+	})
+	wg.Wait()
+	if err := failed(); err != nil {
+		return err
+	}
+	if walkErr != nil {
+		return walkErr
+	}
+
+	// Restore directory metadata deepest-first: writing entries into a
+	// directory updates its mtime, so parents must be stamped last.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirs[i].path, chmodBits(dirs[i].mode)); err != nil {
+			return err
+		}
+		if err := os.Chtimes(dirs[i].path, time.Time{}, dirs[i].modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *treeCopier) copyEntry(src, dst string, info fs.FileInfo) error {
+	var size int64
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(target, dst); err != nil {
+			return err
+		}
+	case info.Mode().IsRegular():
+		if t.hardlink != nil && t.hardlink(src) {
+			err := os.Link(src, dst)
+			if err == nil {
+				size = info.Size()
+				break
+			}
+			if !errors.Is(err, syscall.EXDEV) {
+				return err
+			}
+			// The source lives on another filesystem; clone it instead.
+		}
+		if err := t.cloneFile(src, dst, info); err != nil {
+			return err
+		}
+		if err := os.Chmod(dst, chmodBits(info.Mode())); err != nil {
+			return err
+		}
+		if err := os.Chtimes(dst, time.Time{}, info.ModTime()); err != nil {
+			return err
+		}
+		size = info.Size()
+	default:
+		// Sockets, FIFOs and device nodes belong to whatever process created
+		// them in the golden copy and are meaningless in a workspace.
+	}
+	t.entryDone(size)
+	return nil
+}
+
+// vanished reports whether err is from src having been removed since it
+// was listed, as git's index.lock is while git runs in the source. Like
+// rsync, the copy skips such entries.
+func vanished(src string, err error) bool {
+	if !errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	_, statErr := os.Lstat(src)
+	return errors.Is(statErr, fs.ErrNotExist)
+}
+
+func (t *treeCopier) entryDone(size int64) {
+	if t.onEntry == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onEntry(size)
+}
+
+// chmodBits returns the subset of mode accepted by os.Chmod.
+func chmodBits(mode fs.FileMode) fs.FileMode {
+	return mode & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+}
+
+// cloneTreeWithProgress runs copier over src, reporting one clone event per
+// entry against total. Unknown totals are computed up front by walking src.
+func cloneTreeWithProgress(ctx context.Context, copier *treeCopier, src, dst string, total treeTotals, onProgress ProgressFunc) error {
+	total = total.resolve(src)
+	if onProgress != nil {
+		onProgress(ProgressEvent{Total: total.entries, BytesTotal: total.bytes, Phase: "scan"})
+	}
+
+	var (
+		copied int
+		bytes  int64
+		meter  = newRateMeter()
+	)
+	copier.onEntry = func(size int64) {
+		copied++
+		bytes += size
+		if onProgress != nil {
+			onProgress(ProgressEvent{
+				Copied:     copied,
+				Total:      total.entries,
+				Bytes:      bytes,
+				BytesTotal: total.bytes,
+				Rate:       meter.observe(bytes),
+				Phase:      "clone",
+			})
+		}
+	}
+	if err := copier.copy(ctx, src, dst); err != nil {
+		return fmt.Errorf("clone failed: %w", err)
+	}
+	return nil
+}
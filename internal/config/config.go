@@ -10,7 +10,10 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+
+	"github.com/chrisbanes/grove/internal/ignore"
 )
 
 const (
@@ -18,12 +21,14 @@ const (
 	ConfigFile    = "config.json"
 	BackendFile   = "backend.json"
 	WorkspaceFile = "workspace.json"
+	PoolFile      = "pool.json"
 	HooksDir      = "hooks"
 	runtimeIDFile = ".runtime-id"
 )
 
 const groveGitignoreContents = `# Grove local metadata (safe to ignore)
 workspace.json
+pool.json
 backend.json
 .runtime-id
 `
@@ -35,6 +40,135 @@ type Config struct {
 	MaxWorkspaces int      `json:"max_workspaces"`
 	Exclude       []string `json:"exclude,omitempty"`
 	CloneBackend  string   `json:"clone_backend,omitempty"`
+	// HardlinkPaths lists read-only cache directories, relative to the repo
+	// root, whose files the copy backend hardlinks instead of copying.
+	HardlinkPaths []string `json:"hardlink_paths,omitempty"`
+	// CloneConcurrency bounds how many subtrees a selective clone copies at
+	// once. Zero uses the clone package default.
+	CloneConcurrency int `json:"clone_concurrency,omitempty"`
+	// Relocate lists patterns of files in which the golden copy's path is
+	// rewritten to the workspace path after cloning.
+	Relocate []string `json:"relocate,omitempty"`
+	// PostClone lists built-in fixups applied, in order, to every new
+	// workspace before the post-clone hook runs.
+	PostClone []PostCloneAction `json:"post_clone,omitempty"`
+	// PoolSize is how many unclaimed workspaces grove pool fill keeps ready
+	// for grove create to claim. The pool is not filled past MaxWorkspaces
+	// workspaces in all.
+	PoolSize int `json:"pool_size,omitempty"`
+	// ImageShadowMaxGB caps how large, in GB, the shadow file of an image
+	// workspace may grow. A workspace over it is flagged by grove list and
+	// fails grove image check. Zero means no cap.
+	ImageShadowMaxGB int `json:"image_shadow_max_gb,omitempty"`
+	// ImageHeadroomGB is how much free space, in GB, a base image sync
+	// leaves in the base image, growing the image if needed. Zero uses the
+	// image package default.
+	ImageHeadroomGB int `json:"image_headroom_gb,omitempty"`
+	// ImageSyncEngine selects how base images, the btrfs managed base and
+	// overlay lower layers are synced: "native", the default, or "rsync".
+	ImageSyncEngine string `json:"image_sync_engine,omitempty"`
+	// ImageSyncChecksum makes the native sync engine compare file contents
+	// rather than sizes and modification times.
+	ImageSyncChecksum bool `json:"image_sync_checksum,omitempty"`
+}
+
+// PostCloneAction is a single post-clone fixup. Exactly one action is set.
+// Each action selects workspace paths with a gitignore-style pattern.
+type PostCloneAction struct {
+	// Delete removes matching files and directories.
+	Delete string `json:"delete,omitempty"`
+	// Truncate empties matching files, including files in matching
+	// directories.
+	Truncate string `json:"truncate,omitempty"`
+	// Replace rewrites text in matching files.
+	Replace *ReplaceAction `json:"replace,omitempty"`
+	// Chmod sets the permissions of matching files and directories.
+	Chmod *ChmodAction `json:"chmod,omitempty"`
+}
+
+// ReplaceAction replaces every occurrence of Old with New in the text files
+// matching Glob, including files in matching directories. Old and New may
+// contain {golden} and {workspace}, which expand to the golden copy and
+// workspace paths.
+type ReplaceAction struct {
+	Glob string `json:"glob"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// ChmodAction sets the octal Mode, such as "0755", on the files and
+// directories matching Glob.
+type ChmodAction struct {
+	Glob string `json:"glob"`
+	Mode string `json:"mode"`
+}
+
+// Pattern returns the pattern selecting the paths a is applied to.
+func (a PostCloneAction) Pattern() string {
+	switch {
+	case a.Delete != "":
+		return a.Delete
+	case a.Truncate != "":
+		return a.Truncate
+	case a.Replace != nil:
+		return a.Replace.Glob
+	case a.Chmod != nil:
+		return a.Chmod.Glob
+	}
+	return ""
+}
+
+// String describes a for progress output and errors.
+func (a PostCloneAction) String() string {
+	switch {
+	case a.Delete != "":
+		return "delete " + a.Delete
+	case a.Truncate != "":
+		return "truncate " + a.Truncate
+	case a.Replace != nil:
+		return fmt.Sprintf("replace %q in %s", a.Replace.Old, a.Replace.Glob)
+	case a.Chmod != nil:
+		return "chmod " + a.Chmod.Mode + " " + a.Chmod.Glob
+	}
+	return "empty action"
+}
+
+// Validate reports whether a sets exactly one well-formed action.
+func (a PostCloneAction) Validate() error {
+	set := 0
+	for _, ok := range []bool{a.Delete != "", a.Truncate != "", a.Replace != nil, a.Chmod != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("expected exactly one of delete, truncate, replace or chmod")
+	}
+	p, err := ignore.Parse(a.Pattern())
+	if err != nil {
+		return err
+	}
+	if p == nil || p.Negated() {
+		return fmt.Errorf("invalid pattern %q: must select paths", a.Pattern())
+	}
+	if a.Replace != nil && a.Replace.Old == "" {
+		return fmt.Errorf("replace: old must not be empty")
+	}
+	if a.Chmod != nil {
+		if _, err := a.Chmod.FileMode(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FileMode parses Mode as octal permission bits.
+func (c ChmodAction) FileMode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(c.Mode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid chmod mode %q: expected octal permissions such as 0755", c.Mode)
+	}
+	return os.FileMode(mode), nil
 }
 
 func DefaultConfig(projectName string) *Config {
@@ -63,8 +197,40 @@ func Load(repoRoot string) (*Config, error) {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 	for _, pattern := range cfg.Exclude {
-		if _, err := filepath.Match(pattern, ""); err != nil {
-			return nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		if _, err := ignore.Parse(pattern); err != nil {
+			return nil, fmt.Errorf("invalid exclude: %w", err)
+		}
+	}
+	for _, p := range cfg.HardlinkPaths {
+		if p == "" || filepath.IsAbs(p) || p == ".." || strings.HasPrefix(filepath.Clean(p), ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("invalid hardlink path %q: must be relative to the repository root", p)
+		}
+	}
+	if cfg.PoolSize < 0 {
+		return nil, fmt.Errorf("invalid pool_size %d: must not be negative", cfg.PoolSize)
+	}
+	if cfg.ImageShadowMaxGB < 0 {
+		return nil, fmt.Errorf("invalid image_shadow_max_gb %d: must not be negative", cfg.ImageShadowMaxGB)
+	}
+	if cfg.ImageHeadroomGB < 0 {
+		return nil, fmt.Errorf("invalid image_headroom_gb %d: must not be negative", cfg.ImageHeadroomGB)
+	}
+	switch cfg.ImageSyncEngine {
+	case "", "native", "rsync":
+	default:
+		return nil, fmt.Errorf("invalid image_sync_engine %q: must be native or rsync", cfg.ImageSyncEngine)
+	}
+	if cfg.CloneConcurrency < 0 {
+		return nil, fmt.Errorf("invalid clone_concurrency %d: must not be negative", cfg.CloneConcurrency)
+	}
+	for _, pattern := range cfg.Relocate {
+		if _, err := ignore.Parse(pattern); err != nil {
+			return nil, fmt.Errorf("invalid relocate: %w", err)
+		}
+	}
+	for i, action := range cfg.PostClone {
+		if err := action.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid post_clone action %d: %w", i+1, err)
 		}
 	}
 	if cfg.MaxWorkspaces == 0 {
@@ -127,15 +293,40 @@ func LoadOrInitMinimal(repoRoot string) (*Config, bool, error) {
 	return cfg, true, nil
 }
 
+// ExecBackendPrefix marks a clone_backend implemented by a plugin executable:
+// "exec:<name>" runs grove-backend-<name> from PATH.
+const ExecBackendPrefix = "exec:"
+
+var execBackendNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ExecBackendName returns the plugin name of an "exec:<name>" clone
+// backend, and whether backend is one.
+func ExecBackendName(backend string) (string, bool) {
+	return strings.CutPrefix(backend, ExecBackendPrefix)
+}
+
+// ValidCloneBackend reports whether backend names a clone backend: cp, copy,
+// image, btrfs, zfs, overlay, worktree or exec:<name>.
+func ValidCloneBackend(backend string) bool {
+	_, err := normalizeCloneBackend(backend)
+	return err == nil && backend != ""
+}
+
 func normalizeCloneBackend(value string) (string, error) {
 	if value == "" {
 		return "cp", nil
 	}
+	if name, ok := ExecBackendName(value); ok {
+		if !execBackendNamePattern.MatchString(name) {
+			return "", fmt.Errorf("invalid clone_backend %q: plugin names use lowercase letters, digits, '-' and '_'", value)
+		}
+		return value, nil
+	}
 	switch value {
-	case "cp", "image":
+	case "cp", "copy", "image", "btrfs", "zfs", "overlay", "worktree":
 		return value, nil
 	default:
-		return "", fmt.Errorf("invalid clone_backend %q: expected cp or image", value)
+		return "", fmt.Errorf("invalid clone_backend %q: expected cp, copy, image, btrfs, zfs, overlay, worktree or exec:<name>", value)
 	}
 }
 
@@ -146,17 +337,35 @@ func Save(repoRoot string, cfg *Config) error {
 	}
 	defaults := DefaultConfig("")
 	type persistedConfig struct {
-		WarmupCommand string   `json:"warmup_command,omitempty"`
-		WorkspaceDir  string   `json:"workspace_dir"`
-		StateDir      string   `json:"state_dir,omitempty"`
-		MaxWorkspaces int      `json:"max_workspaces,omitempty"`
-		Exclude       []string `json:"exclude,omitempty"`
-		CloneBackend  string   `json:"clone_backend,omitempty"`
+		WarmupCommand     string            `json:"warmup_command,omitempty"`
+		WorkspaceDir      string            `json:"workspace_dir"`
+		StateDir          string            `json:"state_dir,omitempty"`
+		MaxWorkspaces     int               `json:"max_workspaces,omitempty"`
+		Exclude           []string          `json:"exclude,omitempty"`
+		CloneBackend      string            `json:"clone_backend,omitempty"`
+		HardlinkPaths     []string          `json:"hardlink_paths,omitempty"`
+		CloneConcurrency  int               `json:"clone_concurrency,omitempty"`
+		Relocate          []string          `json:"relocate,omitempty"`
+		PostClone         []PostCloneAction `json:"post_clone,omitempty"`
+		PoolSize          int               `json:"pool_size,omitempty"`
+		ImageShadowMaxGB  int               `json:"image_shadow_max_gb,omitempty"`
+		ImageHeadroomGB   int               `json:"image_headroom_gb,omitempty"`
+		ImageSyncEngine   string            `json:"image_sync_engine,omitempty"`
+		ImageSyncChecksum bool              `json:"image_sync_checksum,omitempty"`
 	}
 	pc := persistedConfig{
-		WarmupCommand: cfg.WarmupCommand,
-		WorkspaceDir:  cfg.WorkspaceDir,
-		Exclude:       cfg.Exclude,
+		WarmupCommand:     cfg.WarmupCommand,
+		WorkspaceDir:      cfg.WorkspaceDir,
+		Exclude:           cfg.Exclude,
+		HardlinkPaths:     cfg.HardlinkPaths,
+		CloneConcurrency:  cfg.CloneConcurrency,
+		Relocate:          cfg.Relocate,
+		PostClone:         cfg.PostClone,
+		PoolSize:          cfg.PoolSize,
+		ImageShadowMaxGB:  cfg.ImageShadowMaxGB,
+		ImageHeadroomGB:   cfg.ImageHeadroomGB,
+		ImageSyncEngine:   cfg.ImageSyncEngine,
+		ImageSyncChecksum: cfg.ImageSyncChecksum,
 	}
 	// Only persist non-default values
 	if cfg.StateDir != defaults.StateDir {
@@ -216,6 +425,45 @@ func ExpandStateDir(stateDir string) string {
 	return stateDir
 }
 
+// PlanCacheDir returns the directory where selective clone plans are cached,
+// or "" when no state dir is configured.
+func PlanCacheDir(cfg *Config) string {
+	if cfg.StateDir == "" {
+		return ""
+	}
+	return filepath.Join(ExpandStateDir(cfg.StateDir), "plans")
+}
+
+// SlotsDirName is the directory workspace slots are reserved in, inside the
+// workspace directory, when no state dir is configured.
+const SlotsDirName = ".grove-slots"
+
+// SlotsDir returns the directory where workspace slots for cfg's workspace
+// directory are reserved. Without a state dir, that is a directory inside
+// the workspace directory.
+func SlotsDir(cfg *Config) string {
+	if cfg.StateDir == "" {
+		return filepath.Join(cfg.WorkspaceDir, SlotsDirName)
+	}
+	sum := sha256.Sum256([]byte(cfg.WorkspaceDir))
+	return filepath.Join(ExpandStateDir(cfg.StateDir), "slots", hex.EncodeToString(sum[:6]))
+}
+
+// GoldenLockPath returns the path of the lock that keeps commands which
+// change the golden copy at repoRoot from running while others read it.
+func GoldenLockPath(repoRoot string, cfg *Config) (string, error) {
+	stateDir, err := filepath.Abs(ExpandStateDir(cfg.StateDir))
+	if err != nil {
+		return "", err
+	}
+	absRepoRoot, err := filepath.Abs(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(absRepoRoot))
+	return filepath.Join(stateDir, "locks", "golden-"+hex.EncodeToString(sum[:6])+".lock"), nil
+}
+
 // MigrateRuntimesToStateDir moves runtimes/ from workspace_dir to state_dir
 // if they exist under workspace_dir. Returns true if migration occurred.
 // Expects cfg.WorkspaceDir to already be expanded.
@@ -393,6 +641,9 @@ func legacyImageRuntimeRoot(repoRoot string, cfg *Config) (string, error) {
 // BuildImageSyncExcludes returns the excludes used for image backend base sync.
 // It includes user excludes plus the workspace directory when that directory
 // lives inside the golden copy (to avoid recursive workspace ingestion).
+// Those entries are appended last and anchored to the root. Excludes take
+// precedence over .groveignore files, so neither exclude nor .groveignore
+// patterns can re-include them.
 func BuildImageSyncExcludes(goldenRoot string, cfg *Config) ([]string, error) {
 	excludes := append([]string(nil), cfg.Exclude...)
 
@@ -415,7 +666,7 @@ func BuildImageSyncExcludes(goldenRoot string, cfg *Config) ([]string, error) {
 		return nil, fmt.Errorf("workspace_dir resolves to the repository root; choose a subdirectory or external path")
 	}
 	if rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
-		excludes = append(excludes, filepath.ToSlash(rel)+"/")
+		excludes = append(excludes, "/"+filepath.ToSlash(rel)+"/")
 	}
 
 	// Exclude state_dir if inside repo
@@ -432,7 +683,7 @@ func BuildImageSyncExcludes(goldenRoot string, cfg *Config) ([]string, error) {
 	}
 	rel = filepath.Clean(rel)
 	if rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && rel != "." {
-		excludes = append(excludes, filepath.ToSlash(rel)+"/")
+		excludes = append(excludes, "/"+filepath.ToSlash(rel)+"/")
 	}
 
 	return excludes, nil
@@ -515,13 +766,16 @@ func EnsureBackendCompatible(repoRoot string, cfg *Config) error {
 		hasImageState = hasImageState || imageStateExists(legacyRoot)
 	}
 
-	switch cfg.CloneBackend {
-	case "cp":
+	// Plugins and the btrfs, zfs, overlay and worktree backends keep their
+	// own state, so like cp they only conflict with leftover image state.
+	_, isExec := ExecBackendName(cfg.CloneBackend)
+	switch {
+	case cfg.CloneBackend == "cp", cfg.CloneBackend == "copy", cfg.CloneBackend == "btrfs", cfg.CloneBackend == "zfs", cfg.CloneBackend == "overlay", cfg.CloneBackend == "worktree", isExec:
 		if hasImageState {
-			return fmt.Errorf("configured clone_backend is %q but initialized backend appears to be %q.\nRun `grove migrate --to %s`", "cp", "image", "cp")
+			return fmt.Errorf("configured clone_backend is %q but initialized backend appears to be %q.\nRun `grove migrate --to %s`", cfg.CloneBackend, "image", cfg.CloneBackend)
 		}
-		return SaveBackendState(repoRoot, "cp")
-	case "image":
+		return SaveBackendState(repoRoot, cfg.CloneBackend)
+	case cfg.CloneBackend == "image":
 		if !hasImageState {
 			// Allow lazy image backend bootstrap. `grove create` and `grove update`
 			// will initialize the base image when state is missing.
@@ -529,7 +783,7 @@ func EnsureBackendCompatible(repoRoot string, cfg *Config) error {
 		}
 		return SaveBackendState(repoRoot, "image")
 	default:
-		return fmt.Errorf("invalid clone_backend %q: expected cp or image", cfg.CloneBackend)
+		return fmt.Errorf("invalid clone_backend %q: expected cp, copy, image, btrfs, zfs, overlay, worktree or exec:<name>", cfg.CloneBackend)
 	}
 }
 
@@ -1,13 +1,16 @@
 package config_test
 
 import (
+	"encoding/json"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/chrisbanes/grove/internal/config"
+	"github.com/chrisbanes/grove/internal/ignore"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -145,8 +148,34 @@ func TestBuildImageSyncExcludes_AddsWorkspaceDirWhenInsideRepo(t *testing.T) {
 	if excludes[0] != "node_modules" {
 		t.Fatalf("expected first exclude node_modules, got %q", excludes[0])
 	}
-	if excludes[1] != "workspaces/" {
-		t.Fatalf("expected workspace exclude workspaces/, got %q", excludes[1])
+	if excludes[1] != "/workspaces/" {
+		t.Fatalf("expected workspace exclude /workspaces/, got %q", excludes[1])
+	}
+}
+
+func TestBuildImageSyncExcludes_GroveignoreCannotReinclude(t *testing.T) {
+	repo := t.TempDir()
+	stateDir := filepath.Join(repo, "state")
+	os.MkdirAll(filepath.Join(repo, "workspaces"), 0755)
+	os.MkdirAll(stateDir, 0755)
+	os.WriteFile(filepath.Join(repo, ignore.FileName), []byte("!workspaces/\n!/state/\n"), 0644)
+	cfg := &config.Config{
+		WorkspaceDir: filepath.Join(repo, "workspaces"),
+		StateDir:     stateDir,
+	}
+
+	excludes, err := config.BuildImageSyncExcludes(repo, cfg)
+	if err != nil {
+		t.Fatalf("BuildImageSyncExcludes() error = %v", err)
+	}
+	m, err := ignore.Load(repo, excludes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"workspaces", "state"} {
+		if !m.Excluded(dir, true) {
+			t.Errorf("%s re-included by .groveignore, want it excluded", dir)
+		}
 	}
 }
 
@@ -179,7 +208,7 @@ func TestBuildImageSyncExcludes_ExpandsTemplateBeforeComparison(t *testing.T) {
 	if err != nil {
 		t.Fatalf("BuildImageSyncExcludes() error = %v", err)
 	}
-	if len(excludes) != 1 || excludes[0] != "workspaces/myproj/" {
+	if len(excludes) != 1 || excludes[0] != "/workspaces/myproj/" {
 		t.Fatalf("expected expanded workspace exclude, got %v", excludes)
 	}
 }
@@ -199,6 +228,27 @@ func TestBuildImageSyncExcludes_ErrorsWhenWorkspaceDirIsRepoRoot(t *testing.T) {
 	}
 }
 
+func TestGoldenLockPath(t *testing.T) {
+	stateDir := t.TempDir()
+	cfg := &config.Config{StateDir: stateDir}
+	repo := t.TempDir()
+
+	path, err := config.GoldenLockPath(repo, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(path) != filepath.Join(stateDir, "locks") {
+		t.Errorf("lock path %s is not in the state dir's locks", path)
+	}
+	t.Chdir(repo)
+	if again, _ := config.GoldenLockPath(".", cfg); again != path {
+		t.Errorf("relative repo root gave %s, want %s", again, path)
+	}
+	if other, _ := config.GoldenLockPath(t.TempDir(), cfg); other == path {
+		t.Error("different golden copies share a lock")
+	}
+}
+
 func TestImageRuntimeRoot_UsesRuntimeIDFile(t *testing.T) {
 	repo := filepath.Join(t.TempDir(), "My-Repo")
 	if err := os.MkdirAll(filepath.Join(repo, ".grove"), 0755); err != nil {
@@ -448,6 +498,236 @@ func TestLoad_CloneBackendImage(t *testing.T) {
 	}
 }
 
+func TestLoad_CloneBackendCopy(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".grove"), 0755)
+	os.WriteFile(
+		filepath.Join(dir, ".grove", "config.json"),
+		[]byte(`{"workspace_dir": "/tmp/test", "clone_backend": "copy", "hardlink_paths": [".gradle/caches"]}`),
+		0644,
+	)
+
+	cfg, err := config.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CloneBackend != "copy" {
+		t.Errorf("expected clone_backend copy, got %q", cfg.CloneBackend)
+	}
+	if len(cfg.HardlinkPaths) != 1 || cfg.HardlinkPaths[0] != ".gradle/caches" {
+		t.Errorf("unexpected hardlink_paths: %v", cfg.HardlinkPaths)
+	}
+}
+
+func TestLoad_InvalidHardlinkPath(t *testing.T) {
+	for _, p := range []string{"/abs/path", "../outside", ""} {
+		dir := t.TempDir()
+		os.MkdirAll(filepath.Join(dir, ".grove"), 0755)
+		data, _ := json.Marshal(map[string]any{"workspace_dir": "/tmp/test", "hardlink_paths": []string{p}})
+		os.WriteFile(filepath.Join(dir, ".grove", "config.json"), data, 0644)
+
+		if _, err := config.Load(dir); err == nil {
+			t.Errorf("expected error for hardlink path %q", p)
+		}
+	}
+}
+
+func TestSaveAndLoad_CloneConcurrency(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig("proj")
+	cfg.CloneConcurrency = 4
+	if err := config.Save(dir, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := config.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.CloneConcurrency != 4 {
+		t.Errorf("expected clone_concurrency 4, got %d", loaded.CloneConcurrency)
+	}
+}
+
+func TestLoad_NegativeCloneConcurrency(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".grove"), 0755)
+	os.WriteFile(
+		filepath.Join(dir, ".grove", "config.json"),
+		[]byte(`{"workspace_dir": "/tmp/test", "clone_concurrency": -1}`),
+		0644,
+	)
+
+	if _, err := config.Load(dir); err == nil {
+		t.Error("expected error for negative clone_concurrency")
+	}
+}
+
+func TestSaveAndLoad_PoolSize(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig("proj")
+	cfg.PoolSize = 3
+	if err := config.Save(dir, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := config.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.PoolSize != 3 {
+		t.Errorf("expected pool_size 3, got %d", loaded.PoolSize)
+	}
+}
+
+func TestLoad_NegativePoolSize(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".grove"), 0755)
+	os.WriteFile(
+		filepath.Join(dir, ".grove", "config.json"),
+		[]byte(`{"workspace_dir": "/tmp/test", "pool_size": -1}`),
+		0644,
+	)
+
+	if _, err := config.Load(dir); err == nil {
+		t.Error("expected error for negative pool_size")
+	}
+}
+
+func TestSaveAndLoad_ImageSettings(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig("proj")
+	cfg.ImageShadowMaxGB = 20
+	cfg.ImageHeadroomGB = 50
+	cfg.ImageSyncEngine = "rsync"
+	cfg.ImageSyncChecksum = true
+	if err := config.Save(dir, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := config.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ImageShadowMaxGB != 20 {
+		t.Errorf("expected image_shadow_max_gb 20, got %d", loaded.ImageShadowMaxGB)
+	}
+	if loaded.ImageHeadroomGB != 50 {
+		t.Errorf("expected image_headroom_gb 50, got %d", loaded.ImageHeadroomGB)
+	}
+	if loaded.ImageSyncEngine != "rsync" || !loaded.ImageSyncChecksum {
+		t.Errorf("expected image_sync_engine rsync with checksums, got %q, %v", loaded.ImageSyncEngine, loaded.ImageSyncChecksum)
+	}
+}
+
+func TestLoad_NegativeImageShadowMaxGB(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".grove"), 0755)
+	os.WriteFile(
+		filepath.Join(dir, ".grove", "config.json"),
+		[]byte(`{"workspace_dir": "/tmp/test", "image_shadow_max_gb": -1}`),
+		0644,
+	)
+
+	if _, err := config.Load(dir); err == nil {
+		t.Error("expected error for negative image_shadow_max_gb")
+	}
+}
+
+func TestLoad_NegativeImageHeadroomGB(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".grove"), 0755)
+	os.WriteFile(
+		filepath.Join(dir, ".grove", "config.json"),
+		[]byte(`{"workspace_dir": "/tmp/test", "image_headroom_gb": -1}`),
+		0644,
+	)
+
+	if _, err := config.Load(dir); err == nil {
+		t.Error("expected error for negative image_headroom_gb")
+	}
+}
+
+func TestLoad_UnknownImageSyncEngine(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".grove"), 0755)
+	os.WriteFile(
+		filepath.Join(dir, ".grove", "config.json"),
+		[]byte(`{"workspace_dir": "/tmp/test", "image_sync_engine": "robocopy"}`),
+		0644,
+	)
+
+	if _, err := config.Load(dir); err == nil {
+		t.Error("expected error for unknown image_sync_engine")
+	}
+}
+
+func TestSaveAndLoad_RelocateAndPostClone(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig("proj")
+	cfg.Relocate = []string{"/venv/"}
+	cfg.PostClone = []config.PostCloneAction{
+		{Delete: "*.lock"},
+		{Replace: &config.ReplaceAction{Glob: "*.properties", Old: "{golden}", New: "{workspace}"}},
+		{Chmod: &config.ChmodAction{Glob: "scripts/*.sh", Mode: "0755"}},
+	}
+	if err := config.Save(dir, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := config.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Relocate, cfg.Relocate) {
+		t.Errorf("relocate = %q, want %q", loaded.Relocate, cfg.Relocate)
+	}
+	if !reflect.DeepEqual(loaded.PostClone, cfg.PostClone) {
+		t.Errorf("post_clone = %+v, want %+v", loaded.PostClone, cfg.PostClone)
+	}
+}
+
+func TestLoad_InvalidRelocatePattern(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".grove"), 0755)
+	os.WriteFile(
+		filepath.Join(dir, ".grove", "config.json"),
+		[]byte(`{"workspace_dir": "/tmp/test", "relocate": ["venv/", "[bad"]}`),
+		0644,
+	)
+
+	_, err := config.Load(dir)
+	if err == nil || !strings.Contains(err.Error(), "invalid relocate") {
+		t.Errorf("expected invalid relocate error, got %v", err)
+	}
+}
+
+func TestLoad_InvalidPostClone(t *testing.T) {
+	tests := map[string]string{
+		"no action":       `{}`,
+		"two actions":     `{"delete": "a", "truncate": "b"}`,
+		"bad pattern":     `{"delete": "[bad"}`,
+		"negated pattern": `{"truncate": "!keep.db"}`,
+		"empty old":       `{"replace": {"glob": "*.txt", "old": ""}}`,
+		"bad mode":        `{"chmod": {"glob": "*.sh", "mode": "rwx"}}`,
+	}
+	for name, action := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			os.MkdirAll(filepath.Join(dir, ".grove"), 0755)
+			os.WriteFile(
+				filepath.Join(dir, ".grove", "config.json"),
+				[]byte(`{"workspace_dir": "/tmp/test", "post_clone": [`+action+`]}`),
+				0644,
+			)
+			_, err := config.Load(dir)
+			if err == nil || !strings.Contains(err.Error(), "post_clone action 1") {
+				t.Errorf("expected post_clone action 1 error, got %v", err)
+			}
+		})
+	}
+}
+
 func TestLoad_InvalidCloneBackend(t *testing.T) {
 	dir := t.TempDir()
 	os.MkdirAll(filepath.Join(dir, ".grove"), 0755)
@@ -489,6 +769,82 @@ func TestEnsureBackendCompatible_SeedsCPState(t *testing.T) {
 	}
 }
 
+func TestEnsureBackendCompatible_SeedsCopyState(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".grove"), 0755)
+	os.WriteFile(
+		filepath.Join(dir, ".grove", "config.json"),
+		[]byte(`{"workspace_dir": "/tmp/test", "clone_backend": "copy"}`),
+		0644,
+	)
+	cfg, err := config.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := config.EnsureBackendCompatible(dir, cfg); err != nil {
+		t.Fatalf("EnsureBackendCompatible() error = %v", err)
+	}
+
+	backend, err := config.LoadBackendState(dir)
+	if err != nil {
+		t.Fatalf("LoadBackendState() error = %v", err)
+	}
+	if backend != "copy" {
+		t.Fatalf("expected backend state copy, got %q", backend)
+	}
+}
+
+func TestEnsureBackendCompatible_SeedsExecState(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".grove"), 0755)
+	os.WriteFile(
+		filepath.Join(dir, ".grove", "config.json"),
+		[]byte(`{"workspace_dir": "/tmp/test", "clone_backend": "exec:zfs"}`),
+		0644,
+	)
+	cfg, err := config.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := config.EnsureBackendCompatible(dir, cfg); err != nil {
+		t.Fatalf("EnsureBackendCompatible() error = %v", err)
+	}
+
+	backend, err := config.LoadBackendState(dir)
+	if err != nil {
+		t.Fatalf("LoadBackendState() error = %v", err)
+	}
+	if backend != "exec:zfs" {
+		t.Fatalf("expected backend state exec:zfs, got %q", backend)
+	}
+}
+
+func TestValidCloneBackend(t *testing.T) {
+	tests := map[string]bool{
+		"cp":            true,
+		"copy":          true,
+		"image":         true,
+		"btrfs":         true,
+		"zfs":           true,
+		"overlay":       true,
+		"worktree":      true,
+		"exec:zfs":      true,
+		"exec:my-store": true,
+		"":              false,
+		"exec:":         false,
+		"exec:../bin":   false,
+		"exec:ZFS":      false,
+		"nfs":           false,
+	}
+	for backend, want := range tests {
+		if got := config.ValidCloneBackend(backend); got != want {
+			t.Errorf("ValidCloneBackend(%q) = %v, want %v", backend, got, want)
+		}
+	}
+}
+
 func TestEnsureBackendCompatible_ImageWithoutStateAllowsLazyBootstrap(t *testing.T) {
 	dir := t.TempDir()
 	os.MkdirAll(filepath.Join(dir, ".grove"), 0755)
@@ -1,6 +1,7 @@
 package git
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
 	"strings"
@@ -42,9 +43,10 @@ func CurrentCommit(path string) (string, error) {
 	return strings.TrimSpace(string(out)), nil
 }
 
-// Pull runs git pull in the repo at path.
-func Pull(path string) error {
-	cmd := exec.Command("git", "-C", path, "pull")
+// Pull runs git pull in the repo at path. The commands it runs are killed
+// once ctx is done.
+func Pull(ctx context.Context, path string) error {
+	cmd := exec.CommandContext(ctx, "git", "-C", path, "pull")
 	out, err := cmd.CombinedOutput()
 	if err == nil {
 		return nil
@@ -60,18 +62,18 @@ func Pull(path string) error {
 			return fmt.Errorf("git pull: %w\n%s", err, out)
 		}
 
-		remote, remoteErr := pullRemote(path, branch)
+		remote, remoteErr := pullRemote(ctx, path, branch)
 		if remoteErr != nil {
 			return fmt.Errorf("git pull: %w\n%s", err, out)
 		}
 
-		fallback := exec.Command("git", "-C", path, "pull", remote, branch)
+		fallback := exec.CommandContext(ctx, "git", "-C", path, "pull", remote, branch)
 		fallbackOut, fallbackErr := fallback.CombinedOutput()
 		if fallbackErr != nil {
 			return fmt.Errorf("git pull: %w\n%s", fallbackErr, fallbackOut)
 		}
 
-		setUpstream := exec.Command("git", "-C", path, "branch", "--set-upstream-to="+remote+"/"+branch, branch)
+		setUpstream := exec.CommandContext(ctx, "git", "-C", path, "branch", "--set-upstream-to="+remote+"/"+branch, branch)
 		setUpstreamOut, setUpstreamErr := setUpstream.CombinedOutput()
 		if setUpstreamErr != nil {
 			return fmt.Errorf("git branch --set-upstream-to: %w\n%s", setUpstreamErr, setUpstreamOut)
@@ -83,15 +85,15 @@ func Pull(path string) error {
 	// default branch and pull that instead.
 	if strings.Contains(outStr, "couldn't find remote ref") ||
 		strings.Contains(outStr, "no such ref was fetched") {
-		return pullDefaultBranch(path)
+		return pullDefaultBranch(ctx, path)
 	}
 
 	return fmt.Errorf("git pull: %w\n%s", err, out)
 }
 
 // pullDefaultBranch checks out the remote's default branch and pulls it.
-func pullDefaultBranch(path string) error {
-	defaultBranch, err := remoteDefaultBranch(path, "origin")
+func pullDefaultBranch(ctx context.Context, path string) error {
+	defaultBranch, err := remoteDefaultBranch(ctx, path, "origin")
 	if err != nil {
 		return fmt.Errorf("git pull: upstream ref deleted and cannot determine default branch: %w", err)
 	}
@@ -100,7 +102,7 @@ func pullDefaultBranch(path string) error {
 		return fmt.Errorf("git pull: upstream ref deleted, failed to checkout %s: %w", defaultBranch, err)
 	}
 
-	pullCmd := exec.Command("git", "-C", path, "pull")
+	pullCmd := exec.CommandContext(ctx, "git", "-C", path, "pull")
 	pullOut, pullErr := pullCmd.CombinedOutput()
 	if pullErr != nil {
 		return fmt.Errorf("git pull: %w\n%s", pullErr, pullOut)
@@ -109,8 +111,8 @@ func pullDefaultBranch(path string) error {
 }
 
 // remoteDefaultBranch returns the default branch name for a remote (e.g. "main").
-func remoteDefaultBranch(path, remote string) (string, error) {
-	cmd := exec.Command("git", "-C", path, "symbolic-ref", "refs/remotes/"+remote+"/HEAD")
+func remoteDefaultBranch(ctx context.Context, path, remote string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", path, "symbolic-ref", "refs/remotes/"+remote+"/HEAD")
 	out, err := cmd.Output()
 	if err != nil {
 		return "", err
@@ -124,8 +126,8 @@ func remoteDefaultBranch(path, remote string) (string, error) {
 	return "", fmt.Errorf("unexpected symbolic-ref output: %s", ref)
 }
 
-func pullRemote(path, branch string) (string, error) {
-	branchRemote := exec.Command("git", "-C", path, "config", "--get", "branch."+branch+".remote")
+func pullRemote(ctx context.Context, path, branch string) (string, error) {
+	branchRemote := exec.CommandContext(ctx, "git", "-C", path, "config", "--get", "branch."+branch+".remote")
 	branchRemoteOut, branchRemoteErr := branchRemote.Output()
 	if branchRemoteErr == nil {
 		remote := strings.TrimSpace(string(branchRemoteOut))
@@ -134,7 +136,7 @@ func pullRemote(path, branch string) (string, error) {
 		}
 	}
 
-	remotesCmd := exec.Command("git", "-C", path, "remote")
+	remotesCmd := exec.CommandContext(ctx, "git", "-C", path, "remote")
 	remotesOut, remotesErr := remotesCmd.Output()
 	if remotesErr != nil {
 		return "", remotesErr
@@ -182,3 +184,90 @@ func Checkout(path, branch string, create bool) error {
 	}
 	return nil
 }
+
+// IgnoredPaths lists the untracked files ignored by .gitignore rules in the
+// repo at path, relative to path and slash-separated. Wholly ignored
+// directories are listed once, with a trailing slash, instead of file by
+// file.
+func IgnoredPaths(ctx context.Context, path string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", path, "ls-files", "--others", "--ignored", "--exclude-standard", "--directory", "-z")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files: %w", err)
+	}
+	var paths []string
+	for _, p := range strings.Split(string(out), "\x00") {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// ChangedPaths lists the files in the repo at path that differ from HEAD:
+// tracked files changed or deleted, whether staged or not, and untracked
+// files that are not ignored. Paths are relative to path and
+// slash-separated.
+func ChangedPaths(ctx context.Context, path string) ([]string, error) {
+	var paths []string
+	for _, args := range [][]string{
+		{"diff", "--name-only", "--no-renames", "-z", "HEAD"},
+		{"ls-files", "--others", "--exclude-standard", "-z"},
+	} {
+		cmd := exec.CommandContext(ctx, "git", append([]string{"-C", path}, args...)...)
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("git %s: %w", args[0], err)
+		}
+		for _, p := range strings.Split(string(out), "\x00") {
+			if p != "" {
+				paths = append(paths, p)
+			}
+		}
+	}
+	return paths, nil
+}
+
+// AddWorktree adds a worktree of the repo at path at dst, checked out at
+// commit with a detached HEAD. The worktree shares the repo's objects and
+// refs.
+func AddWorktree(ctx context.Context, path, dst, commit string) error {
+	cmd := exec.CommandContext(ctx, "git", "-C", path, "worktree", "add", "--detach", dst, commit)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git worktree add: %w\n%s", err, out)
+	}
+	return nil
+}
+
+// RemoveWorktree removes the worktree at dst from the repo at path,
+// discarding any changes and untracked files in it.
+func RemoveWorktree(ctx context.Context, path, dst string) error {
+	cmd := exec.CommandContext(ctx, "git", "-C", path, "worktree", "remove", "--force", dst)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git worktree remove: %w\n%s", err, out)
+	}
+	return nil
+}
+
+// MoveWorktree moves the worktree at dst of the repo at path to newDst.
+func MoveWorktree(ctx context.Context, path, dst, newDst string) error {
+	cmd := exec.CommandContext(ctx, "git", "-C", path, "worktree", "move", dst, newDst)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git worktree move: %w\n%s", err, out)
+	}
+	return nil
+}
+
+// PruneWorktrees forgets worktrees of the repo at path whose directories
+// no longer exist.
+func PruneWorktrees(ctx context.Context, path string) error {
+	cmd := exec.CommandContext(ctx, "git", "-C", path, "worktree", "prune")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git worktree prune: %w\n%s", err, out)
+	}
+	return nil
+}
@@ -202,7 +202,7 @@ func TestPull_DeletedUpstreamRef_FallsBackToDefaultBranch(t *testing.T) {
 	run(t, seedRepo, "git", "push", "origin", branch)
 
 	// Pull should succeed by falling back to the default branch.
-	if err := git.Pull(localRepo); err != nil {
+	if err := git.Pull(t.Context(), localRepo); err != nil {
 		t.Fatalf("expected pull to succeed when upstream ref is deleted, got: %v", err)
 	}
 
@@ -246,7 +246,7 @@ func TestPull_WithoutUpstream_UsesCurrentBranchAndSetsTracking(t *testing.T) {
 	run(t, pusherRepo, "git", "commit", "-m", "new file")
 	run(t, pusherRepo, "git", "push", "origin", branch)
 
-	if err := git.Pull(localRepo); err != nil {
+	if err := git.Pull(t.Context(), localRepo); err != nil {
 		t.Fatalf("expected pull to succeed without upstream tracking, got: %v", err)
 	}
 
@@ -259,3 +259,86 @@ func TestPull_WithoutUpstream_UsesCurrentBranchAndSetsTracking(t *testing.T) {
 		t.Fatalf("expected upstream to be origin/%s, got %s", branch, upstream)
 	}
 }
+
+func TestIgnoredPaths(t *testing.T) {
+	repo := setupRepo(t)
+	os.WriteFile(filepath.Join(repo, ".gitignore"), []byte("build/\n*.log\n"), 0644)
+	os.MkdirAll(filepath.Join(repo, "build", "out"), 0755)
+	os.WriteFile(filepath.Join(repo, "build", "out", "a.o"), []byte("a"), 0644)
+	os.MkdirAll(filepath.Join(repo, "src"), 0755)
+	os.WriteFile(filepath.Join(repo, "src", "debug.log"), []byte("log"), 0644)
+	os.WriteFile(filepath.Join(repo, "src", "main.go"), []byte("package main"), 0644)
+
+	paths, err := git.IgnoredPaths(t.Context(), repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"build/", "src/debug.log"}
+	if strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Errorf("IgnoredPaths = %v, want %v", paths, want)
+	}
+}
+
+func TestChangedPaths(t *testing.T) {
+	repo := setupRepo(t)
+	os.WriteFile(filepath.Join(repo, ".gitignore"), []byte("*.log\n"), 0644)
+	os.WriteFile(filepath.Join(repo, "staged.txt"), []byte("new"), 0644)
+	runOutput(t, repo, "git", "add", "staged.txt")
+	os.WriteFile(filepath.Join(repo, "README.md"), []byte("changed"), 0644)
+	os.WriteFile(filepath.Join(repo, "debug.log"), []byte("log"), 0644)
+
+	paths, err := git.ChangedPaths(t.Context(), repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"README.md", "staged.txt", ".gitignore"}
+	if strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Errorf("ChangedPaths = %v, want %v", paths, want)
+	}
+}
+
+func TestAddAndRemoveWorktree(t *testing.T) {
+	repo := setupRepo(t)
+	dst := filepath.Join(t.TempDir(), "ws")
+
+	if err := git.AddWorktree(t.Context(), repo, dst, "HEAD"); err != nil {
+		t.Fatalf("AddWorktree() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "README.md")); err != nil {
+		t.Fatalf("worktree is missing README.md: %v", err)
+	}
+	if branch := runOutput(t, dst, "git", "branch", "--show-current"); branch != "" {
+		t.Errorf("worktree is on branch %q, want a detached HEAD", branch)
+	}
+
+	os.WriteFile(filepath.Join(dst, "untracked.txt"), []byte("x"), 0644)
+	if err := git.RemoveWorktree(t.Context(), repo, dst); err != nil {
+		t.Fatalf("RemoveWorktree() error = %v", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("worktree still exists: %v", err)
+	}
+	if list := runOutput(t, repo, "git", "worktree", "list"); strings.Contains(list, dst) {
+		t.Errorf("worktree still registered:\n%s", list)
+	}
+}
+
+func TestMoveWorktree(t *testing.T) {
+	repo := setupRepo(t)
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "ws")
+	if err := git.AddWorktree(t.Context(), repo, dst, "HEAD"); err != nil {
+		t.Fatal(err)
+	}
+
+	moved := filepath.Join(dir, "moved")
+	if err := git.MoveWorktree(t.Context(), repo, dst, moved); err != nil {
+		t.Fatalf("MoveWorktree() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(moved, "README.md")); err != nil {
+		t.Fatalf("moved worktree is missing README.md: %v", err)
+	}
+	if list := runOutput(t, repo, "git", "worktree", "list"); strings.Contains(list, dst+" ") || !strings.Contains(list, moved) {
+		t.Errorf("worktree list does not show the move:\n%s", list)
+	}
+}
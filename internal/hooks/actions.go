@@ -0,0 +1,180 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/chrisbanes/grove/internal/clone"
+	"github.com/chrisbanes/grove/internal/config"
+	"github.com/chrisbanes/grove/internal/ignore"
+)
+
+// RunActions applies the post_clone actions to the workspace at wsRoot, in
+// order. onAction, when set, is called before each action starts. The .git
+// and .grove directories are never touched. Once ctx is done, no further
+// files are changed and ctx's error is returned.
+//
+// Files are rewritten by replacing them rather than in place, so files that
+// share data with the golden copy (hardlinks from hardlink_paths) are never
+// modified through the workspace.
+func RunActions(ctx context.Context, goldenRoot, wsRoot string, actions []config.PostCloneAction, onAction func(config.PostCloneAction)) error {
+	for _, action := range actions {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if onAction != nil {
+			onAction(action)
+		}
+		if err := runAction(ctx, goldenRoot, wsRoot, action); err != nil {
+			return fmt.Errorf("post_clone %s: %w", action, err)
+		}
+	}
+	return nil
+}
+
+func runAction(ctx context.Context, goldenRoot, wsRoot string, action config.PostCloneAction) error {
+	if err := action.Validate(); err != nil {
+		return err
+	}
+	pattern, err := ignore.Parse(action.Pattern())
+	if err != nil {
+		return err
+	}
+
+	var apply func(path string, d fs.DirEntry) error
+	// Whether files inside a matching directory are selected too.
+	recursive := true
+	switch {
+	case action.Delete != "":
+		apply = func(path string, _ fs.DirEntry) error {
+			return os.RemoveAll(path)
+		}
+	case action.Truncate != "":
+		apply = func(path string, d fs.DirEntry) error {
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil || info.Size() == 0 {
+				return err
+			}
+			// An empty replacement, unlike truncating in place, needs
+			// no read and leaves hardlinked golden data alone.
+			return clone.ReplaceFile(path, nil, info.Mode().Perm())
+		}
+	case action.Replace != nil:
+		expand := strings.NewReplacer("{golden}", goldenRoot, "{workspace}", wsRoot)
+		old := []byte(expand.Replace(action.Replace.Old))
+		replacement := []byte(expand.Replace(action.Replace.New))
+		apply = func(path string, d fs.DirEntry) error {
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			return rewriteFile(path, func(data []byte) ([]byte, bool) {
+				if clone.IsBinary(data) || !bytes.Contains(data, old) {
+					return nil, false
+				}
+				return bytes.ReplaceAll(data, old, replacement), true
+			})
+		}
+	case action.Chmod != nil:
+		recursive = false
+		mode, err := action.Chmod.FileMode()
+		if err != nil {
+			return err
+		}
+		apply = func(path string, d fs.DirEntry) error {
+			if d.Type()&fs.ModeSymlink != 0 {
+				return nil
+			}
+			return chmod(path, mode)
+		}
+	}
+
+	// matchedDir is the most recent directory selected by the pattern; its
+	// descendants are selected too when the action is recursive.
+	matchedDir := ""
+	return filepath.WalkDir(wsRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(wsRoot, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() && (rel == ".git" || rel == config.GroveDirName) {
+			return fs.SkipDir
+		}
+
+		inMatchedDir := recursive && matchedDir != "" && strings.HasPrefix(rel, matchedDir+"/")
+		if !inMatchedDir && !pattern.Match(rel, d.IsDir()) {
+			return nil
+		}
+		if d.IsDir() && !inMatchedDir {
+			matchedDir = rel
+		}
+		if err := apply(path, d); err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		if action.Delete != "" && d.IsDir() {
+			return fs.SkipDir
+		}
+		return nil
+	})
+}
+
+// rewriteFile replaces the contents of path with the result of edit, keeping
+// its permissions. The new contents are written to a temporary file that is
+// renamed over path. edit returns false to leave the file unchanged.
+func rewriteFile(path string, edit func([]byte) ([]byte, bool)) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	data, ok := edit(data)
+	if !ok {
+		return nil
+	}
+	return clone.ReplaceFile(path, data, info.Mode().Perm())
+}
+
+// chmod sets mode on path. Regular files with other hardlinks are first
+// replaced by a private copy, so the change does not reach the golden copy.
+func chmod(path string, mode os.FileMode) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().IsRegular() && linkCount(info) > 1 {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return clone.ReplaceFile(path, data, mode)
+	}
+	return os.Chmod(path, mode)
+}
+
+func linkCount(info fs.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Nlink)
+	}
+	return 1
+}
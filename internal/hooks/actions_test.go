@@ -0,0 +1,203 @@
+package hooks_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chrisbanes/grove/internal/config"
+	"github.com/chrisbanes/grove/internal/hooks"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRunActions_Delete(t *testing.T) {
+	ws := t.TempDir()
+	writeFiles(t, ws, map[string]string{
+		"yarn.lock":             "lock",
+		"pkg/a/yarn.lock":       "lock",
+		"pkg/a/main.go":         "go",
+		"build/tmp/x.bin":       "bin",
+		".grove/workspace.json": "{}",
+		".git/yarn.lock":        "git",
+	})
+
+	actions := []config.PostCloneAction{{Delete: "*.lock"}, {Delete: "/build/tmp/"}}
+	if err := hooks.RunActions(t.Context(), "/golden", ws, actions, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range []string{"yarn.lock", "pkg/a/yarn.lock", "build/tmp"} {
+		if _, err := os.Lstat(filepath.Join(ws, rel)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be deleted, err = %v", rel, err)
+		}
+	}
+	for _, rel := range []string{"pkg/a/main.go", "build", ".grove/workspace.json", ".git/yarn.lock"} {
+		if _, err := os.Lstat(filepath.Join(ws, rel)); err != nil {
+			t.Errorf("expected %s to be kept: %v", rel, err)
+		}
+	}
+}
+
+func TestRunActions_Truncate(t *testing.T) {
+	ws := t.TempDir()
+	writeFiles(t, ws, map[string]string{
+		"cache/a.db":   "data",
+		"cache/b/c.db": "data",
+		"keep.db":      "data",
+	})
+
+	actions := []config.PostCloneAction{{Truncate: "/cache/"}}
+	if err := hooks.RunActions(t.Context(), "/golden", ws, actions, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range []string{"cache/a.db", "cache/b/c.db"} {
+		if got := readFile(t, filepath.Join(ws, rel)); got != "" {
+			t.Errorf("%s = %q, want empty", rel, got)
+		}
+	}
+	if got := readFile(t, filepath.Join(ws, "keep.db")); got != "data" {
+		t.Errorf("keep.db = %q, want unchanged", got)
+	}
+}
+
+func TestRunActions_TruncateDoesNotReachHardlinkedSource(t *testing.T) {
+	golden := t.TempDir()
+	ws := t.TempDir()
+	writeFiles(t, golden, map[string]string{"cache/a.db": "data"})
+	os.MkdirAll(filepath.Join(ws, "cache"), 0755)
+	if err := os.Link(filepath.Join(golden, "cache", "a.db"), filepath.Join(ws, "cache", "a.db")); err != nil {
+		t.Skipf("hardlinks unsupported: %v", err)
+	}
+
+	actions := []config.PostCloneAction{{Truncate: "/cache/"}}
+	if err := hooks.RunActions(t.Context(), golden, ws, actions, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(ws, "cache", "a.db")); got != "" {
+		t.Errorf("workspace a.db = %q, want empty", got)
+	}
+	if got := readFile(t, filepath.Join(golden, "cache", "a.db")); got != "data" {
+		t.Errorf("golden a.db = %q, want unchanged", got)
+	}
+}
+
+func TestRunActions_ReplaceExpandsPlaceholders(t *testing.T) {
+	ws := t.TempDir()
+	writeFiles(t, ws, map[string]string{
+		"local.properties": "sdk.dir=/golden/sdk\nroot=/golden\n",
+		"notes.txt":        "/golden",
+		"cache.bin":        "/golden\x00",
+	})
+	os.Chmod(filepath.Join(ws, "local.properties"), 0600)
+
+	actions := []config.PostCloneAction{{Replace: &config.ReplaceAction{Glob: "*.properties", Old: "{golden}", New: "{workspace}"}}}
+	if err := hooks.RunActions(t.Context(), "/golden", ws, actions, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := "sdk.dir=" + ws + "/sdk\nroot=" + ws + "\n"
+	if got := readFile(t, filepath.Join(ws, "local.properties")); got != want {
+		t.Errorf("local.properties = %q, want %q", got, want)
+	}
+	info, err := os.Stat(filepath.Join(ws, "local.properties"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+	if got := readFile(t, filepath.Join(ws, "notes.txt")); got != "/golden" {
+		t.Errorf("notes.txt should not match, got %q", got)
+	}
+
+	// Binary files are left alone even when they match.
+	actions[0].Replace.Glob = "cache.bin"
+	if err := hooks.RunActions(t.Context(), "/golden", ws, actions, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(ws, "cache.bin")); got != "/golden\x00" {
+		t.Errorf("cache.bin = %q, want unchanged", got)
+	}
+}
+
+func TestRunActions_ChmodDoesNotReachHardlinkedSource(t *testing.T) {
+	golden := t.TempDir()
+	ws := t.TempDir()
+	writeFiles(t, golden, map[string]string{"scripts/run.sh": "#!/bin/sh\n"})
+	os.MkdirAll(filepath.Join(ws, "scripts"), 0755)
+	if err := os.Link(filepath.Join(golden, "scripts", "run.sh"), filepath.Join(ws, "scripts", "run.sh")); err != nil {
+		t.Skipf("hardlinks unsupported: %v", err)
+	}
+
+	actions := []config.PostCloneAction{{Chmod: &config.ChmodAction{Glob: "scripts/*.sh", Mode: "0755"}}}
+	if err := hooks.RunActions(t.Context(), golden, ws, actions, nil); err != nil {
+		t.Fatal(err)
+	}
+	for root, want := range map[string]os.FileMode{ws: 0755, golden: 0644} {
+		info, err := os.Stat(filepath.Join(root, "scripts", "run.sh"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s mode = %v, want %v", root, info.Mode().Perm(), want)
+		}
+	}
+}
+
+func TestRunActions_ReportsAndStopsOnFailure(t *testing.T) {
+	ws := t.TempDir()
+	writeFiles(t, ws, map[string]string{"a.lock": "lock"})
+
+	var seen []string
+	actions := []config.PostCloneAction{
+		{Delete: "*.lock"},
+		{Delete: "a", Truncate: "b"},
+		{Delete: "never"},
+	}
+	err := hooks.RunActions(t.Context(), "/golden", ws, actions, func(a config.PostCloneAction) {
+		seen = append(seen, a.String())
+	})
+	if err == nil || !strings.Contains(err.Error(), "post_clone delete a") {
+		t.Fatalf("expected error naming the failed action, got %v", err)
+	}
+	if len(seen) != 2 || seen[0] != "delete *.lock" {
+		t.Errorf("reported actions = %q", seen)
+	}
+}
+
+func TestRunActions_StopsWhenCancelled(t *testing.T) {
+	ws := t.TempDir()
+	writeFiles(t, ws, map[string]string{"a.lock": "lock"})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	actions := []config.PostCloneAction{{Delete: "*.lock"}}
+	if err := hooks.RunActions(ctx, "/golden", ws, actions, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("RunActions() error = %v, want context.Canceled", err)
+	}
+	if got := readFile(t, filepath.Join(ws, "a.lock")); got != "lock" {
+		t.Errorf("a.lock = %q, want it kept", got)
+	}
+}
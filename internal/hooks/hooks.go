@@ -1,6 +1,7 @@
 package hooks
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -12,8 +13,9 @@ import (
 // Run executes the named hook from the .grove/hooks/ directory within
 // repoRoot. The hook runs with its working directory set to repoRoot.
 // If the hook doesn't exist, Run returns nil (hooks are optional).
-// If the hook exists but is not executable, Run returns an error.
-func Run(repoRoot, hookName string) error {
+// If the hook exists but is not executable, Run returns an error. The hook
+// is killed if ctx is done before it exits.
+func Run(ctx context.Context, repoRoot, hookName string) error {
 	hookPath := filepath.Join(repoRoot, ".grove", "hooks", hookName)
 
 	info, err := os.Stat(hookPath)
@@ -29,7 +31,7 @@ func Run(repoRoot, hookName string) error {
 		return fmt.Errorf("hook %s exists but is not executable: chmod +x %s", hookName, hookPath)
 	}
 
-	cmd := exec.Command(hookPath)
+	cmd := exec.CommandContext(ctx, hookPath)
 	cmd.Dir = repoRoot
 
 	if err := termio.RunInteractive(cmd); err != nil {
@@ -1,9 +1,11 @@
 package hooks_test
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/chrisbanes/grove/internal/hooks"
 )
@@ -17,7 +19,7 @@ func TestRun_HookExists(t *testing.T) {
 	hookPath := filepath.Join(hooksDir, "post-clone")
 	os.WriteFile(hookPath, []byte("#!/bin/bash\ntouch \"$PWD/hook-ran\"\n"), 0755)
 
-	err := hooks.Run(dir, "post-clone")
+	err := hooks.Run(t.Context(), dir, "post-clone")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -32,7 +34,7 @@ func TestRun_HookMissing(t *testing.T) {
 	os.MkdirAll(filepath.Join(dir, ".grove", "hooks"), 0755)
 
 	// Should succeed silently — hooks are optional
-	err := hooks.Run(dir, "post-clone")
+	err := hooks.Run(t.Context(), dir, "post-clone")
 	if err != nil {
 		t.Errorf("expected no error for missing hook, got: %v", err)
 	}
@@ -46,7 +48,7 @@ func TestRun_HookFails(t *testing.T) {
 	hookPath := filepath.Join(hooksDir, "post-clone")
 	os.WriteFile(hookPath, []byte("#!/bin/bash\nexit 1\n"), 0755)
 
-	err := hooks.Run(dir, "post-clone")
+	err := hooks.Run(t.Context(), dir, "post-clone")
 	if err == nil {
 		t.Error("expected error for failing hook")
 	}
@@ -60,8 +62,25 @@ func TestRun_HookNotExecutable(t *testing.T) {
 	hookPath := filepath.Join(hooksDir, "post-clone")
 	os.WriteFile(hookPath, []byte("#!/bin/bash\necho ok\n"), 0644) // not executable
 
-	err := hooks.Run(dir, "post-clone")
+	err := hooks.Run(t.Context(), dir, "post-clone")
 	if err == nil {
 		t.Error("expected error for non-executable hook")
 	}
 }
+
+func TestRun_HookKilledWhenCancelled(t *testing.T) {
+	dir := t.TempDir()
+	hooksDir := filepath.Join(dir, ".grove", "hooks")
+	os.MkdirAll(hooksDir, 0755)
+	os.WriteFile(filepath.Join(hooksDir, "post-clone"), []byte("#!/bin/sh\nexec sleep 30\n"), 0755)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := hooks.Run(ctx, dir, "post-clone"); err == nil {
+		t.Fatal("expected error for cancelled hook")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("hook ran for %s after cancellation", elapsed)
+	}
+}
@@ -0,0 +1,394 @@
+// Package ignore implements gitignore-style path patterns, shared by the
+// clone planner, config validation and the image backend's sync.
+package ignore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// FileName is the name of the per-directory ignore file. Patterns in a
+// nested file apply relative to the directory containing it.
+const FileName = ".groveignore"
+
+// Pattern is a single parsed gitignore-style pattern.
+//
+// Supported syntax matches .gitignore:
+//   - a pattern without a slash matches a name at any depth
+//   - a leading or middle slash anchors the pattern to the root
+//   - a trailing slash matches directories only
+//   - "**" matches any number of directories
+//   - a leading "!" re-includes paths excluded by an earlier pattern
+type Pattern struct {
+	// Raw is the pattern as written.
+	Raw string
+	// Source is the ignore file the pattern was read from, relative to the
+	// root. It is empty for patterns that did not come from a file.
+	Source string
+	// Line is the 1-based line number within Source.
+	Line int
+
+	negate  bool
+	dirOnly bool
+	// segments are matched against the path components relative to the
+	// root. Unanchored patterns start with "**".
+	segments []string
+}
+
+// Parse parses a single pattern. Blank patterns and "#" comments yield a nil
+// pattern and no error.
+func Parse(raw string) (*Pattern, error) {
+	return parse(raw, "")
+}
+
+// parse parses raw as if it appeared in an ignore file in the directory base
+// (slash-separated, relative to the root).
+func parse(raw, base string) (*Pattern, error) {
+	text := trimTrailingSpaces(raw)
+	if text == "" || strings.HasPrefix(text, "#") {
+		return nil, nil
+	}
+
+	p := &Pattern{Raw: raw}
+	if strings.HasPrefix(text, "!") {
+		p.negate = true
+		text = text[1:]
+	}
+	if strings.HasSuffix(text, "/") {
+		p.dirOnly = true
+		text = strings.TrimRight(text, "/")
+	}
+	anchored := false
+	if strings.HasPrefix(text, "/") {
+		anchored = true
+		text = strings.TrimLeft(text, "/")
+	}
+	if strings.Contains(text, "/") {
+		anchored = true
+	}
+	if text == "" {
+		return nil, fmt.Errorf("invalid pattern %q: empty path", raw)
+	}
+
+	segments := strings.Split(text, "/")
+	for _, seg := range segments {
+		if seg == "" {
+			return nil, fmt.Errorf("invalid pattern %q: empty path segment", raw)
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", raw, err)
+		}
+	}
+	if !anchored {
+		segments = append([]string{"**"}, segments...)
+	}
+	if base != "" && base != "." {
+		for _, dir := range strings.Split(base, "/") {
+			p.segments = append(p.segments, escapeMeta(dir))
+		}
+	}
+	p.segments = append(p.segments, segments...)
+	return p, nil
+}
+
+// escapeMeta escapes glob metacharacters so name matches literally.
+func escapeMeta(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch r {
+		case '*', '?', '[', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// String returns the pattern rewritten relative to the root, so that a
+// pattern read from a nested ignore file keeps its meaning when combined
+// with root-level patterns.
+func (p *Pattern) String() string {
+	var s string
+	switch {
+	case len(p.segments) == 2 && p.segments[0] == "**":
+		s = p.segments[1]
+	case p.segments[0] == "**":
+		s = strings.Join(p.segments, "/")
+	default:
+		s = "/" + strings.Join(p.segments, "/")
+	}
+	if p.dirOnly {
+		s += "/"
+	}
+	if p.negate {
+		s = "!" + s
+	}
+	return s
+}
+
+// Negated reports whether the pattern re-includes paths ("!pattern").
+func (p *Pattern) Negated() bool {
+	return p.negate
+}
+
+// Match reports whether relPath, a slash-separated path relative to the
+// root, matches the pattern. Negation is not applied; see Matcher.
+func (p *Pattern) Match(relPath string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	relPath = strings.Trim(relPath, "/")
+	if relPath == "" || relPath == "." {
+		return false
+	}
+	return matchSegments(p.segments, strings.Split(relPath, "/"))
+}
+
+func matchSegments(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			rest := pat[1:]
+			if len(rest) == 0 {
+				// A trailing "**" matches everything inside, but not the
+				// directory itself.
+				return len(name) > 0
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], name[0]); !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// trimTrailingSpaces drops trailing spaces unless they are escaped with a
+// backslash, as git does.
+func trimTrailingSpaces(s string) string {
+	for strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\\ ") {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// Matcher evaluates an ordered list of patterns. As in .gitignore, the last
+// matching pattern decides whether a path is excluded. The patterns a
+// Matcher is created with always come last, so patterns added later from
+// ignore files cannot override them.
+//
+// Matcher does not consider whether a parent directory is excluded. Callers
+// walking a tree are expected to skip excluded directories, which matches
+// git's rule that a file cannot be re-included if its parent is excluded.
+type Matcher struct {
+	patterns []*Pattern
+	// fixed is how many patterns at the end of patterns were given to New.
+	fixed int
+}
+
+// New compiles patterns into a Matcher.
+func New(patterns []string) (*Matcher, error) {
+	m := &Matcher{}
+	for _, raw := range patterns {
+		p, err := Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			m.patterns = append(m.patterns, p)
+		}
+	}
+	m.fixed = len(m.patterns)
+	return m, nil
+}
+
+// Add adds patterns, which take precedence over those already added but not
+// over the patterns the matcher was created with.
+func (m *Matcher) Add(patterns ...*Pattern) {
+	m.patterns = slices.Insert(m.patterns, len(m.patterns)-m.fixed, patterns...)
+}
+
+// Patterns returns the matcher's patterns rewritten relative to the root, in
+// precedence order.
+func (m *Matcher) Patterns() []string {
+	if m == nil {
+		return nil
+	}
+	out := make([]string, len(m.patterns))
+	for i, p := range m.patterns {
+		out[i] = p.String()
+	}
+	return out
+}
+
+// Empty reports whether the matcher has no patterns.
+func (m *Matcher) Empty() bool {
+	return m == nil || len(m.patterns) == 0
+}
+
+// Excluded reports whether relPath is excluded.
+func (m *Matcher) Excluded(relPath string, isDir bool) bool {
+	p := m.Match(relPath, isDir)
+	return p != nil && !p.negate
+}
+
+// Match returns the pattern that decides relPath, or nil if no pattern
+// matches. The returned pattern may be a negation.
+func (m *Matcher) Match(relPath string, isDir bool) *Pattern {
+	if m == nil {
+		return nil
+	}
+	for i := len(m.patterns) - 1; i >= 0; i-- {
+		if m.patterns[i].Match(relPath, isDir) {
+			return m.patterns[i]
+		}
+	}
+	return nil
+}
+
+// ReadFile reads the ignore file in dir, a slash-separated directory
+// relative to root ("." for the root itself). The returned patterns match
+// paths relative to root. A missing file yields no patterns. Ignore files
+// inside .git and .grove are never consulted.
+func ReadFile(root, dir string) ([]*Pattern, error) {
+	dir = path.Clean(dir)
+	if skipDir(dir) {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(dir), FileName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	source := path.Join(dir, FileName)
+	var patterns []*Pattern
+	for i, text := range strings.Split(string(data), "\n") {
+		p, err := parse(strings.TrimSuffix(text, "\r"), dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", source, i+1, err)
+		}
+		if p == nil {
+			continue
+		}
+		p.Source = source
+		p.Line = i + 1
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// Load compiles patterns and merges in every ignore file under root. Files
+// in excluded directories are not read. Deeper files take precedence over
+// shallower ones, and patterns over all files. A missing root yields a matcher
+// with patterns alone.
+func Load(root string, patterns []string) (*Matcher, error) {
+	m, err := New(patterns)
+	if err != nil {
+		return nil, err
+	}
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && (skipDir(rel) || m.Excluded(rel, true)) {
+			return fs.SkipDir
+		}
+		found, err := ReadFile(root, rel)
+		if err != nil {
+			return err
+		}
+		m.Add(found...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// skipDir reports whether dir is inside .git or .grove, where ignore files
+// are not consulted.
+func skipDir(dir string) bool {
+	first, _, _ := strings.Cut(dir, "/")
+	return first == ".git" || first == ".grove"
+}
+
+// RsyncArgs translates patterns into rsync --exclude/--include arguments
+// with the same meaning. rsync applies the first matching rule, so rules are
+// emitted in reverse order to preserve gitignore's last-match-wins.
+func RsyncArgs(patterns []string) ([]string, error) {
+	var args []string
+	for i := len(patterns) - 1; i >= 0; i-- {
+		p, err := Parse(patterns[i])
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			continue
+		}
+		flag := "--exclude"
+		if p.negate {
+			flag = "--include"
+		}
+		for _, rule := range p.rsyncRules() {
+			args = append(args, flag, rule)
+		}
+	}
+	return args, nil
+}
+
+// rsyncRules returns the rsync pattern(s) equivalent to p, ignoring negation.
+func (p *Pattern) rsyncRules() []string {
+	segments := p.segments
+	anchored := true
+	// rsync matches unanchored patterns against the end of the path at a
+	// component boundary, which is what a leading "**/" means in gitignore.
+	for len(segments) > 1 && segments[0] == "**" {
+		segments = segments[1:]
+		anchored = false
+	}
+	body := strings.Join(segments, "/")
+
+	rules := []string{body}
+	// gitignore's "a/**/b" also matches "a/b"; spell that out for rsync.
+	if strings.Contains(body, "/**/") {
+		rules = append(rules, strings.ReplaceAll(body, "/**/", "/"))
+	}
+	for i := range rules {
+		if anchored {
+			rules[i] = "/" + rules[i]
+		}
+		if p.dirOnly {
+			rules[i] += "/"
+		}
+	}
+	return rules
+}
@@ -0,0 +1,271 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPatternMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		relPath string
+		isDir   bool
+		want    bool
+	}{
+		// Basename matching (no / in pattern)
+		{"basename wildcard matches file", "*.lock", "yarn.lock", false, true},
+		{"basename wildcard matches nested file", "*.lock", "packages/foo/yarn.lock", false, true},
+		{"basename wildcard no match", "*.lock", "yarn.txt", false, false},
+		{"basename exact matches dir", "__pycache__", "__pycache__", true, true},
+		{"basename exact matches nested dir", "__pycache__", "src/lib/__pycache__", true, true},
+		{"basename exact no match", "__pycache__", "pycache", true, false},
+
+		// Path matching (/ in pattern)
+		{"path pattern matches exact", ".gradle/configuration-cache", ".gradle/configuration-cache", true, true},
+		{"path pattern no match at wrong depth", ".gradle/configuration-cache", "sub/.gradle/configuration-cache", true, false},
+		{"path pattern no match partial", ".gradle/configuration-cache", ".gradle/caches", true, false},
+		{"leading slash anchors", "/build", "build", true, true},
+		{"leading slash no match nested", "/build", "app/build", true, false},
+
+		// Directory-only patterns
+		{"dir-only matches dir", "build/", "app/build", true, true},
+		{"dir-only skips file", "build/", "app/build", false, false},
+		{"anchored dir-only", "/out/", "out", true, true},
+
+		// Double-star
+		{"leading ** matches at root", "**/logs", "logs", true, true},
+		{"leading ** matches nested", "**/logs", "a/b/logs", true, true},
+		{"middle ** matches zero dirs", "a/**/b", "a/b", true, true},
+		{"middle ** matches many dirs", "a/**/b", "a/x/y/b", true, true},
+		{"middle ** stays anchored", "a/**/b", "z/a/b", true, false},
+		{"trailing ** matches contents", "cache/**", "cache/x/y", false, true},
+		{"trailing ** skips dir itself", "cache/**", "cache", true, false},
+
+		// Escapes
+		{"escaped hash is literal", `\#notes`, "#notes", false, true},
+		{"escaped bang is literal", `\!important`, "!important", false, true},
+
+		// Edge cases
+		{"empty relPath", "*.lock", "", false, false},
+		{"root file basename match", "*.lock", "package.lock", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(tt.pattern)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.pattern, err)
+			}
+			if got := p.Match(tt.relPath, tt.isDir); got != tt.want {
+				t.Errorf("Parse(%q).Match(%q, %v) = %v, want %v", tt.pattern, tt.relPath, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_BlankAndComments(t *testing.T) {
+	for _, raw := range []string{"", "   ", "# comment"} {
+		p, err := Parse(raw)
+		if err != nil || p != nil {
+			t.Errorf("Parse(%q) = %v, %v; want nil, nil", raw, p, err)
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, raw := range []string{"[invalid", "/", "a//b", "!"} {
+		if _, err := Parse(raw); err == nil {
+			t.Errorf("Parse(%q) expected error", raw)
+		}
+	}
+}
+
+func TestMatcher_LastMatchWins(t *testing.T) {
+	m, err := New([]string{"*.log", "!keep.log", "logs/", "!logs/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		relPath string
+		isDir   bool
+		want    bool
+	}{
+		{"debug.log", false, true},
+		{"keep.log", false, false},
+		{"nested/keep.log", false, false},
+		{"logs", true, false},
+		{"main.go", false, false},
+	}
+	for _, tt := range tests {
+		if got := m.Excluded(tt.relPath, tt.isDir); got != tt.want {
+			t.Errorf("Excluded(%q) = %v, want %v", tt.relPath, got, tt.want)
+		}
+	}
+}
+
+func TestMatcher_NilAndEmpty(t *testing.T) {
+	var m *Matcher
+	if !m.Empty() || m.Excluded("anything", false) {
+		t.Error("nil matcher should be empty and exclude nothing")
+	}
+	m, err := New([]string{"# only a comment"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Empty() {
+		t.Error("matcher with only comments should be empty")
+	}
+}
+
+func TestRsyncArgs(t *testing.T) {
+	got, err := RsyncArgs([]string{
+		"node_modules",
+		"/build/",
+		".gradle/configuration-cache",
+		"**/logs",
+		"a/**/b",
+		"*.log",
+		"!keep.log",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"--include", "keep.log",
+		"--exclude", "*.log",
+		"--exclude", "/a/**/b", "--exclude", "/a/b",
+		"--exclude", "logs",
+		"--exclude", "/.gradle/configuration-cache",
+		"--exclude", "/build/",
+		"--exclude", "node_modules",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RsyncArgs() =\n  %q\nwant\n  %q", got, want)
+	}
+}
+
+func TestRsyncArgs_Invalid(t *testing.T) {
+	if _, err := RsyncArgs([]string{"[invalid"}); err == nil {
+		t.Fatal("expected error for invalid pattern")
+	}
+}
+
+func TestReadFile_RebasesNestedPatterns(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "web"), 0755)
+	os.WriteFile(filepath.Join(root, "web", FileName), []byte("# caches\n*.tmp\n/dist/\n!keep.tmp\n"), 0644)
+
+	patterns, err := ReadFile(root, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patterns) != 3 {
+		t.Fatalf("expected 3 patterns, got %d", len(patterns))
+	}
+	if p := patterns[1]; p.Source != "web/.groveignore" || p.Line != 3 || p.Raw != "/dist/" {
+		t.Errorf("unexpected origin: source=%q line=%d raw=%q", p.Source, p.Line, p.Raw)
+	}
+
+	m := &Matcher{}
+	m.Add(patterns...)
+	tests := []struct {
+		relPath string
+		isDir   bool
+		want    bool
+	}{
+		{"web/a.tmp", false, true},
+		{"web/src/a.tmp", false, true},
+		{"a.tmp", false, false},
+		{"other/a.tmp", false, false},
+		{"web/dist", true, true},
+		{"web/src/dist", true, false},
+		{"web/keep.tmp", false, false},
+	}
+	for _, tt := range tests {
+		if got := m.Excluded(tt.relPath, tt.isDir); got != tt.want {
+			t.Errorf("Excluded(%q) = %v, want %v", tt.relPath, got, tt.want)
+		}
+	}
+
+	want := []string{"/web/**/*.tmp", "/web/dist/", "!/web/**/keep.tmp"}
+	if got := m.Patterns(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Patterns() = %q, want %q", got, want)
+	}
+}
+
+func TestReadFile_MissingFile(t *testing.T) {
+	patterns, err := ReadFile(t.TempDir(), ".")
+	if err != nil || patterns != nil {
+		t.Fatalf("ReadFile() = %v, %v; want nil, nil", patterns, err)
+	}
+}
+
+func TestReadFile_ReportsLine(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, FileName), []byte("ok\n[bad\n"), 0644)
+
+	_, err := ReadFile(root, ".")
+	if err == nil || !strings.Contains(err.Error(), ".groveignore:2") {
+		t.Fatalf("expected error naming .groveignore:2, got %v", err)
+	}
+}
+
+func TestReadFile_EscapesDirectoryName(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "[v1]"), 0755)
+	os.WriteFile(filepath.Join(root, "[v1]", FileName), []byte("out\n"), 0644)
+
+	patterns, err := ReadFile(root, "[v1]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !patterns[0].Match("[v1]/out", true) {
+		t.Error("expected pattern to match inside [v1]")
+	}
+	if patterns[0].Match("v/out", true) {
+		t.Error("directory name should match literally")
+	}
+}
+
+func TestLoad_MergesFilesInPrecedenceOrder(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "app", "cache"), 0755)
+	os.MkdirAll(filepath.Join(root, "vendor"), 0755)
+	os.MkdirAll(filepath.Join(root, ".git"), 0755)
+	os.WriteFile(filepath.Join(root, FileName), []byte("*.log\nvendor/\n"), 0644)
+	os.WriteFile(filepath.Join(root, "app", FileName), []byte("!debug.log\n"), 0644)
+	// Files in excluded directories and .git are never read.
+	os.WriteFile(filepath.Join(root, "vendor", FileName), []byte("[bad\n"), 0644)
+	os.WriteFile(filepath.Join(root, ".git", FileName), []byte("[bad\n"), 0644)
+
+	m, err := Load(root, []string{"*.tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"*.log", "vendor/", "!/app/**/debug.log", "*.tmp"}
+	if got := m.Patterns(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Patterns() = %q, want %q", got, want)
+	}
+	if m.Excluded("app/debug.log", false) {
+		t.Error("nested negation should re-include app/debug.log")
+	}
+	if !m.Excluded("debug.log", false) {
+		t.Error("root debug.log should stay excluded")
+	}
+	if p := m.Match("x.log", false); p == nil || p.Source != ".groveignore" || p.Line != 1 {
+		t.Errorf("Match(x.log) = %+v, want .groveignore:1", p)
+	}
+}
+
+func TestLoad_MissingRoot(t *testing.T) {
+	m, err := Load(filepath.Join(t.TempDir(), "missing"), []string{"*.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Patterns(); !reflect.DeepEqual(got, []string{"*.log"}) {
+		t.Errorf("Patterns() = %q", got)
+	}
+}
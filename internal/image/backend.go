@@ -1,14 +1,32 @@
 package image
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"github.com/chrisbanes/grove/internal/clone"
 )
 
 const defaultBaseSizeGB = 200
 
-func InitBase(runtimeRoot, goldenRoot string, runner Runner, baseSizeGB int, excludes []string, onProgress func(int, string)) (_ *State, err error) {
+// seedBase clones the current base image into a new generation. Base images
+// are far too large to copy, so this only works where copy-on-write clones
+// are supported, as on APFS.
+var seedBase = func(ctx context.Context, prev, next string) error {
+	cloner, err := clone.NewCloner(filepath.Dir(prev))
+	if err != nil {
+		return err
+	}
+	return cloner.Clone(ctx, prev, next)
+}
+
+// InitBase creates the first base image generation, baseSizeGB in size,
+// and syncs the golden copy into it. The image is grown if the golden copy
+// would leave less than headroomGB free in it. A nil syncer syncs with a
+// NativeSyncer.
+func InitBase(ctx context.Context, runtimeRoot, goldenRoot string, runner Runner, syncer Syncer, baseSizeGB, headroomGB int, excludes []string, onProgress func(Progress)) (_ *State, err error) {
 	if baseSizeGB <= 0 {
 		baseSizeGB = defaultBaseSizeGB
 	}
@@ -16,9 +34,6 @@ func InitBase(runtimeRoot, goldenRoot string, runner Runner, baseSizeGB int, exc
 	if err := os.MkdirAll(imagesDir(runtimeRoot), 0755); err != nil {
 		return nil, err
 	}
-	if err := os.MkdirAll(baseMountpoint(runtimeRoot), 0755); err != nil {
-		return nil, err
-	}
 	if err := os.WriteFile(initMarkerPath(runtimeRoot), []byte("initializing\n"), 0644); err != nil {
 		return nil, err
 	}
@@ -29,39 +44,27 @@ func InitBase(runtimeRoot, goldenRoot string, runner Runner, baseSizeGB int, exc
 		}
 	}()
 
-	basePath := baseImagePath(runtimeRoot)
 	// Remove any stale sparsebundle left from a previously interrupted init.
 	// InitBase is only called when no state.json exists (callers gate on os.ErrNotExist),
 	// so any pre-existing sparsebundle is incomplete and safe to discard.
-	if err := os.RemoveAll(basePath); err != nil {
-		return nil, err
-	}
-	if onProgress != nil {
-		onProgress(0, "creating base image")
-	}
-	if err := CreateSparseBundle(runner, basePath, "grove-base", baseSizeGB); err != nil {
-		return nil, err
-	}
-
-	vol, err := Attach(runner, basePath, baseMountpoint(runtimeRoot))
-	if err != nil {
+	if err := removeBaseImages(runtimeRoot); err != nil {
 		return nil, err
 	}
+	basePath := baseImagePath(runtimeRoot, 1)
+	// A base that was not fully synced must not outlive a failed or
+	// interrupted init.
 	defer func() {
-		detachErr := Detach(runner, vol.Device)
-		if err == nil && detachErr != nil {
-			err = detachErr
+		if err != nil {
+			_ = os.RemoveAll(basePath)
 		}
 	}()
-
 	if onProgress != nil {
-		onProgress(5, "syncing golden copy")
-		err = SyncBaseWithProgress(runner, goldenRoot, vol.MountPoint, excludes, func(pct int) {
-			onProgress(mapPercent(pct, 100, 5, 95), "syncing golden copy")
-		})
-	} else {
-		err = SyncBase(runner, goldenRoot, vol.MountPoint, excludes)
+		onProgress(Progress{Percent: 0, Phase: "creating base image"})
 	}
+	if err := CreateSparseBundle(ctx, runner, basePath, "grove-base", baseSizeGB); err != nil {
+		return nil, err
+	}
+	grownGB, err := syncImage(ctx, runtimeRoot, goldenRoot, runner, syncer, basePath, headroomGB, excludes, onProgress)
 	if err != nil {
 		return nil, err
 	}
@@ -70,70 +73,166 @@ func InitBase(runtimeRoot, goldenRoot string, runner Runner, baseSizeGB int, exc
 		Backend:        "image",
 		BasePath:       basePath,
 		BaseGeneration: 1,
+		SizeGB:         baseSizeGB,
+	}
+	if grownGB > 0 {
+		st.SizeGB = grownGB
 	}
 	if err := SaveState(runtimeRoot, st); err != nil {
 		return nil, err
 	}
 	if onProgress != nil {
-		onProgress(100, "done")
+		onProgress(Progress{Percent: 100, Phase: "done"})
 	}
 	return st, nil
 }
 
-func RefreshBase(runtimeRoot, goldenRoot string, runner Runner, commit string, excludes []string, onProgress func(int, string)) (_ *State, err error) {
-	metas, err := ListWorkspaceMeta(runtimeRoot)
+// RefreshBase syncs the golden copy into a new base generation, a
+// copy-on-write clone of the current base image, so only what changed is
+// transferred. Workspaces stay on top of the generation they were created
+// from; generations nothing uses any more are removed. As in InitBase, the
+// new generation is grown if needed to leave headroomGB free.
+func RefreshBase(ctx context.Context, runtimeRoot, goldenRoot string, runner Runner, syncer Syncer, commit string, headroomGB int, excludes []string, onProgress func(Progress)) (*State, error) {
+	st, err := LoadState(runtimeRoot)
 	if err != nil {
 		return nil, err
 	}
-	if len(metas) > 0 {
-		return nil, fmt.Errorf("cannot refresh base with active image workspaces (%d)", len(metas))
+	prev := st.BasePath
+	if prev == "" {
+		prev = legacyBaseImagePath(runtimeRoot)
+	}
+	generation := st.BaseGeneration + 1
+	next := baseImagePath(runtimeRoot, generation)
+	// Left over from an interrupted refresh.
+	if err := os.RemoveAll(next); err != nil {
+		return nil, err
 	}
 
-	st, err := LoadState(runtimeRoot)
+	if onProgress != nil {
+		onProgress(Progress{Percent: 0, Phase: "cloning base image"})
+	}
+	if err := seedBase(ctx, prev, next); err != nil {
+		_ = os.RemoveAll(next)
+		return nil, fmt.Errorf("cloning base image: %w", err)
+	}
+	grownGB, err := syncImage(ctx, runtimeRoot, goldenRoot, runner, syncer, next, headroomGB, excludes, onProgress)
 	if err != nil {
+		_ = os.RemoveAll(next)
 		return nil, err
 	}
-	if st.BasePath == "" {
-		st.BasePath = baseImagePath(runtimeRoot)
+
+	refreshed := &State{
+		Backend:        "image",
+		BasePath:       next,
+		BaseGeneration: generation,
+		LastSyncCommit: commit,
+		SizeGB:         st.SizeGB,
 	}
-	if err := os.MkdirAll(baseMountpoint(runtimeRoot), 0755); err != nil {
+	if grownGB > 0 {
+		refreshed.SizeGB = grownGB
+	}
+	if err := SaveState(runtimeRoot, refreshed); err != nil {
+		_ = os.RemoveAll(next)
 		return nil, err
 	}
+	if err := GCGenerations(runtimeRoot, refreshed); err != nil {
+		return nil, fmt.Errorf("removing old base images: %w", err)
+	}
+	if onProgress != nil {
+		onProgress(Progress{Percent: 100, Phase: "done"})
+	}
+	return refreshed, nil
+}
 
-	vol, err := Attach(runner, st.BasePath, baseMountpoint(runtimeRoot))
+// GCGenerations removes base images other than the current one that no
+// workspace is attached on top of.
+func GCGenerations(runtimeRoot string, st *State) error {
+	metas, err := ListWorkspaceMeta(runtimeRoot)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	current := st.BasePath
+	if current == "" {
+		current = legacyBaseImagePath(runtimeRoot)
+	}
+	referenced := map[string]bool{current: true}
+	for _, meta := range metas {
+		referenced[workspaceBasePath(runtimeRoot, &meta)] = true
+	}
+
+	paths, err := findBaseImages(runtimeRoot)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if referenced[path] {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncImage attaches the image at imagePath and mirrors the golden copy,
+// minus excludes, into it with syncer. If the golden copy would leave less than
+// headroomGB free in the image, the image is grown first, and the size it
+// was grown to is returned. Otherwise the returned size is zero.
+func syncImage(ctx context.Context, runtimeRoot, goldenRoot string, runner Runner, syncer Syncer, imagePath string, headroomGB int, excludes []string, onProgress func(Progress)) (grownGB int, err error) {
+	if err := os.MkdirAll(baseMountpoint(runtimeRoot), 0755); err != nil {
+		return 0, err
+	}
+	vol, err := Attach(ctx, runner, imagePath, baseMountpoint(runtimeRoot))
+	if err != nil {
+		return 0, err
 	}
 	defer func() {
-		detachErr := Detach(runner, vol.Device)
+		// Detach even when ctx is done, so an interrupted sync does not
+		// leave the image attached.
+		if vol == nil {
+			return
+		}
+		detachErr := Detach(context.WithoutCancel(ctx), runner, vol.Device)
 		if err == nil && detachErr != nil {
 			err = detachErr
 		}
 	}()
 
-	if onProgress != nil {
-		onProgress(5, "syncing golden copy")
-		err = SyncBaseWithProgress(runner, goldenRoot, vol.MountPoint, excludes, func(pct int) {
-			onProgress(mapPercent(pct, 100, 5, 95), "syncing golden copy")
-		})
-	} else {
-		err = SyncBase(runner, goldenRoot, vol.MountPoint, excludes)
-	}
+	grownGB, need, err := growPlan(vol.MountPoint, imagePath, goldenRoot, excludes, headroomGB)
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+	if grownGB > 0 {
+		if onProgress != nil {
+			onProgress(Progress{Percent: 5, Phase: "growing base image"})
+		}
+		// hdiutil only resizes detached images.
+		device := vol.Device
+		vol = nil
+		if err := Detach(ctx, runner, device); err != nil {
+			return 0, err
+		}
+		if err := GrowBase(ctx, runner, imagePath, grownGB); err != nil {
+			return 0, &BaseFullError{Need: need, SizeGB: grownGB, Err: err}
+		}
+		if vol, err = Attach(ctx, runner, imagePath, baseMountpoint(runtimeRoot)); err != nil {
+			return 0, err
+		}
 	}
 
-	st.Backend = "image"
-	st.BaseGeneration++
-	st.LastSyncCommit = commit
-
-	if err := SaveState(runtimeRoot, st); err != nil {
-		return nil, err
+	if syncer == nil {
+		syncer = NativeSyncer{}
 	}
 	if onProgress != nil {
-		onProgress(100, "done")
+		onProgress(Progress{Percent: 5, Phase: "syncing golden copy"})
+		return grownGB, syncer.Sync(ctx, goldenRoot, vol.MountPoint, excludes, func(p Progress) {
+			p.Percent = mapPercent(p.Percent, 100, 5, 95)
+			p.Phase = "syncing golden copy"
+			onProgress(p)
+		})
 	}
-	return st, nil
+	return grownGB, syncer.Sync(ctx, goldenRoot, vol.MountPoint, excludes, nil)
 }
 
 func baseMountpoint(runtimeRoot string) string {
@@ -1,6 +1,7 @@
 package image
 
 import (
+	"context"
 	"errors"
 	"os"
 	"path/filepath"
@@ -27,7 +28,7 @@ func TestInitBase_CreatesStateAndRunsCommands(t *testing.T) {
 		},
 	}
 
-	st, err := InitBase(repoRoot, repoRoot, r, 20, nil, nil)
+	st, err := InitBase(t.Context(), repoRoot, repoRoot, r, RsyncSyncer{Runner: r}, 20, 0, nil, nil)
 	if err != nil {
 		t.Fatalf("InitBase() error = %v", err)
 	}
@@ -37,7 +38,7 @@ func TestInitBase_CreatesStateAndRunsCommands(t *testing.T) {
 	if st.BaseGeneration != 1 {
 		t.Fatalf("expected base generation 1, got %d", st.BaseGeneration)
 	}
-	if st.BasePath != filepath.Join(repoRoot, "images", "base.sparsebundle") {
+	if st.BasePath != filepath.Join(repoRoot, "images", "base-1.sparsebundle") {
 		t.Fatalf("unexpected base path %q", st.BasePath)
 	}
 
@@ -68,7 +69,7 @@ func TestInitBase_RemovesInitMarkerOnFailure(t *testing.T) {
 		errs:    []error{errors.New("exit 1")},
 	}
 
-	if _, err := InitBase(repoRoot, repoRoot, r, 20, nil, nil); err == nil {
+	if _, err := InitBase(t.Context(), repoRoot, repoRoot, r, RsyncSyncer{Runner: r}, 20, 0, nil, nil); err == nil {
 		t.Fatal("expected InitBase() to fail")
 	}
 	if _, err := os.Stat(initMarkerPath(repoRoot)); !os.IsNotExist(err) {
@@ -101,12 +102,16 @@ func TestInitBase_CallsOnProgress(t *testing.T) {
 
 	var phases []string
 	var percents []int
-	onProgress := func(pct int, phase string) {
-		phases = append(phases, phase)
-		percents = append(percents, pct)
+	var syncBytes int64
+	onProgress := func(p Progress) {
+		phases = append(phases, p.Phase)
+		percents = append(percents, p.Percent)
+		if p.Bytes > 0 {
+			syncBytes = p.Bytes
+		}
 	}
 
-	st, err := InitBase(repoRoot, repoRoot, r, 20, nil, onProgress)
+	st, err := InitBase(t.Context(), repoRoot, repoRoot, r, RsyncSyncer{Runner: r}, 20, 0, nil, onProgress)
 	if err != nil {
 		t.Fatalf("InitBase() error = %v", err)
 	}
@@ -127,6 +132,9 @@ func TestInitBase_CallsOnProgress(t *testing.T) {
 	if percents[len(percents)-1] != 100 {
 		t.Fatalf("expected final percent 100, got %d", percents[len(percents)-1])
 	}
+	if syncBytes != 7643136000 {
+		t.Fatalf("expected rsync byte counts to be forwarded, got %d", syncBytes)
+	}
 
 	// Verify SyncBaseWithProgress was used (Stream called) instead of SyncBase (CombinedOutput)
 	if len(r.streamCalls) != 1 {
@@ -166,7 +174,7 @@ func TestInitBase_RemovesStaleSparsebundle(t *testing.T) {
 		},
 	}
 
-	st, err := InitBase(repoRoot, repoRoot, r, 20, nil, nil)
+	st, err := InitBase(t.Context(), repoRoot, repoRoot, r, RsyncSyncer{Runner: r}, 20, 0, nil, nil)
 	if err != nil {
 		t.Fatalf("InitBase() error = %v", err)
 	}
@@ -182,6 +190,7 @@ func TestInitBase_RemovesStaleSparsebundle(t *testing.T) {
 
 func TestRefreshBase_CallsOnProgress(t *testing.T) {
 	repoRoot := t.TempDir()
+	stubSeedBase(t)
 	basePath := filepath.Join(repoRoot, "images", "base.sparsebundle")
 	if err := SaveState(repoRoot, &State{
 		Backend:        "image",
@@ -212,12 +221,16 @@ func TestRefreshBase_CallsOnProgress(t *testing.T) {
 
 	var phases []string
 	var percents []int
-	onProgress := func(pct int, phase string) {
-		phases = append(phases, phase)
-		percents = append(percents, pct)
+	var syncBytes int64
+	onProgress := func(p Progress) {
+		phases = append(phases, p.Phase)
+		percents = append(percents, p.Percent)
+		if p.Bytes > 0 {
+			syncBytes = p.Bytes
+		}
 	}
 
-	_, err := RefreshBase(repoRoot, repoRoot, r, "abc1234", nil, onProgress)
+	_, err := RefreshBase(t.Context(), repoRoot, repoRoot, r, RsyncSyncer{Runner: r}, "abc1234", 0, nil, onProgress)
 	if err != nil {
 		t.Fatalf("RefreshBase() error = %v", err)
 	}
@@ -225,8 +238,8 @@ func TestRefreshBase_CallsOnProgress(t *testing.T) {
 	if len(phases) < 2 {
 		t.Fatalf("expected at least 2 progress callbacks, got %d: phases=%v percents=%v", len(phases), phases, percents)
 	}
-	if phases[0] != "syncing golden copy" {
-		t.Fatalf("expected first phase 'syncing golden copy', got %q", phases[0])
+	if phases[0] != "cloning base image" || phases[1] != "syncing golden copy" {
+		t.Fatalf("expected 'cloning base image' then 'syncing golden copy', got %v", phases)
 	}
 	if phases[len(phases)-1] != "done" {
 		t.Fatalf("expected last phase 'done', got %q", phases[len(phases)-1])
@@ -234,6 +247,9 @@ func TestRefreshBase_CallsOnProgress(t *testing.T) {
 	if percents[len(percents)-1] != 100 {
 		t.Fatalf("expected final percent 100, got %d", percents[len(percents)-1])
 	}
+	if syncBytes != 7643136000 {
+		t.Fatalf("expected rsync byte counts to be forwarded, got %d", syncBytes)
+	}
 
 	// Verify SyncBaseWithProgress was used (Stream called) instead of SyncBase
 	if len(r.streamCalls) != 1 {
@@ -264,7 +280,7 @@ func TestInitBase_PassesExcludesToRsync(t *testing.T) {
 	}
 
 	excludes := []string{"node_modules", "*.lock"}
-	_, err := InitBase(repoRoot, repoRoot, r, 20, excludes, nil)
+	_, err := InitBase(t.Context(), repoRoot, repoRoot, r, RsyncSyncer{Runner: r}, 20, 0, excludes, nil)
 	if err != nil {
 		t.Fatalf("InitBase() error = %v", err)
 	}
@@ -288,6 +304,7 @@ func TestInitBase_PassesExcludesToRsync(t *testing.T) {
 
 func TestRefreshBase_PassesExcludesToRsync(t *testing.T) {
 	repoRoot := t.TempDir()
+	stubSeedBase(t)
 	basePath := filepath.Join(repoRoot, "images", "base.sparsebundle")
 	if err := SaveState(repoRoot, &State{
 		Backend:        "image",
@@ -313,7 +330,7 @@ func TestRefreshBase_PassesExcludesToRsync(t *testing.T) {
 	}
 
 	excludes := []string{"__pycache__"}
-	_, err := RefreshBase(repoRoot, repoRoot, r, "abc1234", excludes, nil)
+	_, err := RefreshBase(t.Context(), repoRoot, repoRoot, r, RsyncSyncer{Runner: r}, "abc1234", 0, excludes, nil)
 	if err != nil {
 		t.Fatalf("RefreshBase() error = %v", err)
 	}
@@ -331,39 +348,128 @@ func TestRefreshBase_PassesExcludesToRsync(t *testing.T) {
 	}
 }
 
-func TestRefreshBase_RefusesWhenWorkspacesExist(t *testing.T) {
+func TestRefreshBase_KeepsGenerationsInUse(t *testing.T) {
 	repoRoot := t.TempDir()
-	if err := SaveState(repoRoot, &State{
-		Backend:        "image",
-		BasePath:       filepath.Join(repoRoot, "images", "base.sparsebundle"),
-		BaseGeneration: 1,
-	}); err != nil {
+	seeded := stubSeedBase(t)
+	gen1 := baseImagePath(repoRoot, 1)
+	gen2 := baseImagePath(repoRoot, 2)
+	for _, path := range []string{gen1, gen2} {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SaveState(repoRoot, &State{Backend: "image", BasePath: gen2, BaseGeneration: 2}); err != nil {
 		t.Fatalf("SaveState() error = %v", err)
 	}
 	if err := SaveWorkspaceMeta(repoRoot, &WorkspaceMeta{
-		ID:         "main-a1b2",
-		Mountpoint: "/tmp/grove/main-a1b2",
-		Device:     "/dev/disk7s1",
-		ShadowPath: "/tmp/main-a1b2.shadow",
+		ID:             "main-a1b2",
+		Mountpoint:     "/tmp/grove/main-a1b2",
+		Device:         "/dev/disk7s1",
+		ShadowPath:     "/tmp/main-a1b2.shadow",
+		BaseGeneration: 1,
+		BasePath:       gen1,
 	}); err != nil {
 		t.Fatalf("SaveWorkspaceMeta() error = %v", err)
 	}
 
-	r := &fakeRunner{}
-	_, err := RefreshBase(repoRoot, repoRoot, r, "abc1234", nil, nil)
-	if err == nil {
-		t.Fatal("expected refresh to fail with active workspaces")
+	r := &fakeRunner{outputs: [][]byte{attachPlist(filepath.Join(repoRoot, "mnt", "base"))}}
+	st, err := RefreshBase(t.Context(), repoRoot, repoRoot, r, RsyncSyncer{Runner: r}, "abc1234", 0, nil, nil)
+	if err != nil {
+		t.Fatalf("RefreshBase() error = %v", err)
+	}
+
+	gen3 := baseImagePath(repoRoot, 3)
+	if st.BaseGeneration != 3 || st.BasePath != gen3 {
+		t.Fatalf("refreshed state = %+v, want generation 3 at %s", st, gen3)
+	}
+	if len(*seeded) != 1 || (*seeded)[0] != [2]string{gen2, gen3} {
+		t.Fatalf("expected generation 3 to be cloned from generation 2, got %v", *seeded)
+	}
+	if r.calls[0].args[1] != gen3 {
+		t.Fatalf("expected the sync to attach generation 3, got %v", r.calls[0].args)
+	}
+	if _, err := os.Stat(gen1); err != nil {
+		t.Errorf("generation 1 is still in use but was removed: %v", err)
+	}
+	if _, err := os.Stat(gen2); !os.IsNotExist(err) {
+		t.Errorf("unused generation 2 was not removed: %v", err)
+	}
+}
+
+func TestRefreshBase_FailedSyncKeepsCurrentGeneration(t *testing.T) {
+	repoRoot := t.TempDir()
+	stubSeedBase(t)
+	gen1 := baseImagePath(repoRoot, 1)
+	if err := os.MkdirAll(gen1, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveState(repoRoot, &State{Backend: "image", BasePath: gen1, BaseGeneration: 1}); err != nil {
+		t.Fatalf("SaveState() error = %v", err)
+	}
+
+	r := &fakeRunner{
+		outputs: [][]byte{attachPlist(filepath.Join(repoRoot, "mnt", "base")), []byte("rsync: write failed")},
+		errs:    []error{nil, errors.New("exit 23")},
+	}
+	if _, err := RefreshBase(t.Context(), repoRoot, repoRoot, r, RsyncSyncer{Runner: r}, "abc1234", 0, nil, nil); err == nil {
+		t.Fatal("expected RefreshBase() to fail")
+	}
+
+	if _, err := os.Stat(baseImagePath(repoRoot, 2)); !os.IsNotExist(err) {
+		t.Errorf("partially synced generation 2 was left behind: %v", err)
+	}
+	st, err := LoadState(repoRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.BaseGeneration != 1 || st.BasePath != gen1 {
+		t.Errorf("state after failed refresh = %+v, want generation 1", st)
+	}
+	last := r.calls[len(r.calls)-1]
+	if last.name != "hdiutil" || last.args[0] != "detach" {
+		t.Errorf("expected the new generation to be detached, last call %+v", last)
+	}
+}
+
+func TestDestroyWorkspace_RemovesUnusedGeneration(t *testing.T) {
+	runtimeRoot := t.TempDir()
+	gen1 := baseImagePath(runtimeRoot, 1)
+	gen2 := baseImagePath(runtimeRoot, 2)
+	for _, path := range []string{gen1, gen2} {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SaveState(runtimeRoot, &State{Backend: "image", BasePath: gen2, BaseGeneration: 2}); err != nil {
+		t.Fatal(err)
+	}
+	mountpoint := filepath.Join(t.TempDir(), "main-a1b2")
+	os.MkdirAll(mountpoint, 0755)
+	if err := SaveWorkspaceMeta(runtimeRoot, &WorkspaceMeta{
+		ID:             "main-a1b2",
+		Mountpoint:     mountpoint,
+		Device:         "/dev/disk7s1",
+		ShadowPath:     filepath.Join(runtimeRoot, "shadows", "main-a1b2.shadow"),
+		BaseGeneration: 1,
+		BasePath:       gen1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DestroyWorkspace(t.Context(), runtimeRoot, "main-a1b2", &fakeRunner{outputs: [][]byte{infoPlist()}}); err != nil {
+		t.Fatalf("DestroyWorkspace() error = %v", err)
 	}
-	if !strings.Contains(err.Error(), "active image workspaces") {
-		t.Fatalf("unexpected error: %v", err)
+	if _, err := os.Stat(gen1); !os.IsNotExist(err) {
+		t.Errorf("generation 1 was not removed with its last workspace: %v", err)
 	}
-	if len(r.calls) != 0 {
-		t.Fatalf("expected no command calls, got %d", len(r.calls))
+	if _, err := os.Stat(gen2); err != nil {
+		t.Errorf("current generation was removed: %v", err)
 	}
 }
 
 func TestRefreshBase_UpdatesGenerationAndCommit(t *testing.T) {
 	repoRoot := t.TempDir()
+	stubSeedBase(t)
 	basePath := filepath.Join(repoRoot, "images", "base.sparsebundle")
 	if err := SaveState(repoRoot, &State{
 		Backend:        "image",
@@ -388,7 +494,7 @@ func TestRefreshBase_UpdatesGenerationAndCommit(t *testing.T) {
 		},
 	}
 
-	updated, err := RefreshBase(repoRoot, repoRoot, r, "abc1234", nil, nil)
+	updated, err := RefreshBase(t.Context(), repoRoot, repoRoot, r, RsyncSyncer{Runner: r}, "abc1234", 0, nil, nil)
 	if err != nil {
 		t.Fatalf("RefreshBase() error = %v", err)
 	}
@@ -407,3 +513,57 @@ func TestRefreshBase_UpdatesGenerationAndCommit(t *testing.T) {
 		t.Fatalf("expected persisted generation 3, got %d", persisted.BaseGeneration)
 	}
 }
+
+// stubSeedBase replaces the copy-on-write clone of the base image with an
+// empty directory, and records each clone.
+func stubSeedBase(t *testing.T) *[][2]string {
+	t.Helper()
+	orig := seedBase
+	t.Cleanup(func() { seedBase = orig })
+	var seeded [][2]string
+	seedBase = func(_ context.Context, prev, next string) error {
+		seeded = append(seeded, [2]string{prev, next})
+		return os.MkdirAll(next, 0755)
+	}
+	return &seeded
+}
+
+func attachPlist(mountPoint string) []byte {
+	return []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+  <key>system-entities</key>
+  <array>
+    <dict><key>dev-entry</key><string>/dev/disk9</string></dict>
+    <dict><key>dev-entry</key><string>/dev/disk9s1</string><key>mount-point</key><string>` + mountPoint + `</string></dict>
+  </array>
+</dict>
+</plist>`)
+}
+
+// infoPlist is hdiutil info -plist output listing images, each built with
+// infoImage.
+func infoPlist(images ...string) []byte {
+	return []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+  <key>framework</key><string>680</string>
+  <key>images</key>
+  <array>` + strings.Join(images, "") + `</array>
+</dict>
+</plist>`)
+}
+
+func infoImage(imagePath, shadowPath, device, mountPoint string) string {
+	return `
+    <dict>
+      <key>image-path</key><string>` + imagePath + `</string>
+      <key>shadow-path</key><string>` + shadowPath + `</string>
+      <key>writeable</key><true/>
+      <key>system-entities</key>
+      <array>
+        <dict><key>dev-entry</key><string>` + strings.TrimSuffix(device, "s1") + `</string></dict>
+        <dict><key>dev-entry</key><string>` + device + `</string><key>mount-point</key><string>` + mountPoint + `</string></dict>
+      </array>
+    </dict>`
+}
@@ -2,29 +2,34 @@ package image
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
+
+	"github.com/chrisbanes/grove/internal/ignore"
 )
 
-// Runner executes external commands.
+// Runner executes external commands. Commands are killed if ctx is done
+// before they exit.
 type Runner interface {
-	CombinedOutput(name string, args ...string) ([]byte, error)
-	Stream(name string, args []string, onLine func(string)) error
+	CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error)
+	Stream(ctx context.Context, name string, args []string, onLine func(string)) error
 }
 
 type execRunner struct{}
 
-func (execRunner) CombinedOutput(name string, args ...string) ([]byte, error) {
-	cmd := exec.Command(name, args...)
+func (execRunner) CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
 	return cmd.CombinedOutput()
 }
 
-func (execRunner) Stream(name string, args []string, onLine func(string)) error {
-	cmd := exec.Command(name, args...)
+func (execRunner) Stream(ctx context.Context, name string, args []string, onLine func(string)) error {
+	cmd := exec.CommandContext(ctx, name, args...)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return err
@@ -68,23 +73,62 @@ type AttachedVolume struct {
 	MountPoint string
 }
 
-var (
-	dictPattern         = regexp.MustCompile(`(?s)<dict>(.*?)</dict>`)
-	keyStringPattern    = regexp.MustCompile(`(?s)<key>\s*([^<]+)\s*</key>\s*<string>\s*([^<]+)\s*</string>`)
-	rsyncPercentPattern = regexp.MustCompile(`\s+(\d+)%`)
-)
+// AttachedImage describes a disk image hdiutil reports as attached.
+type AttachedImage struct {
+	ImagePath  string
+	ShadowPath string
+	Volumes    []AttachedVolume
+}
+
+var rsyncProgressPattern = regexp.MustCompile(`^\s*([\d,]+)\s+(\d+)%(?:\s+([\d.]+)([kMGT]?B)/s)?`)
+
+// Progress reports the state of a long-running image operation.
+type Progress struct {
+	Percent int
+	Phase   string
+	// Bytes is the amount of data transferred so far. BytesTotal is an
+	// estimate derived from Bytes and Percent, and zero until known.
+	Bytes      int64
+	BytesTotal int64
+	// Rate is the current throughput in bytes per second.
+	Rate float64
+	// Files is how many files have been transferred, of FilesTotal. Both
+	// are zero if the sync engine does not count files.
+	Files      int
+	FilesTotal int
+}
+
+// rsyncRateUnits are the multipliers for the units rsync prints after
+// rates, which are powers of 1024.
+var rsyncRateUnits = map[string]float64{
+	"B":  1,
+	"kB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+	"TB": 1 << 40,
+}
 
-func parseRsyncPercent(line string) (int, bool) {
-	m := rsyncPercentPattern.FindStringSubmatch(line)
+// parseRsyncProgress parses an rsync --info=progress2 line such as
+// "458,588,160   6%  109.38MB/s    0:01:02".
+func parseRsyncProgress(line string) (Progress, bool) {
+	m := rsyncProgressPattern.FindStringSubmatch(line)
 	if m == nil {
-		return -1, false
+		return Progress{Percent: -1}, false
+	}
+	var p Progress
+	p.Bytes, _ = strconv.ParseInt(strings.ReplaceAll(m[1], ",", ""), 10, 64)
+	p.Percent, _ = strconv.Atoi(m[2])
+	if p.Percent > 0 {
+		p.BytesTotal = p.Bytes * 100 / int64(p.Percent)
+	}
+	if m[3] != "" {
+		rate, _ := strconv.ParseFloat(m[3], 64)
+		p.Rate = rate * rsyncRateUnits[m[4]]
 	}
-	var pct int
-	fmt.Sscanf(m[1], "%d", &pct)
-	return pct, true
+	return p, true
 }
 
-func CreateSparseBundle(r Runner, path, volName string, sizeGB int) error {
+func CreateSparseBundle(ctx context.Context, r Runner, path, volName string, sizeGB int) error {
 	if r == nil {
 		r = execRunner{}
 	}
@@ -96,10 +140,10 @@ func CreateSparseBundle(r Runner, path, volName string, sizeGB int) error {
 		"-volname", volName,
 		path,
 	}
-	return run(r, "hdiutil", args...)
+	return run(ctx, r, "hdiutil", args...)
 }
 
-func AttachWithShadow(r Runner, basePath, shadowPath, mountPoint string) (*AttachedVolume, error) {
+func AttachWithShadow(ctx context.Context, r Runner, basePath, shadowPath, mountPoint string) (*AttachedVolume, error) {
 	if r == nil {
 		r = execRunner{}
 	}
@@ -111,7 +155,7 @@ func AttachWithShadow(r Runner, basePath, shadowPath, mountPoint string) (*Attac
 		"-nobrowse",
 		"-plist",
 	}
-	out, err := r.CombinedOutput("hdiutil", args...)
+	out, err := r.CombinedOutput(ctx, "hdiutil", args...)
 	if err != nil {
 		return nil, fmt.Errorf("hdiutil attach failed: %w\n%s", err, strings.TrimSpace(string(out)))
 	}
@@ -122,7 +166,7 @@ func AttachWithShadow(r Runner, basePath, shadowPath, mountPoint string) (*Attac
 	return vol, nil
 }
 
-func Attach(r Runner, basePath, mountPoint string) (*AttachedVolume, error) {
+func Attach(ctx context.Context, r Runner, basePath, mountPoint string) (*AttachedVolume, error) {
 	if r == nil {
 		r = execRunner{}
 	}
@@ -133,7 +177,7 @@ func Attach(r Runner, basePath, mountPoint string) (*AttachedVolume, error) {
 		"-nobrowse",
 		"-plist",
 	}
-	out, err := r.CombinedOutput("hdiutil", args...)
+	out, err := r.CombinedOutput(ctx, "hdiutil", args...)
 	if err != nil {
 		return nil, fmt.Errorf("hdiutil attach failed: %w\n%s", err, strings.TrimSpace(string(out)))
 	}
@@ -144,14 +188,47 @@ func Attach(r Runner, basePath, mountPoint string) (*AttachedVolume, error) {
 	return vol, nil
 }
 
-func Detach(r Runner, device string) error {
+func Detach(ctx context.Context, r Runner, device string) error {
 	if r == nil {
 		r = execRunner{}
 	}
-	return run(r, "hdiutil", "detach", device)
+	return run(ctx, r, "hdiutil", "detach", device)
 }
 
-func SyncBaseWithProgress(r Runner, src, dst string, excludes []string, onPercent func(int)) error {
+// AttachedImages lists the disk images that are currently attached, with
+// their mounted volumes.
+func AttachedImages(ctx context.Context, r Runner) ([]AttachedImage, error) {
+	if r == nil {
+		r = execRunner{}
+	}
+	out, err := r.CombinedOutput(ctx, "hdiutil", "info", "-plist")
+	if err != nil {
+		return nil, fmt.Errorf("hdiutil info failed: %w\n%s", err, strings.TrimSpace(string(out)))
+	}
+	root, err := parsePlist(out)
+	if err != nil {
+		return nil, fmt.Errorf("parse info output: %w", err)
+	}
+	info, _ := root.(map[string]any)
+	images, _ := info["images"].([]any)
+	var attached []AttachedImage
+	for _, entry := range images {
+		img, ok := entry.(map[string]any)
+		if !ok {
+			continue
+		}
+		imagePath, _ := img["image-path"].(string)
+		shadowPath, _ := img["shadow-path"].(string)
+		attached = append(attached, AttachedImage{
+			ImagePath:  imagePath,
+			ShadowPath: shadowPath,
+			Volumes:    mountedVolumes(img),
+		})
+	}
+	return attached, nil
+}
+
+func SyncBaseWithProgress(ctx context.Context, r Runner, src, dst string, excludes []string, onProgress func(Progress)) error {
 	if r == nil {
 		r = execRunner{}
 	}
@@ -167,16 +244,18 @@ func SyncBaseWithProgress(r Runner, src, dst string, excludes []string, onPercen
 		"--exclude", ".grove/shadows/",
 		"--exclude", ".grove/mnt/",
 	}
-	for _, pattern := range excludes {
-		args = append(args, "--exclude", pattern)
+	filters, err := rsyncFilterArgs(src, excludes)
+	if err != nil {
+		return err
 	}
+	args = append(args, filters...)
 	args = append(args, src, dst)
-	err := r.Stream("rsync", args, func(line string) {
-		if onPercent == nil {
+	err = r.Stream(ctx, "rsync", args, func(line string) {
+		if onProgress == nil {
 			return
 		}
-		if pct, ok := parseRsyncPercent(line); ok {
-			onPercent(pct)
+		if p, ok := parseRsyncProgress(line); ok {
+			onProgress(p)
 		}
 	})
 	if err != nil && isRsyncVanishedErr(err) {
@@ -185,7 +264,7 @@ func SyncBaseWithProgress(r Runner, src, dst string, excludes []string, onPercen
 	return err
 }
 
-func SyncBase(r Runner, src, dst string, excludes []string) error {
+func SyncBase(ctx context.Context, r Runner, src, dst string, excludes []string) error {
 	if r == nil {
 		r = execRunner{}
 	}
@@ -199,19 +278,39 @@ func SyncBase(r Runner, src, dst string, excludes []string) error {
 		"--exclude", ".grove/shadows/",
 		"--exclude", ".grove/mnt/",
 	}
-	for _, pattern := range excludes {
-		args = append(args, "--exclude", pattern)
+	filters, err := rsyncFilterArgs(src, excludes)
+	if err != nil {
+		return err
 	}
+	args = append(args, filters...)
 	args = append(args, src, dst)
-	err := run(r, "rsync", args...)
+	err = run(ctx, r, "rsync", args...)
 	if err != nil && isRsyncVanishedErr(err) {
 		return nil
 	}
 	return err
 }
 
-func run(r Runner, name string, args ...string) error {
-	out, err := r.CombinedOutput(name, args...)
+// rsyncFilterArgs translates gitignore-style excludes, merged with the
+// .groveignore files under src, into rsync filter arguments. As with clone
+// excludes, the .grove directory is protected from user patterns.
+func rsyncFilterArgs(src string, excludes []string) ([]string, error) {
+	m, err := ignore.Load(src, excludes)
+	if err != nil {
+		return nil, fmt.Errorf("loading excludes: %w", err)
+	}
+	filters, err := ignore.RsyncArgs(m.Patterns())
+	if err != nil {
+		return nil, err
+	}
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	return append([]string{"--include", "/.grove/***"}, filters...), nil
+}
+
+func run(ctx context.Context, r Runner, name string, args ...string) error {
+	out, err := r.CombinedOutput(ctx, name, args...)
 	if err != nil {
 		return fmt.Errorf("%s %s failed: %w\n%s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
 	}
@@ -245,21 +344,36 @@ func ensureTrailingSlash(path string) string {
 	return path + "/"
 }
 
-func parseAttachedVolume(plist []byte) (*AttachedVolume, error) {
-	dicts := dictPattern.FindAllSubmatch(plist, -1)
-	for _, dictMatch := range dicts {
-		kv := map[string]string{}
-		for _, pair := range keyStringPattern.FindAllSubmatch(dictMatch[1], -1) {
-			kv[string(pair[1])] = string(pair[2])
+func parseAttachedVolume(out []byte) (*AttachedVolume, error) {
+	root, err := parsePlist(out)
+	if err != nil {
+		return nil, err
+	}
+	dict, _ := root.(map[string]any)
+	if volumes := mountedVolumes(dict); len(volumes) > 0 {
+		return &volumes[0], nil
+	}
+	return nil, fmt.Errorf("missing dev-entry or mount-point in attach plist")
+}
+
+// mountedVolumes returns the mounted volumes among the system-entities of
+// an attached image.
+func mountedVolumes(img map[string]any) []AttachedVolume {
+	entities, _ := img["system-entities"].([]any)
+	var volumes []AttachedVolume
+	for _, entry := range entities {
+		entity, ok := entry.(map[string]any)
+		if !ok {
+			continue
 		}
-		dev := kv["dev-entry"]
-		mount := kv["mount-point"]
+		dev, _ := entity["dev-entry"].(string)
+		mount, _ := entity["mount-point"].(string)
 		if dev != "" && mount != "" {
-			return &AttachedVolume{
+			volumes = append(volumes, AttachedVolume{
 				Device:     strings.TrimSpace(dev),
 				MountPoint: strings.TrimSpace(mount),
-			}, nil
+			})
 		}
 	}
-	return nil, fmt.Errorf("missing dev-entry or mount-point in attach plist")
+	return volumes
 }
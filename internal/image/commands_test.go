@@ -1,8 +1,11 @@
 package image
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -26,7 +29,7 @@ type fakeRunner struct {
 	streamErr   error
 }
 
-func (f *fakeRunner) CombinedOutput(name string, args ...string) ([]byte, error) {
+func (f *fakeRunner) CombinedOutput(_ context.Context, name string, args ...string) ([]byte, error) {
 	f.calls = append(f.calls, runnerCall{name: name, args: append([]string(nil), args...)})
 	if len(f.outputs) == 0 {
 		return nil, nil
@@ -41,7 +44,7 @@ func (f *fakeRunner) CombinedOutput(name string, args ...string) ([]byte, error)
 	return out, err
 }
 
-func (f *fakeRunner) Stream(name string, args []string, onLine func(string)) error {
+func (f *fakeRunner) Stream(_ context.Context, name string, args []string, onLine func(string)) error {
 	f.streamCalls = append(f.streamCalls, streamCall{name: name, args: append([]string(nil), args...)})
 	for _, line := range f.streamLines {
 		onLine(line)
@@ -51,7 +54,7 @@ func (f *fakeRunner) Stream(name string, args []string, onLine func(string)) err
 
 func TestCreateSparseBundle_UsesExpectedCommand(t *testing.T) {
 	r := &fakeRunner{}
-	if err := CreateSparseBundle(r, "/tmp/base.sparsebundle", "grove-base", 20); err != nil {
+	if err := CreateSparseBundle(t.Context(), r, "/tmp/base.sparsebundle", "grove-base", 20); err != nil {
 		t.Fatalf("CreateSparseBundle() error = %v", err)
 	}
 
@@ -91,7 +94,7 @@ func TestAttachWithShadow_ParsesMountedDevice(t *testing.T) {
 </plist>`)},
 	}
 
-	vol, err := AttachWithShadow(r, "/tmp/base.sparsebundle", "/tmp/ws.shadow", "/tmp/ws")
+	vol, err := AttachWithShadow(t.Context(), r, "/tmp/base.sparsebundle", "/tmp/ws.shadow", "/tmp/ws")
 	if err != nil {
 		t.Fatalf("AttachWithShadow() error = %v", err)
 	}
@@ -116,7 +119,7 @@ func TestAttachWithShadow_MissingDeviceOrMountPoint(t *testing.T) {
 	r := &fakeRunner{
 		outputs: [][]byte{[]byte(`<plist version="1.0"><dict></dict></plist>`)},
 	}
-	_, err := AttachWithShadow(r, "/tmp/base.sparsebundle", "/tmp/ws.shadow", "/tmp/ws")
+	_, err := AttachWithShadow(t.Context(), r, "/tmp/base.sparsebundle", "/tmp/ws.shadow", "/tmp/ws")
 	if err == nil {
 		t.Fatal("expected error for missing device/mount-point")
 	}
@@ -124,7 +127,7 @@ func TestAttachWithShadow_MissingDeviceOrMountPoint(t *testing.T) {
 
 func TestDetach_UsesExpectedCommand(t *testing.T) {
 	r := &fakeRunner{}
-	if err := Detach(r, "/dev/disk4s1"); err != nil {
+	if err := Detach(t.Context(), r, "/dev/disk4s1"); err != nil {
 		t.Fatalf("Detach() error = %v", err)
 	}
 
@@ -143,7 +146,7 @@ func TestDetach_UsesExpectedCommand(t *testing.T) {
 
 func TestSyncBase_UsesExpectedCommand(t *testing.T) {
 	r := &fakeRunner{}
-	if err := SyncBase(r, "/src", "/dst", nil); err != nil {
+	if err := SyncBase(t.Context(), r, "/src", "/dst", nil); err != nil {
 		t.Fatalf("SyncBase() error = %v", err)
 	}
 
@@ -174,7 +177,7 @@ func TestCreateSparseBundle_PropagatesCommandError(t *testing.T) {
 		outputs: [][]byte{[]byte("boom")},
 		errs:    []error{errors.New("exit 1")},
 	}
-	err := CreateSparseBundle(r, "/tmp/base.sparsebundle", "grove-base", 20)
+	err := CreateSparseBundle(t.Context(), r, "/tmp/base.sparsebundle", "grove-base", 20)
 	if err == nil {
 		t.Fatal("expected command error")
 	}
@@ -183,26 +186,38 @@ func TestCreateSparseBundle_PropagatesCommandError(t *testing.T) {
 	}
 }
 
-func TestParseRsyncPercent(t *testing.T) {
+func TestParseRsyncProgress(t *testing.T) {
 	tests := []struct {
-		line string
-		want int
-		ok   bool
+		line  string
+		want  int
+		ok    bool
+		bytes int64
+		total int64
+		rate  float64
 	}{
-		{"    458,588,160   6%  109.38MB/s    0:01:02", 6, true},
-		{"  1,234,567,890  99%   50.00MB/s    0:00:01", 99, true},
-		{"              0   0%    0.00kB/s    0:00:00", 0, true},
-		{"  1,234,567,890 100%   50.00MB/s    0:00:01 (xfr#1, to-chk=0/100)", 100, true},
-		{"sending incremental file list", -1, false},
-		{"", -1, false},
+		{"    458,588,160   6%  109.38MB/s    0:01:02", 6, true, 458588160, 7643136000, 109.38 * (1 << 20)},
+		{"  1,234,567,890  99%   50.00MB/s    0:00:01", 99, true, 1234567890, 1247038272, 50 * (1 << 20)},
+		{"              0   0%    0.00kB/s    0:00:00", 0, true, 0, 0, 0},
+		{"  1,234,567,890 100%   50.00MB/s    0:00:01 (xfr#1, to-chk=0/100)", 100, true, 1234567890, 1234567890, 50 * (1 << 20)},
+		{"sending incremental file list", -1, false, 0, 0, 0},
+		{"", -1, false, 0, 0, 0},
 	}
 	for _, tt := range tests {
-		got, ok := parseRsyncPercent(tt.line)
+		got, ok := parseRsyncProgress(tt.line)
 		if ok != tt.ok {
-			t.Errorf("parseRsyncPercent(%q) ok = %v, want %v", tt.line, ok, tt.ok)
+			t.Errorf("parseRsyncProgress(%q) ok = %v, want %v", tt.line, ok, tt.ok)
 		}
-		if ok && got != tt.want {
-			t.Errorf("parseRsyncPercent(%q) = %d, want %d", tt.line, got, tt.want)
+		if !ok {
+			continue
+		}
+		if got.Percent != tt.want {
+			t.Errorf("parseRsyncProgress(%q).Percent = %d, want %d", tt.line, got.Percent, tt.want)
+		}
+		if got.Bytes != tt.bytes || got.BytesTotal != tt.total {
+			t.Errorf("parseRsyncProgress(%q) bytes = %d/%d, want %d/%d", tt.line, got.Bytes, got.BytesTotal, tt.bytes, tt.total)
+		}
+		if got.Rate != tt.rate {
+			t.Errorf("parseRsyncProgress(%q).Rate = %v, want %v", tt.line, got.Rate, tt.rate)
 		}
 	}
 }
@@ -218,11 +233,11 @@ func TestSyncBaseWithProgress_CallsRsyncWithProgressFlags(t *testing.T) {
 	}
 
 	var percents []int
-	onProgress := func(pct int) {
-		percents = append(percents, pct)
+	onProgress := func(p Progress) {
+		percents = append(percents, p.Percent)
 	}
 
-	if err := SyncBaseWithProgress(r, "/src", "/dst", nil, onProgress); err != nil {
+	if err := SyncBaseWithProgress(t.Context(), r, "/src", "/dst", nil, onProgress); err != nil {
 		t.Fatalf("SyncBaseWithProgress() error = %v", err)
 	}
 
@@ -252,12 +267,12 @@ func TestSyncBaseWithProgress_CallsRsyncWithProgressFlags(t *testing.T) {
 func TestSyncBaseWithProgress_NilRunnerUsesDefault(t *testing.T) {
 	// Just verifying it doesn't panic when runner is nil — will fail
 	// with a real rsync error since paths don't exist, which is fine.
-	_ = SyncBaseWithProgress(nil, "/nonexistent/src", "/nonexistent/dst", nil, nil)
+	_ = SyncBaseWithProgress(t.Context(), nil, "/nonexistent/src", "/nonexistent/dst", nil, nil)
 }
 
 func TestSyncBase_WithExcludes(t *testing.T) {
 	r := &fakeRunner{}
-	if err := SyncBase(r, "/src", "/dst", []string{"node_modules", "*.lock"}); err != nil {
+	if err := SyncBase(t.Context(), r, "/src", "/dst", []string{"node_modules", "*.lock"}); err != nil {
 		t.Fatalf("SyncBase() error = %v", err)
 	}
 
@@ -275,8 +290,9 @@ func TestSyncBase_WithExcludes(t *testing.T) {
 		"--exclude", ".grove/workspaces/",
 		"--exclude", ".grove/shadows/",
 		"--exclude", ".grove/mnt/",
-		"--exclude", "node_modules",
+		"--include", "/.grove/***",
 		"--exclude", "*.lock",
+		"--exclude", "node_modules",
 		"/src/",
 		"/dst/",
 	}
@@ -285,6 +301,46 @@ func TestSyncBase_WithExcludes(t *testing.T) {
 	}
 }
 
+func TestSyncBase_TranslatesGitignorePatterns(t *testing.T) {
+	r := &fakeRunner{}
+	excludes := []string{"/build/", "*.log", "!keep.log"}
+	if err := SyncBase(t.Context(), r, "/src", "/dst", excludes); err != nil {
+		t.Fatalf("SyncBase() error = %v", err)
+	}
+	argsStr := strings.Join(r.calls[0].args, " ")
+	want := "--include /.grove/*** --include keep.log --exclude *.log --exclude /build/ /src/"
+	if !strings.Contains(argsStr, want) {
+		t.Fatalf("expected %q in args, got %v", want, r.calls[0].args)
+	}
+}
+
+func TestSyncBase_IncludesGroveignoreFiles(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "web"), 0755)
+	os.WriteFile(filepath.Join(src, ".groveignore"), []byte("*.tmp\n"), 0644)
+	os.WriteFile(filepath.Join(src, "web", ".groveignore"), []byte("/dist/\n"), 0644)
+
+	r := &fakeRunner{}
+	if err := SyncBase(t.Context(), r, src, "/dst", []string{"node_modules"}); err != nil {
+		t.Fatalf("SyncBase() error = %v", err)
+	}
+	argsStr := strings.Join(r.calls[0].args, " ")
+	want := "--include /.grove/*** --exclude node_modules --exclude /web/dist/ --exclude *.tmp"
+	if !strings.Contains(argsStr, want) {
+		t.Fatalf("expected %q in args, got %v", want, r.calls[0].args)
+	}
+}
+
+func TestSyncBase_InvalidExclude(t *testing.T) {
+	r := &fakeRunner{}
+	if err := SyncBase(t.Context(), r, "/src", "/dst", []string{"[invalid"}); err == nil {
+		t.Fatal("expected error for invalid exclude")
+	}
+	if len(r.calls) != 0 {
+		t.Fatalf("expected no rsync call, got %d", len(r.calls))
+	}
+}
+
 func TestSyncBaseWithProgress_WithExcludes(t *testing.T) {
 	r := &fakeRunner{
 		streamLines: []string{
@@ -292,7 +348,7 @@ func TestSyncBaseWithProgress_WithExcludes(t *testing.T) {
 		},
 	}
 
-	if err := SyncBaseWithProgress(r, "/src", "/dst", []string{"__pycache__"}, nil); err != nil {
+	if err := SyncBaseWithProgress(t.Context(), r, "/src", "/dst", []string{"__pycache__"}, nil); err != nil {
 		t.Fatalf("SyncBaseWithProgress() error = %v", err)
 	}
 
@@ -307,7 +363,7 @@ func TestSyncBaseWithProgress_WithExcludes(t *testing.T) {
 
 func TestSyncBase_NilExcludes(t *testing.T) {
 	r := &fakeRunner{}
-	if err := SyncBase(r, "/src", "/dst", nil); err != nil {
+	if err := SyncBase(t.Context(), r, "/src", "/dst", nil); err != nil {
 		t.Fatalf("SyncBase() error = %v", err)
 	}
 	call := r.calls[0]
@@ -331,15 +387,15 @@ type exitError struct {
 	code int
 }
 
-func (e *exitError) Error() string  { return fmt.Sprintf("exit status %d", e.code) }
-func (e *exitError) ExitCode() int  { return e.code }
+func (e *exitError) Error() string { return fmt.Sprintf("exit status %d", e.code) }
+func (e *exitError) ExitCode() int { return e.code }
 
 func TestSyncBase_ToleratesRsyncExitCode24(t *testing.T) {
 	r := &fakeRunner{
 		outputs: [][]byte{[]byte("some files vanished before transfer")},
 		errs:    []error{&exitError{code: 24}},
 	}
-	err := SyncBase(r, "/src", "/dst", nil)
+	err := SyncBase(t.Context(), r, "/src", "/dst", nil)
 	if err != nil {
 		t.Fatalf("SyncBase() should tolerate exit code 24, got error: %v", err)
 	}
@@ -350,7 +406,7 @@ func TestSyncBase_StillFailsOnOtherRsyncErrors(t *testing.T) {
 		outputs: [][]byte{[]byte("rsync error")},
 		errs:    []error{&exitError{code: 23}},
 	}
-	err := SyncBase(r, "/src", "/dst", nil)
+	err := SyncBase(t.Context(), r, "/src", "/dst", nil)
 	if err == nil {
 		t.Fatal("SyncBase() should fail on exit code 23")
 	}
@@ -360,7 +416,7 @@ func TestSyncBaseWithProgress_ToleratesRsyncExitCode24(t *testing.T) {
 	r := &fakeRunner{
 		streamErr: &exitError{code: 24},
 	}
-	err := SyncBaseWithProgress(r, "/src", "/dst", nil, nil)
+	err := SyncBaseWithProgress(t.Context(), r, "/src", "/dst", nil, nil)
 	if err != nil {
 		t.Fatalf("SyncBaseWithProgress() should tolerate exit code 24, got error: %v", err)
 	}
@@ -370,7 +426,7 @@ func TestSyncBaseWithProgress_StillFailsOnOtherRsyncErrors(t *testing.T) {
 	r := &fakeRunner{
 		streamErr: &exitError{code: 23},
 	}
-	err := SyncBaseWithProgress(r, "/src", "/dst", nil, nil)
+	err := SyncBaseWithProgress(t.Context(), r, "/src", "/dst", nil, nil)
 	if err == nil {
 		t.Fatal("SyncBaseWithProgress() should fail on exit code 23")
 	}
@@ -379,7 +435,7 @@ func TestSyncBaseWithProgress_StillFailsOnOtherRsyncErrors(t *testing.T) {
 func TestExecRunner_StreamCallsOnLine(t *testing.T) {
 	r := execRunner{}
 	var lines []string
-	err := r.Stream("echo", []string{"hello"}, func(line string) {
+	err := r.Stream(t.Context(), "echo", []string{"hello"}, func(line string) {
 		lines = append(lines, line)
 	})
 	if err != nil {
@@ -392,3 +448,39 @@ func TestExecRunner_StreamCallsOnLine(t *testing.T) {
 		t.Fatalf("expected 'hello', got %q", lines[0])
 	}
 }
+
+func TestAttachedImages_ParsesInfo(t *testing.T) {
+	r := &fakeRunner{outputs: [][]byte{infoPlist(
+		infoImage("/images/base-1.sparsebundle", "/shadows/a.shadow", "/dev/disk5s1", "/ws/a"),
+		infoImage("/images/base-2.sparsebundle", "/shadows/b.shadow", "/dev/disk6s1", "/ws/b"),
+	)}}
+
+	images, err := AttachedImages(t.Context(), r)
+	if err != nil {
+		t.Fatalf("AttachedImages() error = %v", err)
+	}
+	if len(images) != 2 {
+		t.Fatalf("got %d images, want 2", len(images))
+	}
+	img := images[1]
+	if img.ImagePath != "/images/base-2.sparsebundle" || img.ShadowPath != "/shadows/b.shadow" {
+		t.Errorf("image = %+v", img)
+	}
+	if len(img.Volumes) != 1 || img.Volumes[0].Device != "/dev/disk6s1" || img.Volumes[0].MountPoint != "/ws/b" {
+		t.Errorf("volumes = %+v, want /dev/disk6s1 at /ws/b", img.Volumes)
+	}
+	if got := strings.Join(r.calls[0].args, " "); got != "info -plist" {
+		t.Errorf("args = %q, want info -plist", got)
+	}
+}
+
+func TestAttachedImages_NoneAttached(t *testing.T) {
+	r := &fakeRunner{outputs: [][]byte{infoPlist()}}
+	images, err := AttachedImages(t.Context(), r)
+	if err != nil {
+		t.Fatalf("AttachedImages() error = %v", err)
+	}
+	if len(images) != 0 {
+		t.Fatalf("got %d images, want none", len(images))
+	}
+}
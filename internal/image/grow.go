@@ -0,0 +1,137 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"syscall"
+)
+
+// DefaultHeadroomGB is how much free space a base image sync leaves in the
+// base image when no headroom is configured.
+const DefaultHeadroomGB = 20
+
+const gb = 1 << 30
+
+// volumeSpace returns the size of the filesystem holding path and how much
+// of it is free.
+var volumeSpace = func(path string) (total, free int64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return int64(st.Blocks) * int64(st.Bsize), int64(st.Bavail) * int64(st.Bsize), nil
+}
+
+// BaseFullError reports that the golden copy does not fit in the base image
+// and the image could not be grown to make room.
+type BaseFullError struct {
+	// Need is how many bytes the golden copy needs beyond what is free in
+	// the base image, headroom included.
+	Need int64
+	// HostFree is how many bytes are free on the disk holding the base
+	// image.
+	HostFree int64
+	// SizeGB is the size growing the image was attempted to, and Err why
+	// it failed. Both are unset if growing was not attempted.
+	SizeGB int
+	Err    error
+}
+
+func (e *BaseFullError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("base image needs %.1f GB more space for the golden copy, but growing it to %d GB failed: %v", float64(e.Need)/gb, e.SizeGB, e.Err)
+	}
+	return fmt.Sprintf("base image needs %.1f GB more space for the golden copy, but only %.1f GB is free on the disk holding it — free up space or exclude more of the golden copy", float64(e.Need)/gb, float64(e.HostFree)/gb)
+}
+
+func (e *BaseFullError) Unwrap() error {
+	return e.Err
+}
+
+// growPlan works out whether the base image volume at mountPoint has room
+// for src, minus excludes, with headroomGB to spare once synced. It returns
+// the size in GB to grow the image to, or zero if it has room, and how many
+// bytes short the image is.
+func growPlan(mountPoint, imagePath, src string, excludes []string, headroomGB int) (sizeGB int, need int64, err error) {
+	if headroomGB <= 0 {
+		headroomGB = DefaultHeadroomGB
+	}
+	srcBytes, err := syncedSize(src, excludes)
+	if err != nil {
+		return 0, 0, fmt.Errorf("measuring golden copy: %w", err)
+	}
+	total, free, err := volumeSpace(mountPoint)
+	if err != nil {
+		return 0, 0, fmt.Errorf("checking base image free space: %w", err)
+	}
+	// The sync replaces what the image holds with the golden copy.
+	growth := srcBytes - (total - free)
+	need = growth + int64(headroomGB)*gb - free
+	if need <= 0 {
+		return 0, 0, nil
+	}
+
+	// A sparse bundle only takes host disk for what is written to it.
+	_, hostFree, err := volumeSpace(filepath.Dir(imagePath))
+	if err != nil {
+		return 0, 0, fmt.Errorf("checking host free space: %w", err)
+	}
+	if growth > hostFree {
+		return 0, 0, &BaseFullError{Need: need, HostFree: hostFree}
+	}
+	return int((total + need + gb - 1) / gb), need, nil
+}
+
+// syncedSize returns the total size of the regular files a base sync copies
+// from src.
+func syncedSize(src string, excludes []string) (int64, error) {
+	exclude, err := syncExcluder(src, excludes)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if exclude(filepath.ToSlash(rel), d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// syncSkipsDir reports whether rel is one of the runtime directories a base
+// sync always leaves out.
+func syncSkipsDir(rel string) bool {
+	switch rel {
+	case ".grove/images", ".grove/workspaces", ".grove/shadows", ".grove/mnt":
+		return true
+	}
+	return false
+}
+
+// GrowBase resizes the detached base image at imagePath to sizeGB.
+func GrowBase(ctx context.Context, r Runner, imagePath string, sizeGB int) error {
+	if r == nil {
+		r = execRunner{}
+	}
+	return run(ctx, r, "hdiutil", "resize", "-size", fmt.Sprintf("%dg", sizeGB), imagePath)
+}
@@ -0,0 +1,180 @@
+package image
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Syncs check for free space in the base image, which the tests fake,
+	// so give them a roomy volume unless a test says otherwise.
+	volumeSpace = func(string) (int64, int64, error) {
+		return 1 << 50, 1 << 49, nil
+	}
+	os.Exit(m.Run())
+}
+
+// stubVolumeSpace fakes a base image volume mounted under runtimeRoot,
+// holding total bytes of which free are free, on a host disk with hostFree
+// bytes free.
+func stubVolumeSpace(t *testing.T, runtimeRoot string, total, free, hostFree int64) {
+	t.Helper()
+	orig := volumeSpace
+	t.Cleanup(func() { volumeSpace = orig })
+	volumeSpace = func(path string) (int64, int64, error) {
+		if path == baseMountpoint(runtimeRoot) {
+			return total, free, nil
+		}
+		return 1 << 50, hostFree, nil
+	}
+}
+
+// growFixture sets up a refresh of generation 1 into generation 2 and
+// returns the runtime root and the golden copy.
+func growFixture(t *testing.T) (string, string) {
+	t.Helper()
+	runtimeRoot := t.TempDir()
+	stubSeedBase(t)
+	gen1 := baseImagePath(runtimeRoot, 1)
+	if err := os.MkdirAll(gen1, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveState(runtimeRoot, &State{Backend: "image", BasePath: gen1, BaseGeneration: 1, SizeGB: 10}); err != nil {
+		t.Fatal(err)
+	}
+	golden := t.TempDir()
+	// A sparse file, so the golden copy is large without using the disk.
+	f, err := os.Create(filepath.Join(golden, "big.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Truncate(12 * gb)
+	f.Close()
+	return runtimeRoot, golden
+}
+
+func TestRefreshBase_GrowsBaseToKeepHeadroom(t *testing.T) {
+	runtimeRoot, golden := growFixture(t)
+	// 8 GB of the golden copy is already in a 10 GB image.
+	stubVolumeSpace(t, runtimeRoot, 10*gb, 2*gb, 100*gb)
+
+	mnt := attachPlist(baseMountpoint(runtimeRoot))
+	r := &fakeRunner{outputs: [][]byte{mnt, nil, nil, mnt}}
+	var phases []string
+	st, err := RefreshBase(t.Context(), runtimeRoot, golden, r, RsyncSyncer{Runner: r}, "abc1234", 5, nil, func(p Progress) {
+		phases = append(phases, p.Phase)
+	})
+	if err != nil {
+		t.Fatalf("RefreshBase() error = %v", err)
+	}
+
+	// 12 GB plus 5 GB of headroom, rounded up.
+	if st.SizeGB != 17 {
+		t.Errorf("SizeGB = %d, want 17", st.SizeGB)
+	}
+	var cmds []string
+	for _, call := range r.calls {
+		cmds = append(cmds, call.args[0])
+	}
+	if got := strings.Join(cmds, " "); got != "attach detach resize attach detach" {
+		t.Fatalf("hdiutil commands = %s, want the image detached, resized and attached again", got)
+	}
+	want := "resize -size 17g " + baseImagePath(runtimeRoot, 2)
+	if got := strings.Join(r.calls[2].args, " "); got != want {
+		t.Errorf("resize args = %q, want %q", got, want)
+	}
+	if !strings.Contains(strings.Join(phases, ","), "growing base image") {
+		t.Errorf("phases = %v, want growing base image", phases)
+	}
+	if saved, _ := LoadState(runtimeRoot); saved.SizeGB != 17 {
+		t.Errorf("saved SizeGB = %d, want 17", saved.SizeGB)
+	}
+}
+
+func TestRefreshBase_KeepsSizeWithRoom(t *testing.T) {
+	runtimeRoot, golden := growFixture(t)
+	stubVolumeSpace(t, runtimeRoot, 40*gb, 28*gb, 100*gb)
+
+	r := &fakeRunner{outputs: [][]byte{attachPlist(baseMountpoint(runtimeRoot))}}
+	st, err := RefreshBase(t.Context(), runtimeRoot, golden, r, RsyncSyncer{Runner: r}, "abc1234", 0, nil, nil)
+	if err != nil {
+		t.Fatalf("RefreshBase() error = %v", err)
+	}
+	if st.SizeGB != 10 {
+		t.Errorf("SizeGB = %d, want 10 carried over", st.SizeGB)
+	}
+	for _, call := range r.calls {
+		if call.args[0] == "resize" {
+			t.Fatalf("resized an image with room: %v", call.args)
+		}
+	}
+}
+
+func TestRefreshBase_HostDiskTooFullToGrow(t *testing.T) {
+	runtimeRoot, golden := growFixture(t)
+	stubVolumeSpace(t, runtimeRoot, 10*gb, 2*gb, 1*gb)
+
+	r := &fakeRunner{outputs: [][]byte{attachPlist(baseMountpoint(runtimeRoot))}}
+	_, err := RefreshBase(t.Context(), runtimeRoot, golden, r, RsyncSyncer{Runner: r}, "abc1234", 0, nil, nil)
+	var full *BaseFullError
+	if !errors.As(err, &full) {
+		t.Fatalf("RefreshBase() error = %v, want a *BaseFullError", err)
+	}
+	if !strings.Contains(err.Error(), "only 1.0 GB is free on the disk holding it") {
+		t.Errorf("error = %q, want it to say the host disk is full", err)
+	}
+	if len(r.streamCalls) > 0 || r.calls[len(r.calls)-1].args[0] != "detach" {
+		t.Errorf("synced, or left the image attached: calls %v", r.calls)
+	}
+	if _, err := os.Stat(baseImagePath(runtimeRoot, 2)); !os.IsNotExist(err) {
+		t.Errorf("generation 2 was kept after the failure: %v", err)
+	}
+	if st, _ := LoadState(runtimeRoot); st.BaseGeneration != 1 {
+		t.Errorf("state moved to generation %d, want 1", st.BaseGeneration)
+	}
+}
+
+func TestRefreshBase_ResizeFailure(t *testing.T) {
+	runtimeRoot, golden := growFixture(t)
+	stubVolumeSpace(t, runtimeRoot, 10*gb, 2*gb, 100*gb)
+
+	resizeErr := errors.New("exit status 1")
+	r := &fakeRunner{
+		outputs: [][]byte{attachPlist(baseMountpoint(runtimeRoot)), nil, []byte("hdiutil: resize failed")},
+		errs:    []error{nil, nil, resizeErr},
+	}
+	_, err := RefreshBase(t.Context(), runtimeRoot, golden, r, RsyncSyncer{Runner: r}, "abc1234", 0, nil, nil)
+	var full *BaseFullError
+	if !errors.As(err, &full) || !errors.Is(err, resizeErr) {
+		t.Fatalf("RefreshBase() error = %v, want a *BaseFullError wrapping the resize failure", err)
+	}
+	if !strings.Contains(err.Error(), "growing it to 32 GB failed") {
+		t.Errorf("error = %q, want the size it tried", err)
+	}
+	// Detached before the resize, and not detached again.
+	if n := len(r.calls); n != 3 {
+		t.Errorf("ran %d hdiutil commands, want attach, detach and resize", n)
+	}
+}
+
+func TestSyncedSize_LeavesOutExcludes(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "build"), 0755)
+	os.MkdirAll(filepath.Join(src, ".grove", "mnt"), 0755)
+	os.WriteFile(filepath.Join(src, "main.go"), []byte("package main"), 0644)
+	os.WriteFile(filepath.Join(src, "build", "out.o"), []byte("objects"), 0644)
+	os.WriteFile(filepath.Join(src, ".grove", "config.json"), []byte("{}"), 0644)
+	os.WriteFile(filepath.Join(src, ".grove", "mnt", "x"), []byte("mounted"), 0644)
+
+	got, err := syncedSize(src, []string{"build/", ".grove/"})
+	if err != nil {
+		t.Fatalf("syncedSize() error = %v", err)
+	}
+	// main.go and .grove/config.json.
+	if want := int64(len("package main") + len("{}")); got != want {
+		t.Errorf("syncedSize() = %d, want %d", got, want)
+	}
+}
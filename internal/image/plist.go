@@ -0,0 +1,131 @@
+package image
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// parsePlist decodes an XML property list, such as hdiutil prints with
+// -plist. Dicts decode to map[string]any, arrays to []any, strings and dates
+// to string, integers to int64, reals to float64, booleans to bool and data
+// to []byte. Anything printed before the plist, such as a warning on stderr,
+// is skipped.
+func parsePlist(data []byte) (any, error) {
+	start := bytes.Index(data, []byte("<?xml"))
+	if start < 0 {
+		start = bytes.Index(data, []byte("<plist"))
+	}
+	if start < 0 {
+		return nil, fmt.Errorf("no plist in output")
+	}
+	d := xml.NewDecoder(bytes.NewReader(data[start:]))
+
+	el, err := nextPlistElement(d)
+	if err != nil {
+		return nil, err
+	}
+	if el.Name.Local != "plist" {
+		return nil, fmt.Errorf("expected <plist>, got <%s>", el.Name.Local)
+	}
+	el, err = nextPlistElement(d)
+	if err != nil {
+		return nil, err
+	}
+	return decodePlistValue(d, el)
+}
+
+// nextPlistElement returns the next start element, skipping text, comments
+// and directives. It returns io.EOF at the end of the enclosing element.
+func nextPlistElement(d *xml.Decoder) (xml.StartElement, error) {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return xml.StartElement{}, fmt.Errorf("unexpected end of plist")
+			}
+			return xml.StartElement{}, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			return t, nil
+		case xml.EndElement:
+			return xml.StartElement{}, io.EOF
+		}
+	}
+}
+
+func decodePlistValue(d *xml.Decoder, el xml.StartElement) (any, error) {
+	switch el.Name.Local {
+	case "dict":
+		dict := map[string]any{}
+		for {
+			keyEl, err := nextPlistElement(d)
+			if err == io.EOF {
+				return dict, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if keyEl.Name.Local != "key" {
+				return nil, fmt.Errorf("expected <key> in <dict>, got <%s>", keyEl.Name.Local)
+			}
+			var key string
+			if err := d.DecodeElement(&key, &keyEl); err != nil {
+				return nil, err
+			}
+			valueEl, err := nextPlistElement(d)
+			if err == io.EOF {
+				return nil, fmt.Errorf("missing value for key %q", key)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if dict[key], err = decodePlistValue(d, valueEl); err != nil {
+				return nil, err
+			}
+		}
+	case "array":
+		array := []any{}
+		for {
+			itemEl, err := nextPlistElement(d)
+			if err == io.EOF {
+				return array, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			item, err := decodePlistValue(d, itemEl)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, item)
+		}
+	case "true", "false":
+		if err := d.Skip(); err != nil {
+			return nil, err
+		}
+		return el.Name.Local == "true", nil
+	}
+
+	var text string
+	if err := d.DecodeElement(&text, &el); err != nil {
+		return nil, err
+	}
+	switch el.Name.Local {
+	case "string", "date":
+		return text, nil
+	case "integer":
+		return strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+	case "real":
+		return strconv.ParseFloat(strings.TrimSpace(text), 64)
+	case "data":
+		return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+	}
+	return nil, fmt.Errorf("unknown plist element <%s>", el.Name.Local)
+}
@@ -0,0 +1,59 @@
+package image
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePlist_Values(t *testing.T) {
+	data := []byte(`hdiutil: warning: something odd
+<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+  <key>name</key><string>a &amp; b</string>
+  <key>count</key><integer>42</integer>
+  <key>ratio</key><real>0.5</real>
+  <key>on</key><true/>
+  <key>off</key><false/>
+  <key>blob</key><data>aGk=</data>
+  <key>list</key>
+  <array>
+    <string>x</string>
+    <dict/>
+    <array/>
+  </array>
+</dict>
+</plist>`)
+
+	got, err := parsePlist(data)
+	if err != nil {
+		t.Fatalf("parsePlist() error = %v", err)
+	}
+	want := map[string]any{
+		"name":  "a & b",
+		"count": int64(42),
+		"ratio": 0.5,
+		"on":    true,
+		"off":   false,
+		"blob":  []byte("hi"),
+		"list":  []any{"x", map[string]any{}, []any{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parsePlist() =\n%#v\nwant\n%#v", got, want)
+	}
+}
+
+func TestParsePlist_Invalid(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"not a plist",
+		`<plist version="1.0"><dict><key>a</key></dict></plist>`,
+		`<plist version="1.0"><dict><key>a</key><integer>x</integer></dict></plist>`,
+		`<plist version="1.0"><dict><key>a</key><string>b`,
+	} {
+		if _, err := parsePlist([]byte(data)); err == nil {
+			t.Errorf("parsePlist(%q) succeeded, want an error", data)
+		}
+	}
+}
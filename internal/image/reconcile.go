@@ -0,0 +1,130 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ReconcileAction is what Reconcile did with a workspace.
+type ReconcileAction string
+
+const (
+	// ReconcileAttached means the workspace was still attached. Its device
+	// entry is updated if it had changed.
+	ReconcileAttached ReconcileAction = "attached"
+	// ReconcileReattached means the workspace's shadow was attached again.
+	ReconcileReattached ReconcileAction = "reattached"
+	// ReconcileOrphaned means the workspace's shadow is gone, so it cannot
+	// be reattached. Its metadata is left in place.
+	ReconcileOrphaned ReconcileAction = "orphaned"
+	// ReconcileRemoved means the metadata of an orphaned workspace was
+	// removed.
+	ReconcileRemoved ReconcileAction = "removed"
+	// ReconcileFailed means the workspace could not be reconciled; Err says
+	// why.
+	ReconcileFailed ReconcileAction = "failed"
+)
+
+// ReconcileResult reports what Reconcile did with one workspace.
+type ReconcileResult struct {
+	ID     string
+	Action ReconcileAction
+	Device string
+	Err    error
+}
+
+// Reconcile brings workspace metadata back in line with the images that are
+// actually attached, as after a reboot or crash. Workspaces whose shadow
+// still exists are attached again on top of their base generation, and
+// device entries are updated. Metadata of workspaces whose shadow is gone is
+// reported, and removed along with the empty mountpoint if clean is set.
+func Reconcile(ctx context.Context, runtimeRoot string, runner Runner, clean bool) ([]ReconcileResult, error) {
+	metas, err := ListWorkspaceMeta(runtimeRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []ReconcileResult
+	removed := false
+	for i := range metas {
+		meta := &metas[i]
+		result := reconcileWorkspace(ctx, runtimeRoot, runner, meta, clean)
+		if result.Action == ReconcileRemoved {
+			removed = true
+		}
+		results = append(results, result)
+	}
+
+	if removed {
+		st, err := LoadState(runtimeRoot)
+		if err == nil {
+			err = GCGenerations(runtimeRoot, st)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return results, fmt.Errorf("removing unused base images: %w", err)
+		}
+	}
+	return results, nil
+}
+
+func reconcileWorkspace(ctx context.Context, runtimeRoot string, runner Runner, meta *WorkspaceMeta, clean bool) ReconcileResult {
+	result := ReconcileResult{ID: meta.ID, Action: ReconcileFailed}
+	fail := func(err error) ReconcileResult {
+		result.Err = err
+		return result
+	}
+
+	vol, err := attachedVolume(ctx, runner, meta)
+	if err != nil {
+		return fail(err)
+	}
+	if vol != nil {
+		result.Action, result.Device = ReconcileAttached, vol.Device
+		if vol.Device != meta.Device {
+			meta.Device = vol.Device
+			if err := SaveWorkspaceMeta(runtimeRoot, meta); err != nil {
+				return fail(err)
+			}
+		}
+		return result
+	}
+
+	if _, err := os.Stat(meta.ShadowPath); errors.Is(err, os.ErrNotExist) {
+		if !clean {
+			result.Action = ReconcileOrphaned
+			return result
+		}
+		if err := DeleteWorkspaceMeta(runtimeRoot, meta.ID); err != nil {
+			return fail(err)
+		}
+		// Not attached, so this is the empty mountpoint.
+		if err := os.RemoveAll(meta.Mountpoint); err != nil {
+			return fail(err)
+		}
+		result.Action = ReconcileRemoved
+		return result
+	} else if err != nil {
+		return fail(err)
+	}
+
+	basePath := workspaceBasePath(runtimeRoot, meta)
+	if _, err := os.Stat(basePath); err != nil {
+		return fail(fmt.Errorf("base image of generation %d: %w", meta.BaseGeneration, err))
+	}
+	if err := os.MkdirAll(meta.Mountpoint, 0755); err != nil {
+		return fail(err)
+	}
+	vol, err = AttachWithShadow(ctx, runner, basePath, meta.ShadowPath, meta.Mountpoint)
+	if err != nil {
+		return fail(err)
+	}
+	meta.Device = vol.Device
+	if err := SaveWorkspaceMeta(runtimeRoot, meta); err != nil {
+		_ = Detach(context.WithoutCancel(ctx), runner, vol.Device)
+		return fail(err)
+	}
+	result.Action, result.Device = ReconcileReattached, vol.Device
+	return result
+}
@@ -0,0 +1,140 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// reconcileFixture saves metadata for a workspace on base generation 1 and
+// returns it. The shadow file is only created if withShadow is set.
+func reconcileFixture(t *testing.T, runtimeRoot, id string, withShadow bool) *WorkspaceMeta {
+	t.Helper()
+	meta := &WorkspaceMeta{
+		ID:             id,
+		Mountpoint:     filepath.Join(runtimeRoot, "ws", id),
+		Device:         "/dev/disk7s1",
+		ShadowPath:     filepath.Join(runtimeRoot, "shadows", id+".shadow"),
+		BaseGeneration: 1,
+		BasePath:       baseImagePath(runtimeRoot, 1),
+	}
+	if withShadow {
+		os.MkdirAll(filepath.Dir(meta.ShadowPath), 0755)
+		if err := os.WriteFile(meta.ShadowPath, []byte("shadow"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SaveWorkspaceMeta(runtimeRoot, meta); err != nil {
+		t.Fatal(err)
+	}
+	return meta
+}
+
+func TestReconcile_ReattachesAndUpdatesDevices(t *testing.T) {
+	runtimeRoot := t.TempDir()
+	if err := os.MkdirAll(baseImagePath(runtimeRoot, 1), 0755); err != nil {
+		t.Fatal(err)
+	}
+	attached := reconcileFixture(t, runtimeRoot, "main-aaaa", true)
+	detached := reconcileFixture(t, runtimeRoot, "main-bbbb", true)
+
+	r := &fakeRunner{outputs: [][]byte{
+		infoPlist(infoImage(attached.BasePath, attached.ShadowPath, "/dev/disk4s1", attached.Mountpoint)),
+		infoPlist(infoImage(attached.BasePath, attached.ShadowPath, "/dev/disk4s1", attached.Mountpoint)),
+		attachPlist(detached.Mountpoint),
+	}}
+	results, err := Reconcile(t.Context(), runtimeRoot, r, false)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	want := map[string]ReconcileAction{"main-aaaa": ReconcileAttached, "main-bbbb": ReconcileReattached}
+	for _, res := range results {
+		if res.Err != nil || res.Action != want[res.ID] {
+			t.Errorf("%s: action %s, err %v; want %s", res.ID, res.Action, res.Err, want[res.ID])
+		}
+	}
+
+	if m, _ := LoadWorkspaceMeta(runtimeRoot, "main-aaaa"); m.Device != "/dev/disk4s1" {
+		t.Errorf("attached workspace device = %q, want /dev/disk4s1", m.Device)
+	}
+	if m, _ := LoadWorkspaceMeta(runtimeRoot, "main-bbbb"); m.Device != "/dev/disk9s1" {
+		t.Errorf("reattached workspace device = %q, want /dev/disk9s1", m.Device)
+	}
+	attach := r.calls[len(r.calls)-1]
+	wantArgs := []string{"attach", detached.BasePath, "-shadow", detached.ShadowPath, "-mountpoint", detached.Mountpoint}
+	if !strings.HasPrefix(strings.Join(attach.args, " "), strings.Join(wantArgs, " ")) {
+		t.Errorf("attach args = %v, want prefix %v", attach.args, wantArgs)
+	}
+}
+
+func TestReconcile_ReportsOrphans(t *testing.T) {
+	runtimeRoot := t.TempDir()
+	reconcileFixture(t, runtimeRoot, "main-aaaa", false)
+
+	r := &fakeRunner{outputs: [][]byte{infoPlist()}}
+	results, err := Reconcile(t.Context(), runtimeRoot, r, false)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(results) != 1 || results[0].Action != ReconcileOrphaned {
+		t.Fatalf("results = %+v, want one orphan", results)
+	}
+	if _, err := LoadWorkspaceMeta(runtimeRoot, "main-aaaa"); err != nil {
+		t.Errorf("orphan metadata removed without clean: %v", err)
+	}
+}
+
+func TestReconcile_CleanRemovesOrphans(t *testing.T) {
+	runtimeRoot := t.TempDir()
+	meta := reconcileFixture(t, runtimeRoot, "main-aaaa", false)
+	os.MkdirAll(meta.Mountpoint, 0755)
+	gen1 := baseImagePath(runtimeRoot, 1)
+	gen2 := baseImagePath(runtimeRoot, 2)
+	for _, p := range []string{gen1, gen2} {
+		if err := os.MkdirAll(p, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SaveState(runtimeRoot, &State{Backend: "image", BasePath: gen2, BaseGeneration: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &fakeRunner{outputs: [][]byte{infoPlist()}}
+	results, err := Reconcile(t.Context(), runtimeRoot, r, true)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(results) != 1 || results[0].Action != ReconcileRemoved {
+		t.Fatalf("results = %+v, want one removed", results)
+	}
+	if _, err := LoadWorkspaceMeta(runtimeRoot, "main-aaaa"); !os.IsNotExist(err) {
+		t.Errorf("orphan metadata still exists: %v", err)
+	}
+	if _, err := os.Stat(meta.Mountpoint); !os.IsNotExist(err) {
+		t.Errorf("orphan mountpoint still exists: %v", err)
+	}
+	if _, err := os.Stat(gen1); !os.IsNotExist(err) {
+		t.Errorf("generation used only by the orphan was kept: %v", err)
+	}
+}
+
+func TestReconcile_MissingBaseFails(t *testing.T) {
+	runtimeRoot := t.TempDir()
+	reconcileFixture(t, runtimeRoot, "main-aaaa", true)
+
+	r := &fakeRunner{outputs: [][]byte{infoPlist()}}
+	results, err := Reconcile(t.Context(), runtimeRoot, r, false)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(results) != 1 || results[0].Action != ReconcileFailed || results[0].Err == nil {
+		t.Fatalf("results = %+v, want one failure", results)
+	}
+	for _, call := range r.calls {
+		if call.args[0] == "attach" {
+			t.Fatalf("attached without a base image: %v", call.args)
+		}
+	}
+}
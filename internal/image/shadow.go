@@ -0,0 +1,165 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// UpdateShadowSizes measures the shadow file of every workspace, records
+// the sizes in the workspace metadata and returns the updated metadata.
+// Workspaces whose shadow is missing are returned unchanged.
+func UpdateShadowSizes(runtimeRoot string) ([]WorkspaceMeta, error) {
+	metas, err := ListWorkspaceMeta(runtimeRoot)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	for i := range metas {
+		meta := &metas[i]
+		fi, err := os.Stat(meta.ShadowPath)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		meta.ShadowBytes = fi.Size()
+		meta.ShadowCheckedAt = now
+		if err := SaveWorkspaceMeta(runtimeRoot, meta); err != nil {
+			return nil, err
+		}
+	}
+	return metas, nil
+}
+
+// OverShadowCap returns the workspaces among metas whose shadow has grown
+// past maxGB. A maxGB of zero means no cap.
+func OverShadowCap(metas []WorkspaceMeta, maxGB int) []WorkspaceMeta {
+	if maxGB <= 0 {
+		return nil
+	}
+	var over []WorkspaceMeta
+	for _, meta := range metas {
+		if meta.ShadowBytes > int64(maxGB)<<30 {
+			over = append(over, meta)
+		}
+	}
+	return over
+}
+
+// ShadowCapError reports workspaces whose shadows have grown past the cap.
+type ShadowCapError struct {
+	MaxGB      int
+	Workspaces []WorkspaceMeta
+}
+
+func (e *ShadowCapError) Error() string {
+	var parts []string
+	for _, meta := range e.Workspaces {
+		parts = append(parts, fmt.Sprintf("%s (%.1f GB)", meta.ID, float64(meta.ShadowBytes)/(1<<30)))
+	}
+	return fmt.Sprintf("shadow over %d GB: %s", e.MaxGB, strings.Join(parts, ", "))
+}
+
+// CheckShadows updates the recorded shadow sizes and returns a
+// *ShadowCapError if any has grown past maxGB.
+func CheckShadows(runtimeRoot string, maxGB int) ([]WorkspaceMeta, error) {
+	metas, err := UpdateShadowSizes(runtimeRoot)
+	if err != nil {
+		return nil, err
+	}
+	if over := OverShadowCap(metas, maxGB); len(over) > 0 {
+		return metas, &ShadowCapError{MaxGB: maxGB, Workspaces: over}
+	}
+	return metas, nil
+}
+
+// Compacted reports the size of a base image before and after CompactBase.
+type Compacted struct {
+	Path   string
+	Before int64
+	After  int64
+}
+
+// CompactBase returns the unused space in every base image generation to
+// the host. hdiutil can only compact an image that is not attached, so it
+// fails while any workspace, or a base sync, has a base image attached.
+func CompactBase(ctx context.Context, runtimeRoot string, runner Runner) ([]Compacted, error) {
+	if runner == nil {
+		runner = execRunner{}
+	}
+	paths, err := findBaseImages(runtimeRoot)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no base image in %s: %w", imagesDir(runtimeRoot), os.ErrNotExist)
+	}
+
+	images, err := AttachedImages(ctx, runner)
+	if err != nil {
+		return nil, err
+	}
+	var attached []string
+	for _, img := range images {
+		if isBaseImage(filepath.Base(img.ImagePath)) && sameDir(filepath.Dir(img.ImagePath), imagesDir(runtimeRoot)) {
+			attached = append(attached, img.ImagePath)
+		}
+	}
+	if len(attached) > 0 {
+		return nil, fmt.Errorf("%d workspace(s) or syncs have a base image attached — destroy or detach them first", len(attached))
+	}
+
+	sort.Strings(paths)
+	var results []Compacted
+	for _, path := range paths {
+		before, err := dirSize(path)
+		if err != nil {
+			return results, err
+		}
+		if err := run(ctx, runner, "hdiutil", "compact", path, "-batteryallowed"); err != nil {
+			return results, err
+		}
+		after, err := dirSize(path)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, Compacted{Path: path, Before: before, After: after})
+	}
+	return results, nil
+}
+
+// sameDir reports whether a and b name the same directory. hdiutil reports
+// image paths with symlinks resolved.
+func sameDir(a, b string) bool {
+	if a == b {
+		return true
+	}
+	resolved, err := filepath.EvalSymlinks(b)
+	return err == nil && a == resolved
+}
+
+// dirSize returns the total size of the regular files under path.
+func dirSize(path string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
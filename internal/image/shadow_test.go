@@ -0,0 +1,99 @@
+package image
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckShadows_RecordsSizesAndReportsOverCap(t *testing.T) {
+	runtimeRoot := t.TempDir()
+	small := reconcileFixture(t, runtimeRoot, "main-aaaa", true)
+	big := reconcileFixture(t, runtimeRoot, "main-bbbb", true)
+	reconcileFixture(t, runtimeRoot, "main-cccc", false)
+	if err := os.Truncate(big.ShadowPath, 3<<30); err != nil {
+		t.Fatal(err)
+	}
+
+	metas, err := CheckShadows(runtimeRoot, 2)
+	var capErr *ShadowCapError
+	if !errors.As(err, &capErr) {
+		t.Fatalf("CheckShadows() error = %v, want a *ShadowCapError", err)
+	}
+	if len(capErr.Workspaces) != 1 || capErr.Workspaces[0].ID != "main-bbbb" {
+		t.Errorf("over cap = %+v, want only main-bbbb", capErr.Workspaces)
+	}
+	if !strings.Contains(err.Error(), "main-bbbb (3.0 GB)") {
+		t.Errorf("error = %q, want the size of main-bbbb", err)
+	}
+	if len(metas) != 3 {
+		t.Fatalf("got %d workspaces, want 3", len(metas))
+	}
+
+	loaded, err := LoadWorkspaceMeta(runtimeRoot, small.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ShadowBytes != int64(len("shadow")) || loaded.ShadowCheckedAt.IsZero() {
+		t.Errorf("recorded %d bytes at %v, want %d bytes and a time", loaded.ShadowBytes, loaded.ShadowCheckedAt, len("shadow"))
+	}
+	if missing, _ := LoadWorkspaceMeta(runtimeRoot, "main-cccc"); !missing.ShadowCheckedAt.IsZero() {
+		t.Errorf("recorded a size for a missing shadow")
+	}
+
+	if _, err := CheckShadows(runtimeRoot, 0); err != nil {
+		t.Errorf("CheckShadows() without a cap error = %v", err)
+	}
+}
+
+func TestCompactBase_CompactsEveryGeneration(t *testing.T) {
+	runtimeRoot := t.TempDir()
+	for gen := 1; gen <= 2; gen++ {
+		bands := filepath.Join(baseImagePath(runtimeRoot, gen), "bands")
+		os.MkdirAll(bands, 0755)
+		os.WriteFile(filepath.Join(bands, "0"), []byte("band"), 0644)
+	}
+
+	r := &fakeRunner{outputs: [][]byte{infoPlist(infoImage("/other.dmg", "", "/dev/disk5s1", "/Volumes/Other"))}}
+	results, err := CompactBase(t.Context(), runtimeRoot, r)
+	if err != nil {
+		t.Fatalf("CompactBase() error = %v", err)
+	}
+	if len(results) != 2 || results[0].Before != 4 || results[0].After != 4 {
+		t.Fatalf("results = %+v, want two generations of 4 bytes", results)
+	}
+	var compacted []string
+	for _, call := range r.calls[1:] {
+		compacted = append(compacted, call.args[1])
+		if call.name != "hdiutil" || call.args[0] != "compact" {
+			t.Errorf("unexpected call %s %v", call.name, call.args)
+		}
+	}
+	want := []string{baseImagePath(runtimeRoot, 1), baseImagePath(runtimeRoot, 2)}
+	if strings.Join(compacted, " ") != strings.Join(want, " ") {
+		t.Errorf("compacted %v, want %v", compacted, want)
+	}
+}
+
+func TestCompactBase_RefusesWhileAttached(t *testing.T) {
+	runtimeRoot := t.TempDir()
+	base := baseImagePath(runtimeRoot, 1)
+	os.MkdirAll(base, 0755)
+
+	r := &fakeRunner{outputs: [][]byte{infoPlist(infoImage(base, "/shadows/a.shadow", "/dev/disk5s1", "/ws/a"))}}
+	if _, err := CompactBase(t.Context(), runtimeRoot, r); err == nil {
+		t.Fatal("CompactBase() succeeded with a workspace attached")
+	}
+	if len(r.calls) != 1 {
+		t.Errorf("ran %d commands, want only hdiutil info", len(r.calls))
+	}
+}
+
+func TestCompactBase_NoBaseImage(t *testing.T) {
+	_, err := CompactBase(t.Context(), t.TempDir(), &fakeRunner{})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("CompactBase() error = %v, want os.ErrNotExist", err)
+	}
+}
@@ -19,6 +19,9 @@ type State struct {
 	BasePath       string `json:"base_path"`
 	BaseGeneration int    `json:"base_generation"`
 	LastSyncCommit string `json:"last_sync_commit,omitempty"`
+	// SizeGB is the size the base image was created with or last grown
+	// to. It is zero for base images from before sizes were recorded.
+	SizeGB int `json:"size_gb,omitempty"`
 }
 
 // WorkspaceMeta stores image metadata for a workspace.
@@ -29,6 +32,14 @@ type WorkspaceMeta struct {
 	ShadowPath     string    `json:"shadow_path"`
 	BaseGeneration int       `json:"base_generation"`
 	CreatedAt      time.Time `json:"created_at"`
+	// BasePath is the base image the shadow sits on top of. It is empty for
+	// workspaces created before base generations were kept, which are all
+	// on the legacy base image.
+	BasePath string `json:"base_path,omitempty"`
+	// ShadowBytes is the size of the shadow file when it was last measured,
+	// at ShadowCheckedAt.
+	ShadowBytes     int64     `json:"shadow_bytes,omitempty"`
+	ShadowCheckedAt time.Time `json:"shadow_checked_at,omitzero"`
 }
 
 func LoadState(runtimeRoot string) (*State, error) {
@@ -131,10 +142,62 @@ func stateFilePath(runtimeRoot string) string {
 	return filepath.Join(imagesDir(runtimeRoot), "state.json")
 }
 
-func baseImagePath(runtimeRoot string) string {
+// baseImagePath returns where the given generation of the base image is
+// kept.
+func baseImagePath(runtimeRoot string, generation int) string {
+	return filepath.Join(imagesDir(runtimeRoot), fmt.Sprintf("base-%d.sparsebundle", generation))
+}
+
+// legacyBaseImagePath is where the single base image was kept before base
+// generations.
+func legacyBaseImagePath(runtimeRoot string) string {
 	return filepath.Join(imagesDir(runtimeRoot), "base.sparsebundle")
 }
 
+// isBaseImage reports whether name is a base image of any generation.
+func isBaseImage(name string) bool {
+	return strings.HasPrefix(name, "base") && strings.HasSuffix(name, ".sparsebundle")
+}
+
+// workspaceBasePath returns the base image meta's shadow sits on top of.
+func workspaceBasePath(runtimeRoot string, meta *WorkspaceMeta) string {
+	if meta.BasePath == "" {
+		return legacyBaseImagePath(runtimeRoot)
+	}
+	return meta.BasePath
+}
+
+// findBaseImages returns the base images of every generation.
+func findBaseImages(runtimeRoot string) ([]string, error) {
+	entries, err := os.ReadDir(imagesDir(runtimeRoot))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if isBaseImage(entry.Name()) {
+			paths = append(paths, filepath.Join(imagesDir(runtimeRoot), entry.Name()))
+		}
+	}
+	return paths, nil
+}
+
+func removeBaseImages(runtimeRoot string) error {
+	paths, err := findBaseImages(runtimeRoot)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func initMarkerPath(runtimeRoot string) string {
 	return filepath.Join(imagesDir(runtimeRoot), "init-in-progress")
 }
@@ -157,11 +220,12 @@ func detectInitMarker(runtimeRoot string) error {
 }
 
 func detectBaseWithoutState(runtimeRoot string) error {
-	if _, err := os.Stat(baseImagePath(runtimeRoot)); err == nil {
-		return fmt.Errorf("%w: found %s without %s; remove stale image data and rerun `grove migrate --to image`", ErrInitIncomplete, baseImagePath(runtimeRoot), stateFilePath(runtimeRoot))
-	} else if !errors.Is(err, os.ErrNotExist) {
+	paths, err := findBaseImages(runtimeRoot)
+	if err != nil {
 		return err
 	}
-
+	if len(paths) > 0 {
+		return fmt.Errorf("%w: found %s without %s; remove stale image data and rerun `grove migrate --to image`", ErrInitIncomplete, paths[0], stateFilePath(runtimeRoot))
+	}
 	return nil
 }
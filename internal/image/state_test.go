@@ -149,7 +149,7 @@ func TestLoadState_DetectsInterruptedInitMarkerEvenWithStateFile(t *testing.T) {
 	repoRoot := t.TempDir()
 	if err := SaveState(repoRoot, &State{
 		Backend:        "image",
-		BasePath:       baseImagePath(repoRoot),
+		BasePath:       baseImagePath(repoRoot, 1),
 		BaseGeneration: 1,
 	}); err != nil {
 		t.Fatalf("SaveState() error = %v", err)
@@ -172,7 +172,7 @@ func TestLoadState_DetectsBaseImageWithoutState(t *testing.T) {
 	if err := os.MkdirAll(imagesDir(repoRoot), 0755); err != nil {
 		t.Fatalf("mkdir images: %v", err)
 	}
-	if err := os.WriteFile(baseImagePath(repoRoot), []byte("placeholder"), 0644); err != nil {
+	if err := os.WriteFile(baseImagePath(repoRoot, 1), []byte("placeholder"), 0644); err != nil {
 		t.Fatalf("write base image placeholder: %v", err)
 	}
 
@@ -183,7 +183,7 @@ func TestLoadState_DetectsBaseImageWithoutState(t *testing.T) {
 	if !errors.Is(err, ErrInitIncomplete) {
 		t.Fatalf("expected ErrInitIncomplete, got %v", err)
 	}
-	if !strings.Contains(err.Error(), "base.sparsebundle") {
+	if !strings.Contains(err.Error(), "base-1.sparsebundle") {
 		t.Fatalf("expected base path in error, got %v", err)
 	}
 }
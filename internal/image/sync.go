@@ -0,0 +1,102 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chrisbanes/grove/internal/ignore"
+	"github.com/chrisbanes/grove/internal/mirror"
+)
+
+// Syncer mirrors the golden copy, minus excludes, into a base image or
+// layer, deleting what the golden copy no longer has. Excludes are
+// gitignore-style patterns, merged with the .groveignore files in src.
+type Syncer interface {
+	Sync(ctx context.Context, src, dst string, excludes []string, onProgress func(Progress)) error
+}
+
+// Sync engines, as named in config.
+const (
+	SyncEngineNative = "native"
+	SyncEngineRsync  = "rsync"
+)
+
+// NewSyncer returns the sync engine named engine. The empty name selects
+// the native engine. checksum only applies to the native engine; rsync
+// runs through r.
+func NewSyncer(engine string, checksum bool, r Runner) (Syncer, error) {
+	switch engine {
+	case "", SyncEngineNative:
+		return NativeSyncer{Checksum: checksum}, nil
+	case SyncEngineRsync:
+		return RsyncSyncer{Runner: r}, nil
+	}
+	return nil, fmt.Errorf("unknown sync engine %q: must be %s or %s", engine, SyncEngineNative, SyncEngineRsync)
+}
+
+// NativeSyncer syncs in-process, with no external tools. Changed files are
+// found by size and modification time or, with Checksum, by content.
+type NativeSyncer struct {
+	Checksum bool
+}
+
+func (s NativeSyncer) Sync(ctx context.Context, src, dst string, excludes []string, onProgress func(Progress)) error {
+	exclude, err := syncExcluder(src, excludes)
+	if err != nil {
+		return err
+	}
+	opts := mirror.Options{Exclude: exclude, Checksum: s.Checksum}
+	if onProgress != nil {
+		start := time.Now()
+		opts.OnProgress = func(p mirror.Progress) {
+			progress := Progress{
+				Percent:    100,
+				Bytes:      p.Bytes,
+				BytesTotal: p.BytesTotal,
+				Files:      p.Files,
+				FilesTotal: p.FilesTotal,
+			}
+			if p.BytesTotal > 0 {
+				progress.Percent = int(p.Bytes * 100 / p.BytesTotal)
+			}
+			if elapsed := time.Since(start).Seconds(); elapsed > 0 {
+				progress.Rate = float64(p.Bytes) / elapsed
+			}
+			onProgress(progress)
+		}
+	}
+	_, err = mirror.Tree(ctx, src, dst, opts)
+	return err
+}
+
+// RsyncSyncer syncs with rsync, run through Runner. Progress needs an rsync
+// that supports --info=progress2.
+type RsyncSyncer struct {
+	Runner Runner
+}
+
+func (s RsyncSyncer) Sync(ctx context.Context, src, dst string, excludes []string, onProgress func(Progress)) error {
+	if onProgress != nil {
+		return SyncBaseWithProgress(ctx, s.Runner, src, dst, excludes, onProgress)
+	}
+	return SyncBase(ctx, s.Runner, src, dst, excludes)
+}
+
+// syncExcluder returns whether a sync leaves out the entry at rel: the
+// runtime directories under .grove, and whatever excludes and the
+// .groveignore files in src exclude. As with clone excludes, the rest of
+// .grove is protected from user patterns.
+func syncExcluder(src string, excludes []string) (func(rel string, isDir bool) bool, error) {
+	m, err := ignore.Load(src, excludes)
+	if err != nil {
+		return nil, fmt.Errorf("loading excludes: %w", err)
+	}
+	return func(rel string, isDir bool) bool {
+		if rel == ".grove" || strings.HasPrefix(rel, ".grove/") {
+			return isDir && syncSkipsDir(rel)
+		}
+		return m.Excluded(rel, isDir)
+	}, nil
+}
@@ -0,0 +1,86 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewSyncer(t *testing.T) {
+	r := &fakeRunner{}
+	for _, tt := range []struct {
+		engine string
+		want   Syncer
+	}{
+		{"", NativeSyncer{Checksum: true}},
+		{SyncEngineNative, NativeSyncer{Checksum: true}},
+		{SyncEngineRsync, RsyncSyncer{Runner: r}},
+	} {
+		got, err := NewSyncer(tt.engine, true, r)
+		if err != nil {
+			t.Fatalf("NewSyncer(%q) error = %v", tt.engine, err)
+		}
+		if got != tt.want {
+			t.Errorf("NewSyncer(%q) = %#v, want %#v", tt.engine, got, tt.want)
+		}
+	}
+	if _, err := NewSyncer("robocopy", false, r); err == nil {
+		t.Error("expected an error for an unknown engine")
+	}
+}
+
+func TestNativeSyncer_AppliesExcludesAndSkipsRuntimeDirs(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	for rel, data := range map[string]string{
+		"main.go":                  "package main",
+		"build/out.o":              "object",
+		"cache/blob":               "ignored by .groveignore",
+		".groveignore":             "cache/\n",
+		".grove/config.json":       "{}",
+		".grove/images/base/band":  "image",
+		".grove/shadows/ws.shadow": "shadow",
+	} {
+		path := filepath.Join(src, filepath.FromSlash(rel))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(data), 0644)
+	}
+
+	var last Progress
+	err := NativeSyncer{}.Sync(t.Context(), src, dst, []string{"build/", ".grove/"}, func(p Progress) { last = p })
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	for _, rel := range []string{"main.go", ".groveignore", ".grove/config.json"} {
+		if _, err := os.Stat(filepath.Join(dst, rel)); err != nil {
+			t.Errorf("%s should be synced: %v", rel, err)
+		}
+	}
+	for _, rel := range []string{"build", "cache", ".grove/images", ".grove/shadows"} {
+		if _, err := os.Stat(filepath.Join(dst, rel)); !os.IsNotExist(err) {
+			t.Errorf("%s should not be synced: %v", rel, err)
+		}
+	}
+	if last.Percent != 100 || last.Files != 3 || last.FilesTotal != 3 {
+		t.Errorf("last progress = %+v, want 100%% with 3 of 3 files", last)
+	}
+}
+
+func TestInitBase_SyncsNativelyByDefault(t *testing.T) {
+	stubSeedBase(t)
+	repoRoot := t.TempDir()
+	os.WriteFile(filepath.Join(repoRoot, "main.go"), []byte("package main"), 0644)
+	mnt := baseMountpoint(repoRoot)
+	r := &fakeRunner{outputs: [][]byte{nil, attachPlist(mnt), nil}}
+
+	if _, err := InitBase(t.Context(), repoRoot, repoRoot, r, nil, 20, 0, nil, nil); err != nil {
+		t.Fatalf("InitBase() error = %v", err)
+	}
+	for _, call := range r.calls {
+		if call.name == "rsync" {
+			t.Fatalf("expected no rsync calls, got %v", r.calls)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(mnt, "main.go")); err != nil {
+		t.Errorf("main.go should be synced into the base: %v", err)
+	}
+}
@@ -1,13 +1,15 @@
 package image
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 )
 
-func CreateWorkspace(runtimeRoot, goldenRoot, workspacePath, workspaceID string, st *State, runner Runner) (*WorkspaceMeta, error) {
+func CreateWorkspace(ctx context.Context, runtimeRoot, goldenRoot, workspacePath, workspaceID string, st *State, runner Runner) (*WorkspaceMeta, error) {
 	_ = goldenRoot
 	if st == nil {
 		loaded, err := LoadState(runtimeRoot)
@@ -28,7 +30,7 @@ func CreateWorkspace(runtimeRoot, goldenRoot, workspacePath, workspaceID string,
 		return nil, err
 	}
 
-	vol, err := AttachWithShadow(runner, st.BasePath, shadowPath, workspacePath)
+	vol, err := AttachWithShadow(ctx, runner, st.BasePath, shadowPath, workspacePath)
 	if err != nil {
 		return nil, err
 	}
@@ -40,23 +42,32 @@ func CreateWorkspace(runtimeRoot, goldenRoot, workspacePath, workspaceID string,
 		ShadowPath:     shadowPath,
 		BaseGeneration: st.BaseGeneration,
 		CreatedAt:      time.Now().UTC(),
+		BasePath:       st.BasePath,
 	}
 	if err := SaveWorkspaceMeta(runtimeRoot, meta); err != nil {
-		_ = Detach(runner, vol.Device)
+		_ = Detach(context.WithoutCancel(ctx), runner, vol.Device)
 		_ = os.Remove(shadowPath)
 		return nil, err
 	}
 	return meta, nil
 }
 
-func DestroyWorkspace(runtimeRoot, workspaceID string, runner Runner) error {
+func DestroyWorkspace(ctx context.Context, runtimeRoot, workspaceID string, runner Runner) error {
 	meta, err := LoadWorkspaceMeta(runtimeRoot, workspaceID)
 	if err != nil {
 		return err
 	}
-	if err := Detach(runner, meta.Device); err != nil {
+	// After a reboot or crash the workspace is no longer attached, and the
+	// device it was attached as may since have gone to another image.
+	vol, err := attachedVolume(ctx, runner, meta)
+	if err != nil {
 		return err
 	}
+	if vol != nil {
+		if err := Detach(ctx, runner, vol.Device); err != nil {
+			return err
+		}
+	}
 	if err := os.Remove(meta.ShadowPath); err != nil && !os.IsNotExist(err) {
 		return err
 	}
@@ -66,5 +77,84 @@ func DestroyWorkspace(runtimeRoot, workspaceID string, runner Runner) error {
 	if err := os.RemoveAll(meta.Mountpoint); err != nil {
 		return err
 	}
-	return nil
+
+	st, err := LoadState(runtimeRoot)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return GCGenerations(runtimeRoot, st)
+}
+
+// RenameWorkspace gives the workspace workspaceID the ID newID. Its image
+// is detached, its shadow file renamed, and it is attached again at
+// workspacePath.
+func RenameWorkspace(ctx context.Context, runtimeRoot, workspaceID, newID, workspacePath string, runner Runner) (*WorkspaceMeta, error) {
+	meta, err := LoadWorkspaceMeta(runtimeRoot, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	vol, err := attachedVolume(ctx, runner, meta)
+	if err != nil {
+		return nil, err
+	}
+	if vol != nil {
+		if err := Detach(ctx, runner, vol.Device); err != nil {
+			return nil, err
+		}
+	}
+
+	renamed := *meta
+	renamed.ID = newID
+	renamed.Mountpoint = workspacePath
+	renamed.ShadowPath = filepath.Join(filepath.Dir(meta.ShadowPath), newID+".shadow")
+	renamed.Device = ""
+	if err := os.Rename(meta.ShadowPath, renamed.ShadowPath); err != nil {
+		return nil, err
+	}
+	// Detached, so this is the empty mountpoint.
+	if err := os.Rename(meta.Mountpoint, renamed.Mountpoint); err != nil {
+		return nil, err
+	}
+	if err := SaveWorkspaceMeta(runtimeRoot, &renamed); err != nil {
+		return nil, err
+	}
+	if err := DeleteWorkspaceMeta(runtimeRoot, workspaceID); err != nil {
+		return nil, err
+	}
+
+	vol, err = AttachWithShadow(ctx, runner, workspaceBasePath(runtimeRoot, &renamed), renamed.ShadowPath, renamed.Mountpoint)
+	if err != nil {
+		return nil, err
+	}
+	renamed.Device = vol.Device
+	if err := SaveWorkspaceMeta(runtimeRoot, &renamed); err != nil {
+		_ = Detach(context.WithoutCancel(ctx), runner, vol.Device)
+		return nil, err
+	}
+	return &renamed, nil
+}
+
+// attachedVolume returns the volume the workspace is attached as, or nil if
+// it is not attached.
+func attachedVolume(ctx context.Context, runner Runner, meta *WorkspaceMeta) (*AttachedVolume, error) {
+	images, err := AttachedImages(ctx, runner)
+	if err != nil {
+		return nil, err
+	}
+	// hdiutil reports mount points with symlinks, such as /tmp, resolved.
+	mountpoint := meta.Mountpoint
+	if resolved, err := filepath.EvalSymlinks(mountpoint); err == nil {
+		mountpoint = resolved
+	}
+	for _, img := range images {
+		for _, vol := range img.Volumes {
+			if vol.MountPoint == meta.Mountpoint || vol.MountPoint == mountpoint || (img.ShadowPath != "" && img.ShadowPath == meta.ShadowPath) {
+				return &vol, nil
+			}
+		}
+	}
+	return nil, nil
 }
@@ -3,6 +3,7 @@ package image
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -30,7 +31,7 @@ func TestCreateWorkspace_SavesMetadata(t *testing.T) {
 		},
 	}
 
-	meta, err := CreateWorkspace(runtimeRoot, "", wsPath, "main-a1b2", st, r)
+	meta, err := CreateWorkspace(t.Context(), runtimeRoot, "", wsPath, "main-a1b2", st, r)
 	if err != nil {
 		t.Fatalf("CreateWorkspace() error = %v", err)
 	}
@@ -85,7 +86,7 @@ func TestCreateWorkspace_CleansUpOnMetadataFailure(t *testing.T) {
 		},
 	}
 
-	_, err := CreateWorkspace(runtimeRoot, "", wsPath, "main-a1b2", st, r)
+	_, err := CreateWorkspace(t.Context(), runtimeRoot, "", wsPath, "main-a1b2", st, r)
 	if err == nil {
 		t.Fatal("expected create failure")
 	}
@@ -120,16 +121,18 @@ func TestDestroyWorkspace_DetachesAndRemovesMetadata(t *testing.T) {
 		t.Fatalf("SaveWorkspaceMeta() error = %v", err)
 	}
 
-	r := &fakeRunner{}
-	if err := DestroyWorkspace(runtimeRoot, "main-a1b2", r); err != nil {
+	r := &fakeRunner{outputs: [][]byte{
+		infoPlist(infoImage("/images/base-1.sparsebundle", shadowPath, "/dev/disk13s1", mountpoint)),
+	}}
+	if err := DestroyWorkspace(t.Context(), runtimeRoot, "main-a1b2", r); err != nil {
 		t.Fatalf("DestroyWorkspace() error = %v", err)
 	}
 
-	if len(r.calls) != 1 {
-		t.Fatalf("expected one detach call, got %d", len(r.calls))
+	if len(r.calls) != 2 {
+		t.Fatalf("expected info and detach calls, got %d", len(r.calls))
 	}
-	if r.calls[0].name != "hdiutil" || r.calls[0].args[0] != "detach" {
-		t.Fatalf("expected hdiutil detach call, got %+v", r.calls[0])
+	if r.calls[1].name != "hdiutil" || strings.Join(r.calls[1].args, " ") != "detach /dev/disk13s1" {
+		t.Fatalf("expected hdiutil detach call, got %+v", r.calls[1])
 	}
 	if _, err := os.Stat(shadowPath); !os.IsNotExist(err) {
 		t.Fatalf("expected shadow file removed, stat err = %v", err)
@@ -141,3 +144,91 @@ func TestDestroyWorkspace_DetachesAndRemovesMetadata(t *testing.T) {
 		t.Fatalf("expected mountpoint removed, stat err = %v", err)
 	}
 }
+
+func TestDestroyWorkspace_SkipsDetachWhenNotAttached(t *testing.T) {
+	runtimeRoot := t.TempDir()
+	mountpoint := filepath.Join(t.TempDir(), "main-a1b2")
+	os.MkdirAll(mountpoint, 0755)
+	if err := SaveWorkspaceMeta(runtimeRoot, &WorkspaceMeta{
+		ID:         "main-a1b2",
+		Mountpoint: mountpoint,
+		Device:     "/dev/disk13s1",
+		ShadowPath: filepath.Join(runtimeRoot, "shadows", "main-a1b2.shadow"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// After a reboot, the stale device belongs to some other image.
+	r := &fakeRunner{outputs: [][]byte{
+		infoPlist(infoImage("/other.dmg", "", "/dev/disk13s1", "/Volumes/Other")),
+	}}
+	if err := DestroyWorkspace(t.Context(), runtimeRoot, "main-a1b2", r); err != nil {
+		t.Fatalf("DestroyWorkspace() error = %v", err)
+	}
+	for _, call := range r.calls {
+		if call.args[0] == "detach" {
+			t.Fatalf("detached %v, which is not the workspace", call.args)
+		}
+	}
+	if _, err := LoadWorkspaceMeta(runtimeRoot, "main-a1b2"); !os.IsNotExist(err) {
+		t.Fatalf("expected metadata removed, err = %v", err)
+	}
+}
+
+func TestRenameWorkspace_ReattachesUnderNewID(t *testing.T) {
+	runtimeRoot := t.TempDir()
+	dir := t.TempDir()
+	mountpoint := filepath.Join(dir, "main-a1b2")
+	shadowPath := filepath.Join(runtimeRoot, "shadows", "main-a1b2.shadow")
+	basePath := filepath.Join(runtimeRoot, "images", "base-3.sparsebundle")
+	os.MkdirAll(filepath.Dir(shadowPath), 0755)
+	os.WriteFile(shadowPath, []byte("shadow"), 0644)
+	os.MkdirAll(mountpoint, 0755)
+	if err := SaveWorkspaceMeta(runtimeRoot, &WorkspaceMeta{
+		ID:             "main-a1b2",
+		Mountpoint:     mountpoint,
+		Device:         "/dev/disk13s1",
+		ShadowPath:     shadowPath,
+		BaseGeneration: 3,
+		BasePath:       basePath,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	newPath := filepath.Join(dir, "feature-c3d4")
+	r := &fakeRunner{outputs: [][]byte{
+		infoPlist(infoImage(basePath, shadowPath, "/dev/disk13s1", mountpoint)),
+		nil,
+		attachPlist(newPath),
+	}}
+	meta, err := RenameWorkspace(t.Context(), runtimeRoot, "main-a1b2", "feature-c3d4", newPath, r)
+	if err != nil {
+		t.Fatalf("RenameWorkspace() error = %v", err)
+	}
+
+	newShadow := filepath.Join(runtimeRoot, "shadows", "feature-c3d4.shadow")
+	want := []string{
+		"info -plist",
+		"detach /dev/disk13s1",
+		"attach " + basePath + " -shadow " + newShadow + " -mountpoint " + newPath + " -nobrowse -plist",
+	}
+	var got []string
+	for _, call := range r.calls {
+		got = append(got, strings.Join(call.args, " "))
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("hdiutil calls = %q, want %q", got, want)
+	}
+	if meta.ID != "feature-c3d4" || meta.Mountpoint != newPath || meta.ShadowPath != newShadow || meta.BasePath != basePath {
+		t.Errorf("meta = %+v", meta)
+	}
+	if _, err := os.Stat(newShadow); err != nil {
+		t.Errorf("shadow was not renamed: %v", err)
+	}
+	if _, err := LoadWorkspaceMeta(runtimeRoot, "main-a1b2"); !os.IsNotExist(err) {
+		t.Errorf("meta under the old ID still exists: %v", err)
+	}
+	if _, err := os.Stat(mountpoint); !os.IsNotExist(err) {
+		t.Errorf("old mountpoint still exists: %v", err)
+	}
+}
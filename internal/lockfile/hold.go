@@ -0,0 +1,205 @@
+package lockfile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Holder describes a process holding a lock it took with Hold.
+type Holder struct {
+	PID     int       `json:"pid"`
+	Command string    `json:"command"`
+	Since   time.Time `json:"since"`
+	Shared  bool      `json:"shared,omitempty"`
+}
+
+func (h Holder) String() string {
+	return fmt.Sprintf("PID %d (%s), since %s", h.PID, h.Command, h.Since.Local().Format(time.DateTime))
+}
+
+// BusyError is returned by Hold when the lock is busy and waiting was not
+// allowed.
+type BusyError struct {
+	Holders []Holder
+}
+
+func (e *BusyError) Error() string {
+	if len(e.Holders) == 0 {
+		return "locked by another process"
+	}
+	holders := make([]string, len(e.Holders))
+	for i, h := range e.Holders {
+		holders[i] = h.String()
+	}
+	return "locked by " + strings.Join(holders, "; ")
+}
+
+// HoldOptions configures Hold.
+type HoldOptions struct {
+	Mode Mode
+	// NoWait makes Hold return a *BusyError rather than wait for a busy
+	// lock.
+	NoWait bool
+	// OnWait, if set, is called with the lock's holders when Hold starts
+	// waiting for it.
+	OnWait func([]Holder)
+}
+
+// pollInterval is how often Hold retries a busy lock.
+var pollInterval = 100 * time.Millisecond
+
+// Hold acquires the lock at path in opts.Mode, and records the calling
+// process as a holder so that others waiting for the lock can tell who
+// they are waiting for. It polls for a busy lock rather than blocking in
+// flock, so ctx can interrupt the wait.
+//
+// An exclusive holder waiting for the lock holds its intent lock until it
+// gets it, and new shared holders wait while the intent lock is held, so a
+// stream of overlapping shared holders can't keep it waiting forever.
+func Hold(ctx context.Context, path string, opts HoldOptions) (*Lock, error) {
+	try := func() (*Lock, error) { return tryHold(path, opts.Mode) }
+	l, err := try()
+	if errors.Is(err, ErrLocked) {
+		holders := Holders(path)
+		if opts.NoWait {
+			return nil, &BusyError{Holders: holders}
+		}
+		if opts.OnWait != nil {
+			opts.OnWait(holders)
+		}
+		if opts.Mode == Exclusive {
+			intent, err := poll(ctx, func() (*Lock, error) {
+				return acquire(intentPath(path), syscall.LOCK_EX|syscall.LOCK_NB)
+			})
+			if err != nil {
+				return nil, err
+			}
+			defer intent.Release()
+		}
+		l, err = poll(ctx, try)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if l.record, err = writeHolder(path, opts.Mode == Shared); err != nil {
+		l.Release()
+		return nil, fmt.Errorf("recording lock holder: %w", err)
+	}
+	return l, nil
+}
+
+// tryHold acquires the lock at path in mode without waiting. A shared lock
+// is refused while an exclusive holder is waiting for it.
+func tryHold(path string, mode Mode) (*Lock, error) {
+	if mode == Exclusive {
+		return acquire(path, syscall.LOCK_EX|syscall.LOCK_NB)
+	}
+	intent, err := acquire(intentPath(path), syscall.LOCK_SH|syscall.LOCK_NB)
+	if err != nil {
+		return nil, err
+	}
+	defer intent.Release()
+	return acquire(path, syscall.LOCK_SH|syscall.LOCK_NB)
+}
+
+// poll calls try every pollInterval for as long as it returns ErrLocked,
+// or until ctx is done.
+func poll(ctx context.Context, try func() (*Lock, error)) (*Lock, error) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+		l, err := try()
+		if !errors.Is(err, ErrLocked) {
+			return l, err
+		}
+	}
+}
+
+// Holders returns the holders recorded for the lock at path, oldest first.
+// Records left behind by processes that have since exited are removed.
+func Holders(path string) []Holder {
+	dir := holdersDir(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var holders []Holder
+	for _, entry := range entries {
+		record := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(record)
+		if err != nil {
+			continue
+		}
+		var h Holder
+		if err := json.Unmarshal(data, &h); err != nil {
+			// Still being written.
+			continue
+		}
+		if !alive(h.PID) {
+			os.Remove(record)
+			continue
+		}
+		holders = append(holders, h)
+	}
+	slices.SortFunc(holders, func(a, b Holder) int { return a.Since.Compare(b.Since) })
+	return holders
+}
+
+func holdersDir(path string) string {
+	return path + ".holders"
+}
+
+func intentPath(path string) string {
+	return path + ".intent"
+}
+
+func writeHolder(path string, shared bool) (string, error) {
+	dir := holdersDir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	h := Holder{PID: os.Getpid(), Command: command(), Since: time.Now(), Shared: shared}
+	data, err := json.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(dir, fmt.Sprintf("%d-*.json", h.PID))
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// command returns the calling process's command line, with the program
+// name shortened to its base name.
+func command() string {
+	args := append([]string{filepath.Base(os.Args[0])}, os.Args[1:]...)
+	return strings.Join(args, " ")
+}
+
+func alive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,157 @@
+package lockfile
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHold_SharedHoldersCoexist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golden.lock")
+	first, err := Hold(t.Context(), path, HoldOptions{Mode: Shared, NoWait: true})
+	if err != nil {
+		t.Fatalf("Hold() error = %v", err)
+	}
+	second, err := Hold(t.Context(), path, HoldOptions{Mode: Shared, NoWait: true})
+	if err != nil {
+		t.Fatalf("second shared Hold() error = %v", err)
+	}
+	if holders := Holders(path); len(holders) != 2 || !holders[0].Shared {
+		t.Errorf("Holders() = %+v, want 2 shared holders", holders)
+	}
+
+	_, err = Hold(t.Context(), path, HoldOptions{Mode: Exclusive, NoWait: true})
+	var busy *BusyError
+	if !errors.As(err, &busy) {
+		t.Fatalf("exclusive Hold() error = %v, want a *BusyError", err)
+	}
+	if len(busy.Holders) != 2 || busy.Holders[0].PID != os.Getpid() {
+		t.Errorf("BusyError holders = %+v, want this process twice", busy.Holders)
+	}
+	if !strings.Contains(err.Error(), "PID ") || !strings.Contains(err.Error(), "since ") {
+		t.Errorf("error = %q, want the holders' PIDs and start times", err)
+	}
+
+	first.Release()
+	second.Release()
+	if holders := Holders(path); len(holders) != 0 {
+		t.Errorf("Holders() after release = %+v, want none", holders)
+	}
+}
+
+func TestHold_WaitsForExclusiveHolder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golden.lock")
+	held, err := Hold(t.Context(), path, HoldOptions{Mode: Exclusive})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waited := make(chan []Holder, 1)
+	acquired := make(chan *Lock)
+	go func() {
+		l, err := Hold(t.Context(), path, HoldOptions{Mode: Shared, OnWait: func(h []Holder) { waited <- h }})
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- l
+	}()
+
+	select {
+	case holders := <-waited:
+		if len(holders) != 1 || holders[0].Shared {
+			t.Errorf("waited for %+v, want the exclusive holder", holders)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Hold() did not report waiting")
+	}
+	held.Release()
+	select {
+	case l := <-acquired:
+		l.Release()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Hold() did not return after the lock was released")
+	}
+}
+
+func TestHold_SharedHoldersQueueBehindWaitingExclusive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golden.lock")
+	shared, err := Hold(t.Context(), path, HoldOptions{Mode: Shared})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan *Lock)
+	go func() {
+		l, err := Hold(t.Context(), path, HoldOptions{Mode: Exclusive})
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- l
+	}()
+
+	// Once the exclusive holder is waiting, new shared holders wait too,
+	// although the lock is only held shared.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		l, err := Hold(t.Context(), path, HoldOptions{Mode: Shared, NoWait: true})
+		var busy *BusyError
+		if errors.As(err, &busy) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.Release()
+		if time.Now().After(deadline) {
+			t.Fatal("shared Hold() kept succeeding while an exclusive holder waited")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	shared.Release()
+	select {
+	case l := <-acquired:
+		l.Release()
+	case <-time.After(5 * time.Second):
+		t.Fatal("exclusive Hold() did not return after the shared holder left")
+	}
+	l, err := Hold(t.Context(), path, HoldOptions{Mode: Shared, NoWait: true})
+	if err != nil {
+		t.Fatalf("shared Hold() after the exclusive holder left error = %v", err)
+	}
+	l.Release()
+}
+
+func TestHold_StopsWaitingWhenCancelled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golden.lock")
+	held, err := Hold(t.Context(), path, HoldOptions{Mode: Exclusive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Release()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := Hold(ctx, path, HoldOptions{Mode: Exclusive}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Hold() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestHolders_RemovesRecordsOfExitedProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golden.lock")
+	dir := holdersDir(path)
+	os.MkdirAll(dir, 0755)
+	// PIDs are far below this limit on Linux and macOS.
+	os.WriteFile(filepath.Join(dir, "gone.json"), []byte(`{"pid":2147483647,"command":"grove update"}`), 0644)
+
+	if holders := Holders(path); len(holders) != 0 {
+		t.Errorf("Holders() = %+v, want none", holders)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gone.json")); !os.IsNotExist(err) {
+		t.Errorf("stale record should be removed: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+// Package lockfile provides advisory file locks that coordinate grove
+// processes. They are flock(2) locks, so the kernel releases them when the
+// holder exits, however it exits, and a crashed process never leaves a
+// lock behind.
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// ErrLocked is returned by TryAcquire when another holder has the lock.
+var ErrLocked = errors.New("locked")
+
+// Mode is how a lock is held: by one holder at a time, or shared by any
+// number of holders while no one holds it exclusively.
+type Mode int
+
+const (
+	Exclusive Mode = iota
+	Shared
+)
+
+// Lock is a held lock.
+type Lock struct {
+	f *os.File
+	// record is the holder record written by Hold, if any.
+	record string
+}
+
+// Acquire blocks until it holds an exclusive lock on the file at path,
+// creating the file and its directory if needed.
+func Acquire(path string) (*Lock, error) {
+	return acquire(path, syscall.LOCK_EX)
+}
+
+// TryAcquire is like Acquire, but returns ErrLocked rather than waiting
+// when the lock is held.
+func TryAcquire(path string) (*Lock, error) {
+	return acquire(path, syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+func acquire(path string, how int) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err = syscall.Flock(int(f.Fd()), how)
+		if !errors.Is(err, syscall.EINTR) {
+			break
+		}
+	}
+	if err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrLocked
+		}
+		return nil, fmt.Errorf("locking %s: %w", path, err)
+	}
+	return &Lock{f: f}, nil
+}
+
+// Release releases the lock. Releasing it again does nothing.
+func (l *Lock) Release() error {
+	if l.f == nil {
+		return nil
+	}
+	if l.record != "" {
+		os.Remove(l.record)
+	}
+	f := l.f
+	l.f = nil
+	return f.Close()
+}
@@ -0,0 +1,56 @@
+package lockfile
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTryAcquire_FailsWhileHeld(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locks", "create.lock")
+	held, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if _, err := TryAcquire(path); !errors.Is(err, ErrLocked) {
+		t.Fatalf("TryAcquire() error = %v, want ErrLocked", err)
+	}
+	if err := held.Release(); err != nil {
+		t.Fatal(err)
+	}
+	l, err := TryAcquire(path)
+	if err != nil {
+		t.Fatalf("TryAcquire() after release error = %v", err)
+	}
+	l.Release()
+}
+
+func TestAcquire_WaitsForRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "create.lock")
+	held, err := Acquire(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan *Lock)
+	go func() {
+		l, err := Acquire(path)
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- l
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Acquire() returned while the lock was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	held.Release()
+	select {
+	case l := <-acquired:
+		l.Release()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Acquire() did not return after the lock was released")
+	}
+}
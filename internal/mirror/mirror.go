@@ -0,0 +1,453 @@
+// Package mirror makes a destination tree a copy of a source tree, writing
+// only what changed and deleting what the source no longer has, much like
+// rsync -a --delete.
+//
+// Regular files, directories and symlinks are mirrored with their
+// permissions and, for files and directories, modification times. Ownership,
+// extended attributes and hard links are not preserved, and other kinds of
+// files are skipped.
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Options configures Tree.
+type Options struct {
+	// Exclude reports whether the entry at rel, slash-separated and
+	// relative to the source, is left out. Excluded entries are not copied
+	// and, if the destination has them, not deleted either. Nil leaves
+	// nothing out.
+	Exclude func(rel string, isDir bool) bool
+	// Checksum finds changed files by comparing the contents of files of
+	// the same size, rather than their modification times.
+	Checksum bool
+	// OnProgress, if set, is called as files are written.
+	OnProgress func(Progress)
+}
+
+// Progress reports how much of a Tree call's writing is done. The totals
+// are exact: they count only what differs between the trees.
+type Progress struct {
+	Files      int
+	FilesTotal int
+	Bytes      int64
+	BytesTotal int64
+}
+
+// Stats summarizes what Tree changed.
+type Stats struct {
+	// Written is the number of files and symlinks written, and Bytes the
+	// size of the files among them.
+	Written int
+	Bytes   int64
+	// Deleted is the number of entries removed from the destination,
+	// counting a directory and its contents once.
+	Deleted int
+}
+
+type entryMeta struct {
+	rel     string
+	mode    fs.FileMode
+	modTime time.Time
+	size    int64
+}
+
+type symlink struct {
+	rel    string
+	target string
+}
+
+// plan is what Tree has to do, worked out before anything is written.
+type plan struct {
+	deletes []string
+	mkdirs  []string
+	files   []entryMeta
+	links   []symlink
+	chmods  []entryMeta
+	// dirs are all mirrored directories, parents first, whose permissions
+	// and times are set once their contents are written.
+	dirs []entryMeta
+	// unlock are directories in dst that must be made writable for their
+	// contents to be written.
+	unlock []string
+	bytes  int64
+}
+
+// Tree mirrors src into dst, creating dst if needed. Entries that vanish
+// from src while Tree runs are skipped, as the source may be in use. If dst
+// is inside src, it is left out of the mirror.
+func Tree(ctx context.Context, src, dst string, opts Options) (Stats, error) {
+	m, err := newMirror(src, dst, opts)
+	if err != nil {
+		return Stats{}, err
+	}
+	root, err := os.Stat(src)
+	if err != nil {
+		return Stats{}, err
+	}
+	if !root.IsDir() {
+		return Stats{}, &fs.PathError{Op: "mirror", Path: src, Err: errors.New("not a directory")}
+	}
+	m.plan.dirs = append(m.plan.dirs, entryMeta{rel: ".", mode: root.Mode().Perm(), modTime: root.ModTime()})
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return Stats{}, err
+	}
+	if err := m.planDir(ctx, "."); err != nil {
+		return Stats{}, err
+	}
+	return m.execute(ctx)
+}
+
+type mirror struct {
+	src, dst string
+	opts     Options
+	// dstRel is where dst is inside src, or empty if it is not.
+	dstRel string
+	plan   plan
+
+	progress Progress
+	stats    Stats
+}
+
+func newMirror(src, dst string, opts Options) (*mirror, error) {
+	absSrc, err := filepath.Abs(src)
+	if err != nil {
+		return nil, err
+	}
+	absDst, err := filepath.Abs(dst)
+	if err != nil {
+		return nil, err
+	}
+	m := &mirror{src: absSrc, dst: absDst, opts: opts}
+	if rel, err := filepath.Rel(absSrc, absDst); err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		m.dstRel = filepath.ToSlash(rel)
+	}
+	return m, nil
+}
+
+func (m *mirror) excluded(rel string, isDir bool) bool {
+	if rel == m.dstRel {
+		return true
+	}
+	return m.opts.Exclude != nil && m.opts.Exclude(rel, isDir)
+}
+
+func (m *mirror) srcPath(rel string) string {
+	return filepath.Join(m.src, filepath.FromSlash(rel))
+}
+
+func (m *mirror) dstPath(rel string) string {
+	return filepath.Join(m.dst, filepath.FromSlash(rel))
+}
+
+// planDir compares the directory rel in src and dst, and everything under
+// it.
+func (m *mirror) planDir(ctx context.Context, rel string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	srcEntries, err := os.ReadDir(m.srcPath(rel))
+	if err != nil {
+		if vanished(err) && rel != "." {
+			return nil
+		}
+		return err
+	}
+	dstEntries := map[string]fs.DirEntry{}
+	if entries, err := os.ReadDir(m.dstPath(rel)); err == nil {
+		for _, e := range entries {
+			dstEntries[e.Name()] = e
+		}
+	} else if !vanished(err) && !isNotDir(err) {
+		return err
+	}
+
+	kept := map[string]bool{}
+	for _, e := range srcEntries {
+		childRel := path.Join(rel, e.Name())
+		info, err := e.Info()
+		if err != nil {
+			if vanished(err) {
+				continue
+			}
+			return err
+		}
+		if m.excluded(childRel, info.IsDir()) {
+			continue
+		}
+		var dstInfo fs.FileInfo
+		if de, ok := dstEntries[e.Name()]; ok {
+			if dstInfo, err = de.Info(); err != nil && !vanished(err) {
+				return err
+			}
+		}
+
+		switch {
+		case info.IsDir():
+			kept[e.Name()] = true
+			if dstInfo == nil || !dstInfo.IsDir() {
+				if dstInfo != nil {
+					m.plan.deletes = append(m.plan.deletes, childRel)
+				}
+				m.plan.mkdirs = append(m.plan.mkdirs, childRel)
+			} else if dstInfo.Mode().Perm()&0200 == 0 {
+				m.plan.unlock = append(m.plan.unlock, childRel)
+			}
+			m.plan.dirs = append(m.plan.dirs, entryMeta{rel: childRel, mode: info.Mode().Perm(), modTime: info.ModTime()})
+			if err := m.planDir(ctx, childRel); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			kept[e.Name()] = true
+			meta := entryMeta{rel: childRel, mode: info.Mode().Perm(), modTime: info.ModTime(), size: info.Size()}
+			same, err := m.sameFile(childRel, info, dstInfo)
+			if err != nil {
+				return err
+			}
+			switch {
+			case same && dstInfo.Mode().Perm() != meta.mode:
+				m.plan.chmods = append(m.plan.chmods, meta)
+			case !same:
+				if dstInfo != nil && dstInfo.IsDir() {
+					m.plan.deletes = append(m.plan.deletes, childRel)
+				}
+				m.plan.files = append(m.plan.files, meta)
+				m.plan.bytes += meta.size
+			}
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(m.srcPath(childRel))
+			if err != nil {
+				if vanished(err) {
+					continue
+				}
+				return err
+			}
+			kept[e.Name()] = true
+			if dstInfo != nil && dstInfo.Mode()&fs.ModeSymlink != 0 {
+				if current, err := os.Readlink(m.dstPath(childRel)); err == nil && current == target {
+					continue
+				}
+			}
+			if dstInfo != nil && dstInfo.IsDir() {
+				m.plan.deletes = append(m.plan.deletes, childRel)
+			}
+			m.plan.links = append(m.plan.links, symlink{rel: childRel, target: target})
+		}
+	}
+
+	for name, de := range dstEntries {
+		childRel := path.Join(rel, name)
+		if kept[name] || m.excluded(childRel, de.IsDir()) {
+			continue
+		}
+		m.plan.deletes = append(m.plan.deletes, childRel)
+	}
+	return nil
+}
+
+// sameFile reports whether the regular file rel, described by info, is
+// already in dst, described by dstInfo.
+func (m *mirror) sameFile(rel string, info, dstInfo fs.FileInfo) (bool, error) {
+	if dstInfo == nil || !dstInfo.Mode().IsRegular() || dstInfo.Size() != info.Size() {
+		return false, nil
+	}
+	if !m.opts.Checksum {
+		return dstInfo.ModTime().Equal(info.ModTime()), nil
+	}
+	srcSum, err := fileSum(m.srcPath(rel))
+	if err != nil {
+		if vanished(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	dstSum, err := fileSum(m.dstPath(rel))
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(srcSum, dstSum), nil
+}
+
+func fileSum(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func (m *mirror) execute(ctx context.Context) (Stats, error) {
+	p := &m.plan
+	m.progress = Progress{FilesTotal: len(p.files) + len(p.links), BytesTotal: p.bytes}
+	m.report()
+
+	for _, rel := range p.unlock {
+		if err := os.Chmod(m.dstPath(rel), 0700); err != nil {
+			return m.stats, err
+		}
+	}
+	for _, rel := range p.deletes {
+		if err := os.RemoveAll(m.dstPath(rel)); err != nil {
+			return m.stats, err
+		}
+		m.stats.Deleted++
+	}
+	for _, rel := range p.mkdirs {
+		if err := os.MkdirAll(m.dstPath(rel), 0755); err != nil {
+			return m.stats, err
+		}
+	}
+	for _, f := range p.files {
+		if err := ctx.Err(); err != nil {
+			return m.stats, err
+		}
+		done := m.progress.Bytes + f.size
+		if err := m.copyFile(ctx, f); err != nil {
+			return m.stats, err
+		}
+		// The file may have changed size since it was planned.
+		m.progress.Bytes = done
+		m.progress.Files++
+		m.report()
+	}
+	for _, l := range p.links {
+		if err := m.writeSymlink(l); err != nil {
+			return m.stats, err
+		}
+		m.stats.Written++
+		m.progress.Files++
+		m.report()
+	}
+	for _, f := range p.chmods {
+		if err := os.Chmod(m.dstPath(f.rel), f.mode); err != nil {
+			return m.stats, err
+		}
+	}
+	// Children first, since writing into a directory changes its time.
+	for i := len(p.dirs) - 1; i >= 0; i-- {
+		d := p.dirs[i]
+		if err := os.Chmod(m.dstPath(d.rel), d.mode); err != nil {
+			return m.stats, err
+		}
+		if err := os.Chtimes(m.dstPath(d.rel), d.modTime, d.modTime); err != nil {
+			return m.stats, err
+		}
+	}
+	return m.stats, nil
+}
+
+func (m *mirror) report() {
+	if m.opts.OnProgress != nil {
+		m.opts.OnProgress(m.progress)
+	}
+}
+
+// copyFile writes the file f into a temporary file next to its place in
+// dst, then renames it into place, so an interrupted copy never leaves a
+// partial file behind under the real name.
+func (m *mirror) copyFile(ctx context.Context, f entryMeta) (err error) {
+	in, err := os.Open(m.srcPath(f.rel))
+	if err != nil {
+		if vanished(err) {
+			return nil
+		}
+		return err
+	}
+	defer in.Close()
+
+	dstPath := m.dstPath(f.rel)
+	out, err := os.CreateTemp(filepath.Dir(dstPath), "."+filepath.Base(dstPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(out.Name())
+		}
+	}()
+
+	start := m.progress.Bytes
+	n, err := io.CopyBuffer(out, &progressReader{ctx: ctx, r: in, onRead: func(n int64) {
+		m.progress.Bytes = start + n
+		m.report()
+	}}, make([]byte, 1<<20))
+	if err != nil {
+		return err
+	}
+	if err := out.Chmod(f.mode); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Chtimes(out.Name(), f.modTime, f.modTime); err != nil {
+		return err
+	}
+	if err := os.Rename(out.Name(), dstPath); err != nil {
+		return err
+	}
+	m.stats.Written++
+	m.stats.Bytes += n
+	return nil
+}
+
+func (m *mirror) writeSymlink(l symlink) error {
+	dstPath := m.dstPath(l.rel)
+	tmp := filepath.Join(filepath.Dir(dstPath), "."+filepath.Base(dstPath)+".link.tmp")
+	_ = os.Remove(tmp)
+	if err := os.Symlink(l.target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dstPath); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// progressReader reports the running total read from r, and stops once
+// ctx is done.
+type progressReader struct {
+	ctx    context.Context
+	r      io.Reader
+	n      int64
+	onRead func(total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	if err := p.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.n += int64(n)
+		p.onRead(p.n)
+	}
+	return n, err
+}
+
+func vanished(err error) bool {
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+func isNotDir(err error) bool {
+	return errors.Is(err, syscall.ENOTDIR)
+}
@@ -0,0 +1,235 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for rel, data := range files {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestTree_CopiesTree(t *testing.T) {
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "dst")
+	writeTree(t, src, map[string]string{
+		"main.go":        "package main",
+		"a/b/c.txt":      "deep",
+		"scripts/run.sh": "#!/bin/sh",
+	})
+	os.Chmod(filepath.Join(src, "scripts", "run.sh"), 0755)
+	os.Symlink("a/b/c.txt", filepath.Join(src, "link"))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	os.Chtimes(filepath.Join(src, "main.go"), mtime, mtime)
+	os.Chtimes(filepath.Join(src, "a"), mtime, mtime)
+
+	stats, err := Tree(t.Context(), src, dst, Options{})
+	if err != nil {
+		t.Fatalf("Tree() error = %v", err)
+	}
+	if stats.Written != 4 || stats.Bytes != int64(len("package main")+len("deep")+len("#!/bin/sh")) {
+		t.Errorf("stats = %+v, want 4 entries written", stats)
+	}
+	if got := readFile(t, filepath.Join(dst, "a", "b", "c.txt")); got != "deep" {
+		t.Errorf("a/b/c.txt = %q", got)
+	}
+	if fi, _ := os.Stat(filepath.Join(dst, "scripts", "run.sh")); fi.Mode().Perm() != 0755 {
+		t.Errorf("run.sh mode = %v, want 0755", fi.Mode().Perm())
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "link")); err != nil || target != "a/b/c.txt" {
+		t.Errorf("link = %q, %v; want a/b/c.txt", target, err)
+	}
+	for _, rel := range []string{"main.go", "a"} {
+		if fi, _ := os.Stat(filepath.Join(dst, rel)); !fi.ModTime().Equal(mtime) {
+			t.Errorf("%s mtime = %v, want %v", rel, fi.ModTime(), mtime)
+		}
+	}
+}
+
+func TestTree_OnlyWritesChanges(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{"same.txt": "same", "changed.txt": "old", "grown.txt": "a"})
+	if _, err := Tree(t.Context(), src, dst, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	later := time.Now().Add(time.Hour)
+	os.WriteFile(filepath.Join(src, "changed.txt"), []byte("new"), 0644)
+	os.Chtimes(filepath.Join(src, "changed.txt"), later, later)
+	os.WriteFile(filepath.Join(src, "grown.txt"), []byte("abc"), 0644)
+	os.Chmod(filepath.Join(src, "same.txt"), 0600)
+
+	var last Progress
+	stats, err := Tree(t.Context(), src, dst, Options{OnProgress: func(p Progress) { last = p }})
+	if err != nil {
+		t.Fatalf("Tree() error = %v", err)
+	}
+	if stats.Written != 2 {
+		t.Errorf("wrote %d files, want the 2 that changed", stats.Written)
+	}
+	if last != (Progress{Files: 2, FilesTotal: 2, Bytes: 6, BytesTotal: 6}) {
+		t.Errorf("last progress = %+v, want 2 files and 6 bytes of 2 and 6", last)
+	}
+	if got := readFile(t, filepath.Join(dst, "changed.txt")); got != "new" {
+		t.Errorf("changed.txt = %q, want new", got)
+	}
+	if fi, _ := os.Stat(filepath.Join(dst, "same.txt")); fi.Mode().Perm() != 0600 {
+		t.Errorf("same.txt mode = %v, want the new 0600", fi.Mode().Perm())
+	}
+}
+
+func TestTree_ChecksumFindsSameSizeChanges(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{"f.txt": "aaaa"})
+	if _, err := Tree(t.Context(), src, dst, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	// Same size and time, different content.
+	fi, _ := os.Stat(filepath.Join(src, "f.txt"))
+	os.WriteFile(filepath.Join(src, "f.txt"), []byte("bbbb"), 0644)
+	os.Chtimes(filepath.Join(src, "f.txt"), fi.ModTime(), fi.ModTime())
+
+	if stats, err := Tree(t.Context(), src, dst, Options{}); err != nil || stats.Written != 0 {
+		t.Fatalf("Tree() = %+v, %v; want nothing written without checksums", stats, err)
+	}
+	if stats, err := Tree(t.Context(), src, dst, Options{Checksum: true}); err != nil || stats.Written != 1 {
+		t.Fatalf("Tree() = %+v, %v; want the file written with checksums", stats, err)
+	}
+	if got := readFile(t, filepath.Join(dst, "f.txt")); got != "bbbb" {
+		t.Errorf("f.txt = %q, want bbbb", got)
+	}
+}
+
+func TestTree_DeletesExtraneousButKeepsExcluded(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{"keep.txt": "k", "build/out.o": "o", "cache/x": "x"})
+	writeTree(t, dst, map[string]string{
+		"stale.txt":     "s",
+		"old/dir/f":     "f",
+		"cache/local":   "excluded in dst",
+		"build/stale.o": "s",
+	})
+
+	exclude := func(rel string, isDir bool) bool { return rel == "cache" && isDir }
+	stats, err := Tree(t.Context(), src, dst, Options{Exclude: exclude})
+	if err != nil {
+		t.Fatalf("Tree() error = %v", err)
+	}
+	for _, rel := range []string{"stale.txt", "old", "build/stale.o", "cache/x"} {
+		if _, err := os.Lstat(filepath.Join(dst, rel)); !os.IsNotExist(err) {
+			t.Errorf("%s should not be in dst: %v", rel, err)
+		}
+	}
+	for _, rel := range []string{"keep.txt", "build/out.o", "cache/local"} {
+		if _, err := os.Lstat(filepath.Join(dst, rel)); err != nil {
+			t.Errorf("%s should be in dst: %v", rel, err)
+		}
+	}
+	if stats.Deleted != 3 {
+		t.Errorf("deleted %d entries, want 3", stats.Deleted)
+	}
+}
+
+func TestTree_ReplacesChangedTypes(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{"was-dir": "file now", "was-file/f": "dir now"})
+	os.Symlink("target", filepath.Join(src, "was-link-dir"))
+	writeTree(t, dst, map[string]string{"was-dir/f": "old", "was-file": "old", "was-link-dir/f": "old"})
+
+	if _, err := Tree(t.Context(), src, dst, Options{}); err != nil {
+		t.Fatalf("Tree() error = %v", err)
+	}
+	if got := readFile(t, filepath.Join(dst, "was-dir")); got != "file now" {
+		t.Errorf("was-dir = %q", got)
+	}
+	if got := readFile(t, filepath.Join(dst, "was-file", "f")); got != "dir now" {
+		t.Errorf("was-file/f = %q", got)
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "was-link-dir")); err != nil || target != "target" {
+		t.Errorf("was-link-dir = %q, %v; want a link to target", target, err)
+	}
+}
+
+func TestTree_SkipsDestinationInsideSource(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"main.go": "package main"})
+	dst := filepath.Join(src, "mnt", "base")
+
+	if _, err := Tree(t.Context(), src, dst, Options{}); err != nil {
+		t.Fatalf("Tree() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "mnt", "base")); !os.IsNotExist(err) {
+		t.Errorf("dst was mirrored into itself: %v", err)
+	}
+	if got := readFile(t, filepath.Join(dst, "main.go")); got != "package main" {
+		t.Errorf("main.go = %q", got)
+	}
+}
+
+func TestTree_WritesIntoReadOnlyDirectories(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{"ro/f": "one"})
+	os.Chmod(filepath.Join(src, "ro"), 0555)
+	t.Cleanup(func() {
+		os.Chmod(filepath.Join(src, "ro"), 0755)
+		os.Chmod(filepath.Join(dst, "ro"), 0755)
+	})
+	if _, err := Tree(t.Context(), src, dst, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Chmod(filepath.Join(src, "ro"), 0755)
+	os.WriteFile(filepath.Join(src, "ro", "f"), []byte("two"), 0644)
+	os.Chmod(filepath.Join(src, "ro"), 0555)
+	if _, err := Tree(t.Context(), src, dst, Options{}); err != nil {
+		t.Fatalf("Tree() error = %v", err)
+	}
+	if got := readFile(t, filepath.Join(dst, "ro", "f")); got != "two" {
+		t.Errorf("ro/f = %q, want two", got)
+	}
+	if fi, _ := os.Stat(filepath.Join(dst, "ro")); fi.Mode().Perm() != 0555 {
+		t.Errorf("ro mode = %v, want 0555 restored", fi.Mode().Perm())
+	}
+}
+
+func TestTree_StopsWhenCancelled(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{"a": "a", "b": "b"})
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	if _, err := Tree(ctx, src, dst, Options{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Tree() error = %v, want context.Canceled", err)
+	}
+	entries, _ := os.ReadDir(dst)
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			t.Errorf("left temporary file %s behind", e.Name())
+		}
+	}
+}
@@ -0,0 +1,283 @@
+// Package overlay implements workspaces as overlay mounts on Linux.
+//
+// It is the Linux analogue of the image backend: RefreshBase materializes
+// the golden copy into a read-only lower layer, and each workspace is an
+// overlay of that layer with its own upper and work directories, so creating
+// one takes the same time however large the golden copy is. Lower layers are
+// numbered by generation; workspaces stay on the generation they were created
+// from, and a generation is removed once no workspace uses it.
+package overlay
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Drivers that mount overlays.
+const (
+	// DriverKernel mounts with the kernel's overlayfs, which needs
+	// privileges in the host mount namespace.
+	DriverKernel = "kernel"
+	// DriverUserNS mounts with the kernel's overlayfs in a user and mount
+	// namespace of its own, which needs no privileges. A holder process
+	// keeps the namespace alive, and the mountpoint is a symlink to the
+	// mount through the holder's /proc/<pid>/root.
+	DriverUserNS = "userns"
+	// DriverFUSE mounts with fuse-overlayfs, which works unprivileged.
+	DriverFUSE = "fuse"
+)
+
+// Runner executes external commands. Commands are killed if ctx is done
+// before they exit.
+type Runner interface {
+	CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+type execRunner struct{}
+
+func (execRunner) CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).CombinedOutput()
+}
+
+var (
+	geteuid       = os.Geteuid
+	mountInfoPath = "/proc/self/mountinfo"
+	procDir       = "/proc"
+)
+
+// holderScript mounts the overlay inside the namespace, then leaves a
+// holder process in its own session to keep the namespace alive once
+// unshare exits, and prints the holder's PID.
+const holderScript = `mount -t overlay overlay -o "$1" "$2" || exit
+setsid sleep infinity </dev/null >/dev/null 2>&1 &
+echo $!`
+
+// Mount mounts an overlay of lower and upper at mountpoint, and returns the
+// driver used. The kernel's overlayfs is tried first: directly when running
+// as root, otherwise in a user namespace. fuse-overlayfs is the fallback.
+func Mount(ctx context.Context, r Runner, lower, upper, work, mountpoint string) (string, error) {
+	opts := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", escapeOption(lower), escapeOption(upper), escapeOption(work))
+	driver := DriverKernel
+	var kernelErr error
+	if geteuid() == 0 {
+		kernelErr = run(ctx, r, "mount", "-t", "overlay", "overlay", "-o", opts, mountpoint)
+	} else {
+		driver = DriverUserNS
+		kernelErr = mountUserNS(ctx, r, opts, work, mountpoint)
+	}
+	if kernelErr == nil {
+		return driver, nil
+	}
+	if err := run(ctx, r, "fuse-overlayfs", "-o", opts, mountpoint); err != nil {
+		return "", fmt.Errorf("%w\n%w", kernelErr, err)
+	}
+	return DriverFUSE, nil
+}
+
+// Unmount unmounts an overlay mounted by driver.
+func Unmount(ctx context.Context, r Runner, driver, mountpoint string) error {
+	switch driver {
+	case DriverKernel:
+		return run(ctx, r, "umount", mountpoint)
+	case DriverUserNS:
+		return unmountUserNS(ctx, r, mountpoint)
+	}
+	err := run(ctx, r, "fusermount3", "-u", mountpoint)
+	if err != nil && run(ctx, r, "fusermount", "-u", mountpoint) == nil {
+		return nil
+	}
+	return err
+}
+
+// namespaceTarget is where an overlay with work directory work is mounted
+// inside its namespace.
+func namespaceTarget(work string) string {
+	return work + ".mnt"
+}
+
+// mountUserNS mounts an overlay in a namespace of its own, then replaces the
+// empty mountpoint directory with a symlink to it.
+func mountUserNS(ctx context.Context, r Runner, opts, work, mountpoint string) error {
+	target := namespaceTarget(work)
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+	pid, err := startHolder(ctx, r, opts, target)
+	if err != nil {
+		_ = os.Remove(target)
+		return err
+	}
+	if err := os.Remove(mountpoint); err == nil || errors.Is(err, fs.ErrNotExist) {
+		err = os.Symlink(holderPath(pid, target), mountpoint)
+	}
+	if err != nil {
+		_ = stopHolder(context.WithoutCancel(ctx), r, pid, target)
+		_ = os.Remove(target)
+		return err
+	}
+	return nil
+}
+
+// unmountUserNS stops the holder of the namespace mountpoint links into,
+// which unmounts the overlay, and puts back an empty mountpoint directory.
+func unmountUserNS(ctx context.Context, r Runner, mountpoint string) error {
+	pid, target, ok := namespaceHolder(mountpoint)
+	if !ok {
+		return fmt.Errorf("%s is not a namespace mount", mountpoint)
+	}
+	if err := stopHolder(ctx, r, pid, target); err != nil {
+		return err
+	}
+	if err := os.Remove(mountpoint); err != nil {
+		return err
+	}
+	if err := os.Mkdir(mountpoint, 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// startHolder mounts an overlay with opts at target in a new user and mount
+// namespace, and returns the PID of the process holding it.
+func startHolder(ctx context.Context, r Runner, opts, target string) (int, error) {
+	if r == nil {
+		r = execRunner{}
+	}
+	args := []string{"--user", "--map-root-user", "--mount", "--propagation", "private", "sh", "-c", holderScript, "sh", opts, target}
+	out, err := r.CombinedOutput(ctx, "unshare", args...)
+	if err != nil {
+		return 0, fmt.Errorf("unshare mount -t overlay failed: %w\n%s", err, strings.TrimSpace(string(out)))
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return 0, fmt.Errorf("unshare mount -t overlay: unexpected output %q", out)
+	}
+	return pid, nil
+}
+
+// stopHolder kills holder pid if it still has an overlay mounted at
+// target, and waits for the mount to go away with its namespace.
+func stopHolder(ctx context.Context, r Runner, pid int, target string) error {
+	if !holderMounted(pid, target) {
+		return nil
+	}
+	if err := run(ctx, r, "kill", "-KILL", strconv.Itoa(pid)); err != nil && holderMounted(pid, target) {
+		return err
+	}
+	for holderMounted(pid, target) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return nil
+}
+
+// holderPath is the path of target inside the namespace of holder pid.
+func holderPath(pid int, target string) string {
+	return filepath.Join(procDir, strconv.Itoa(pid), "root", target)
+}
+
+// holderMounted reports whether holder pid has an overlay mounted at
+// target. Once the holder has exited, or its PID belongs to another
+// process, it has not.
+func holderMounted(pid int, target string) bool {
+	mounted, err := mountedIn(filepath.Join(procDir, strconv.Itoa(pid), "mountinfo"), target)
+	return err == nil && mounted
+}
+
+// namespaceHolder returns the holder PID and the mount target inside its
+// namespace if mountpoint is a symlink made by mountUserNS.
+func namespaceHolder(mountpoint string) (int, string, bool) {
+	link, err := os.Readlink(mountpoint)
+	if err != nil {
+		return 0, "", false
+	}
+	rest, ok := strings.CutPrefix(link, procDir+string(filepath.Separator))
+	if !ok {
+		return 0, "", false
+	}
+	pidText, target, ok := strings.Cut(rest, string(filepath.Separator)+"root"+string(filepath.Separator))
+	pid, err := strconv.Atoi(pidText)
+	if !ok || err != nil {
+		return 0, "", false
+	}
+	return pid, string(filepath.Separator) + target, true
+}
+
+// Mounted reports whether something is mounted at path. For a namespace
+// mount, that is whether its holder still has the overlay mounted.
+func Mounted(path string) (bool, error) {
+	if pid, target, ok := namespaceHolder(path); ok {
+		return holderMounted(pid, target), nil
+	}
+	return mountedIn(mountInfoPath, path)
+}
+
+// mountedIn reports whether the mountinfo file lists path as a mount point.
+func mountedIn(mountInfo, path string) (bool, error) {
+	f, err := os.Open(mountInfo)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// The fifth field is the mount point, with spaces and other
+		// special characters octal-escaped.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 4 && unescapeMountInfo(fields[4]) == path {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// escapeOption escapes the characters overlay mount options use as
+// separators in a path.
+func escapeOption(path string) string {
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`, ":", `\:`).Replace(path)
+}
+
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			var c byte
+			if _, err := fmt.Sscanf(s[i+1:i+4], "%03o", &c); err == nil {
+				b.WriteByte(c)
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func run(ctx context.Context, r Runner, name string, args ...string) error {
+	if r == nil {
+		r = execRunner{}
+	}
+	out, err := r.CombinedOutput(ctx, name, args...)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w\n%s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,423 @@
+package overlay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/chrisbanes/grove/internal/image"
+)
+
+type fakeRunner struct {
+	commands []string
+	// fail makes commands starting with any of these prefixes fail.
+	fail []string
+}
+
+func (f *fakeRunner) CombinedOutput(_ context.Context, name string, args ...string) ([]byte, error) {
+	cmd := name + " " + strings.Join(args, " ")
+	f.commands = append(f.commands, cmd)
+	for _, prefix := range f.fail {
+		if strings.HasPrefix(cmd, prefix) {
+			return []byte(name + ": operation not permitted"), errors.New("exit status 1")
+		}
+	}
+	return nil, nil
+}
+
+func stubEUID(t *testing.T, euid int) {
+	t.Helper()
+	orig := geteuid
+	t.Cleanup(func() { geteuid = orig })
+	geteuid = func() int { return euid }
+}
+
+// nsRunner fakes unshare starting a namespace holder with PID pid, whose
+// mountinfo under procDir lists the overlay until the holder is killed.
+type nsRunner struct {
+	fakeRunner
+	pid int
+}
+
+func (r *nsRunner) CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if _, err := r.fakeRunner.CombinedOutput(ctx, name, args...); err != nil {
+		return nil, err
+	}
+	mountInfo := filepath.Join(procDir, strconv.Itoa(r.pid), "mountinfo")
+	switch name {
+	case "unshare":
+		target := args[len(args)-1]
+		os.MkdirAll(filepath.Dir(mountInfo), 0755)
+		line := fmt.Sprintf("20 1 0:1 / %s rw - overlay overlay rw\n", target)
+		return []byte(strconv.Itoa(r.pid) + "\n"), os.WriteFile(mountInfo, []byte(line), 0644)
+	case "kill":
+		return nil, os.Remove(mountInfo)
+	}
+	return nil, nil
+}
+
+func stubProcDir(t *testing.T) {
+	t.Helper()
+	orig := procDir
+	t.Cleanup(func() { procDir = orig })
+	procDir = t.TempDir()
+}
+
+// stubMountInfo makes paths the mount points in /proc/self/mountinfo.
+func stubMountInfo(t *testing.T, paths ...string) {
+	t.Helper()
+	var b strings.Builder
+	for i, p := range paths {
+		p = strings.ReplaceAll(p, " ", `\040`)
+		fmt.Fprintf(&b, "%d 1 0:%d / %s rw - overlay overlay rw\n", 20+i, i, p)
+	}
+	path := filepath.Join(t.TempDir(), "mountinfo")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	orig := mountInfoPath
+	t.Cleanup(func() { mountInfoPath = orig })
+	mountInfoPath = path
+}
+
+// syncFunc is an image.Syncer that calls itself.
+type syncFunc func(ctx context.Context, src, dst string, excludes []string, onProgress func(image.Progress)) error
+
+func (f syncFunc) Sync(ctx context.Context, src, dst string, excludes []string, onProgress func(image.Progress)) error {
+	return f(ctx, src, dst, excludes, onProgress)
+}
+
+// stubSync returns a syncer that writes *content to a file in the lower
+// layer, and makes seedLower copy the previous layer.
+func stubSync(t *testing.T, content *string) image.Syncer {
+	t.Helper()
+	origSeed := seedLower
+	t.Cleanup(func() { seedLower = origSeed })
+	seedLower = func(_ context.Context, prev, next string) error {
+		return os.CopyFS(next, os.DirFS(prev))
+	}
+	return syncFunc(func(_ context.Context, src, dst string, _ []string, _ func(image.Progress)) error {
+		return os.WriteFile(filepath.Join(dst, "content"), []byte(*content), 0644)
+	})
+}
+
+func TestMount_UsesKernelOverlayAsRoot(t *testing.T) {
+	stubEUID(t, 0)
+	r := &fakeRunner{}
+
+	driver, err := Mount(t.Context(), r, "/l", "/u", "/w", "/mnt/ws")
+	if err != nil {
+		t.Fatalf("Mount() error = %v", err)
+	}
+	if driver != DriverKernel {
+		t.Errorf("driver = %q, want %q", driver, DriverKernel)
+	}
+	want := []string{"mount -t overlay overlay -o lowerdir=/l,upperdir=/u,workdir=/w /mnt/ws"}
+	if !slices.Equal(r.commands, want) {
+		t.Errorf("commands = %q, want %q", r.commands, want)
+	}
+}
+
+func TestMount_FallsBackToFUSE(t *testing.T) {
+	stubEUID(t, 0)
+	r := &fakeRunner{fail: []string{"mount "}}
+
+	driver, err := Mount(t.Context(), r, "/l", "/u", "/w", "/mnt/ws")
+	if err != nil {
+		t.Fatalf("Mount() error = %v", err)
+	}
+	if driver != DriverFUSE {
+		t.Errorf("driver = %q, want %q", driver, DriverFUSE)
+	}
+	if got := r.commands[len(r.commands)-1]; got != "fuse-overlayfs -o lowerdir=/l,upperdir=/u,workdir=/w /mnt/ws" {
+		t.Errorf("last command = %q", got)
+	}
+}
+
+func TestMount_UnprivilegedUsesUserNamespace(t *testing.T) {
+	stubEUID(t, 1000)
+	stubProcDir(t)
+	r := &nsRunner{pid: 4242}
+	dir := t.TempDir()
+	work, mountpoint := filepath.Join(dir, "work"), filepath.Join(dir, "ws")
+	os.Mkdir(mountpoint, 0755)
+
+	driver, err := Mount(t.Context(), r, "/l", "/u", work, mountpoint)
+	if err != nil {
+		t.Fatalf("Mount() error = %v", err)
+	}
+	if driver != DriverUserNS {
+		t.Errorf("driver = %q, want %q", driver, DriverUserNS)
+	}
+	want := "unshare --user --map-root-user --mount --propagation private sh -c " + holderScript + " sh lowerdir=/l,upperdir=/u,workdir=" + work + " " + work + ".mnt"
+	if !slices.Equal(r.commands, []string{want}) {
+		t.Errorf("commands = %q, want %q", r.commands, want)
+	}
+	link, err := os.Readlink(mountpoint)
+	if want := filepath.Join(procDir, "4242", "root", work+".mnt"); err != nil || link != want {
+		t.Errorf("mountpoint -> %q, %v; want %q", link, err, want)
+	}
+	if mounted, err := Mounted(mountpoint); err != nil || !mounted {
+		t.Errorf("Mounted() = %v, %v; want true", mounted, err)
+	}
+}
+
+func TestUnmount_UserNamespaceStopsHolder(t *testing.T) {
+	stubEUID(t, 1000)
+	stubProcDir(t)
+	r := &nsRunner{pid: 4242}
+	dir := t.TempDir()
+	work, mountpoint := filepath.Join(dir, "work"), filepath.Join(dir, "ws")
+	os.Mkdir(mountpoint, 0755)
+	if _, err := Mount(t.Context(), r, "/l", "/u", work, mountpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Unmount(t.Context(), r, DriverUserNS, mountpoint); err != nil {
+		t.Fatalf("Unmount() error = %v", err)
+	}
+	if got := r.commands[len(r.commands)-1]; got != "kill -KILL 4242" {
+		t.Errorf("last command = %q, want the holder killed", got)
+	}
+	if info, err := os.Lstat(mountpoint); err != nil || !info.IsDir() {
+		t.Errorf("mountpoint should be an empty directory again: %v", err)
+	}
+	if _, err := os.Stat(work + ".mnt"); !os.IsNotExist(err) {
+		t.Errorf("namespace mount target still exists: %v", err)
+	}
+	if mounted, _ := Mounted(mountpoint); mounted {
+		t.Error("Mounted() = true after unmount")
+	}
+}
+
+func TestMounted_UserNamespaceHolderGone(t *testing.T) {
+	stubProcDir(t)
+	mountpoint := filepath.Join(t.TempDir(), "ws")
+	// Left behind by a holder that did not survive a reboot.
+	os.Symlink(filepath.Join(procDir, "4242", "root", "/state/work/ws.mnt"), mountpoint)
+
+	if mounted, err := Mounted(mountpoint); err != nil || mounted {
+		t.Errorf("Mounted() = %v, %v; want false", mounted, err)
+	}
+}
+
+func TestMount_UnprivilegedFallsBackToFUSE(t *testing.T) {
+	stubEUID(t, 1000)
+	r := &fakeRunner{fail: []string{"unshare", "fuse-overlayfs"}}
+	dir := t.TempDir()
+
+	_, err := Mount(t.Context(), r, "/l,x", "/u", filepath.Join(dir, "w"), "/mnt/ws")
+	if err == nil || !strings.Contains(err.Error(), "unshare") || !strings.Contains(err.Error(), "fuse-overlayfs") {
+		t.Fatalf("Mount() error = %v, want the unshare and fuse-overlayfs failures", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "w.mnt")); !os.IsNotExist(err) {
+		t.Errorf("namespace mount target left behind: %v", err)
+	}
+	want := `fuse-overlayfs -o lowerdir=/l\,x,upperdir=/u,workdir=` + filepath.Join(dir, "w") + " /mnt/ws"
+	if got := r.commands[len(r.commands)-1]; got != want {
+		t.Errorf("last command = %q, want %q", got, want)
+	}
+}
+
+func TestMounted(t *testing.T) {
+	stubMountInfo(t, "/", "/home/me/grove workspaces/ws")
+
+	for path, want := range map[string]bool{
+		"/home/me/grove workspaces/ws": true,
+		"/home/me":                     false,
+	} {
+		got, err := Mounted(path)
+		if err != nil {
+			t.Fatalf("Mounted(%q) error = %v", path, err)
+		}
+		if got != want {
+			t.Errorf("Mounted(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestRefreshBase_CreatesGenerations(t *testing.T) {
+	runtimeRoot := t.TempDir()
+	content := "one"
+	sync := stubSync(t, &content)
+
+	first, err := RefreshBase(t.Context(), runtimeRoot, t.TempDir(), sync, "aaa", nil, nil)
+	if err != nil {
+		t.Fatalf("RefreshBase() error = %v", err)
+	}
+	if first.BaseGeneration != 1 || first.BasePath != lowerPath(runtimeRoot, 1) {
+		t.Errorf("state = %+v", first)
+	}
+
+	content = "two"
+	second, err := RefreshBase(t.Context(), runtimeRoot, t.TempDir(), sync, "bbb", nil, nil)
+	if err != nil {
+		t.Fatalf("RefreshBase() error = %v", err)
+	}
+	if second.BaseGeneration != 2 {
+		t.Errorf("generation = %d, want 2", second.BaseGeneration)
+	}
+	if got, _ := os.ReadFile(filepath.Join(second.BasePath, "content")); string(got) != "two" {
+		t.Errorf("lower layer content = %q, want two", got)
+	}
+	if _, err := os.Stat(first.BasePath); !os.IsNotExist(err) {
+		t.Errorf("unused generation 1 was not removed: %v", err)
+	}
+	loaded, err := LoadState(runtimeRoot)
+	if err != nil || loaded.BaseGeneration != 2 || loaded.LastSyncCommit != "bbb" {
+		t.Errorf("LoadState() = %+v, %v", loaded, err)
+	}
+}
+
+func TestRefreshBase_SyncFailureKeepsCurrentGeneration(t *testing.T) {
+	runtimeRoot := t.TempDir()
+	content := "one"
+	sync := stubSync(t, &content)
+	if _, err := RefreshBase(t.Context(), runtimeRoot, t.TempDir(), sync, "aaa", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	failing := syncFunc(func(context.Context, string, string, []string, func(image.Progress)) error {
+		return errors.New("rsync failed")
+	})
+	if _, err := RefreshBase(t.Context(), runtimeRoot, t.TempDir(), failing, "bbb", nil, nil); err == nil {
+		t.Fatal("expected RefreshBase() to fail")
+	}
+	st, err := LoadState(runtimeRoot)
+	if err != nil || st.BaseGeneration != 1 {
+		t.Errorf("LoadState() = %+v, %v, want generation 1", st, err)
+	}
+	if _, err := os.Stat(lowerPath(runtimeRoot, 2)); !os.IsNotExist(err) {
+		t.Errorf("partial generation 2 was left behind: %v", err)
+	}
+}
+
+func TestWorkspaceLifecycle_PinsGeneration(t *testing.T) {
+	stubEUID(t, 1000)
+	runtimeRoot := t.TempDir()
+	wsPath := filepath.Join(t.TempDir(), "ws-1")
+	content := "one"
+	sync := stubSync(t, &content)
+	// Without user namespaces, overlays are mounted with FUSE.
+	r := &fakeRunner{fail: []string{"unshare"}}
+
+	st, err := RefreshBase(t.Context(), runtimeRoot, t.TempDir(), sync, "aaa", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := CreateWorkspace(t.Context(), runtimeRoot, wsPath, "ws-1", st, r)
+	if err != nil {
+		t.Fatalf("CreateWorkspace() error = %v", err)
+	}
+	if meta.Driver != DriverFUSE || meta.BaseGeneration != 1 || meta.LowerPath != st.BasePath {
+		t.Errorf("meta = %+v", meta)
+	}
+	for _, dir := range []string{meta.UpperPath, meta.WorkPath, wsPath} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("missing %s: %v", dir, err)
+		}
+	}
+
+	content = "two"
+	if _, err := RefreshBase(t.Context(), runtimeRoot, t.TempDir(), sync, "bbb", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(meta.LowerPath); err != nil {
+		t.Fatalf("generation 1 was removed while ws-1 uses it: %v", err)
+	}
+
+	stubMountInfo(t, wsPath)
+	if err := DestroyWorkspace(t.Context(), runtimeRoot, "ws-1", r); err != nil {
+		t.Fatalf("DestroyWorkspace() error = %v", err)
+	}
+	if got := r.commands[len(r.commands)-1]; got != "fusermount3 -u "+wsPath {
+		t.Errorf("last command = %q, want an unmount", got)
+	}
+	for _, dir := range []string{meta.UpperPath, meta.WorkPath, wsPath, meta.LowerPath} {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("%s still exists after destroy: %v", dir, err)
+		}
+	}
+	if _, err := LoadWorkspaceMeta(runtimeRoot, "ws-1"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("workspace meta still exists: %v", err)
+	}
+}
+
+func TestDestroyWorkspace_NotMounted(t *testing.T) {
+	stubEUID(t, 1000)
+	stubMountInfo(t, "/")
+	runtimeRoot := t.TempDir()
+	content := "one"
+	sync := stubSync(t, &content)
+	// Without user namespaces, overlays are mounted with FUSE.
+	r := &fakeRunner{fail: []string{"unshare"}}
+	st, err := RefreshBase(t.Context(), runtimeRoot, t.TempDir(), sync, "aaa", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateWorkspace(t.Context(), runtimeRoot, filepath.Join(t.TempDir(), "ws-1"), "ws-1", st, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DestroyWorkspace(t.Context(), runtimeRoot, "ws-1", r); err != nil {
+		t.Fatalf("DestroyWorkspace() error = %v", err)
+	}
+	if len(r.commands) != 2 {
+		t.Errorf("expected no unmount for a workspace that is not mounted, got %q", r.commands)
+	}
+}
+
+func TestRenameWorkspace(t *testing.T) {
+	stubEUID(t, 1000)
+	runtimeRoot := t.TempDir()
+	dir := t.TempDir()
+	wsPath := filepath.Join(dir, "ws-1")
+	content := "one"
+	sync := stubSync(t, &content)
+	// Without user namespaces, overlays are mounted with FUSE.
+	r := &fakeRunner{fail: []string{"unshare"}}
+	st, err := RefreshBase(t.Context(), runtimeRoot, t.TempDir(), sync, "aaa", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := CreateWorkspace(t.Context(), runtimeRoot, wsPath, "ws-1", st, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(old.UpperPath, "changed"), []byte("x"), 0644)
+
+	stubMountInfo(t, wsPath)
+	newPath := filepath.Join(dir, "feature-2")
+	meta, err := RenameWorkspace(t.Context(), runtimeRoot, "ws-1", "feature-2", newPath, r)
+	if err != nil {
+		t.Fatalf("RenameWorkspace() error = %v", err)
+	}
+	want := []string{
+		"fusermount3 -u " + wsPath,
+		"unshare --user --map-root-user --mount --propagation private sh -c " + holderScript + " sh lowerdir=" + st.BasePath + ",upperdir=" + meta.UpperPath + ",workdir=" + meta.WorkPath + " " + meta.WorkPath + ".mnt",
+		"fuse-overlayfs -o lowerdir=" + st.BasePath + ",upperdir=" + meta.UpperPath + ",workdir=" + meta.WorkPath + " " + newPath,
+	}
+	if got := r.commands[len(r.commands)-3:]; !slices.Equal(got, want) {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+	if meta.ID != "feature-2" || meta.Mountpoint != newPath || meta.LowerPath != st.BasePath {
+		t.Errorf("meta = %+v", meta)
+	}
+	if _, err := os.Stat(filepath.Join(meta.UpperPath, "changed")); err != nil {
+		t.Errorf("upper layer was not moved: %v", err)
+	}
+	for _, path := range []string{old.UpperPath, old.WorkPath, wsPath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s still exists after rename: %v", path, err)
+		}
+	}
+	if _, err := LoadWorkspaceMeta(runtimeRoot, "ws-1"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("meta under the old ID still exists: %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package overlay
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// State stores overlay backend metadata for a golden copy.
+type State struct {
+	Backend string `json:"backend"`
+	// BasePath is the lower layer of the current generation.
+	BasePath       string `json:"base_path"`
+	BaseGeneration int    `json:"base_generation"`
+	LastSyncCommit string `json:"last_sync_commit,omitempty"`
+}
+
+// WorkspaceMeta stores overlay metadata for a workspace.
+type WorkspaceMeta struct {
+	ID             string    `json:"id"`
+	Mountpoint     string    `json:"mountpoint"`
+	Driver         string    `json:"driver"`
+	LowerPath      string    `json:"lower_path"`
+	UpperPath      string    `json:"upper_path"`
+	WorkPath       string    `json:"work_path"`
+	BaseGeneration int       `json:"base_generation"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func LoadState(runtimeRoot string) (*State, error) {
+	data, err := os.ReadFile(stateFilePath(runtimeRoot))
+	if err != nil {
+		return nil, err
+	}
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func SaveState(runtimeRoot string, st *State) error {
+	if err := os.MkdirAll(overlayDir(runtimeRoot), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(stateFilePath(runtimeRoot), data, 0644)
+}
+
+func SaveWorkspaceMeta(runtimeRoot string, meta *WorkspaceMeta) error {
+	if err := os.MkdirAll(workspacesDir(runtimeRoot), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(workspaceMetaPath(runtimeRoot, meta.ID), data, 0644)
+}
+
+func LoadWorkspaceMeta(runtimeRoot, id string) (*WorkspaceMeta, error) {
+	data, err := os.ReadFile(workspaceMetaPath(runtimeRoot, id))
+	if err != nil {
+		return nil, err
+	}
+	var meta WorkspaceMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+func ListWorkspaceMeta(runtimeRoot string) ([]WorkspaceMeta, error) {
+	entries, err := os.ReadDir(workspacesDir(runtimeRoot))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	out := make([]WorkspaceMeta, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		meta, err := LoadWorkspaceMeta(runtimeRoot, strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *meta)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+func DeleteWorkspaceMeta(runtimeRoot, id string) error {
+	err := os.Remove(workspaceMetaPath(runtimeRoot, id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func overlayDir(runtimeRoot string) string {
+	return filepath.Join(runtimeRoot, "overlay")
+}
+
+func stateFilePath(runtimeRoot string) string {
+	return filepath.Join(overlayDir(runtimeRoot), "state.json")
+}
+
+func lowersDir(runtimeRoot string) string {
+	return filepath.Join(overlayDir(runtimeRoot), "lower")
+}
+
+func lowerPath(runtimeRoot string, generation int) string {
+	return filepath.Join(lowersDir(runtimeRoot), strconv.Itoa(generation))
+}
+
+func upperPath(runtimeRoot, id string) string {
+	return filepath.Join(overlayDir(runtimeRoot), "upper", id)
+}
+
+func workPath(runtimeRoot, id string) string {
+	return filepath.Join(overlayDir(runtimeRoot), "work", id)
+}
+
+// workspacesDir is separate from the image backend's, whose metadata marks
+// a workspace as image-backed.
+func workspacesDir(runtimeRoot string) string {
+	return filepath.Join(overlayDir(runtimeRoot), "workspaces")
+}
+
+func workspaceMetaPath(runtimeRoot, id string) string {
+	return filepath.Join(workspacesDir(runtimeRoot), id+".json")
+}
@@ -0,0 +1,244 @@
+package overlay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/chrisbanes/grove/internal/clone"
+	"github.com/chrisbanes/grove/internal/image"
+)
+
+// seedLower copies the previous lower layer into a new one, so the sync
+// only transfers what changed. It only succeeds where copy-on-write clones
+// are supported; elsewhere the sync copies everything.
+var seedLower = func(ctx context.Context, prev, next string) error {
+	cloner, err := clone.NewCloner(prev)
+	if err != nil {
+		return err
+	}
+	return cloner.Clone(ctx, prev, next)
+}
+
+// RefreshBase materializes the golden copy, minus excludes, into the lower
+// layer of a new generation with syncer. Workspaces on older generations keep theirs;
+// generations nothing uses any more are removed.
+func RefreshBase(ctx context.Context, runtimeRoot, goldenRoot string, syncer image.Syncer, commit string, excludes []string, onProgress func(image.Progress)) (*State, error) {
+	prev, err := LoadState(runtimeRoot)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	generation := 1
+	if prev != nil {
+		generation = prev.BaseGeneration + 1
+	}
+
+	next := lowerPath(runtimeRoot, generation)
+	// Left over from an interrupted refresh.
+	if err := os.RemoveAll(next); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(lowersDir(runtimeRoot), 0755); err != nil {
+		return nil, err
+	}
+	if prev == nil || seedLower(ctx, prev.BasePath, next) != nil {
+		if err := os.RemoveAll(next); err != nil {
+			return nil, err
+		}
+		if err := os.Mkdir(next, 0755); err != nil {
+			return nil, err
+		}
+	}
+	if err := syncer.Sync(ctx, goldenRoot, next, excludes, onProgress); err != nil {
+		_ = os.RemoveAll(next)
+		return nil, fmt.Errorf("syncing lower layer: %w", err)
+	}
+
+	st := &State{
+		Backend:        "overlay",
+		BasePath:       next,
+		BaseGeneration: generation,
+		LastSyncCommit: commit,
+	}
+	if err := SaveState(runtimeRoot, st); err != nil {
+		_ = os.RemoveAll(next)
+		return nil, err
+	}
+	if err := GCGenerations(runtimeRoot, st); err != nil {
+		return nil, fmt.Errorf("removing old lower layers: %w", err)
+	}
+	return st, nil
+}
+
+// CreateWorkspace mounts an overlay of the current lower layer at
+// workspacePath.
+func CreateWorkspace(ctx context.Context, runtimeRoot, workspacePath, workspaceID string, st *State, r Runner) (*WorkspaceMeta, error) {
+	if st.BasePath == "" {
+		return nil, fmt.Errorf("overlay backend state missing base_path")
+	}
+	meta := &WorkspaceMeta{
+		ID:             workspaceID,
+		Mountpoint:     workspacePath,
+		LowerPath:      st.BasePath,
+		UpperPath:      upperPath(runtimeRoot, workspaceID),
+		WorkPath:       workPath(runtimeRoot, workspaceID),
+		BaseGeneration: st.BaseGeneration,
+		CreatedAt:      time.Now().UTC(),
+	}
+	for _, dir := range []string{meta.UpperPath, meta.WorkPath, workspacePath} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			_ = removeWorkspaceDirs(meta)
+			return nil, err
+		}
+	}
+
+	driver, err := Mount(ctx, r, meta.LowerPath, meta.UpperPath, meta.WorkPath, workspacePath)
+	if err != nil {
+		_ = removeWorkspaceDirs(meta)
+		return nil, err
+	}
+	meta.Driver = driver
+	if err := SaveWorkspaceMeta(runtimeRoot, meta); err != nil {
+		_ = Unmount(context.WithoutCancel(ctx), r, driver, workspacePath)
+		_ = removeWorkspaceDirs(meta)
+		return nil, err
+	}
+	return meta, nil
+}
+
+// DestroyWorkspace unmounts the workspace, removes its upper layer and
+// metadata, then removes lower layers nothing uses any more. A workspace
+// that is no longer mounted, e.g. after a reboot, is removed all the same.
+func DestroyWorkspace(ctx context.Context, runtimeRoot, workspaceID string, r Runner) error {
+	meta, err := LoadWorkspaceMeta(runtimeRoot, workspaceID)
+	if err != nil {
+		return err
+	}
+	mounted, err := Mounted(meta.Mountpoint)
+	if err != nil {
+		return err
+	}
+	if mounted {
+		if err := Unmount(ctx, r, meta.Driver, meta.Mountpoint); err != nil {
+			return err
+		}
+	}
+	if err := removeWorkspaceDirs(meta); err != nil {
+		return err
+	}
+	if err := DeleteWorkspaceMeta(runtimeRoot, workspaceID); err != nil {
+		return err
+	}
+
+	st, err := LoadState(runtimeRoot)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return GCGenerations(runtimeRoot, st)
+}
+
+// RenameWorkspace gives the workspace workspaceID the ID newID, moving its
+// upper layer and mounting it at workspacePath instead.
+func RenameWorkspace(ctx context.Context, runtimeRoot, workspaceID, newID, workspacePath string, r Runner) (*WorkspaceMeta, error) {
+	meta, err := LoadWorkspaceMeta(runtimeRoot, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	mounted, err := Mounted(meta.Mountpoint)
+	if err != nil {
+		return nil, err
+	}
+	if mounted {
+		if err := Unmount(ctx, r, meta.Driver, meta.Mountpoint); err != nil {
+			return nil, err
+		}
+	}
+
+	renamed := *meta
+	renamed.ID = newID
+	renamed.Mountpoint = workspacePath
+	renamed.UpperPath = upperPath(runtimeRoot, newID)
+	renamed.WorkPath = workPath(runtimeRoot, newID)
+	moves := [][2]string{
+		{meta.UpperPath, renamed.UpperPath},
+		{meta.WorkPath, renamed.WorkPath},
+		{meta.Mountpoint, renamed.Mountpoint},
+	}
+	for _, move := range moves {
+		if err := os.Rename(move[0], move[1]); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.Remove(namespaceTarget(meta.WorkPath)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err := SaveWorkspaceMeta(runtimeRoot, &renamed); err != nil {
+		return nil, err
+	}
+	if err := DeleteWorkspaceMeta(runtimeRoot, workspaceID); err != nil {
+		return nil, err
+	}
+
+	driver, err := Mount(ctx, r, renamed.LowerPath, renamed.UpperPath, renamed.WorkPath, renamed.Mountpoint)
+	if err != nil {
+		return nil, err
+	}
+	renamed.Driver = driver
+	if err := SaveWorkspaceMeta(runtimeRoot, &renamed); err != nil {
+		_ = Unmount(context.WithoutCancel(ctx), r, driver, renamed.Mountpoint)
+		return nil, err
+	}
+	return &renamed, nil
+}
+
+// GCGenerations removes lower layers other than the current one that no
+// workspace was created from.
+func GCGenerations(runtimeRoot string, st *State) error {
+	metas, err := ListWorkspaceMeta(runtimeRoot)
+	if err != nil {
+		return err
+	}
+	referenced := map[int]bool{st.BaseGeneration: true}
+	for _, meta := range metas {
+		referenced[meta.BaseGeneration] = true
+	}
+
+	entries, err := os.ReadDir(lowersDir(runtimeRoot))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		generation, err := strconv.Atoi(entry.Name())
+		if err != nil || referenced[generation] {
+			continue
+		}
+		if err := os.RemoveAll(lowerPath(runtimeRoot, generation)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeWorkspaceDirs removes the workspace's upper and work directories,
+// any namespace mount target left by a holder that is gone, and its now
+// empty mountpoint.
+func removeWorkspaceDirs(meta *WorkspaceMeta) error {
+	for _, dir := range []string{meta.UpperPath, meta.WorkPath, namespaceTarget(meta.WorkPath)} {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(meta.Mountpoint); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/chrisbanes/grove/internal/config"
+)
+
+// ErrClaimed is returned by Claim when the workspace is no longer pooled,
+// usually because another grove process claimed it first.
+var ErrClaimed = errors.New("workspace already claimed")
+
+// ListPool returns the pooled workspaces in the configured workspace
+// directory.
+func ListPool(cfg *config.Config) ([]Info, error) {
+	entries, err := os.ReadDir(cfg.WorkspaceDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var pooled []Info
+	for _, entry := range entries {
+		if !mayBeWorkspace(entry) {
+			continue
+		}
+		wsPath := filepath.Join(cfg.WorkspaceDir, entry.Name())
+		info, err := readInfo(filepath.Join(wsPath, config.GroveDirName, config.PoolFile))
+		if err != nil {
+			continue // not pooled
+		}
+		info.Path = wsPath
+		pooled = append(pooled, *info)
+	}
+	return pooled, nil
+}
+
+// AddToPool moves the ready workspace at wsPath into the pool. Its marker
+// moves to .grove/pool.json, so List and Get don't see it until it is
+// claimed.
+func AddToPool(wsPath string) error {
+	groveDir := filepath.Join(wsPath, config.GroveDirName)
+	return os.Rename(filepath.Join(groveDir, config.WorkspaceFile), filepath.Join(groveDir, config.PoolFile))
+}
+
+// Claim takes the pooled workspace id out of the pool and returns it as an
+// ordinary workspace. Claiming renames the pool marker back to the
+// workspace marker, so when several processes claim the same workspace
+// exactly one succeeds and the rest get ErrClaimed.
+func Claim(cfg *config.Config, id string) (*Info, error) {
+	wsPath := filepath.Join(cfg.WorkspaceDir, id)
+	groveDir := filepath.Join(wsPath, config.GroveDirName)
+	if err := os.Rename(filepath.Join(groveDir, config.PoolFile), filepath.Join(groveDir, config.WorkspaceFile)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrClaimed
+		}
+		return nil, fmt.Errorf("claiming pooled workspace %s: %w", id, err)
+	}
+	info, err := readMarker(wsPath)
+	if err != nil {
+		return nil, err
+	}
+	info.Path = wsPath
+	return info, nil
+}
+
+// Rename moves the workspace id to newID within the workspace directory and
+// rewrites its marker to match.
+func Rename(cfg *config.Config, id, newID string) (*Info, error) {
+	newPath := filepath.Join(cfg.WorkspaceDir, newID)
+	if err := os.Rename(filepath.Join(cfg.WorkspaceDir, id), newPath); err != nil {
+		return nil, err
+	}
+	return Relabel(newPath, newID)
+}
+
+// Relabel rewrites the marker of a workspace that has been moved to wsPath
+// with its new ID and path.
+func Relabel(wsPath, id string) (*Info, error) {
+	info, err := readMarker(wsPath)
+	if err != nil {
+		return nil, err
+	}
+	info.ID = id
+	info.Path = wsPath
+	if err := WriteMarker(wsPath, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
@@ -0,0 +1,120 @@
+package workspace_test
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/chrisbanes/grove/internal/clone"
+	"github.com/chrisbanes/grove/internal/workspace"
+)
+
+func TestPool_AddAndClaim(t *testing.T) {
+	golden, cfg := setupGolden(t)
+	c := &clone.CopyCloner{Root: golden}
+	info, err := workspace.Create(t.Context(), golden, cfg, c, workspace.CreateOpts{GoldenCommit: "abc123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := workspace.AddToPool(info.Path); err != nil {
+		t.Fatalf("AddToPool() error = %v", err)
+	}
+	if list, _ := workspace.List(cfg); len(list) != 0 {
+		t.Errorf("pooled workspace is listed as a workspace: %+v", list)
+	}
+	if workspace.IsWorkspace(info.Path) {
+		t.Error("pooled workspace should not have a workspace marker")
+	}
+	pooled, err := workspace.ListPool(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pooled) != 1 || pooled[0].ID != info.ID || pooled[0].GoldenCommit != "abc123" {
+		t.Fatalf("ListPool() = %+v, want %s at abc123", pooled, info.ID)
+	}
+
+	claimed, err := workspace.Claim(cfg, info.ID)
+	if err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if claimed.Path != info.Path {
+		t.Errorf("claimed path = %s, want %s", claimed.Path, info.Path)
+	}
+	if !workspace.IsWorkspace(info.Path) {
+		t.Error("claimed workspace should have a workspace marker")
+	}
+	if pooled, _ := workspace.ListPool(cfg); len(pooled) != 0 {
+		t.Errorf("claimed workspace is still pooled: %+v", pooled)
+	}
+	if _, err := workspace.Claim(cfg, info.ID); !errors.Is(err, workspace.ErrClaimed) {
+		t.Errorf("second Claim() error = %v, want ErrClaimed", err)
+	}
+}
+
+func TestPool_ConcurrentClaimsSucceedOnce(t *testing.T) {
+	golden, cfg := setupGolden(t)
+	c := &clone.CopyCloner{Root: golden}
+	info, err := workspace.Create(t.Context(), golden, cfg, c, workspace.CreateOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := workspace.AddToPool(info.Path); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		claimed int
+	)
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := workspace.Claim(cfg, info.ID)
+			if err != nil && !errors.Is(err, workspace.ErrClaimed) {
+				t.Errorf("Claim() error = %v", err)
+				return
+			}
+			if err == nil {
+				mu.Lock()
+				claimed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if claimed != 1 {
+		t.Errorf("%d claims succeeded, want 1", claimed)
+	}
+}
+
+func TestRename(t *testing.T) {
+	golden, cfg := setupGolden(t)
+	c := &clone.CopyCloner{Root: golden}
+	info, err := workspace.Create(t.Context(), golden, cfg, c, workspace.CreateOpts{BranchForID: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renamed, err := workspace.Rename(cfg, info.ID, "feature-1234")
+	if err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	wantPath := filepath.Join(cfg.WorkspaceDir, "feature-1234")
+	if renamed.ID != "feature-1234" || renamed.Path != wantPath {
+		t.Errorf("Rename() = %s at %s, want feature-1234 at %s", renamed.ID, renamed.Path, wantPath)
+	}
+	if workspace.IsWorkspace(info.Path) {
+		t.Error("workspace is still at its old path")
+	}
+	got, err := workspace.Get(cfg, "feature-1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != "feature-1234" {
+		t.Errorf("marker ID = %s, want feature-1234", got.ID)
+	}
+}
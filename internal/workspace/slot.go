@@ -0,0 +1,105 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chrisbanes/grove/internal/config"
+	"github.com/chrisbanes/grove/internal/lockfile"
+)
+
+const slotSuffix = ".slot"
+
+// Slot is a reserved place for a workspace under MaxWorkspaces. It counts
+// against the limit from Reserve until Release, so a workspace still being
+// cloned is counted before its marker exists.
+type Slot struct {
+	path string
+	lock *lockfile.Lock
+}
+
+// Reserve reserves a slot for the workspace id, or fails if MaxWorkspaces
+// workspaces already exist or are reserved. Concurrent reservations, from
+// any process, take turns; only checking the limit and recording the
+// reservation is serialized, not creating the workspace.
+//
+// Reservations live in the state dir, or in the workspace directory when
+// no state dir is configured.
+func Reserve(cfg *config.Config, id string) (*Slot, error) {
+	dir := config.SlotsDir(cfg)
+	lock, err := lockfile.Acquire(filepath.Join(dir, "create.lock"))
+	if err != nil {
+		return nil, fmt.Errorf("locking workspace slots: %w", err)
+	}
+	defer lock.Release()
+
+	reserved, err := reservedSlots(dir, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLimit(cfg, reserved); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, id+slotSuffix)
+	slotLock, err := lockfile.TryAcquire(path)
+	if err != nil {
+		return nil, fmt.Errorf("reserving workspace slot: %w", err)
+	}
+	return &Slot{path: path, lock: slotLock}, nil
+}
+
+// Release gives the slot up. Once the workspace marker is written, the
+// workspace counts against the limit by itself.
+func (s *Slot) Release() {
+	if s.lock == nil {
+		return
+	}
+	os.Remove(s.path)
+	s.lock.Release()
+	s.lock = nil
+}
+
+func checkLimit(cfg *config.Config, reserved int) error {
+	existing, err := List(cfg)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(existing)+reserved >= cfg.MaxWorkspaces {
+		return fmt.Errorf("max workspaces (%d) reached — destroy one first", cfg.MaxWorkspaces)
+	}
+	return nil
+}
+
+// reservedSlots counts the slots in dir still held by a live process for
+// a workspace whose marker isn't written yet. A slot nobody holds was left
+// by a process that died before releasing it, and is removed.
+func reservedSlots(dir string, cfg *config.Config) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	reserved := 0
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), slotSuffix)
+		if !ok {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		l, err := lockfile.TryAcquire(path)
+		if errors.Is(err, lockfile.ErrLocked) {
+			if !IsWorkspace(filepath.Join(cfg.WorkspaceDir, id)) {
+				reserved++
+			}
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("checking workspace slot %s: %w", id, err)
+		}
+		os.Remove(path)
+		l.Release()
+	}
+	return reserved, nil
+}
@@ -0,0 +1,137 @@
+package workspace_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chrisbanes/grove/internal/clone"
+	"github.com/chrisbanes/grove/internal/config"
+	"github.com/chrisbanes/grove/internal/workspace"
+)
+
+// slowCloner copies like CopyCloner, but takes a while, so concurrent
+// creates overlap.
+type slowCloner struct {
+	clone.CopyCloner
+}
+
+func (c *slowCloner) Clone(ctx context.Context, src, dst string) error {
+	time.Sleep(20 * time.Millisecond)
+	return c.CopyCloner.Clone(ctx, src, dst)
+}
+
+func TestReserve_HeldSlotsCountAgainstLimit(t *testing.T) {
+	_, cfg := setupGolden(t)
+	cfg.StateDir = t.TempDir()
+	cfg.MaxWorkspaces = 2
+
+	first, err := workspace.Reserve(cfg, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := workspace.Reserve(cfg, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := workspace.Reserve(cfg, "c"); err == nil || !strings.Contains(err.Error(), "max workspaces (2)") {
+		t.Fatalf("Reserve() error = %v, want the max workspaces error", err)
+	}
+
+	first.Release()
+	third, err := workspace.Reserve(cfg, "c")
+	if err != nil {
+		t.Fatalf("Reserve() after a release error = %v", err)
+	}
+	second.Release()
+	third.Release()
+}
+
+func TestReserve_WithoutStateDirLocksInWorkspaceDir(t *testing.T) {
+	_, cfg := setupGolden(t)
+	cfg.StateDir = ""
+	cfg.MaxWorkspaces = 1
+
+	slot, err := workspace.Reserve(cfg, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slot.Release()
+	if _, err := os.Stat(filepath.Join(cfg.WorkspaceDir, config.SlotsDirName, "a.slot")); err != nil {
+		t.Errorf("slot should be reserved in the workspace dir: %v", err)
+	}
+	if _, err := workspace.Reserve(cfg, "b"); err == nil || !strings.Contains(err.Error(), "max workspaces (1)") {
+		t.Fatalf("Reserve() error = %v, want the max workspaces error", err)
+	}
+	if list, err := workspace.List(cfg); err != nil || len(list) != 0 {
+		t.Errorf("List() = %+v, %v; the slots dir is not a workspace", list, err)
+	}
+}
+
+func TestReserve_ReclaimsAbandonedSlots(t *testing.T) {
+	_, cfg := setupGolden(t)
+	cfg.StateDir = t.TempDir()
+	cfg.MaxWorkspaces = 1
+
+	// Left by a process that died holding it; nobody holds its lock.
+	abandoned := filepath.Join(config.SlotsDir(cfg), "gone.slot")
+	os.MkdirAll(filepath.Dir(abandoned), 0755)
+	os.WriteFile(abandoned, nil, 0644)
+
+	slot, err := workspace.Reserve(cfg, "a")
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	defer slot.Release()
+	if _, err := os.Stat(abandoned); !os.IsNotExist(err) {
+		t.Errorf("abandoned slot should be removed: %v", err)
+	}
+}
+
+func TestCreate_ConcurrentCreatesRespectLimit(t *testing.T) {
+	golden, cfg := setupGolden(t)
+	cfg.StateDir = t.TempDir()
+	cfg.MaxWorkspaces = 3
+	c := &slowCloner{clone.CopyCloner{Root: golden}}
+
+	const creates = 20
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		created int
+	)
+	for range creates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := workspace.Create(t.Context(), golden, cfg, c, workspace.CreateOpts{})
+			if err != nil && !strings.Contains(err.Error(), "max workspaces") {
+				t.Errorf("Create() error = %v", err)
+				return
+			}
+			if err == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created != cfg.MaxWorkspaces {
+		t.Errorf("%d of %d concurrent creates succeeded, want %d", created, creates, cfg.MaxWorkspaces)
+	}
+	if list, _ := workspace.List(cfg); len(list) != cfg.MaxWorkspaces {
+		t.Errorf("listed %d workspaces, want %d", len(list), cfg.MaxWorkspaces)
+	}
+	entries, _ := os.ReadDir(config.SlotsDir(cfg))
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".slot") {
+			t.Errorf("slot %s was not released", e.Name())
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package workspace
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
@@ -30,23 +31,23 @@ type CreateOpts struct {
 	BranchForID  string
 	GoldenCommit string
 	OnClone      clone.ProgressFunc
+	// OnRelocateSkip is called with each binary file that could not be
+	// relocated safely.
+	OnRelocateSkip func(rel string)
 }
 
-// Create makes a new workspace by CoW-cloning the golden copy.
-func Create(goldenRoot string, cfg *config.Config, cloner clone.Cloner, opts CreateOpts) (*Info, error) {
-	// Check max workspace limit
-	existing, err := List(cfg)
-	if err != nil && !os.IsNotExist(err) {
-		return nil, err
-	}
-	if len(existing) >= cfg.MaxWorkspaces {
-		return nil, fmt.Errorf("max workspaces (%d) reached — destroy one first", cfg.MaxWorkspaces)
-	}
-
+// Create makes a new workspace by CoW-cloning the golden copy. The partial
+// clone is removed if cloning fails or ctx is done first.
+func Create(ctx context.Context, goldenRoot string, cfg *config.Config, cloner clone.Cloner, opts CreateOpts) (*Info, error) {
 	id, err := GenerateID(opts.BranchForID)
 	if err != nil {
 		return nil, fmt.Errorf("generating workspace ID: %w", err)
 	}
+	slot, err := Reserve(cfg, id)
+	if err != nil {
+		return nil, err
+	}
+	defer slot.Release()
 
 	wsPath := filepath.Join(cfg.WorkspaceDir, id)
 
@@ -56,7 +57,15 @@ func Create(goldenRoot string, cfg *config.Config, cloner clone.Cloner, opts Cre
 	}
 
 	// CoW clone
-	if err := cloneWorkspace(cloner, goldenRoot, wsPath, cfg.Exclude, opts.OnClone); err != nil {
+	cloneOpts := clone.Options{
+		Excludes:       cfg.Exclude,
+		Concurrency:    cfg.CloneConcurrency,
+		OnProgress:     opts.OnClone,
+		CacheDir:       config.PlanCacheDir(cfg),
+		Relocate:       cfg.Relocate,
+		OnRelocateSkip: opts.OnRelocateSkip,
+	}
+	if err := clone.SelectiveCloneWithOptions(ctx, cloner, goldenRoot, wsPath, cloneOpts); err != nil {
 		os.RemoveAll(wsPath) // clean up partial clone
 		return nil, fmt.Errorf("clone failed: %w", err)
 	}
@@ -79,13 +88,6 @@ func Create(goldenRoot string, cfg *config.Config, cloner clone.Cloner, opts Cre
 	return info, nil
 }
 
-func cloneWorkspace(cloner clone.Cloner, src, dst string, excludes []string, onClone clone.ProgressFunc) error {
-	if onClone != nil {
-		return clone.SelectiveCloneWithProgress(cloner, src, dst, excludes, onClone)
-	}
-	return clone.SelectiveClone(cloner, src, dst, excludes)
-}
-
 // List returns all workspaces in the configured workspace directory.
 func List(cfg *config.Config) ([]Info, error) {
 	entries, err := os.ReadDir(cfg.WorkspaceDir)
@@ -98,7 +100,7 @@ func List(cfg *config.Config) ([]Info, error) {
 
 	var workspaces []Info
 	for _, entry := range entries {
-		if !entry.IsDir() {
+		if !mayBeWorkspace(entry) {
 			continue
 		}
 		wsPath := filepath.Join(cfg.WorkspaceDir, entry.Name())
@@ -112,6 +114,13 @@ func List(cfg *config.Config) ([]Info, error) {
 	return workspaces, nil
 }
 
+// mayBeWorkspace reports whether entry in the workspace directory can be a
+// workspace: a directory, or a symlink to one, as an overlay mounted in a
+// user namespace is.
+func mayBeWorkspace(entry os.DirEntry) bool {
+	return entry.IsDir() || entry.Type()&os.ModeSymlink != 0
+}
+
 // Destroy removes a workspace by ID or path.
 func Destroy(cfg *config.Config, idOrPath string) error {
 	wsPath, err := resolveWorkspace(cfg, idOrPath)
@@ -169,7 +178,11 @@ func WriteMarker(wsPath string, info *Info) error {
 }
 
 func readMarker(wsPath string) (*Info, error) {
-	data, err := os.ReadFile(filepath.Join(wsPath, ".grove", config.WorkspaceFile))
+	return readInfo(filepath.Join(wsPath, ".grove", config.WorkspaceFile))
+}
+
+func readInfo(path string) (*Info, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
@@ -34,7 +34,7 @@ func TestCreate(t *testing.T) {
 	golden, cfg := setupGolden(t)
 	c, _ := clone.NewCloner(golden)
 
-	info, err := workspace.Create(golden, cfg, c, workspace.CreateOpts{})
+	info, err := workspace.Create(t.Context(), golden, cfg, c, workspace.CreateOpts{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -69,9 +69,9 @@ func TestCreate_MaxWorkspaces(t *testing.T) {
 	cfg.MaxWorkspaces = 2
 	c, _ := clone.NewCloner(golden)
 
-	workspace.Create(golden, cfg, c, workspace.CreateOpts{})
-	workspace.Create(golden, cfg, c, workspace.CreateOpts{})
-	_, err := workspace.Create(golden, cfg, c, workspace.CreateOpts{})
+	workspace.Create(t.Context(), golden, cfg, c, workspace.CreateOpts{})
+	workspace.Create(t.Context(), golden, cfg, c, workspace.CreateOpts{})
+	_, err := workspace.Create(t.Context(), golden, cfg, c, workspace.CreateOpts{})
 	if err == nil {
 		t.Error("expected error when exceeding max workspaces")
 	}
@@ -84,8 +84,8 @@ func TestList(t *testing.T) {
 	golden, cfg := setupGolden(t)
 	c, _ := clone.NewCloner(golden)
 
-	workspace.Create(golden, cfg, c, workspace.CreateOpts{})
-	workspace.Create(golden, cfg, c, workspace.CreateOpts{})
+	workspace.Create(t.Context(), golden, cfg, c, workspace.CreateOpts{})
+	workspace.Create(t.Context(), golden, cfg, c, workspace.CreateOpts{})
 
 	list, err := workspace.List(cfg)
 	if err != nil {
@@ -96,6 +96,25 @@ func TestList(t *testing.T) {
 	}
 }
 
+func TestList_FollowsSymlinkedWorkspaces(t *testing.T) {
+	cfg := &config.Config{WorkspaceDir: t.TempDir()}
+	target := t.TempDir()
+	os.MkdirAll(filepath.Join(target, ".grove"), 0755)
+	if err := workspace.WriteMarker(target, &workspace.Info{ID: "ns-1"}); err != nil {
+		t.Fatal(err)
+	}
+	wsPath := filepath.Join(cfg.WorkspaceDir, "ns-1")
+	os.Symlink(target, wsPath)
+
+	list, err := workspace.List(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != "ns-1" || list[0].Path != wsPath {
+		t.Errorf("List() = %+v, want ns-1 at %s", list, wsPath)
+	}
+}
+
 func TestDestroy(t *testing.T) {
 	if runtime.GOOS != "darwin" {
 		t.Skip("APFS tests only run on macOS")
@@ -103,7 +122,7 @@ func TestDestroy(t *testing.T) {
 	golden, cfg := setupGolden(t)
 	c, _ := clone.NewCloner(golden)
 
-	info, _ := workspace.Create(golden, cfg, c, workspace.CreateOpts{})
+	info, _ := workspace.Create(t.Context(), golden, cfg, c, workspace.CreateOpts{})
 	err := workspace.Destroy(cfg, info.ID)
 	if err != nil {
 		t.Fatal(err)
@@ -199,7 +218,7 @@ func TestCreate_WithExcludes(t *testing.T) {
 	config.Save(dir, cfg)
 	c, _ := clone.NewCloner(dir)
 
-	info, err := workspace.Create(dir, cfg, c, workspace.CreateOpts{})
+	info, err := workspace.Create(t.Context(), dir, cfg, c, workspace.CreateOpts{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -217,3 +236,36 @@ func TestCreate_WithExcludes(t *testing.T) {
 		t.Error("workspace marker should exist")
 	}
 }
+
+func TestCreate_CopyCloner(t *testing.T) {
+	golden, cfg := setupGolden(t)
+	cfg.Exclude = []string{"*.pyc"}
+	os.WriteFile(filepath.Join(golden, "module.pyc"), []byte("pyc"), 0644)
+	c := &clone.CopyCloner{Root: golden}
+
+	info, err := workspace.Create(t.Context(), golden, cfg, c, workspace.CreateOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(info.Path, "src.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "source" {
+		t.Errorf("expected 'source', got %q", string(data))
+	}
+	if _, err := os.Stat(filepath.Join(info.Path, "module.pyc")); !os.IsNotExist(err) {
+		t.Error("module.pyc should not exist in workspace")
+	}
+	if !workspace.IsWorkspace(info.Path) {
+		t.Error("expected workspace marker to exist")
+	}
+
+	if err := workspace.Destroy(cfg, info.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(info.Path); !os.IsNotExist(err) {
+		t.Error("workspace directory should be deleted")
+	}
+}
@@ -0,0 +1,112 @@
+// Package zfs implements workspaces as ZFS clones.
+//
+// RefreshBase snapshots the dataset holding the golden copy, and each
+// workspace is a clone of the latest snapshot mounted in workspace_dir.
+// Snapshots are destroyed once no workspace clone depends on them.
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// SnapshotPrefix starts the names of snapshots grove takes, so garbage
+// collection leaves other snapshots of the dataset alone.
+const SnapshotPrefix = "grove-"
+
+// Runner executes external commands. Commands are killed if ctx is done
+// before they exit.
+type Runner interface {
+	CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+type execRunner struct{}
+
+func (execRunner) CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).CombinedOutput()
+}
+
+// DatasetAt returns the name of the dataset mounted at mountpoint. It errors
+// if mountpoint is inside a dataset rather than its root, since only whole
+// datasets can be snapshotted.
+func DatasetAt(ctx context.Context, r Runner, mountpoint string) (string, error) {
+	out, err := output(ctx, r, "zfs", "list", "-H", "-o", "name,mountpoint", mountpoint)
+	if err != nil {
+		return "", err
+	}
+	name, mounted, ok := strings.Cut(strings.TrimSpace(out), "\t")
+	if !ok {
+		return "", fmt.Errorf("unexpected zfs list output: %q", out)
+	}
+	if mounted != mountpoint {
+		return "", fmt.Errorf("%s is not the root of a ZFS dataset: %s is mounted at %s", mountpoint, name, mounted)
+	}
+	return name, nil
+}
+
+// Exists reports whether the dataset or snapshot exists.
+func Exists(ctx context.Context, r Runner, name string) bool {
+	_, err := output(ctx, r, "zfs", "list", "-H", "-t", "all", "-o", "name", name)
+	return err == nil
+}
+
+// Snapshot creates the snapshot name (dataset@snap).
+func Snapshot(ctx context.Context, r Runner, name string) error {
+	_, err := output(ctx, r, "zfs", "snapshot", name)
+	return err
+}
+
+// Clone creates the dataset clone from snapshot, mounted at mountpoint.
+func Clone(ctx context.Context, r Runner, snapshot, clone, mountpoint string) error {
+	_, err := output(ctx, r, "zfs", "clone", "-o", "mountpoint="+mountpoint, snapshot, clone)
+	return err
+}
+
+// SetMountpoint mounts dataset at mountpoint instead.
+func SetMountpoint(ctx context.Context, r Runner, dataset, mountpoint string) error {
+	_, err := output(ctx, r, "zfs", "set", "mountpoint="+mountpoint, dataset)
+	return err
+}
+
+// Destroy destroys a dataset or snapshot.
+func Destroy(ctx context.Context, r Runner, name string) error {
+	_, err := output(ctx, r, "zfs", "destroy", name)
+	return err
+}
+
+// ListSnapshots returns the names of dataset's own snapshots.
+func ListSnapshots(ctx context.Context, r Runner, dataset string) ([]string, error) {
+	out, err := output(ctx, r, "zfs", "list", "-H", "-t", "snapshot", "-d", "1", "-o", "name", dataset)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			names = append(names, line)
+		}
+	}
+	return names, nil
+}
+
+// CloneName returns the dataset a workspace is cloned into: a sibling of the
+// golden dataset, or a child when the golden copy is the pool's root dataset.
+func CloneName(dataset, workspaceID string) string {
+	if !strings.Contains(dataset, "/") {
+		return dataset + "/" + SnapshotPrefix + workspaceID
+	}
+	return dataset + "-" + SnapshotPrefix + workspaceID
+}
+
+func output(ctx context.Context, r Runner, name string, args ...string) (string, error) {
+	if r == nil {
+		r = execRunner{}
+	}
+	out, err := r.CombinedOutput(ctx, name, args...)
+	if err != nil {
+		return "", fmt.Errorf("%s %s failed: %w\n%s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
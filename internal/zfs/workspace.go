@@ -0,0 +1,165 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chrisbanes/grove/internal/clone"
+)
+
+// now is the clock snapshot names are taken from.
+var now = time.Now
+
+// RefreshBase snapshots the dataset mounted at goldenRoot, makes the
+// snapshot the base for new workspaces and garbage-collects older ones.
+func RefreshBase(ctx context.Context, runtimeRoot, goldenRoot string, r Runner, commit string) (*State, error) {
+	dataset, err := DatasetAt(ctx, r, goldenRoot)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := dataset + "@" + SnapshotPrefix + now().UTC().Format("20060102T150405.000000000Z")
+	if err := Snapshot(ctx, r, snapshot); err != nil {
+		return nil, err
+	}
+
+	st := &State{
+		Backend:        "zfs",
+		Dataset:        dataset,
+		Snapshot:       snapshot,
+		LastSyncCommit: commit,
+		UpdatedAt:      now().UTC(),
+	}
+	if err := SaveState(runtimeRoot, st); err != nil {
+		_ = Destroy(context.WithoutCancel(ctx), r, snapshot)
+		return nil, err
+	}
+	if err := GCSnapshots(ctx, runtimeRoot, r, st); err != nil {
+		return nil, fmt.Errorf("removing old snapshots: %w", err)
+	}
+	return st, nil
+}
+
+// CreateWorkspace clones the base snapshot into a dataset mounted at
+// workspacePath. The snapshot holds the whole golden dataset, so paths
+// matching excludes are removed from the clone. They are matched against the
+// clone rather than the golden copy, which may have changed since the
+// snapshot was taken.
+func CreateWorkspace(ctx context.Context, runtimeRoot, workspacePath, workspaceID string, st *State, r Runner, excludes []string) (*WorkspaceMeta, error) {
+	if st.Snapshot == "" {
+		return nil, fmt.Errorf("zfs backend state missing snapshot")
+	}
+	meta := &WorkspaceMeta{
+		ID:         workspaceID,
+		Mountpoint: workspacePath,
+		Clone:      CloneName(st.Dataset, workspaceID),
+		Snapshot:   st.Snapshot,
+		CreatedAt:  now().UTC(),
+	}
+	// Record the workspace first so the snapshot is not collected while it
+	// is being cloned.
+	if err := SaveWorkspaceMeta(runtimeRoot, meta); err != nil {
+		return nil, err
+	}
+	if err := Clone(ctx, r, meta.Snapshot, meta.Clone, workspacePath); err != nil {
+		_ = DeleteWorkspaceMeta(runtimeRoot, workspaceID)
+		return nil, err
+	}
+
+	excluded, err := clone.ExcludedPaths(workspacePath, excludes)
+	if err == nil {
+		for _, e := range excluded {
+			if err = os.RemoveAll(filepath.Join(workspacePath, filepath.FromSlash(e.Path))); err != nil {
+				err = fmt.Errorf("removing excluded %s: %w", e.Path, err)
+				break
+			}
+		}
+	}
+	if err != nil {
+		_ = DestroyWorkspace(context.WithoutCancel(ctx), runtimeRoot, workspaceID, r)
+		return nil, err
+	}
+	return meta, nil
+}
+
+// DestroyWorkspace destroys the workspace clone and its metadata, then
+// garbage-collects snapshots nothing depends on any more.
+func DestroyWorkspace(ctx context.Context, runtimeRoot, workspaceID string, r Runner) error {
+	meta, err := LoadWorkspaceMeta(runtimeRoot, workspaceID)
+	if err != nil {
+		return err
+	}
+	if err := Destroy(ctx, r, meta.Clone); err != nil && Exists(ctx, r, meta.Clone) {
+		return err
+	}
+	if err := DeleteWorkspaceMeta(runtimeRoot, workspaceID); err != nil {
+		return err
+	}
+	if err := os.Remove(meta.Mountpoint); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	st, err := LoadState(runtimeRoot)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return GCSnapshots(ctx, runtimeRoot, r, st)
+}
+
+// RenameWorkspace gives the workspace workspaceID the ID newID and mounts
+// its clone at workspacePath instead. The clone keeps its dataset name.
+func RenameWorkspace(ctx context.Context, runtimeRoot, workspaceID, newID, workspacePath string, r Runner) (*WorkspaceMeta, error) {
+	meta, err := LoadWorkspaceMeta(runtimeRoot, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := SetMountpoint(ctx, r, meta.Clone, workspacePath); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(meta.Mountpoint); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	meta.ID = newID
+	meta.Mountpoint = workspacePath
+	if err := SaveWorkspaceMeta(runtimeRoot, meta); err != nil {
+		return nil, err
+	}
+	if err := DeleteWorkspaceMeta(runtimeRoot, workspaceID); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// GCSnapshots destroys grove's snapshots of the golden dataset other than
+// the current base and those workspaces were cloned from.
+func GCSnapshots(ctx context.Context, runtimeRoot string, r Runner, st *State) error {
+	metas, err := ListWorkspaceMeta(runtimeRoot)
+	if err != nil {
+		return err
+	}
+	referenced := map[string]bool{st.Snapshot: true}
+	for _, meta := range metas {
+		referenced[meta.Snapshot] = true
+	}
+
+	snapshots, err := ListSnapshots(ctx, r, st.Dataset)
+	if err != nil {
+		return err
+	}
+	for _, snapshot := range snapshots {
+		if referenced[snapshot] || !strings.HasPrefix(snapshot, st.Dataset+"@"+SnapshotPrefix) {
+			continue
+		}
+		if err := Destroy(ctx, r, snapshot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
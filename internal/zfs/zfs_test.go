@@ -0,0 +1,346 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeZFS simulates the zfs CLI: datasets map to mountpoints, and a clone
+// copies the origin dataset's current files to its mountpoint.
+type fakeZFS struct {
+	commands  []string
+	datasets  map[string]string
+	snapshots []string
+	failOn    string
+}
+
+func newFakeZFS(golden string) *fakeZFS {
+	return &fakeZFS{datasets: map[string]string{"tank/src/app": golden}}
+}
+
+func (f *fakeZFS) CombinedOutput(_ context.Context, name string, args ...string) ([]byte, error) {
+	cmd := name + " " + strings.Join(args, " ")
+	f.commands = append(f.commands, cmd)
+	if f.failOn != "" && strings.HasPrefix(cmd, f.failOn) {
+		return []byte("cannot " + args[0] + ": permission denied"), errors.New("exit status 1")
+	}
+	last := args[len(args)-1]
+	switch args[0] {
+	case "list":
+		if slices.Contains(args, "snapshot") {
+			var out string
+			for _, s := range f.snapshots {
+				if strings.HasPrefix(s, last+"@") {
+					out += s + "\n"
+				}
+			}
+			return []byte(out), nil
+		}
+		for ds, mnt := range f.datasets {
+			if ds == last || mnt == last {
+				return []byte(ds + "\t" + mnt + "\n"), nil
+			}
+			if strings.HasPrefix(last, mnt+"/") {
+				return []byte(ds + "\t" + mnt + "\n"), nil
+			}
+		}
+		if slices.Contains(f.snapshots, last) {
+			return []byte(last + "\n"), nil
+		}
+		return []byte("cannot open '" + last + "': dataset does not exist"), errors.New("exit status 1")
+	case "snapshot":
+		f.snapshots = append(f.snapshots, last)
+	case "clone":
+		mountpoint := strings.TrimPrefix(args[2], "mountpoint=")
+		origin, _, _ := strings.Cut(args[3], "@")
+		f.datasets[last] = mountpoint
+		return nil, os.CopyFS(mountpoint, os.DirFS(f.datasets[origin]))
+	case "set":
+		mountpoint := strings.TrimPrefix(args[1], "mountpoint=")
+		if err := os.Rename(f.datasets[last], mountpoint); err != nil {
+			return nil, err
+		}
+		f.datasets[last] = mountpoint
+	case "destroy":
+		if mnt, ok := f.datasets[last]; ok {
+			delete(f.datasets, last)
+			return nil, os.RemoveAll(mnt)
+		}
+		f.snapshots = slices.DeleteFunc(f.snapshots, func(s string) bool { return s == last })
+	}
+	return nil, nil
+}
+
+func newGolden(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "build"), 0755)
+	os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n"), 0644)
+	os.WriteFile(filepath.Join(root, "build", "output.bin"), []byte("compiled"), 0644)
+	return root
+}
+
+func stubClock(t *testing.T) {
+	t.Helper()
+	orig := now
+	t.Cleanup(func() { now = orig })
+	tick := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	now = func() time.Time {
+		tick = tick.Add(time.Second)
+		return tick
+	}
+}
+
+func TestDatasetAt_RequiresDatasetRoot(t *testing.T) {
+	golden := newGolden(t)
+	r := newFakeZFS(golden)
+
+	name, err := DatasetAt(t.Context(), r, golden)
+	if err != nil || name != "tank/src/app" {
+		t.Fatalf("DatasetAt() = %q, %v", name, err)
+	}
+	_, err = DatasetAt(t.Context(), r, filepath.Join(golden, "build"))
+	if err == nil || !strings.Contains(err.Error(), "not the root of a ZFS dataset") {
+		t.Fatalf("DatasetAt(subdir) error = %v", err)
+	}
+}
+
+func TestCloneName(t *testing.T) {
+	if got := CloneName("tank/src/app", "main-a1b2"); got != "tank/src/app-grove-main-a1b2" {
+		t.Errorf("CloneName() = %q", got)
+	}
+	if got := CloneName("tank", "main-a1b2"); got != "tank/grove-main-a1b2" {
+		t.Errorf("CloneName(pool root) = %q", got)
+	}
+}
+
+func TestRefreshBase_SnapshotsGoldenDataset(t *testing.T) {
+	stubClock(t)
+	golden := newGolden(t)
+	runtimeRoot := t.TempDir()
+	r := newFakeZFS(golden)
+
+	st, err := RefreshBase(t.Context(), runtimeRoot, golden, r, "abc1234")
+	if err != nil {
+		t.Fatalf("RefreshBase() error = %v", err)
+	}
+	want := "tank/src/app@grove-20260102T030406.000000000Z"
+	if st.Snapshot != want || st.Dataset != "tank/src/app" {
+		t.Errorf("state = %+v, want snapshot %s", st, want)
+	}
+	if !slices.Contains(r.commands, "zfs snapshot "+want) {
+		t.Errorf("commands = %q", r.commands)
+	}
+	loaded, err := LoadState(runtimeRoot)
+	if err != nil || loaded.Snapshot != want || loaded.LastSyncCommit != "abc1234" {
+		t.Errorf("LoadState() = %+v, %v", loaded, err)
+	}
+}
+
+func TestCreateAndDestroyWorkspace(t *testing.T) {
+	stubClock(t)
+	golden := newGolden(t)
+	runtimeRoot := t.TempDir()
+	wsPath := filepath.Join(t.TempDir(), "main-a1b2")
+	r := newFakeZFS(golden)
+
+	st, err := RefreshBase(t.Context(), runtimeRoot, golden, r, "abc1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := CreateWorkspace(t.Context(), runtimeRoot, wsPath, "main-a1b2", st, r, []string{"build/"})
+	if err != nil {
+		t.Fatalf("CreateWorkspace() error = %v", err)
+	}
+	wantClone := "zfs clone -o mountpoint=" + wsPath + " " + st.Snapshot + " tank/src/app-grove-main-a1b2"
+	if !slices.Contains(r.commands, wantClone) {
+		t.Errorf("commands = %q, want %q", r.commands, wantClone)
+	}
+	if meta.Snapshot != st.Snapshot || meta.Clone != "tank/src/app-grove-main-a1b2" {
+		t.Errorf("meta = %+v", meta)
+	}
+	if _, err := os.Stat(filepath.Join(wsPath, "main.go")); err != nil {
+		t.Errorf("workspace is missing main.go: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(wsPath, "build")); !os.IsNotExist(err) {
+		t.Errorf("excluded build/ is in the workspace: %v", err)
+	}
+	if loaded, err := LoadWorkspaceMeta(runtimeRoot, "main-a1b2"); err != nil || loaded.Snapshot != st.Snapshot {
+		t.Errorf("LoadWorkspaceMeta() = %+v, %v", loaded, err)
+	}
+
+	if err := DestroyWorkspace(t.Context(), runtimeRoot, "main-a1b2", r); err != nil {
+		t.Fatalf("DestroyWorkspace() error = %v", err)
+	}
+	if !slices.Contains(r.commands, "zfs destroy tank/src/app-grove-main-a1b2") {
+		t.Errorf("commands = %q", r.commands)
+	}
+	if _, err := LoadWorkspaceMeta(runtimeRoot, "main-a1b2"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("workspace meta still exists: %v", err)
+	}
+	if !slices.Contains(r.snapshots, st.Snapshot) {
+		t.Error("the current base snapshot was garbage-collected")
+	}
+}
+
+// staleZFS clones files the golden copy no longer has, as a clone of a
+// snapshot taken before they were deleted would.
+type staleZFS struct {
+	*fakeZFS
+	stale map[string]string
+}
+
+func (f staleZFS) CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error) {
+	out, err := f.fakeZFS.CombinedOutput(ctx, name, args...)
+	if err != nil || args[0] != "clone" {
+		return out, err
+	}
+	mountpoint := strings.TrimPrefix(args[2], "mountpoint=")
+	for rel, data := range f.stale {
+		path := filepath.Join(mountpoint, rel)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func TestCreateWorkspace_ExcludesPathsOnlyInSnapshot(t *testing.T) {
+	stubClock(t)
+	golden := newGolden(t)
+	runtimeRoot := t.TempDir()
+	wsPath := filepath.Join(t.TempDir(), "main-a1b2")
+	r := staleZFS{newFakeZFS(golden), map[string]string{"cache/old.bin": "stale"}}
+
+	st, err := RefreshBase(t.Context(), runtimeRoot, golden, r, "abc1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateWorkspace(t.Context(), runtimeRoot, wsPath, "main-a1b2", st, r, []string{"cache/"}); err != nil {
+		t.Fatalf("CreateWorkspace() error = %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(wsPath, "cache")); !os.IsNotExist(err) {
+		t.Errorf("excluded cache/ from the snapshot is in the workspace: %v", err)
+	}
+}
+
+func TestRenameWorkspace(t *testing.T) {
+	stubClock(t)
+	golden := newGolden(t)
+	runtimeRoot := t.TempDir()
+	dir := t.TempDir()
+	r := newFakeZFS(golden)
+	st, err := RefreshBase(t.Context(), runtimeRoot, golden, r, "abc1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateWorkspace(t.Context(), runtimeRoot, filepath.Join(dir, "main-a1b2"), "main-a1b2", st, r, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	newPath := filepath.Join(dir, "feature-c3d4")
+	meta, err := RenameWorkspace(t.Context(), runtimeRoot, "main-a1b2", "feature-c3d4", newPath, r)
+	if err != nil {
+		t.Fatalf("RenameWorkspace() error = %v", err)
+	}
+	if !slices.Contains(r.commands, "zfs set mountpoint="+newPath+" tank/src/app-grove-main-a1b2") {
+		t.Errorf("commands = %q", r.commands)
+	}
+	if meta.ID != "feature-c3d4" || meta.Mountpoint != newPath || meta.Clone != "tank/src/app-grove-main-a1b2" {
+		t.Errorf("meta = %+v", meta)
+	}
+	if _, err := LoadWorkspaceMeta(runtimeRoot, "main-a1b2"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("meta under the old ID still exists: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(newPath, "main.go")); err != nil {
+		t.Errorf("renamed workspace is missing main.go: %v", err)
+	}
+
+	if err := DestroyWorkspace(t.Context(), runtimeRoot, "feature-c3d4", r); err != nil {
+		t.Fatalf("DestroyWorkspace() error = %v", err)
+	}
+	if !slices.Contains(r.commands, "zfs destroy tank/src/app-grove-main-a1b2") {
+		t.Errorf("commands = %q", r.commands)
+	}
+}
+
+func TestCreateWorkspace_CloneFailureRemovesMeta(t *testing.T) {
+	stubClock(t)
+	golden := newGolden(t)
+	runtimeRoot := t.TempDir()
+	r := newFakeZFS(golden)
+	st, err := RefreshBase(t.Context(), runtimeRoot, golden, r, "abc1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.failOn = "zfs clone"
+	_, err = CreateWorkspace(t.Context(), runtimeRoot, filepath.Join(t.TempDir(), "ws"), "ws", st, r, nil)
+	if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("CreateWorkspace() error = %v", err)
+	}
+	if metas, _ := ListWorkspaceMeta(runtimeRoot); len(metas) != 0 {
+		t.Errorf("expected no workspace meta after a failed clone, got %+v", metas)
+	}
+}
+
+func TestGCSnapshots_KeepsReferencedSnapshots(t *testing.T) {
+	stubClock(t)
+	golden := newGolden(t)
+	runtimeRoot := t.TempDir()
+	r := newFakeZFS(golden)
+	r.snapshots = []string{"tank/src/app@manual"}
+
+	first, err := RefreshBase(t.Context(), runtimeRoot, golden, r, "aaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsPath := filepath.Join(t.TempDir(), "ws")
+	if _, err := CreateWorkspace(t.Context(), runtimeRoot, wsPath, "ws", first, r, nil); err != nil {
+		t.Fatal(err)
+	}
+	second, err := RefreshBase(t.Context(), runtimeRoot, golden, r, "bbb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := RefreshBase(t.Context(), runtimeRoot, golden, r, "ccc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"tank/src/app@manual", first.Snapshot, third.Snapshot}
+	if !slices.Equal(r.snapshots, want) {
+		t.Errorf("snapshots = %q, want %q (%s collected)", r.snapshots, want, second.Snapshot)
+	}
+
+	if err := DestroyWorkspace(t.Context(), runtimeRoot, "ws", r); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"tank/src/app@manual", third.Snapshot}
+	if !slices.Equal(r.snapshots, want) {
+		t.Errorf("after destroy, snapshots = %q, want %q", r.snapshots, want)
+	}
+}
+
+func TestDestroyWorkspace_ToleratesMissingClone(t *testing.T) {
+	runtimeRoot := t.TempDir()
+	r := newFakeZFS(t.TempDir())
+	if err := SaveWorkspaceMeta(runtimeRoot, &WorkspaceMeta{ID: "ws", Clone: "tank/src/app-grove-ws", Mountpoint: filepath.Join(t.TempDir(), "ws")}); err != nil {
+		t.Fatal(err)
+	}
+	r.failOn = "zfs destroy"
+
+	if err := DestroyWorkspace(t.Context(), runtimeRoot, "ws", r); err != nil {
+		t.Fatalf("DestroyWorkspace() error = %v", err)
+	}
+	if _, err := LoadWorkspaceMeta(runtimeRoot, "ws"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("workspace meta still exists: %v", err)
+	}
+}
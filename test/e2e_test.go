@@ -10,7 +10,9 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/chrisbanes/grove/internal/config"
 	"github.com/chrisbanes/grove/internal/workspace"
@@ -416,6 +418,446 @@ func TestImageBackendLifecycle(t *testing.T) {
 	}
 }
 
+func TestCopyBackendLifecycle(t *testing.T) {
+	binary := buildGrove(t)
+	repo := setupTestRepo(t)
+
+	grove(t, binary, repo, "config", "--backend", "copy", "--workspace-dir", filepath.Join(t.TempDir(), "ws"))
+
+	out := grove(t, binary, repo, "create", "--json", "--branch", "copy-feature")
+	var info workspace.Info
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		t.Fatalf("invalid JSON output: %s\n%s", err, out)
+	}
+
+	data, err := os.ReadFile(filepath.Join(info.Path, "build", "output.bin"))
+	if err != nil {
+		t.Fatal("build/output.bin not in workspace — gitignored files not copied")
+	}
+	if string(data) != "compiled" {
+		t.Error("build artifact content mismatch")
+	}
+	branch := run(t, info.Path, "git", "branch", "--show-current")
+	if branch != "copy-feature" {
+		t.Errorf("expected branch copy-feature, got %q", branch)
+	}
+
+	os.WriteFile(filepath.Join(info.Path, "main.go"), []byte("modified\n"), 0644)
+	origData, _ := os.ReadFile(filepath.Join(repo, "main.go"))
+	if string(origData) != "package main\n" {
+		t.Error("golden copy was modified through the workspace")
+	}
+
+	grove(t, binary, repo, "destroy", info.ID)
+	if _, err := os.Stat(info.Path); !os.IsNotExist(err) {
+		t.Error("workspace not cleaned up after destroy")
+	}
+}
+
+func TestCreateInterruptedRollsBack(t *testing.T) {
+	binary := buildGrove(t)
+	repo := setupTestRepo(t)
+	wsDir := filepath.Join(t.TempDir(), "ws")
+
+	grove(t, binary, repo, "config", "--backend", "copy", "--workspace-dir", wsDir)
+
+	// The hook signals that the workspace exists, then blocks until killed.
+	started := filepath.Join(t.TempDir(), "started")
+	hook := fmt.Sprintf("#!/bin/sh\ntouch %q\nexec sleep 30\n", started)
+	if err := os.WriteFile(filepath.Join(repo, ".grove", "hooks", "post-clone"), []byte(hook), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(binary, "create")
+	cmd.Dir = repo
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err := os.Stat(started); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			cmd.Process.Kill()
+			cmd.Wait()
+			t.Fatalf("post-clone hook never ran:\n%s", out.String())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	start := time.Now()
+	cmd.Process.Signal(os.Interrupt)
+	if err := cmd.Wait(); err == nil {
+		t.Fatalf("expected interrupted create to fail:\n%s", out.String())
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("create took %s to stop after the interrupt", elapsed)
+	}
+	entries, err := os.ReadDir(wsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("interrupted create left %d entries in the workspace dir:\n%s", len(entries), out.String())
+	}
+}
+
+func TestConcurrentCreatesRespectMaxWorkspaces(t *testing.T) {
+	binary := buildGrove(t)
+	repo := setupTestRepo(t)
+	wsDir := filepath.Join(t.TempDir(), "ws")
+
+	grove(t, binary, repo, "config", "--backend", "copy", "--workspace-dir", wsDir, "--state-dir", t.TempDir())
+	cfg, err := config.Load(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.MaxWorkspaces = 3
+	if err := config.Save(repo, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	const creates = 12
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		outs   []string
+		failed int
+	)
+	for range creates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cmd := exec.Command(binary, "create")
+			cmd.Dir = repo
+			cmd.Stdin = bytes.NewReader(nil)
+			out, err := cmd.CombinedOutput()
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed++
+				if !strings.Contains(string(out), "max workspaces") {
+					t.Errorf("create failed for another reason: %s", out)
+				}
+				return
+			}
+			outs = append(outs, string(out))
+		}()
+	}
+	wg.Wait()
+
+	if len(outs) != cfg.MaxWorkspaces || failed != creates-cfg.MaxWorkspaces {
+		t.Errorf("%d creates succeeded and %d failed, want %d and %d", len(outs), failed, cfg.MaxWorkspaces, creates-cfg.MaxWorkspaces)
+	}
+	var list []workspace.Info
+	if err := json.Unmarshal([]byte(grove(t, binary, repo, "list", "--json")), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != cfg.MaxWorkspaces {
+		t.Errorf("listed %d workspaces, want %d", len(list), cfg.MaxWorkspaces)
+	}
+	grove(t, binary, repo, "destroy", "--all")
+}
+
+func TestCreateWaitsForGoldenCopyLock(t *testing.T) {
+	binary := buildGrove(t)
+	repo := setupTestRepo(t)
+	wsDir := filepath.Join(t.TempDir(), "ws")
+	stateDir := t.TempDir()
+	grove(t, binary, repo, "config", "--defaults", "--backend", "copy", "--workspace-dir", wsDir, "--state-dir", stateDir)
+
+	// The warmup holds the golden copy lock until told to finish.
+	signals := t.TempDir()
+	started, release := filepath.Join(signals, "started"), filepath.Join(signals, "release")
+	warmup := fmt.Sprintf("touch %q; while [ ! -f %q ]; do sleep 0.05; done", started, release)
+	configCmd := exec.Command(binary, "config", "--defaults", "--backend", "copy", "--workspace-dir", wsDir, "--state-dir", stateDir, "--warmup-command", warmup)
+	configCmd.Dir = repo
+	var configOut bytes.Buffer
+	configCmd.Stdout, configCmd.Stderr = &configOut, &configOut
+	if err := configCmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.WriteFile(release, nil, 0644)
+		configCmd.Wait()
+	}()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err := os.Stat(started); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("warmup never started:\n%s", configOut.String())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	errOut := groveExpectErr(t, binary, repo, "create", "--no-wait")
+	want := fmt.Sprintf("golden copy is locked by PID %d (grove config", configCmd.Process.Pid)
+	if !strings.Contains(errOut, want) {
+		t.Errorf("create --no-wait error = %q, want it to contain %q", errOut, want)
+	}
+
+	createCmd := exec.Command(binary, "create")
+	createCmd.Dir = repo
+	var stdout, stderr bytes.Buffer
+	createCmd.Stdout, createCmd.Stderr = &stdout, &stderr
+	if err := createCmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if entries, _ := os.ReadDir(wsDir); len(entries) != 0 {
+		t.Errorf("create cloned while the warmup held the lock")
+	}
+	os.WriteFile(release, nil, 0644)
+	if err := createCmd.Wait(); err != nil {
+		t.Fatalf("create failed after the lock was released: %v\n%s", err, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "Waiting for the golden copy, in use by:") {
+		t.Errorf("create did not say what it was waiting for:\n%s", stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Workspace created:") {
+		t.Errorf("unexpected create output:\n%s", stdout.String())
+	}
+	if err := configCmd.Wait(); err != nil {
+		t.Fatalf("config failed: %v\n%s", err, configOut.String())
+	}
+	grove(t, binary, repo, "destroy", "--all")
+}
+
+func TestPoolFillAndClaim(t *testing.T) {
+	binary := buildGrove(t)
+	repo := setupTestRepo(t)
+	wsDir := filepath.Join(t.TempDir(), "ws")
+
+	grove(t, binary, repo, "config", "--backend", "copy", "--workspace-dir", wsDir)
+	cfg, err := config.Load(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.PoolSize = 2
+	if err := config.Save(repo, cfg); err != nil {
+		t.Fatal(err)
+	}
+	hookLog := filepath.Join(t.TempDir(), "hooks.log")
+	hook := fmt.Sprintf("#!/bin/sh\npwd >> %q\n", hookLog)
+	if err := os.WriteFile(filepath.Join(repo, ".grove", "hooks", "post-clone"), []byte(hook), 0755); err != nil {
+		t.Fatal(err)
+	}
+	hookRuns := func() int {
+		data, _ := os.ReadFile(hookLog)
+		return strings.Count(string(data), "\n")
+	}
+	listed := func() []workspace.Info {
+		var list []workspace.Info
+		if err := json.Unmarshal([]byte(grove(t, binary, repo, "list", "--json")), &list); err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+	pooled := func() []workspace.Info {
+		list, err := workspace.ListPool(&config.Config{WorkspaceDir: wsDir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+
+	grove(t, binary, repo, "pool", "fill")
+	if got := len(pooled()); got != 2 {
+		t.Fatalf("pool holds %d workspaces after fill, want 2", got)
+	}
+	if got := len(listed()); got != 0 {
+		t.Errorf("grove list shows %d pooled workspaces, want 0", got)
+	}
+	if got := hookRuns(); got != 2 {
+		t.Errorf("post-clone hook ran %d times while filling, want 2", got)
+	}
+
+	out := grove(t, binary, repo, "create", "--json", "--branch", "pooled-feature")
+	var info workspace.Info
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		t.Fatalf("invalid JSON output: %s\n%s", err, out)
+	}
+	if got := hookRuns(); got != 2 {
+		t.Errorf("claiming a pooled workspace ran the post-clone hook again (%d runs)", got)
+	}
+	if got := len(pooled()); got != 1 {
+		t.Errorf("pool holds %d workspaces after a claim, want 1", got)
+	}
+	if branch := run(t, info.Path, "git", "branch", "--show-current"); branch != "pooled-feature" {
+		t.Errorf("expected branch pooled-feature, got %q", branch)
+	}
+	if !strings.HasPrefix(info.ID, "pooled-feature-") || info.Path != filepath.Join(wsDir, info.ID) {
+		t.Errorf("claimed workspace is %s at %s, want it renamed after pooled-feature", info.ID, info.Path)
+	}
+	list := listed()
+	if len(list) != 1 || list[0].ID != info.ID || list[0].Branch != "pooled-feature" {
+		t.Errorf("grove list = %+v, want the claimed workspace on pooled-feature", list)
+	}
+
+	// A claim counts against max_workspaces like any other create.
+	cfg.MaxWorkspaces = 1
+	if err := config.Save(repo, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if out := groveExpectErr(t, binary, repo, "create"); !strings.Contains(out, "max workspaces (1) reached") {
+		t.Errorf("claim past max_workspaces failed with:\n%s", out)
+	}
+	if got := len(pooled()); got != 1 {
+		t.Errorf("pool holds %d workspaces after a refused claim, want 1", got)
+	}
+	cfg.MaxWorkspaces = 10
+	if err := config.Save(repo, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// Moving the golden copy on invalidates what is left in the pool.
+	os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+	run(t, repo, "git", "commit", "-am", "second")
+	commit := run(t, repo, "git", "rev-parse", "--short", "HEAD")
+	if out := grove(t, binary, repo, "status"); !strings.Contains(out, "0 / 2 ready, 1 stale") {
+		t.Errorf("status does not report the stale pool:\n%s", out)
+	}
+	out = grove(t, binary, repo, "create", "--json")
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		t.Fatalf("invalid JSON output: %s\n%s", err, out)
+	}
+	if info.GoldenCommit != commit {
+		t.Errorf("create claimed a workspace at %s, want a new one at %s", info.GoldenCommit, commit)
+	}
+
+	grove(t, binary, repo, "pool", "fill")
+	pool := pooled()
+	if len(pool) != 2 {
+		t.Fatalf("pool holds %d workspaces after refill, want 2", len(pool))
+	}
+	for _, ws := range pool {
+		if ws.GoldenCommit != commit {
+			t.Errorf("pooled workspace %s is at %s, want %s", ws.ID, ws.GoldenCommit, commit)
+		}
+	}
+	if entries, _ := os.ReadDir(wsDir); len(entries) != 4 {
+		t.Errorf("workspace dir holds %d entries, want 2 workspaces and 2 pooled", len(entries))
+	}
+}
+
+func TestExecBackendLifecycle(t *testing.T) {
+	binary := buildGrove(t)
+	repo := setupTestRepo(t)
+
+	binDir := t.TempDir()
+	cmd := exec.Command("go", "build", "-o", filepath.Join(binDir, "grove-backend-fake"), "./cmd/grove-backend-fake")
+	cmd.Dir = repoRoot(t)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build fake backend: %s\n%s", err, out)
+	}
+
+	out := groveExpectErr(t, binary, repo, "config", "--backend", "exec:fake", "--workspace-dir", filepath.Join(t.TempDir(), "ws"))
+	if !strings.Contains(out, "grove-backend-fake not found on PATH") {
+		t.Errorf("expected missing plugin error, got: %s", out)
+	}
+
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	grove(t, binary, repo, "config", "--backend", "exec:fake", "--workspace-dir", filepath.Join(t.TempDir(), "ws"))
+
+	out = grove(t, binary, repo, "create", "--json", "--branch", "plugin-feature")
+	var info workspace.Info
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		t.Fatalf("invalid JSON output: %s\n%s", err, out)
+	}
+
+	data, err := os.ReadFile(filepath.Join(info.Path, "build", "output.bin"))
+	if err != nil || string(data) != "compiled" {
+		t.Errorf("build/output.bin not copied by the plugin: %q, %v", data, err)
+	}
+	branch := run(t, info.Path, "git", "branch", "--show-current")
+	if branch != "plugin-feature" {
+		t.Errorf("expected branch plugin-feature, got %q", branch)
+	}
+	if list := grove(t, binary, repo, "list"); !strings.Contains(list, info.ID) {
+		t.Errorf("expected list to show %s, got:\n%s", info.ID, list)
+	}
+
+	grove(t, binary, repo, "destroy", info.ID)
+	if _, err := os.Stat(info.Path); !os.IsNotExist(err) {
+		t.Error("workspace not cleaned up after destroy")
+	}
+}
+
+func TestBackendsCommand(t *testing.T) {
+	binary := buildGrove(t)
+	repo := setupTestRepo(t)
+
+	out := grove(t, binary, repo, "backends", "--json")
+	var reports []struct {
+		Name      string `json:"name"`
+		Available bool   `json:"available"`
+		Reason    string `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(out), &reports); err != nil {
+		t.Fatalf("invalid JSON output: %s\n%s", err, out)
+	}
+	byName := map[string]bool{}
+	for _, r := range reports {
+		byName[r.Name] = r.Available
+		if !r.Available && r.Reason == "" {
+			t.Errorf("%s is unavailable without a reason", r.Name)
+		}
+	}
+	for _, name := range []string{"cp", "copy", "image", "btrfs", "zfs", "overlay", "worktree"} {
+		if _, ok := byName[name]; !ok {
+			t.Errorf("backends output is missing %s:\n%s", name, out)
+		}
+	}
+	if !byName["copy"] {
+		t.Error("copy backend should be available everywhere")
+	}
+	if byName["image"] != (runtime.GOOS == "darwin") {
+		t.Errorf("image available = %v on %s", byName["image"], runtime.GOOS)
+	}
+
+	if table := grove(t, binary, repo, "backends"); !strings.Contains(table, "BACKEND") || !strings.Contains(table, "worktree") {
+		t.Errorf("unexpected backends output:\n%s", table)
+	}
+}
+
+func TestCreateDryRunReportsGroveignore(t *testing.T) {
+	binary := buildGrove(t)
+	repo := setupTestRepo(t)
+	wsDir := filepath.Join(t.TempDir(), "ws")
+
+	grove(t, binary, repo, "config", "--backend", "copy", "--workspace-dir", wsDir)
+	os.WriteFile(filepath.Join(repo, "build", ".groveignore"), []byte("# artifacts\n*.bin\n"), 0644)
+
+	out := grove(t, binary, repo, "create", "--dry-run", "--json")
+	var excluded []struct {
+		Path   string `json:"path"`
+		Source string `json:"source"`
+		Line   int    `json:"line"`
+	}
+	if err := json.Unmarshal([]byte(out), &excluded); err != nil {
+		t.Fatalf("invalid JSON output: %s\n%s", err, out)
+	}
+	if len(excluded) != 1 {
+		t.Fatalf("expected 1 exclusion, got %+v", excluded)
+	}
+	if e := excluded[0]; e.Path != "build/output.bin" || e.Source != "build/.groveignore" || e.Line != 2 {
+		t.Errorf("unexpected exclusion: %+v", e)
+	}
+	if _, err := os.Stat(wsDir); !os.IsNotExist(err) {
+		t.Error("dry run should not create a workspace")
+	}
+
+	text := grove(t, binary, repo, "create", "--dry-run")
+	if !strings.Contains(text, "build/.groveignore:2") {
+		t.Errorf("expected file and line in output, got:\n%s", text)
+	}
+}
+
 func TestBackendMismatchRequiresMigration(t *testing.T) {
 	if runtime.GOOS != "darwin" {
 		t.Skip("APFS tests only run on macOS")
@@ -538,6 +980,157 @@ func TestMigrateCommand_ConfigMismatchUsesInitializedBackend(t *testing.T) {
 	}
 }
 
+func TestPostCloneActions(t *testing.T) {
+	binary := buildGrove(t)
+	repo := setupTestRepo(t)
+
+	grove(t, binary, repo, "config", "--backend", "copy", "--workspace-dir", filepath.Join(t.TempDir(), "ws"))
+	os.WriteFile(filepath.Join(repo, "build", "cache.lock"), []byte("lock"), 0644)
+
+	cfgPath := filepath.Join(repo, ".grove", "config.json")
+	cfgData, err := os.ReadFile(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg map[string]any
+	json.Unmarshal(cfgData, &cfg)
+	cfg["post_clone"] = []map[string]any{
+		{"delete": "*.lock"},
+		{"replace": map[string]string{"glob": "/build/*.bin", "old": "compiled", "new": "built in {workspace}"}},
+	}
+	updated, _ := json.MarshalIndent(cfg, "", "  ")
+	os.WriteFile(cfgPath, updated, 0644)
+
+	stdout, stderr := groveOutErr(t, binary, repo, "create", "--json", "--force", "--progress")
+	var info workspace.Info
+	if err := json.Unmarshal([]byte(stdout), &info); err != nil {
+		t.Fatalf("invalid JSON output: %s\n%s", err, stdout)
+	}
+	defer grove(t, binary, repo, "destroy", info.ID)
+
+	if !strings.Contains(stderr, "post-clone: delete *.lock") {
+		t.Errorf("expected action in progress output, got:\n%s", stderr)
+	}
+	if _, err := os.Stat(filepath.Join(info.Path, "build", "cache.lock")); !os.IsNotExist(err) {
+		t.Error("build/cache.lock should be deleted in the workspace")
+	}
+	data, err := os.ReadFile(filepath.Join(info.Path, "build", "output.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "built in " + info.Path; string(data) != want {
+		t.Errorf("build/output.bin = %q, want %q", data, want)
+	}
+	if data, _ := os.ReadFile(filepath.Join(repo, "build", "output.bin")); string(data) != "compiled" {
+		t.Error("golden copy was modified by post_clone actions")
+	}
+}
+
+func TestCreateRelocatesGoldenPaths(t *testing.T) {
+	binary := buildGrove(t)
+	repo := setupTestRepo(t)
+
+	grove(t, binary, repo, "config", "--backend", "copy", "--workspace-dir", filepath.Join(t.TempDir(), "ws"))
+	os.WriteFile(filepath.Join(repo, "build", "paths.txt"), []byte("root="+repo+"\n"), 0644)
+	if err := os.Symlink(filepath.Join(repo, "build", "output.bin"), filepath.Join(repo, "build", "latest")); err != nil {
+		t.Fatal(err)
+	}
+
+	cfgPath := filepath.Join(repo, ".grove", "config.json")
+	cfgData, err := os.ReadFile(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg map[string]any
+	json.Unmarshal(cfgData, &cfg)
+	cfg["relocate"] = []string{"/build/*.txt"}
+	updated, _ := json.MarshalIndent(cfg, "", "  ")
+	os.WriteFile(cfgPath, updated, 0644)
+
+	out := grove(t, binary, repo, "create", "--json", "--force")
+	var info workspace.Info
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		t.Fatalf("invalid JSON output: %s\n%s", err, out)
+	}
+	defer grove(t, binary, repo, "destroy", info.ID)
+
+	data, err := os.ReadFile(filepath.Join(info.Path, "build", "paths.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "root=" + info.Path + "\n"; string(data) != want {
+		t.Errorf("build/paths.txt = %q, want %q", data, want)
+	}
+	target, err := os.Readlink(filepath.Join(info.Path, "build", "latest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(info.Path, "build", "output.bin"); target != want {
+		t.Errorf("build/latest -> %q, want %q", target, want)
+	}
+}
+
+func TestScanPaths(t *testing.T) {
+	binary := buildGrove(t)
+	repo := setupTestRepo(t)
+
+	grove(t, binary, repo, "config", "--backend", "copy", "--workspace-dir", filepath.Join(t.TempDir(), "ws"))
+	out := grove(t, binary, repo, "scan-paths")
+	if !strings.Contains(out, "No ignored files refer to") {
+		t.Errorf("expected no references in a fresh repo, got:\n%s", out)
+	}
+
+	os.WriteFile(filepath.Join(repo, "build", "paths.txt"), []byte("root="+repo+"\n"), 0644)
+	if err := os.Symlink(filepath.Join(repo, "main.go"), filepath.Join(repo, "build", "main-link")); err != nil {
+		t.Fatal(err)
+	}
+
+	out = grove(t, binary, repo, "scan-paths")
+	for _, want := range []string{"build/", "build/paths.txt", "build/main-link", "symlink"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected scan output to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "output.bin") {
+		t.Errorf("expected files without references to be left out, got:\n%s", out)
+	}
+
+	out = grove(t, binary, repo, "scan-paths", "--json")
+	var groups []map[string]any
+	if err := json.Unmarshal([]byte(out), &groups); err != nil {
+		t.Fatalf("invalid JSON output: %s\n%s", err, out)
+	}
+	if len(groups) != 1 || groups[0]["path"] != "build" {
+		t.Errorf("expected one build group, got %s", out)
+	}
+
+	out, _ = groveOutErr(t, binary, repo, "scan-paths", "--suggest", "exclude")
+	if !strings.Contains(out, `"/build/"`) {
+		t.Errorf("expected exclude suggestion for /build/, got:\n%s", out)
+	}
+	out, _ = groveOutErr(t, binary, repo, "scan-paths", "--suggest", "relocate")
+	if !strings.Contains(out, `"/build/paths.txt"`) || strings.Contains(out, "main-link") {
+		t.Errorf("expected relocate suggestion for /build/paths.txt only, got:\n%s", out)
+	}
+
+	// Excluded paths are never cloned, so they are not reported.
+	cfgPath := filepath.Join(repo, ".grove", "config.json")
+	cfgData, err := os.ReadFile(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg map[string]any
+	json.Unmarshal(cfgData, &cfg)
+	cfg["exclude"] = []string{"build/"}
+	updated, _ := json.MarshalIndent(cfg, "", "  ")
+	os.WriteFile(cfgPath, updated, 0644)
+
+	out = grove(t, binary, repo, "scan-paths")
+	if !strings.Contains(out, "No ignored files refer to") {
+		t.Errorf("expected excluded build/ to be skipped, got:\n%s", out)
+	}
+}
+
 func TestPostCloneHook(t *testing.T) {
 	if runtime.GOOS != "darwin" {
 		t.Skip("APFS tests only run on macOS")
@@ -1035,6 +1628,66 @@ func TestUpdateWithLocalRemote(t *testing.T) {
 	}
 }
 
+func TestUpdateRemovesStalePool(t *testing.T) {
+	binary := buildGrove(t)
+
+	bareRepo := filepath.Join(t.TempDir(), "remote.git")
+	run(t, "/", "git", "init", "--bare", bareRepo)
+	goldenDir := t.TempDir()
+	run(t, "/", "git", "clone", bareRepo, goldenDir)
+	run(t, goldenDir, "git", "config", "user.email", "test@test.com")
+	run(t, goldenDir, "git", "config", "user.name", "Test")
+	os.WriteFile(filepath.Join(goldenDir, "main.go"), []byte("package main\n"), 0644)
+	os.WriteFile(filepath.Join(goldenDir, ".gitignore"), []byte(".grove/\n"), 0644)
+	run(t, goldenDir, "git", "add", ".")
+	run(t, goldenDir, "git", "commit", "-m", "initial")
+	branch := run(t, goldenDir, "git", "branch", "--show-current")
+	run(t, goldenDir, "git", "push", "-u", "origin", branch)
+
+	wsDir := filepath.Join(t.TempDir(), "ws")
+	grove(t, binary, goldenDir, "config", "--backend", "copy", "--workspace-dir", wsDir)
+	cfg, err := config.Load(goldenDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.PoolSize = 1
+	if err := config.Save(goldenDir, cfg); err != nil {
+		t.Fatal(err)
+	}
+	grove(t, binary, goldenDir, "pool", "fill")
+	pooled := func() []workspace.Info {
+		list, err := workspace.ListPool(&config.Config{WorkspaceDir: wsDir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+	pool := pooled()
+	if len(pool) != 1 {
+		t.Fatalf("pool holds %d workspaces after fill, want 1", len(pool))
+	}
+
+	pusher := t.TempDir()
+	run(t, "/", "git", "clone", bareRepo, pusher)
+	run(t, pusher, "git", "config", "user.email", "test@test.com")
+	run(t, pusher, "git", "config", "user.name", "Test")
+	os.WriteFile(filepath.Join(pusher, "new-file.txt"), []byte("from remote"), 0644)
+	run(t, pusher, "git", "add", ".")
+	run(t, pusher, "git", "commit", "-m", "add new file")
+	run(t, pusher, "git", "push")
+
+	out := grove(t, binary, goldenDir, "update")
+	if !strings.Contains(out, "Removed: "+pool[0].ID) || !strings.Contains(out, "grove pool fill") {
+		t.Errorf("update did not remove the stale pooled workspace:\n%s", out)
+	}
+	if got := len(pooled()); got != 0 {
+		t.Errorf("pool holds %d workspaces after update, want the stale one removed", got)
+	}
+	if _, err := os.Stat(pool[0].Path); !os.IsNotExist(err) {
+		t.Errorf("stale pooled workspace still exists: %v", err)
+	}
+}
+
 func TestCreateIDIncludesBranch(t *testing.T) {
 	if runtime.GOOS != "darwin" {
 		t.Skip("APFS tests only run on macOS")